@@ -2,10 +2,10 @@ package agent
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"sync"
 	"sync/atomic"
 
@@ -13,6 +13,9 @@ import (
 
 	"github.com/joaopandolfi/core"
 	"github.com/joaopandolfi/core/agent/bootstrap"
+	"github.com/joaopandolfi/core/agent/retrieval"
+	"github.com/joaopandolfi/core/agent/toolcache"
+	"github.com/joaopandolfi/core/agent/toolresult"
 	"github.com/joaopandolfi/core/memory/array"
 )
 
@@ -21,10 +24,17 @@ type Agent struct {
 	// interfaces
 	mem          core.MemoryBackend
 	provider     core.Provider
-	vecStore     core.VectorStorer
 	systemPrompt string
 
-	tools ToolMap
+	tools atomic.Pointer[ToolRegistry]
+
+	resultRenderer core.ToolResultRenderer
+	toolSelector   core.ToolSelector
+
+	// retriever searches the vector stores, nil without any
+	retriever *retrieval.Retriever
+	// injector injects context into every user turn, nil unless enabled
+	injector *retrieval.Injector
 
 	maxSteps            int
 	memoryWindowContext int
@@ -38,6 +48,8 @@ func NewAgent(opts ...bootstrap.NewAgentConfigFunc) (*Agent, error) {
 		Provider:               nil,
 		MaxSteps:               25,
 		MaxMemoryWindowContext: 10,
+		RerankCandidates:       50,
+		RetrievalTool:          true,
 		Tools:                  []*core.Tool{},
 		SystemPrompt:           "You are a helpful assistant",
 		Logger:                 nil,
@@ -70,65 +82,167 @@ func NewAgent(opts ...bootstrap.NewAgentConfigFunc) (*Agent, error) {
 		conf.Memory = array.NewArrayMemoryBackend()
 	}
 
+	// set the default tool result renderer if non provided
+	if conf.ToolResultRenderer == nil {
+		conf.ToolResultRenderer = toolresult.NewRenderer()
+	}
+
 	agent := &Agent{
 		provider:            conf.Provider,
-		tools:               make(map[string]*core.Tool),
-		vecStore:            conf.VecStore,
 		mem:                 conf.Memory,
 		maxSteps:            conf.MaxSteps,
 		logger:              conf.Logger,
 		systemPrompt:        conf.SystemPrompt,
 		memoryWindowContext: conf.MaxMemoryWindowContext,
+		resultRenderer:      conf.ToolResultRenderer,
+		toolSelector:        conf.ToolSelector,
 	}
 
 	// set tools
-	for _, tool := range conf.Tools {
-		agent.tools[tool.Name] = tool
+	if conf.ToolCache != nil {
+		cached, err := cacheTools(conf.ToolCache, conf.Tools, conf.CachedTools)
+		if err != nil {
+			return nil, err
+		}
+		conf.Tools = cached
+	}
+	tools, err := NewToolRegistry(conf.Tools...)
+	if err != nil {
+		return nil, err
+	}
+	agent.tools.Store(tools)
+
+	if err := agent.setupRetrieval(conf); err != nil {
+		return nil, err
 	}
 
-	if agent.vecStore != nil {
-		agent.addVecStoreTools()
+	// renderers and selectors may come with tools of their own, i.e.,
+	// readToolResult or searchTools
+	if err := agent.addProvidedTools(agent.resultRenderer); err != nil {
+		return nil, err
+	}
+	if err := agent.addProvidedTools(agent.toolSelector); err != nil {
+		return nil, err
 	}
 
 	return agent, nil
 }
 
-func (a *Agent) addVecStoreTools() {
-	// TODO - this json schema is, unfortunately, not valid for
-	jsonSchema := `{
-      "title": "searchVectorStore",
-      "description": "Searches a connected vector store for relevant and related content",
-      "type": "object",
-      "properties": {
-        "Query": {
-          "description": "The query to use on the vector store",
-          "type": "string"
-        },
-        "Limit": {
-          "description": "The limit of returned content",
-          "type": "number"
-        }
-      },
-      "required": [
-        "Query"
-      ]
-    }`
-
-	// Register the vector searching functionality
-	wrappedSearch, err := core.WrapToolFunction(a.vecStore.Search)
+// cacheTools returns tools with the named ones wrapped by cache
+func cacheTools(cache *toolcache.Cache, tools []*core.Tool, names []string) ([]*core.Tool, error) {
+	index := make(map[string]int, len(tools))
+	for i, tool := range tools {
+		if tool != nil {
+			index[tool.Name] = i
+		}
+	}
+
+	out := slices.Clone(tools)
+	for _, name := range names {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("error caching tool: %w: %s", ErrToolNotFound, name)
+		}
+		out[i] = cache.Wrap(tools[i])[0]
+	}
+
+	return out, nil
+}
+
+// toolProvider is implemented by components that come with tools
+type toolProvider interface {
+	Tools() []*core.Tool
+}
+
+func (a *Agent) addProvidedTools(component any) error {
+	if tp, ok := component.(toolProvider); ok {
+		return a.Tools().Add(tp.Tools()...)
+	}
+
+	return nil
+}
+
+// setupRetrieval registers the tool searching the vector store and the named
+// stores of the configuration, if any, and prepares context injection
+func (a *Agent) setupRetrieval(conf *bootstrap.NewAgentConfig) error {
+	opts := []retrieval.RetrieverConfigFunc{
+		retrieval.WithReranker(conf.Reranker),
+		retrieval.WithRerankCandidates(conf.RerankCandidates),
+		retrieval.WithLogger(conf.Logger),
+	}
+	if conf.VecStore != nil {
+		opts = append(opts, retrieval.WithStore("default", "", conf.VecStore))
+	}
+
+	retriever := retrieval.NewRetriever(append(opts, conf.Retrieval...)...)
+	if len(retriever.Stores()) == 0 {
+		if conf.InjectContext {
+			return fmt.Errorf("context injection needs a vector store")
+		}
+		return nil
+	}
+	a.retriever = retriever
+
+	if conf.InjectContext {
+		injectorOpts := []retrieval.InjectorConfigFunc{
+			retrieval.WithRewriteProvider(conf.Provider),
+			retrieval.WithInjectorLogger(conf.Logger),
+		}
+
+		injector, err := retrieval.NewInjector(retriever, append(injectorOpts, conf.ContextInjection...)...)
+		if err != nil {
+			return err
+		}
+		a.injector = injector
+	}
+
+	if !conf.RetrievalTool {
+		return nil
+	}
+	return a.addProvidedTools(retriever)
+}
+
+// retrieveContext retrieves the context of the user message m once per run,
+// so that every step sees the same passages, and records their citations in
+// its metadata. It returns nil without context injection.
+func (a *Agent) retrieveContext(ctx context.Context, m *core.Message) (*retrieval.Injection, error) {
+	if a.injector == nil {
+		return nil, nil
+	}
+
+	history, err := a.mem.GetMaxN(a.memoryWindowContext)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	err = a.AddTool(&core.Tool{
-		Name:                "searchVectorStore",
-		Description:         "Searches the connected vector store for similar, related content",
-		WrappedToolFunction: wrappedSearch,
-		JSONSchema:          []byte(jsonSchema),
-	})
+	inj, err := a.injector.Retrieve(ctx, slices.Concat(history, []*core.Message{m}))
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	cite(m, inj)
+
+	return inj, nil
+}
+
+// injectContext returns the messages to send with the retrieved context
+func (a *Agent) injectContext(messages []*core.Message, inj *retrieval.Injection) []*core.Message {
+	if a.injector == nil {
+		return messages
+	}
+
+	return a.injector.Inject(messages, inj)
+}
+
+// cite records the passages injected in the metadata of m
+func cite(m *core.Message, inj *retrieval.Injection) {
+	if m == nil || inj == nil || len(inj.Passages) == 0 {
+		return
+	}
+
+	if m.Metadata == nil {
+		m.Metadata = &core.Metadata{}
 	}
+	m.Metadata.Citations = inj.Citations()
 }
 
 // Run implements the main agent loop
@@ -147,6 +261,8 @@ func (a *Agent) Run(ctx context.Context, opts ...RunOptionFunc) (*AgentRunAggreg
 
 	var id uint32 = 0
 
+	ctx = withRunID(ctx)
+
 	a.prepareMemory(id)
 
 	agg := NewAgentRunAggregator()
@@ -161,7 +277,12 @@ func (a *Agent) Run(ctx context.Context, opts ...RunOptionFunc) (*AgentRunAggreg
 	}
 	agg.Push(m)
 
-	err := a.mem.Add(m)
+	inj, err := a.retrieveContext(ctx, m)
+	if err != nil {
+		return agg, err
+	}
+
+	err = a.mem.Add(m)
 	if err != nil {
 		panic(err)
 	}
@@ -175,11 +296,13 @@ func (a *Agent) Run(ctx context.Context, opts ...RunOptionFunc) (*AgentRunAggreg
 
 		a.logger.V(1).Info("sending messages", "messages", messages)
 
-		respMessage, respErr := a.SendMessages(ctx, messages)
+		stepCtx := a.withStepTools(ctx)
+		respMessage, respErr := a.SendMessages(stepCtx, a.injectContext(messages, inj))
 		agg.Push(respMessage)
 		if respErr != nil {
 			return agg, respErr
 		}
+		cite(respMessage, inj)
 
 		respMessage.ID = atomic.AddUint32(&id, 1)
 		a.logger.V(1).Info("response message", "message", respMessage)
@@ -211,7 +334,7 @@ func (a *Agent) Run(ctx context.Context, opts ...RunOptionFunc) (*AgentRunAggreg
 
 		// Call tools if tool calls were present
 		if len(respMessage.ToolCalls) > 0 {
-			toolResponses := a.executeToolCallsParallel(ctx, respMessage.ToolCalls, id)
+			toolResponses := a.executeToolCallsParallel(stepCtx, respMessage.ToolCalls, id)
 			agg.Push(toolResponses...)
 			a.mem.Add(toolResponses...)
 		}
@@ -264,6 +387,8 @@ func (a *Agent) RunStream(ctx context.Context, opts ...RunOptionFunc) *StreamRun
 
 	var id uint32 = 0
 
+	ctx = withRunID(ctx)
+
 	// buffered, non-blocking channels
 	outAggChan := make(chan AgentRunAggregator, 10)
 	outDeltaChan := make(chan string, 10)
@@ -287,7 +412,16 @@ func (a *Agent) RunStream(ctx context.Context, opts ...RunOptionFunc) *StreamRun
 	}
 	agg.Push(nil, m)
 
-	err := a.mem.Add(m)
+	inj, err := a.retrieveContext(ctx, m)
+	if err != nil {
+		outErrChan <- err
+		close(outAggChan)
+		close(outDeltaChan)
+		close(outErrChan)
+		return result
+	}
+
+	err = a.mem.Add(m)
 	if err != nil {
 		panic(err)
 	}
@@ -314,7 +448,8 @@ func (a *Agent) RunStream(ctx context.Context, opts ...RunOptionFunc) *StreamRun
 				panic(err)
 			}
 
-			msgChan, deltaChan, errChan := a.SendMessageStream(ctx, messages)
+			stepCtx := a.withStepTools(ctx)
+			msgChan, deltaChan, errChan := a.SendMessageStream(stepCtx, a.injectContext(messages, inj))
 
 			var respMessage *core.Message
 			var respErr error
@@ -341,6 +476,7 @@ func (a *Agent) RunStream(ctx context.Context, opts ...RunOptionFunc) *StreamRun
 						)
 						respMessage = msg
 						respMessage.ID = atomic.AddUint32(&id, 1)
+						cite(respMessage, inj)
 					}
 
 				case delta, ok := <-deltaChan:
@@ -423,7 +559,7 @@ func (a *Agent) RunStream(ctx context.Context, opts ...RunOptionFunc) *StreamRun
 
 			// Call tools if tool calls were present
 			if respMessage != nil && len(respMessage.ToolCalls) > 0 {
-				toolResponses := a.executeToolCallsParallel(ctx, respMessage.ToolCalls, id)
+				toolResponses := a.executeToolCallsParallel(stepCtx, respMessage.ToolCalls, id)
 				agg.Push(toolResponses...)
 				a.mem.Add(toolResponses...)
 
@@ -442,10 +578,7 @@ func (a *Agent) RunStream(ctx context.Context, opts ...RunOptionFunc) *StreamRun
 
 // SendMessage sends a message to the agent and gets a response
 func (a *Agent) SendMessages(ctx context.Context, m []*core.Message) (*core.Message, error) {
-	toolSlice := make([]*core.Tool, 0, len(a.tools))
-	for _, tool := range a.tools {
-		toolSlice = append(toolSlice, tool)
-	}
+	toolSlice := a.selectTools(ctx, m)
 
 	genOpts := &core.GenerateOptions{
 		Messages: m,
@@ -463,10 +596,7 @@ func (a *Agent) SendMessages(ctx context.Context, m []*core.Message) (*core.Mess
 
 // SendMessage sends a message to the agent and gets a response
 func (a *Agent) SendMessageStream(ctx context.Context, m []*core.Message) (<-chan *core.Message, <-chan string, <-chan error) {
-	toolSlice := make([]*core.Tool, 0, len(a.tools))
-	for _, tool := range a.tools {
-		toolSlice = append(toolSlice, tool)
-	}
+	toolSlice := a.selectTools(ctx, m)
 
 	genOpts := &core.GenerateOptions{
 		Messages: m,
@@ -477,32 +607,50 @@ func (a *Agent) SendMessageStream(ctx context.Context, m []*core.Message) (<-cha
 	return a.provider.GenerateStream(ctx, genOpts)
 }
 
-// CallTool sends a message to the agent and gets a response
-func (a *Agent) CallTool(ctx context.Context, tc *core.ToolCall) (*core.Message, error) {
-	// Find the corresponding tool
-	var toolToCall *core.Tool
+// selectTools returns the tools offered to the LLM for the given messages.
+// Without a selector, or if selection fails, every tool is offered.
+func (a *Agent) selectTools(ctx context.Context, m []*core.Message) []*core.Tool {
+	tools := a.stepTools(ctx).Tools()
+	if a.toolSelector == nil {
+		return tools
+	}
 
-	for _, t := range a.tools {
-		if t.Name == tc.Name {
-			toolToCall = t
-			break
-		}
+	selected, err := a.toolSelector.SelectTools(ctx, m, tools)
+	if err != nil {
+		a.logger.V(-1).Info("tool selection failed, offering all tools", "error", err)
+		return tools
 	}
 
-	if toolToCall == nil {
+	return selected
+}
+
+// CallTool sends a message to the agent and gets a response
+func (a *Agent) CallTool(ctx context.Context, tc *core.ToolCall) (*core.Message, error) {
+	// Find the corresponding tool, disabled tools cannot be called
+	toolToCall, ok := a.stepTools(ctx).Get(tc.Name)
+	if !ok {
 		return nil, fmt.Errorf("tool %s not found", tc.Name)
 	}
 
 	// Call the tool
+	if core.IdempotencyKey(ctx) == "" {
+		ctx = core.WithIdempotencyKey(ctx, idempotencyKey(ctx, tc))
+	}
+
 	result, err := toolToCall.WrappedToolFunction(ctx, []byte(tc.Arguments))
 	if err != nil {
 		return nil, fmt.Errorf("tool execution failed: %w", err)
 	}
 
+	content, err := a.resultRenderer.RenderToolResult(ctx, tc, result)
+	if err != nil {
+		return nil, fmt.Errorf("error rendering tool result: %w", err)
+	}
+
 	// Add the tool response to messages
 	return &core.Message{
 		Role:    core.ToolMessageRole,
-		Content: fmt.Sprintf("%v", result),
+		Content: content,
 		ToolResult: []*core.ToolResult{
 			{
 				ToolCallID: tc.ID,
@@ -513,21 +661,6 @@ func (a *Agent) CallTool(ctx context.Context, tc *core.ToolCall) (*core.Message,
 	}, nil
 }
 
-// AddTool adds a tool to the agent's available tools
-func (a *Agent) AddTool(tool *core.Tool) error {
-	if tool.Name == "" {
-		return errors.New("tool must have a name")
-	}
-
-	if tool.WrappedToolFunction == nil {
-		return errors.New("tool must have a function")
-	}
-
-	a.tools[tool.Name] = tool
-
-	return nil
-}
-
 // Example stop condition
 func DefaultStopCondition(agg *AgentRunAggregator) bool {
 	// Stop if no tool calls were made and we got a response
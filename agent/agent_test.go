@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/agent/bootstrap"
+	"github.com/joaopandolfi/core/embedder"
+	"github.com/joaopandolfi/core/vectorstore/memory"
+)
+
+// answeringProvider answers every request with content, recording the
+// messages it was sent
+type answeringProvider struct {
+	core.Provider
+	content string
+	sent    [][]*core.Message
+}
+
+func (p *answeringProvider) Generate(ctx context.Context, opts *core.GenerateOptions) (*core.Message, error) {
+	p.sent = append(p.sent, opts.Messages)
+	return &core.Message{Role: core.AssistantMessageRole, Content: p.content}, nil
+}
+
+func TestContextInjectionCitations(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemoryVectorStore(embedder.NewHashingEmbedder(embedder.WithDimensions(64)))
+	err := store.Upsert(ctx,
+		&core.Embedding{ID: "leave", Content: "Employees accrue 25 days of paid leave", Metadata: map[string]interface{}{"source": "handbook.md"}},
+		&core.Embedding{ID: "other", Content: "The office opens at 9", Metadata: map[string]interface{}{"source": "office.md"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logr.Discard()
+	provider := &answeringProvider{content: "25 days [1]"}
+	a, err := NewAgent(
+		bootstrap.WithProvider(provider),
+		bootstrap.WithVectorStore(store),
+		bootstrap.WithRetrievalTool(false),
+		bootstrap.WithContextInjection(),
+		bootstrap.WithLogger(&logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agg, err := a.Run(ctx, WithInput("how many days of paid leave?"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(agg.Messages) != 2 {
+		t.Fatalf("got %d messages, want the user and assistant messages", len(agg.Messages))
+	}
+
+	for _, m := range agg.Messages {
+		if m.Metadata == nil || len(m.Metadata.Citations) != 2 {
+			t.Fatalf("%s message: got metadata %+v, want 2 citations", m.Role, m.Metadata)
+		}
+		if c := m.Metadata.Citations[0]; c.Index != 1 || c.ID != "leave" || c.Metadata["source"] != "handbook.md" {
+			t.Errorf("%s message: got first citation %+v", m.Role, c)
+		}
+	}
+
+	// the user message is stored as typed, the provider gets the passages
+	if agg.Messages[0].Content != "how many days of paid leave?" {
+		t.Errorf("user message changed to %q", agg.Messages[0].Content)
+	}
+	sent := provider.sent[0]
+	if last := sent[len(sent)-1]; last.Role != core.UserMessageRole || last.Content == agg.Messages[0].Content {
+		t.Errorf("provider was sent %+v, want the user turn with its context", last)
+	}
+}
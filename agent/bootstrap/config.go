@@ -4,6 +4,8 @@ import (
 	"github.com/go-logr/logr"
 
 	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/agent/retrieval"
+	"github.com/joaopandolfi/core/agent/toolcache"
 )
 
 // NewAgentConfig holds configuration for agent initialization
@@ -32,6 +34,55 @@ type NewAgentConfig struct {
 	// Maximum number of messages restored from memory
 	// default 10
 	MaxMemoryWindowContext int
+
+	// ToolResultRenderer turns tool results into tool message content.
+	// Renderers that also provide tools (i.e., to page through spilled
+	// results) get them registered with the agent.
+	// default toolresult.Renderer with its defaults
+	ToolResultRenderer core.ToolResultRenderer
+
+	// Reranker, when set, rescores the results of the vector store tool.
+	// The tool then fetches RerankCandidates results and keeps the best of
+	// them.
+	Reranker core.Reranker
+
+	// Number of results fetched from the vector store for reranking
+	// default 50
+	RerankCandidates int
+
+	// Retrieval configures the vector store tool, for instance to add named
+	// stores, expose metadata filters or cap the tokens it returns. The tool
+	// is registered when VecStore or a store of Retrieval is set.
+	// default the defaults of the retrieval package
+	Retrieval []retrieval.RetrieverConfigFunc
+
+	// RetrievalTool offers the vector store tool to the LLM. Agents that
+	// inject context may do without it.
+	// default true
+	RetrievalTool bool
+
+	// InjectContext makes the agent search the vector stores for every user
+	// turn and inject the passages found in the prompt, whether or not the
+	// LLM would call the tool. Citations of the passages are recorded in the
+	// metadata of the messages.
+	// default false
+	InjectContext bool
+
+	// ContextInjection configures the injected context, see
+	// retrieval.Injector
+	ContextInjection []retrieval.InjectorConfigFunc
+
+	// ToolSelector, when set, picks the tools offered to the LLM at each step
+	// instead of offering all of them. Selectors that also provide tools get
+	// them registered with the agent.
+	ToolSelector core.ToolSelector
+
+	// ToolCache memoizes the results of the tools named by CachedTools
+	ToolCache *toolcache.Cache
+
+	// CachedTools names the tools of Tools whose results ToolCache keeps.
+	// Only name tools whose result depends on nothing but their arguments.
+	CachedTools []string
 }
 
 // RunOptionFunc is a function type that modifies RunOptions
@@ -88,3 +139,55 @@ func WithMaxMemoryWindowContext(size int) NewAgentConfigFunc {
 		conf.MaxMemoryWindowContext = size
 	}
 }
+
+func WithToolResultRenderer(r core.ToolResultRenderer) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.ToolResultRenderer = r
+	}
+}
+
+func WithToolSelector(s core.ToolSelector) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.ToolSelector = s
+	}
+}
+
+func WithReranker(r core.Reranker) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.Reranker = r
+	}
+}
+
+// WithToolCache memoizes the results of the named tools in cache
+func WithToolCache(cache *toolcache.Cache, names ...string) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.ToolCache = cache
+		conf.CachedTools = append(conf.CachedTools, names...)
+	}
+}
+
+func WithRerankCandidates(n int) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.RerankCandidates = n
+	}
+}
+
+func WithRetrieval(opts ...retrieval.RetrieverConfigFunc) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.Retrieval = append(conf.Retrieval, opts...)
+	}
+}
+
+func WithRetrievalTool(enabled bool) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.RetrievalTool = enabled
+	}
+}
+
+// WithContextInjection enables context injection, configured by opts
+func WithContextInjection(opts ...retrieval.InjectorConfigFunc) NewAgentConfigFunc {
+	return func(conf *NewAgentConfig) {
+		conf.InjectContext = true
+		conf.ContextInjection = append(conf.ContextInjection, opts...)
+	}
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/joaopandolfi/core"
+)
+
+// newRunID returns a random run identifier
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return "run_" + hex.EncodeToString(b)
+}
+
+// withRunID tags ctx with a new run identifier unless the caller provided one
+func withRunID(ctx context.Context) context.Context {
+	if core.RunID(ctx) != "" {
+		return ctx
+	}
+
+	return core.WithRunID(ctx, newRunID())
+}
+
+// idempotencyKey derives the idempotency key of a tool call from the run and
+// the call's identifier, which providers keep stable when a call is retried.
+// Calls without an identifier fall back to a digest of name and arguments.
+func idempotencyKey(ctx context.Context, tc *core.ToolCall) string {
+	id := tc.ID
+	if id == "" {
+		sum := sha256.Sum256(append([]byte(tc.Name+"\x00"), tc.Arguments...))
+		id = hex.EncodeToString(sum[:16])
+	}
+
+	return core.RunID(ctx) + "/" + id
+}
@@ -0,0 +1,122 @@
+package retrieval
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Passage is a retrieved chunk, numbered for citation
+type Passage struct {
+	// Index is the 1-based number the passage is cited with
+	Index int `json:"index"`
+
+	// Store is the name of the store the passage comes from, when the
+	// retriever searches several
+	Store string `json:"store,omitempty"`
+
+	// ID of the embedding of the chunk
+	ID string `json:"id"`
+
+	Score    float32                `json:"score"`
+	Content  string                 `json:"content"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Formatter renders a passage for the model
+type Formatter func(p *Passage) string
+
+// DefaultCitationFields are the metadata fields cited by default, as set by
+// the ingest package
+var DefaultCitationFields = []string{"source", "title", "section", "page"}
+
+// FormatPassage returns a Formatter writing a header line with the number of
+// the passage, its store, the given metadata fields when present, its ID
+// and score, followed by its content:
+//
+//	[1] store: handbook | source: benefits.pdf | page: 3 | id: 7f3a | score: 0.82
+//	Employees accrue 25 days of paid leave per year...
+func FormatPassage(citationFields ...string) Formatter {
+	return func(p *Passage) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "[%d]", p.Index)
+
+		sep := " "
+		if p.Store != "" {
+			fmt.Fprintf(&b, "%sstore: %s", sep, p.Store)
+			sep = " | "
+		}
+		for _, field := range citationFields {
+			if v, ok := p.Metadata[field]; ok && v != nil && v != "" {
+				fmt.Fprintf(&b, "%s%s: %v", sep, field, v)
+				sep = " | "
+			}
+		}
+		fmt.Fprintf(&b, "%sid: %s | score: %.2f\n%s", sep, p.ID, p.Score, strings.TrimSpace(p.Content))
+
+		return b.String()
+	}
+}
+
+// ApproxTokens estimates the number of tokens of text as a quarter of its
+// runes, close enough for English with most tokenizers
+func ApproxTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// minTruncatedTokens is the smallest part of a passage worth showing when it
+// does not fit the budget whole
+const minTruncatedTokens = 32
+
+// Render formats passages for the model, separated by blank lines, within
+// the token budget of the retriever. A passage that does not fit is
+// truncated when enough budget is left, and the passages left out are
+// mentioned at the end. It also returns the passages rendered, whole or
+// truncated, which are the only ones the model can cite.
+func (r *Retriever) Render(passages []*Passage) (string, []*Passage) {
+	if len(passages) == 0 {
+		return "No passages found.", nil
+	}
+
+	var parts []string
+	used := 0
+	for i, p := range passages {
+		text := r.format(p)
+		n := r.countTokens(text)
+
+		if r.maxTokens > 0 && used+n > r.maxTokens {
+			if left := r.maxTokens - used; left >= minTruncatedTokens {
+				parts = append(parts, r.truncate(text, left))
+				i++
+			}
+			if omitted := len(passages) - i; omitted > 0 {
+				parts = append(parts, fmt.Sprintf("[%d more passages left out to fit the token budget]", omitted))
+			}
+			return strings.Join(parts, "\n\n"), passages[:i]
+		}
+
+		parts = append(parts, text)
+		used += n
+	}
+
+	return strings.Join(parts, "\n\n"), passages
+}
+
+// truncate returns the longest prefix of text, marked as truncated, that
+// fits in tokens
+func (r *Retriever) truncate(text string, tokens int) string {
+	const marker = " [...]"
+	runes := []rune(text)
+
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if r.countTokens(string(runes[:mid])+marker) <= tokens {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+
+	return strings.TrimRight(string(runes[:lo]), " \n") + marker
+}
@@ -0,0 +1,110 @@
+package retrieval
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFormatPassage(t *testing.T) {
+	p := &Passage{
+		Index:    2,
+		Store:    "handbook",
+		ID:       "7f3a",
+		Score:    0.8234,
+		Content:  "  Employees accrue 25 days.\n",
+		Metadata: map[string]interface{}{"source": "benefits.pdf", "page": 3, "title": ""},
+	}
+
+	tests := map[string]struct {
+		format Formatter
+		p      *Passage
+		want   string
+	}{
+		"default fields": {
+			FormatPassage(DefaultCitationFields...), p,
+			"[2] store: handbook | source: benefits.pdf | page: 3 | id: 7f3a | score: 0.82\nEmployees accrue 25 days.",
+		},
+		"no fields": {
+			FormatPassage(), p,
+			"[2] store: handbook | id: 7f3a | score: 0.82\nEmployees accrue 25 days.",
+		},
+		"single store": {
+			FormatPassage("source"), &Passage{Index: 1, ID: "x", Score: 1, Content: "text"},
+			"[1] id: x | score: 1.00\ntext",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.format(tt.p); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	passages := func(n int) []*Passage {
+		out := make([]*Passage, n)
+		for i := range out {
+			out[i] = &Passage{Index: i + 1, ID: "id", Content: strings.Repeat("word ", 80)}
+		}
+		return out
+	}
+	// every passage renders to the same number of tokens
+	tokens := ApproxTokens(FormatPassage()(passages(1)[0]))
+
+	tests := map[string]struct {
+		passages  []*Passage
+		maxTokens int
+		rendered  int
+		truncated bool
+		leftOut   int
+	}{
+		"none":                     {nil, 100, 0, false, 0},
+		"no budget":                {passages(10), 0, 10, false, 0},
+		"all fit":                  {passages(3), 3 * tokens, 3, false, 0},
+		"last one truncated":       {passages(3), 2*tokens + minTruncatedTokens, 3, true, 0},
+		"truncated and left out":   {passages(4), tokens + minTruncatedTokens, 2, true, 2},
+		"too little to truncate":   {passages(3), tokens + minTruncatedTokens - 1, 1, false, 2},
+		"not even the first whole": {passages(2), minTruncatedTokens, 1, true, 1},
+		"nothing fits":             {passages(2), minTruncatedTokens - 1, 0, false, 2},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := NewRetriever(WithMaxTokens(tt.maxTokens), WithFormatter(FormatPassage()))
+
+			out, rendered := r.Render(tt.passages)
+			if len(rendered) != tt.rendered {
+				t.Errorf("rendered %d passages, want %d", len(rendered), tt.rendered)
+			}
+			if len(tt.passages) == 0 {
+				if out != "No passages found." {
+					t.Errorf("got %q", out)
+				}
+				return
+			}
+
+			if got := strings.Contains(out, "[...]"); got != tt.truncated {
+				t.Errorf("truncated %v, want %v:\n%s", got, tt.truncated, out)
+			}
+
+			marker := fmt.Sprintf("[%d more passages left out to fit the token budget]", tt.leftOut)
+			body, found := strings.CutSuffix(out, "\n\n"+marker)
+			if tt.leftOut > 0 && !found && out != marker {
+				t.Errorf("got\n%s\nwant %d passages mentioned as left out", out, tt.leftOut)
+			}
+			if tt.leftOut == 0 && strings.Contains(out, "left out") {
+				t.Errorf("passages mentioned as left out:\n%s", out)
+			}
+
+			// the marker and the blank lines between passages aside, the
+			// budget holds
+			if tt.maxTokens > 0 && out != marker && ApproxTokens(body) > tt.maxTokens+len(rendered) {
+				t.Errorf("%d tokens rendered, budget %d", ApproxTokens(body), tt.maxTokens)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package retrieval
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Injector retrieves passages for each user turn and injects them into the
+// prompt, for models that do not reliably call the search tool. Every turn
+// is searched, whatever the model would decide.
+type Injector struct {
+	retriever      *Retriever
+	template       *template.Template
+	limit          int
+	stores         []string
+	rewrite        bool
+	provider       core.Provider
+	rewritePrompt  string
+	rewriteHistory int
+	logger         *logr.Logger
+}
+
+// InjectorConfig holds configuration for an Injector
+type InjectorConfig struct {
+	// Template renders the user turn sent to the model from a TemplateData.
+	// It should include both the context and the input.
+	// default DefaultContextTemplate
+	Template string
+
+	// Limit is the number of passages injected
+	// default the limit of the retriever
+	Limit int
+
+	// Stores names the stores searched, all of them when empty
+	Stores []string
+
+	// RewriteQuery turns follow-up turns such as "and in 2023?" into
+	// standalone search queries by asking Provider, given the conversation.
+	// The first turn of a conversation is searched as is.
+	// default false
+	RewriteQuery bool
+
+	// Provider rewrites queries. Agents set their own.
+	Provider core.Provider
+
+	// RewritePrompt is the system prompt of query rewriting
+	// default a prompt asking for the query only
+	RewritePrompt string
+
+	// RewriteHistory is the number of earlier user and assistant messages
+	// shown to the provider when rewriting
+	// default 6
+	RewriteHistory int
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// InjectorConfigFunc is a function type that modifies InjectorConfig
+type InjectorConfigFunc func(*InjectorConfig)
+
+func WithContextTemplate(tmpl string) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.Template = tmpl
+	}
+}
+
+func WithContextLimit(n int) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.Limit = n
+	}
+}
+
+func WithContextStores(names ...string) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.Stores = names
+	}
+}
+
+func WithQueryRewriting(enabled bool) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.RewriteQuery = enabled
+	}
+}
+
+func WithRewriteProvider(p core.Provider) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.Provider = p
+	}
+}
+
+func WithRewritePrompt(prompt string) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.RewritePrompt = prompt
+	}
+}
+
+func WithRewriteHistory(n int) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.RewriteHistory = n
+	}
+}
+
+func WithInjectorLogger(l *logr.Logger) InjectorConfigFunc {
+	return func(conf *InjectorConfig) {
+		conf.Logger = l
+	}
+}
+
+// DefaultContextTemplate puts the passages before the input of the user
+const DefaultContextTemplate = `Answer using the context below when it is relevant. Cite the passages you use by their number, as [1].
+
+<context>
+{{.Context}}
+</context>
+
+{{.Input}}`
+
+const defaultRewritePrompt = "You turn the last message of a conversation into a standalone search query " +
+	"for a knowledge base, resolving references to earlier messages. Answer with the query only."
+
+// TemplateData is rendered by the context template
+type TemplateData struct {
+	// Input is the content of the user turn
+	Input string
+
+	// Query is the text searched for, the input unless rewritten
+	Query string
+
+	// Context holds the passages formatted by the retriever, within its
+	// token budget
+	Context string
+
+	// Passages are the passages formatted into Context
+	Passages []*Passage
+}
+
+// NewInjector returns a new Injector searching with retriever, or an error if
+// the template does not parse
+func NewInjector(retriever *Retriever, opts ...InjectorConfigFunc) (*Injector, error) {
+	discard := logr.Discard()
+	conf := &InjectorConfig{
+		Template:       DefaultContextTemplate,
+		RewritePrompt:  defaultRewritePrompt,
+		RewriteHistory: 6,
+		Logger:         &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	tmpl, err := template.New("context").Parse(conf.Template)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing context template: %w", err)
+	}
+
+	return &Injector{
+		retriever:      retriever,
+		template:       tmpl,
+		limit:          conf.Limit,
+		stores:         conf.Stores,
+		rewrite:        conf.RewriteQuery,
+		provider:       conf.Provider,
+		rewritePrompt:  conf.RewritePrompt,
+		rewriteHistory: conf.RewriteHistory,
+		logger:         conf.Logger,
+	}, nil
+}
+
+// Injection is the context retrieved for a user turn
+type Injection struct {
+	// Query is the text searched for
+	Query string
+
+	// Passages are the passages rendered into Content, those retrieved
+	// past the token budget of the retriever are left out
+	Passages []*Passage
+
+	// Content replaces the content of the user turn sent to the model
+	Content string
+}
+
+// Citations returns the passages of the injection as citations
+func (inj *Injection) Citations() []*core.Citation {
+	citations := make([]*core.Citation, len(inj.Passages))
+	for i, p := range inj.Passages {
+		citations[i] = &core.Citation{
+			Index:    p.Index,
+			Store:    p.Store,
+			ID:       p.ID,
+			Score:    p.Score,
+			Metadata: p.Metadata,
+		}
+	}
+
+	return citations
+}
+
+// Retrieve searches for the last user message of messages, the conversation
+// so far, and renders the turn to send in its place. A failed rewrite falls
+// back to the message itself.
+func (in *Injector) Retrieve(ctx context.Context, messages []*core.Message) (*Injection, error) {
+	last := lastUserMessage(messages)
+	if last < 0 {
+		return nil, fmt.Errorf("no user message to retrieve context for")
+	}
+	input := messages[last].Content
+
+	query := input
+	if in.rewrite {
+		rewritten, err := in.rewriteQuery(ctx, messages[:last], input)
+		if err != nil {
+			in.logger.Error(err, "Error rewriting query, searching the input")
+		} else if rewritten != "" {
+			query = rewritten
+		}
+	}
+
+	passages, err := in.retriever.Retrieve(ctx, &Query{Text: query, Limit: in.limit, Stores: in.stores})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving context: %w", err)
+	}
+
+	inj := &Injection{Query: query, Content: input}
+	if len(passages) == 0 {
+		return inj, nil
+	}
+
+	var b strings.Builder
+	rendered, passages := in.retriever.Render(passages)
+	inj.Passages = passages
+	err = in.template.Execute(&b, &TemplateData{
+		Input:    input,
+		Query:    query,
+		Context:  rendered,
+		Passages: passages,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering context template: %w", err)
+	}
+	inj.Content = b.String()
+
+	return inj, nil
+}
+
+// rewriteQuery asks the provider for a standalone query, unless there is no
+// conversation before input
+func (in *Injector) rewriteQuery(ctx context.Context, history []*core.Message, input string) (string, error) {
+	var turns []string
+	for i := len(history) - 1; i >= 0 && len(turns) < in.rewriteHistory; i-- {
+		m := history[i]
+		if m == nil || (m.Role != core.UserMessageRole && m.Role != core.AssistantMessageRole) || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		turns = append(turns, fmt.Sprintf("%s: %s", m.Role, truncate(m.Content, 1000)))
+	}
+	if len(turns) == 0 || in.provider == nil {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("Conversation:\n")
+	for i := len(turns) - 1; i >= 0; i-- {
+		b.WriteString(turns[i] + "\n")
+	}
+	fmt.Fprintf(&b, "\nLast message: %s\n\nSearch query:", input)
+
+	msg, err := in.provider.Generate(ctx, &core.GenerateOptions{
+		Messages: []*core.Message{
+			{Role: core.SystemMessageRole, Content: in.rewritePrompt},
+			{Role: core.UserMessageRole, Content: b.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	query := strings.TrimSpace(msg.Content)
+	query = strings.Trim(query, "\"'`")
+	in.logger.V(1).Info("Rewrote query", "input", input, "query", query)
+
+	return query, nil
+}
+
+// Inject returns messages with the last user message replaced by a copy
+// holding the content of inj. When the window of messages no longer holds it,
+// the content is inserted as a user message after the system messages.
+// messages is left untouched.
+func (in *Injector) Inject(messages []*core.Message, inj *Injection) []*core.Message {
+	if inj == nil || len(inj.Passages) == 0 {
+		return messages
+	}
+
+	out := make([]*core.Message, len(messages), len(messages)+1)
+	copy(out, messages)
+
+	if last := lastUserMessage(out); last >= 0 {
+		m := *out[last]
+		m.Content = inj.Content
+		out[last] = &m
+		return out
+	}
+
+	i := 0
+	for i < len(out) && out[i] != nil && out[i].Role == core.SystemMessageRole {
+		i++
+	}
+
+	return append(out[:i], append([]*core.Message{{Role: core.UserMessageRole, Content: inj.Content}}, out[i:]...)...)
+}
+
+func lastUserMessage(messages []*core.Message) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i] != nil && messages[i].Role == core.UserMessageRole {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return strings.ToValidUTF8(s[:n], "") + "..."
+}
@@ -0,0 +1,217 @@
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+// fakeStore returns its results, best first, and records the queries
+type fakeStore struct {
+	results []*core.SearchResult
+	params  []*core.SearchParams
+}
+
+func (s *fakeStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *fakeStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	s.params = append(s.params, params)
+	return s.results[:min(params.Limit, len(s.results))], nil
+}
+
+func (s *fakeStore) Close() error {
+	return nil
+}
+
+// passages returns a store holding n results with contents of length chars
+func passages(n, length int) *fakeStore {
+	s := &fakeStore{}
+	for i := 0; i < n; i++ {
+		s.results = append(s.results, &core.SearchResult{
+			Embedding: &core.Embedding{
+				ID:       fmt.Sprintf("chunk-%d", i+1),
+				Content:  strings.Repeat("x", length),
+				Metadata: map[string]interface{}{"source": fmt.Sprintf("doc-%d.md", i+1)},
+			},
+			Score: 1 - float32(i)/10,
+		})
+	}
+
+	return s
+}
+
+// fakeProvider answers every request with content or err
+type fakeProvider struct {
+	core.Provider
+	content string
+	err     error
+	calls   int
+}
+
+func (p *fakeProvider) Generate(ctx context.Context, opts *core.GenerateOptions) (*core.Message, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return &core.Message{Role: core.AssistantMessageRole, Content: p.content}, nil
+}
+
+func newInjector(t *testing.T, store *fakeStore, retrieverOpts []RetrieverConfigFunc, opts ...InjectorConfigFunc) *Injector {
+	t.Helper()
+
+	r := NewRetriever(append([]RetrieverConfigFunc{WithStore("docs", "", store)}, retrieverOpts...)...)
+	in, err := NewInjector(r, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return in
+}
+
+func TestInjectorRewriteQuery(t *testing.T) {
+	history := []*core.Message{
+		{Role: core.SystemMessageRole, Content: "be helpful"},
+		{Role: core.UserMessageRole, Content: "how much leave do we get?"},
+		{Role: core.AssistantMessageRole, Content: "25 days"},
+		{Role: core.UserMessageRole, Content: "and in 2023?"},
+	}
+
+	tests := map[string]struct {
+		messages  []*core.Message
+		rewrite   bool
+		provider  *fakeProvider
+		wantQuery string
+		wantCalls int
+	}{
+		"disabled":        {history, false, &fakeProvider{content: "leave in 2023"}, "and in 2023?", 0},
+		"rewritten":       {history, true, &fakeProvider{content: `"leave in 2023"`}, "leave in 2023", 1},
+		"provider fails":  {history, true, &fakeProvider{err: errors.New("down")}, "and in 2023?", 1},
+		"empty rewrite":   {history, true, &fakeProvider{content: "  "}, "and in 2023?", 1},
+		"first turn":      {history[:2], true, &fakeProvider{content: "other"}, "how much leave do we get?", 0},
+		"system and user": {[]*core.Message{history[0], history[3]}, true, &fakeProvider{content: "other"}, "and in 2023?", 0},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := passages(1, 10)
+			in := newInjector(t, store, nil, WithQueryRewriting(tt.rewrite), WithRewriteProvider(tt.provider))
+
+			inj, err := in.Retrieve(context.Background(), tt.messages)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inj.Query != tt.wantQuery || store.params[0].Query != tt.wantQuery {
+				t.Errorf("searched %q, want %q", store.params[0].Query, tt.wantQuery)
+			}
+			if tt.provider.calls != tt.wantCalls {
+				t.Errorf("provider called %d times, want %d", tt.provider.calls, tt.wantCalls)
+			}
+
+			// the input is sent as typed, whatever was searched
+			input := tt.messages[len(tt.messages)-1].Content
+			if !strings.HasSuffix(inj.Content, input) {
+				t.Errorf("content %q does not end with the input", inj.Content)
+			}
+		})
+	}
+}
+
+func TestInjectorRetrieveWithoutUserMessage(t *testing.T) {
+	in := newInjector(t, passages(1, 10), nil)
+
+	if _, err := in.Retrieve(context.Background(), []*core.Message{{Role: core.SystemMessageRole, Content: "x"}}); err == nil {
+		t.Error("retrieved context without a user message")
+	}
+}
+
+func TestInjectorCitesRenderedPassages(t *testing.T) {
+	// each passage is about 40 tokens, the budget fits one and none of the
+	// next
+	in := newInjector(t, passages(3, 120), []RetrieverConfigFunc{WithMaxTokens(60)})
+
+	inj, err := in.Retrieve(context.Background(), []*core.Message{{Role: core.UserMessageRole, Content: "question"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(inj.Passages) != 1 || inj.Passages[0].ID != "chunk-1" {
+		t.Fatalf("got passages %+v, want the rendered one", inj.Passages)
+	}
+	citations := inj.Citations()
+	if len(citations) != 1 || citations[0].Index != 1 || citations[0].ID != "chunk-1" || citations[0].Metadata["source"] != "doc-1.md" {
+		t.Errorf("got citations %+v", citations)
+	}
+	if !strings.Contains(inj.Content, "[2 more passages left out to fit the token budget]") {
+		t.Errorf("content %q does not mention the passages left out", inj.Content)
+	}
+
+	empty := newInjector(t, &fakeStore{}, nil)
+	inj, err = empty.Retrieve(context.Background(), []*core.Message{{Role: core.UserMessageRole, Content: "question"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inj.Content != "question" || len(inj.Citations()) != 0 {
+		t.Errorf("got %+v without passages", inj)
+	}
+}
+
+func TestInject(t *testing.T) {
+	in := newInjector(t, passages(1, 10), nil)
+	inj := &Injection{Passages: []*Passage{{Index: 1}}, Content: "context and question"}
+
+	system := &core.Message{Role: core.SystemMessageRole, Content: "be helpful"}
+	user := &core.Message{Role: core.UserMessageRole, Content: "question"}
+	assistant := &core.Message{Role: core.AssistantMessageRole, Content: "calling a tool"}
+	tool := &core.Message{Role: core.ToolMessageRole, Content: "result"}
+
+	roles := func(messages []*core.Message) string {
+		var out []string
+		for _, m := range messages {
+			out = append(out, string(m.Role)+":"+m.Content)
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := map[string]struct {
+		messages []*core.Message
+		want     string
+	}{
+		"user message in the window": {
+			[]*core.Message{system, user, assistant, tool},
+			"system:be helpful,user:context and question,assistant:calling a tool,tool:result",
+		},
+		"user message scrolled out": {
+			[]*core.Message{system, assistant, tool},
+			"system:be helpful,user:context and question,assistant:calling a tool,tool:result",
+		},
+		"no system message": {
+			[]*core.Message{assistant, tool},
+			"user:context and question,assistant:calling a tool,tool:result",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			before := roles(tt.messages)
+
+			if got := roles(in.Inject(tt.messages, inj)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if roles(tt.messages) != before || user.Content != "question" {
+				t.Error("the messages passed in changed")
+			}
+		})
+	}
+
+	messages := []*core.Message{system, user}
+	if got := in.Inject(messages, &Injection{Content: "unused"}); roles(got) != roles(messages) {
+		t.Errorf("injection without passages: got %s", roles(got))
+	}
+}
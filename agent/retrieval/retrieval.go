@@ -0,0 +1,426 @@
+// Package retrieval exposes vector stores to agents as a search tool. The
+// tool returns numbered passages with their citation (source, chunk ID and
+// score) rather than raw search results, within a token budget, and lets the
+// model filter on chosen metadata fields and pick among several named
+// stores:
+//
+//	r := retrieval.NewRetriever(
+//		retrieval.WithStore("handbook", "Company policies and benefits", handbook),
+//		retrieval.WithStore("tickets", "Resolved support tickets", tickets),
+//		retrieval.WithFilterField(&retrieval.FilterField{Name: "year", Type: "integer", Range: true}),
+//		retrieval.WithMaxTokens(1500),
+//	)
+//	a, err := agent.NewAgent(bootstrap.WithProvider(p), bootstrap.WithTools(r.Tools()...))
+//
+// Agents configured with a vector store build one themselves, which
+// bootstrap.WithRetrieval configures.
+//
+// Models that seldom call tools get the passages anyway with an Injector,
+// which searches every user turn and injects the passages found into the
+// prompt, see bootstrap.WithContextInjection.
+package retrieval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Store is a vector store searched by a Retriever under a name
+type Store struct {
+	// Name identifies the store to the model
+	Name string
+
+	// Description tells the model what the store holds
+	Description string
+
+	VectorStorer core.VectorStorer
+}
+
+// FilterField is a metadata field the model may restrict searches on
+type FilterField struct {
+	// Name of the metadata field
+	Name string
+
+	// Type of the values in JSON schema terms: "string", "number", "integer"
+	// or "boolean". Dates are strings in RFC 3339 format.
+	Type string
+
+	// Description tells the model what the field holds
+	Description string
+
+	// Enum lists the values of the field, when there are few
+	Enum []interface{}
+
+	// Range lets the model bound the field with gte and lte instead of
+	// matching a value, for numbers and dates
+	Range bool
+}
+
+// Retriever searches vector stores for passages relevant to a query, as a
+// tool for the model or directly through Retrieve
+type Retriever struct {
+	stores           []*Store
+	toolName         string
+	toolDescription  string
+	reranker         core.Reranker
+	rerankCandidates int
+	limit            int
+	maxLimit         int
+	threshold        float32
+	filter           *core.Filter
+	fields           []*FilterField
+	maxTokens        int
+	countTokens      func(string) int
+	format           Formatter
+	logger           *logr.Logger
+}
+
+// RetrieverConfig holds configuration for a Retriever
+type RetrieverConfig struct {
+	// Stores searched, by default all of them
+	Stores []*Store
+
+	// ToolName is the name of the search tool
+	// default "searchVectorStore"
+	ToolName string
+
+	// ToolDescription is the description of the search tool. The names and
+	// descriptions of the stores are listed in its schema.
+	// default a description asking the model to cite passages by number
+	ToolDescription string
+
+	// Reranker, when set, rescores the results of the stores. RerankCandidates
+	// results are then fetched from each store and the best Limit of them kept.
+	Reranker core.Reranker
+
+	// Number of results fetched from each store for reranking
+	// default 50
+	RerankCandidates int
+
+	// Limit is the number of passages returned when the model asks for none
+	// default 5
+	Limit int
+
+	// MaxLimit caps the number of passages the model may ask for
+	// default 20
+	MaxLimit int
+
+	// Threshold is the minimum score of a search result, on the scale of
+	// the stores: hybrid stores fusing ranks score far below similarities
+	// default 0
+	Threshold float32
+
+	// Filter restricts every search, whatever the model asks, for instance
+	// to the documents of a tenant
+	Filter *core.Filter
+
+	// FilterFields are the metadata fields the model may filter on
+	FilterFields []*FilterField
+
+	// MaxTokens caps the length of the passages returned by the tool. Zero
+	// disables the cap.
+	// default 2000
+	MaxTokens int
+
+	// TokenCounter measures text against MaxTokens
+	// default ApproxTokens
+	TokenCounter func(text string) int
+
+	// Formatter renders a passage for the model
+	// default FormatPassage with DefaultCitationFields
+	Formatter Formatter
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// RetrieverConfigFunc is a function type that modifies RetrieverConfig
+type RetrieverConfigFunc func(*RetrieverConfig)
+
+// WithStore adds a store searched under name, replacing any store with the
+// same name
+func WithStore(name, description string, store core.VectorStorer) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		for i, s := range conf.Stores {
+			if s.Name == name {
+				conf.Stores = append(conf.Stores[:i], conf.Stores[i+1:]...)
+				break
+			}
+		}
+
+		conf.Stores = append(conf.Stores, &Store{Name: name, Description: description, VectorStorer: store})
+	}
+}
+
+func WithToolName(name string) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.ToolName = name
+	}
+}
+
+func WithToolDescription(description string) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.ToolDescription = description
+	}
+}
+
+func WithReranker(r core.Reranker) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Reranker = r
+	}
+}
+
+func WithRerankCandidates(n int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.RerankCandidates = n
+	}
+}
+
+func WithLimit(n int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Limit = n
+	}
+}
+
+func WithMaxLimit(n int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.MaxLimit = n
+	}
+}
+
+func WithThreshold(t float32) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Threshold = t
+	}
+}
+
+func WithFilter(f *core.Filter) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Filter = f
+	}
+}
+
+func WithFilterField(fields ...*FilterField) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.FilterFields = append(conf.FilterFields, fields...)
+	}
+}
+
+func WithMaxTokens(n int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.MaxTokens = n
+	}
+}
+
+func WithTokenCounter(f func(text string) int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.TokenCounter = f
+	}
+}
+
+func WithFormatter(f Formatter) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Formatter = f
+	}
+}
+
+func WithLogger(l *logr.Logger) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewRetriever returns a new Retriever
+func NewRetriever(opts ...RetrieverConfigFunc) *Retriever {
+	discard := logr.Discard()
+	conf := &RetrieverConfig{
+		ToolName:         "searchVectorStore",
+		ToolDescription:  defaultToolDescription,
+		RerankCandidates: 50,
+		Limit:            5,
+		MaxLimit:         20,
+		MaxTokens:        2000,
+		TokenCounter:     ApproxTokens,
+		Formatter:        FormatPassage(DefaultCitationFields...),
+		Logger:           &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	limit := max(conf.Limit, 1)
+	return &Retriever{
+		stores:           conf.Stores,
+		toolName:         conf.ToolName,
+		toolDescription:  conf.ToolDescription,
+		reranker:         conf.Reranker,
+		rerankCandidates: conf.RerankCandidates,
+		limit:            limit,
+		maxLimit:         max(conf.MaxLimit, limit),
+		threshold:        conf.Threshold,
+		filter:           conf.Filter,
+		fields:           conf.FilterFields,
+		maxTokens:        conf.MaxTokens,
+		countTokens:      conf.TokenCounter,
+		format:           conf.Formatter,
+		logger:           conf.Logger,
+	}
+}
+
+const defaultToolDescription = "Searches the knowledge base for passages relevant to a query. " +
+	"Passages are numbered: cite them as [1], [2] when using their content."
+
+// Stores returns the stores searched by the retriever
+func (r *Retriever) Stores() []*Store {
+	return r.stores
+}
+
+// Query is a search of a Retriever
+type Query struct {
+	// Text searched for
+	Text string
+
+	// Limit is the number of passages returned
+	// default the limit of the retriever
+	Limit int
+
+	// Stores names the stores searched, all of them when empty
+	Stores []string
+
+	// Filter restricts the search, along with the filter of the retriever
+	Filter *core.Filter
+}
+
+// Retrieve searches the stores and returns the best passages, best first.
+// Results of several stores are merged by score, which suits stores using
+// the same embedder and metric, or a reranker.
+func (r *Retriever) Retrieve(ctx context.Context, q *Query) ([]*Passage, error) {
+	if strings.TrimSpace(q.Text) == "" {
+		return nil, errors.New("query must not be empty")
+	}
+
+	stores, err := r.selectStores(q.Stores)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := r.limit
+	if q.Limit > 0 {
+		limit = min(q.Limit, r.maxLimit)
+	}
+	candidates := limit
+	if r.reranker != nil {
+		candidates = max(r.rerankCandidates, limit)
+	}
+
+	filter := r.filter
+	if q.Filter != nil {
+		filter = q.Filter
+		if r.filter != nil {
+			filter = core.And(r.filter, q.Filter)
+		}
+	}
+
+	var results []*core.SearchResult
+	// rerankers may return copies of the results, the embeddings remain
+	storeOf := map[*core.Embedding]string{}
+	for _, s := range stores {
+		found, err := s.VectorStorer.Search(ctx, &core.SearchParams{
+			Query:     q.Text,
+			Limit:     candidates,
+			Threshold: r.threshold,
+			Filter:    filter,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error searching %s: %w", s.Name, err)
+		}
+
+		for _, res := range found {
+			storeOf[res.Embedding] = s.Name
+		}
+		results = append(results, found...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if r.reranker != nil && len(results) > 0 {
+		reranked, err := r.reranker.Rerank(ctx, q.Text, results, limit)
+		if err != nil {
+			// the search results are still worth returning
+			r.logger.Error(err, "Error reranking search results")
+		} else {
+			results = reranked
+		}
+	}
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	passages := make([]*Passage, len(results))
+	for i, res := range results {
+		store := ""
+		if len(r.stores) > 1 {
+			store = storeOf[res.Embedding]
+		}
+
+		passages[i] = &Passage{
+			Index:    i + 1,
+			Store:    store,
+			ID:       res.Embedding.ID,
+			Score:    res.Score,
+			Content:  res.Embedding.Content,
+			Metadata: res.Embedding.Metadata,
+		}
+	}
+
+	return passages, nil
+}
+
+// selectStores returns the stores with the given names, all of them when
+// names is empty
+func (r *Retriever) selectStores(names []string) ([]*Store, error) {
+	if len(r.stores) == 0 {
+		return nil, errors.New("no store to search")
+	}
+	if len(names) == 0 {
+		return r.stores, nil
+	}
+
+	var out []*Store
+	for _, name := range names {
+		found := false
+		for _, s := range r.stores {
+			if s.Name == name {
+				out = append(out, s)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown store %q, expected one of %s", name, strings.Join(r.storeNames(), ", "))
+		}
+	}
+
+	return out, nil
+}
+
+func (r *Retriever) storeNames() []string {
+	names := make([]string, len(r.stores))
+	for i, s := range r.stores {
+		names[i] = s.Name
+	}
+
+	return names
+}
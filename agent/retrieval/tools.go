@@ -0,0 +1,189 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Tools returns the search tool of the retriever. The agent registers it
+// automatically when the retriever is built from its configuration.
+func (r *Retriever) Tools() []*core.Tool {
+	wrapped, err := core.WrapToolFunction(r.Search)
+	if err != nil {
+		panic(err)
+	}
+
+	return []*core.Tool{
+		{
+			Name:                r.toolName,
+			Description:         r.toolDescription,
+			WrappedToolFunction: wrapped,
+			JSONSchema:          r.schema(),
+		},
+	}
+}
+
+// schema describes the arguments of the search tool. Stores are only
+// offered when there are several, and the filter only when fields are
+// exposed.
+func (r *Retriever) schema() []byte {
+	properties := map[string]interface{}{
+		"query": map[string]interface{}{
+			"type":        "string",
+			"description": "What to search for, in natural language",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": fmt.Sprintf("Maximum number of passages to return, defaults to %d, at most %d", r.limit, r.maxLimit),
+		},
+	}
+
+	if len(r.stores) > 1 {
+		names := make([]interface{}, len(r.stores))
+		descriptions := make([]string, len(r.stores))
+		for i, s := range r.stores {
+			names[i] = s.Name
+			descriptions[i] = s.Name
+			if s.Description != "" {
+				descriptions[i] += ": " + s.Description
+			}
+		}
+
+		properties["stores"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string", "enum": names},
+			"description": "Stores to search, all of them when omitted. " + strings.Join(descriptions, "; "),
+		}
+	}
+
+	if len(r.fields) > 0 {
+		fields := map[string]interface{}{}
+		for _, f := range r.fields {
+			value := map[string]interface{}{"type": f.Type}
+			if len(f.Enum) > 0 {
+				value["enum"] = f.Enum
+			}
+
+			field := value
+			if f.Range {
+				field = map[string]interface{}{
+					"type":       "object",
+					"properties": map[string]interface{}{"gte": value, "lte": value},
+				}
+			}
+			if f.Description != "" {
+				field["description"] = f.Description
+			}
+			fields[f.Name] = field
+		}
+
+		properties["filter"] = map[string]interface{}{
+			"type": "object",
+			"description": "Restricts the search to passages whose metadata match every given field. " +
+				"Bounds of range fields are inclusive.",
+			"properties": fields,
+		}
+	}
+
+	schema, err := json.Marshal(map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"query"},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return schema
+}
+
+type SearchArgs struct {
+	Query  string                     `json:"query"`
+	Limit  int                        `json:"limit"`
+	Stores []string                   `json:"stores"`
+	Filter map[string]json.RawMessage `json:"filter"`
+}
+
+// Search runs the search asked by the model and returns the passages found,
+// formatted for citation
+func (r *Retriever) Search(ctx context.Context, args *SearchArgs) (string, error) {
+	filter, err := r.parseFilter(args.Filter)
+	if err != nil {
+		return "", err
+	}
+
+	passages, err := r.Retrieve(ctx, &Query{
+		Text:   args.Query,
+		Limit:  args.Limit,
+		Stores: args.Stores,
+		Filter: filter,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	rendered, _ := r.Render(passages)
+	return rendered, nil
+}
+
+// parseFilter turns the filter of the model into a core.Filter: a value
+// matches a field, a list of values any of them, and gte and lte bound range
+// fields
+func (r *Retriever) parseFilter(args map[string]json.RawMessage) (*core.Filter, error) {
+	for name := range args {
+		known := false
+		for _, f := range r.fields {
+			known = known || f.Name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown filter field %q", name)
+		}
+	}
+
+	var filters []*core.Filter
+	for _, field := range r.fields {
+		name := field.Name
+		raw, ok := args[name]
+		if !ok {
+			continue
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("invalid value of filter field %q: %w", name, err)
+		}
+
+		switch v := value.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			if len(v) == 0 {
+				continue
+			}
+			filters = append(filters, core.In(name, v...))
+		case map[string]interface{}:
+			if !field.Range {
+				return nil, fmt.Errorf("filter field %q takes a value, not bounds", name)
+			}
+			if v["gte"] == nil && v["lte"] == nil {
+				return nil, fmt.Errorf("filter field %q needs gte or lte", name)
+			}
+			filters = append(filters, core.Range(name, v["gte"], v["lte"]))
+		default:
+			filters = append(filters, core.Eq(name, v))
+		}
+	}
+
+	switch len(filters) {
+	case 0:
+		return nil, nil
+	case 1:
+		return filters[0], nil
+	default:
+		return core.And(filters...), nil
+	}
+}
@@ -0,0 +1,175 @@
+package retrieval
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+var testFields = []*FilterField{
+	{Name: "source", Type: "string"},
+	{Name: "year", Type: "integer", Range: true},
+	{Name: "published", Type: "string", Range: true, Description: "RFC 3339 date"},
+	{Name: "lang", Type: "string", Enum: []interface{}{"en", "pt"}},
+}
+
+func TestParseFilter(t *testing.T) {
+	r := NewRetriever(WithFilterField(testFields...))
+
+	tests := map[string]struct {
+		args string
+		want *core.Filter
+		err  string
+	}{
+		"no filter":      {`{}`, nil, ""},
+		"value":          {`{"source": "a.md"}`, core.Eq("source", "a.md"), ""},
+		"list":           {`{"lang": ["en", "pt"]}`, core.In("lang", "en", "pt"), ""},
+		"empty list":     {`{"lang": []}`, nil, ""},
+		"null":           {`{"source": null}`, nil, ""},
+		"value of range": {`{"year": 2024}`, core.Eq("year", 2024.0), ""},
+		"list of range":  {`{"year": [2023, 2024]}`, core.In("year", 2023.0, 2024.0), ""},
+		"gte":            {`{"year": {"gte": 2020}}`, core.Range("year", 2020.0, nil), ""},
+		"lte":            {`{"published": {"lte": "2024-06-30"}}`, core.Range("published", nil, "2024-06-30"), ""},
+		"gte and lte":    {`{"year": {"gte": 2020, "lte": 2022}}`, core.Range("year", 2020.0, 2022.0), ""},
+		"several fields": {
+			`{"lang": "en", "source": "a.md", "year": {"gte": 2020}}`,
+			// in the order the fields are declared
+			core.And(core.Eq("source", "a.md"), core.Range("year", 2020.0, nil), core.Eq("lang", "en")),
+			"",
+		},
+		"unknown field":     {`{"author": "x"}`, nil, `unknown filter field "author"`},
+		"bounds of a value": {`{"source": {"gte": "a"}}`, nil, `filter field "source" takes a value, not bounds`},
+		"no bounds":         {`{"year": {"gt": 2020}}`, nil, `filter field "year" needs gte or lte`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			args := map[string]json.RawMessage{}
+			if err := json.Unmarshal([]byte(tt.args), &args); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := r.parseFilter(args)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("got %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+
+	if _, err := r.parseFilter(map[string]json.RawMessage{"year": json.RawMessage("tru")}); err == nil {
+		t.Error("invalid JSON value accepted")
+	}
+}
+
+func TestSchema(t *testing.T) {
+	type property struct {
+		Type        string                     `json:"type"`
+		Description string                     `json:"description"`
+		Properties  map[string]json.RawMessage `json:"properties"`
+		Items       struct {
+			Enum []string `json:"enum"`
+		} `json:"items"`
+	}
+	parse := func(t *testing.T, r *Retriever) map[string]*property {
+		t.Helper()
+
+		schema := struct {
+			Properties map[string]*property `json:"properties"`
+			Required   []string             `json:"required"`
+		}{}
+		if err := json.Unmarshal(r.schema(), &schema); err != nil {
+			t.Fatal(err)
+		}
+		if len(schema.Required) != 1 || schema.Required[0] != "query" {
+			t.Errorf("required %v", schema.Required)
+		}
+
+		return schema.Properties
+	}
+
+	t.Run("one store", func(t *testing.T) {
+		properties := parse(t, NewRetriever(WithStore("docs", "Documentation", &fakeStore{})))
+
+		if _, ok := properties["stores"]; ok {
+			t.Error("stores offered with a single store")
+		}
+		if _, ok := properties["filter"]; ok {
+			t.Error("filter offered without fields")
+		}
+		if !strings.Contains(properties["limit"].Description, "defaults to 5, at most 20") {
+			t.Errorf("limit: %q", properties["limit"].Description)
+		}
+	})
+
+	t.Run("several stores", func(t *testing.T) {
+		properties := parse(t, NewRetriever(
+			WithStore("docs", "Documentation", &fakeStore{}),
+			WithStore("tickets", "", &fakeStore{}),
+			WithFilterField(testFields...),
+		))
+
+		stores := properties["stores"]
+		if stores == nil || strings.Join(stores.Items.Enum, ",") != "docs,tickets" {
+			t.Fatalf("got stores %+v", stores)
+		}
+		if !strings.Contains(stores.Description, "docs: Documentation; tickets") {
+			t.Errorf("stores: %q", stores.Description)
+		}
+
+		filter := properties["filter"]
+		if filter == nil || len(filter.Properties) != len(testFields) {
+			t.Fatalf("got filter %+v", filter)
+		}
+		for name, want := range map[string]string{
+			"source":    `{"type":"string"}`,
+			"year":      `{"properties":{"gte":{"type":"integer"},"lte":{"type":"integer"}},"type":"object"}`,
+			"published": `{"description":"RFC 3339 date","properties":{"gte":{"type":"string"},"lte":{"type":"string"}},"type":"object"}`,
+			"lang":      `{"enum":["en","pt"],"type":"string"}`,
+		} {
+			if got := string(filter.Properties[name]); got != want {
+				t.Errorf("%s: got %s, want %s", name, got, want)
+			}
+		}
+	})
+}
+
+func TestSearchLeavesVectorsOut(t *testing.T) {
+	store := passages(2, 10)
+	for _, res := range store.results {
+		res.Embedding.Vector = core.Vec32{0.123456, -0.654321}
+	}
+	r := NewRetriever(WithStore("docs", "", store), WithFilterField(testFields...))
+
+	out, err := r.Search(context.Background(), &SearchArgs{
+		Query:  "x",
+		Filter: map[string]json.RawMessage{"lang": json.RawMessage(`"en"`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(out, "0.12") || strings.Contains(out, "0.65") {
+		t.Errorf("vector in the output:\n%s", out)
+	}
+	if !strings.Contains(out, "[1] source: doc-1.md | id: chunk-1 | score: 1.00") {
+		t.Errorf("got\n%s", out)
+	}
+	if f := store.params[0].Filter; f == nil || f.Op != core.FilterEq || f.Field != "lang" {
+		t.Errorf("searched with filter %+v", f)
+	}
+}
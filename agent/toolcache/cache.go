@@ -0,0 +1,356 @@
+package toolcache
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Cache memoizes the results of pure tools. Only tools wrapped with Wrap are
+// cached, so tools with side effects are never skipped by accident.
+//
+// Without a TTL, results are only reused within the agent run that produced
+// them (see core.RunID). With a TTL, they are shared across runs until they
+// expire. Failed calls are not cached, and identical calls running at the
+// same time are executed once; a panicking tool fails with ErrPanic.
+//
+// Results are shared as copies: strings, numbers and booleans as is, byte
+// slices copied, and other values as a json.RawMessage of their JSON
+// encoding, which renders the same. Results that cannot be encoded are not
+// cached.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	logger     *logr.Logger
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	inflight map[string]*call
+	hits     uint64
+	misses   uint64
+}
+
+// ErrPanic is returned for calls whose tool panicked
+var ErrPanic = errors.New("tool panicked")
+
+type entry struct {
+	key     string
+	tool    string
+	result  interface{}
+	expires time.Time
+}
+
+// call is an execution other identical calls wait for
+type call struct {
+	done   chan struct{}
+	result interface{}
+	err    error
+	// shared is false when the result could not be frozen
+	shared bool
+}
+
+// Stats are the hit and miss counters of a Cache
+type Stats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int
+}
+
+// CacheConfig holds configuration for a Cache
+type CacheConfig struct {
+	// TTL shares results across runs for the given duration. Zero keeps
+	// results within a single run.
+	TTL time.Duration
+
+	// MaxEntries caps the number of cached results, least recently used
+	// results are evicted first.
+	// default 1000
+	MaxEntries int
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// CacheConfigFunc is a function type that modifies CacheConfig
+type CacheConfigFunc func(*CacheConfig)
+
+func WithTTL(ttl time.Duration) CacheConfigFunc {
+	return func(conf *CacheConfig) {
+		conf.TTL = ttl
+	}
+}
+
+func WithMaxEntries(n int) CacheConfigFunc {
+	return func(conf *CacheConfig) {
+		conf.MaxEntries = n
+	}
+}
+
+func WithLogger(l *logr.Logger) CacheConfigFunc {
+	return func(conf *CacheConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewCache returns a new Cache
+func NewCache(opts ...CacheConfigFunc) *Cache {
+	discard := logr.Discard()
+	conf := &CacheConfig{
+		MaxEntries: 1000,
+		Logger:     &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Cache{
+		ttl:        conf.TTL,
+		maxEntries: conf.MaxEntries,
+		logger:     conf.Logger,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		inflight:   map[string]*call{},
+	}
+}
+
+// Wrap returns copies of the tools whose results are memoized. Only wrap
+// tools whose result depends on nothing but their arguments.
+func (c *Cache) Wrap(tools ...*core.Tool) []*core.Tool {
+	wrapped := make([]*core.Tool, 0, len(tools))
+	for _, t := range tools {
+		tool := *t
+		fn := t.WrappedToolFunction
+		tool.WrappedToolFunction = func(ctx context.Context, args []byte) (interface{}, error) {
+			return c.do(ctx, t.Name, args, fn)
+		}
+		wrapped = append(wrapped, &tool)
+	}
+
+	return wrapped
+}
+
+func (c *Cache) do(ctx context.Context, name string, args []byte, fn func(context.Context, []byte) (interface{}, error)) (interface{}, error) {
+	key, ok := c.key(ctx, name, args)
+	if !ok {
+		return fn(ctx, args)
+	}
+
+	for {
+		c.mu.Lock()
+		if result, ok := c.lookup(key); ok {
+			c.hits++
+			c.mu.Unlock()
+			c.logger.V(1).Info("tool cache hit", "tool", name)
+			return thaw(result), nil
+		}
+
+		inflight, ok := c.inflight[key]
+		if !ok {
+			break
+		}
+		c.hits++
+		c.mu.Unlock()
+
+		select {
+		case <-inflight.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		// a call that ended with its caller's context, or whose result
+		// cannot be shared, is run again
+		if !inflight.shared || isContextErr(inflight.err) {
+			c.mu.Lock()
+			c.hits--
+			c.mu.Unlock()
+
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return thaw(inflight.result), inflight.err
+	}
+
+	c.misses++
+	current := &call{done: make(chan struct{})}
+	c.inflight[key] = current
+	c.mu.Unlock()
+
+	return c.lead(ctx, key, name, args, current, fn)
+}
+
+// lead runs a call identical calls wait for, and caches its result
+func (c *Cache) lead(ctx context.Context, key, name string, args []byte, current *call, fn func(context.Context, []byte) (interface{}, error)) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("%w: tool %s: %v", ErrPanic, name, r)
+		}
+
+		frozen, ok := freeze(result)
+		current.result, current.err, current.shared = frozen, err, ok
+
+		c.mu.Lock()
+		delete(c.inflight, key)
+		if ok && err == nil {
+			c.store(key, name, frozen)
+		}
+		c.mu.Unlock()
+		close(current.done)
+	}()
+
+	return fn(ctx, args)
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// freeze returns a copy of result that callers cannot change: values of
+// immutable kinds as is, byte slices copied and anything else as its JSON
+// encoding. It reports false for results that cannot be encoded.
+func freeze(result interface{}) (interface{}, bool) {
+	switch v := result.(type) {
+	case nil:
+		return nil, true
+	case json.RawMessage:
+		return json.RawMessage(bytes.Clone(v)), true
+	case []byte:
+		return bytes.Clone(v), true
+	}
+
+	switch reflect.ValueOf(result).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return result, true
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, false
+	}
+
+	return json.RawMessage(raw), true
+}
+
+// thaw returns a copy of a frozen result for a caller
+func thaw(frozen interface{}) interface{} {
+	switch v := frozen.(type) {
+	case json.RawMessage:
+		return json.RawMessage(bytes.Clone(v))
+	case []byte:
+		return bytes.Clone(v)
+	}
+
+	return frozen
+}
+
+// key identifies a call by tool name and arguments. Arguments are normalized
+// so that key order and whitespace do not matter. Without a TTL the run is
+// part of the key, and calls outside of a run are not cached.
+func (c *Cache) key(ctx context.Context, name string, args []byte) (string, bool) {
+	scope := ""
+	if c.ttl <= 0 {
+		scope = core.RunID(ctx)
+		if scope == "" {
+			return "", false
+		}
+	}
+
+	normalized := bytes.TrimSpace(args)
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(normalized))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err == nil {
+		// maps are marshalled with sorted keys
+		if raw, err := json.Marshal(v); err == nil {
+			normalized = raw
+		}
+	}
+
+	return scope + "\x00" + name + "\x00" + string(normalized), true
+}
+
+// lookup returns a live cached result. The caller must hold the lock.
+func (c *Cache) lookup(key string) (interface{}, bool) {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return e.result, true
+}
+
+// store caches a result, evicting the least recently used entries beyond
+// MaxEntries. The caller must hold the lock.
+func (c *Cache) store(key, name string, result interface{}) {
+	e := &entry{key: key, tool: name, result: result}
+	if c.ttl > 0 {
+		e.expires = time.Now().Add(c.ttl)
+	}
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(e)
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Invalidate drops the cached results of the named tools, or of every tool
+// when no name is given
+func (c *Cache) Invalidate(name ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	drop := map[string]bool{}
+	for _, n := range name {
+		drop[n] = true
+	}
+
+	for key, el := range c.entries {
+		if len(name) == 0 || drop[el.Value.(*entry).tool] {
+			c.lru.Remove(el)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Stats returns the hit and miss counters of the cache
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries)}
+}
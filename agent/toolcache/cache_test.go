@@ -0,0 +1,251 @@
+package toolcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joaopandolfi/core"
+)
+
+// counted returns a tool counting its calls, returning fn's result
+func counted(name string, fn func(ctx context.Context, args []byte) (interface{}, error)) (*core.Tool, *atomic.Int64) {
+	calls := &atomic.Int64{}
+	return &core.Tool{
+		Name: name,
+		WrappedToolFunction: func(ctx context.Context, args []byte) (interface{}, error) {
+			calls.Add(1)
+			return fn(ctx, args)
+		},
+	}, calls
+}
+
+func echo(ctx context.Context, args []byte) (interface{}, error) {
+	return string(args), nil
+}
+
+func TestRunScope(t *testing.T) {
+	c := NewCache()
+	tool, calls := counted("echo", echo)
+	wrapped := c.Wrap(tool)[0]
+
+	run1 := core.WithRunID(context.Background(), "run1")
+	run2 := core.WithRunID(context.Background(), "run2")
+
+	for _, ctx := range []context.Context{run1, run1, run2, context.Background(), context.Background()} {
+		if _, err := wrapped.WrappedToolFunction(ctx, []byte(`{"a": 1, "b": 2}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// arguments differing in key order and spacing are the same call
+	if _, err := wrapped.WrappedToolFunction(run1, []byte(`{"b":2,"a":1}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// once per run, and every call outside of a run
+	if got := calls.Load(); got != 4 {
+		t.Errorf("tool called %d times, want 4", got)
+	}
+	if stats := c.Stats(); stats.Hits != 2 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("got %+v", stats)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := NewCache(WithTTL(50 * time.Millisecond))
+	tool, calls := counted("echo", echo)
+	wrapped := c.Wrap(tool)[0]
+
+	// shared across runs until the entry expires
+	for _, id := range []string{"run1", "run2", ""} {
+		if _, err := wrapped.WrappedToolFunction(core.WithRunID(context.Background(), id), []byte(`"x"`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("tool called %d times before expiry, want 1", got)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := wrapped.WrappedToolFunction(context.Background(), []byte(`"x"`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("tool called %d times after expiry, want 2", got)
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	c := NewCache(WithTTL(time.Hour), WithMaxEntries(2))
+	tool, calls := counted("echo", echo)
+	wrapped := c.Wrap(tool)[0]
+	ctx := context.Background()
+
+	for _, args := range []string{`1`, `2`, `1`, `3`, `1`, `2`} {
+		if _, err := wrapped.WrappedToolFunction(ctx, []byte(args)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 2 was the least recently used when 3 came in
+	if got := calls.Load(); got != 4 {
+		t.Errorf("tool called %d times, want 4", got)
+	}
+	if entries := c.Stats().Entries; entries != 2 {
+		t.Errorf("%d entries, want 2", entries)
+	}
+
+	c.Invalidate("echo")
+	if entries := c.Stats().Entries; entries != 0 {
+		t.Errorf("%d entries after invalidation, want 0", entries)
+	}
+}
+
+func TestSingleflight(t *testing.T) {
+	c := NewCache(WithTTL(time.Hour))
+	release := make(chan struct{})
+	tool, calls := counted("slow", func(ctx context.Context, args []byte) (interface{}, error) {
+		<-release
+		return map[string]int{"n": 1}, nil
+	})
+	wrapped := c.Wrap(tool)[0]
+
+	results := make([]interface{}, 8)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := wrapped.WrappedToolFunction(context.Background(), []byte(`{}`))
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = result
+		}(i)
+	}
+
+	// let the callers pile up behind the first one
+	for c.Stats().Hits+c.Stats().Misses < uint64(len(results)) {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("tool called %d times, want 1", got)
+	}
+
+	// waiters get copies they cannot change for others
+	for i, result := range results {
+		raw, err := json.Marshal(result)
+		if err != nil || string(raw) != `{"n":1}` {
+			t.Errorf("caller %d got %s, %v", i, raw, err)
+		}
+		if r, ok := result.(json.RawMessage); ok {
+			r[0] = 'x'
+		}
+	}
+	cached, _ := wrapped.WrappedToolFunction(context.Background(), []byte(`{}`))
+	if raw, _ := json.Marshal(cached); string(raw) != `{"n":1}` {
+		t.Errorf("cached result changed to %s", raw)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	c := NewCache(WithTTL(time.Hour))
+	panics := atomic.Bool{}
+	panics.Store(true)
+	tool, calls := counted("flaky", func(ctx context.Context, args []byte) (interface{}, error) {
+		if panics.Load() {
+			panic("boom")
+		}
+		return "ok", nil
+	})
+	wrapped := c.Wrap(tool)[0]
+
+	if _, err := wrapped.WrappedToolFunction(context.Background(), []byte(`{}`)); !errors.Is(err, ErrPanic) {
+		t.Fatalf("got %v, want ErrPanic", err)
+	}
+
+	// the panic left nothing behind for the next call to wait for
+	panics.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	result, err := wrapped.WrappedToolFunction(ctx, []byte(`{}`))
+	if err != nil || result != "ok" {
+		t.Errorf("got %v, %v", result, err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("tool called %d times, want 2", got)
+	}
+}
+
+func TestCancellation(t *testing.T) {
+	c := NewCache(WithTTL(time.Hour))
+	started := make(chan struct{})
+	tool, calls := counted("slow", func(ctx context.Context, args []byte) (interface{}, error) {
+		if ctx.Value(leaderKey{}) != nil {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "done", nil
+	})
+	wrapped := c.Wrap(tool)[0]
+
+	leaderCtx, cancelLeader := context.WithCancel(context.WithValue(context.Background(), leaderKey{}, true))
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := wrapped.WrappedToolFunction(leaderCtx, []byte(`{}`))
+		leaderErr <- err
+	}()
+	<-started
+
+	waiter := make(chan error, 1)
+	var result interface{}
+	go func() {
+		var err error
+		result, err = wrapped.WrappedToolFunction(context.Background(), []byte(`{}`))
+		waiter <- err
+	}()
+	// wait for the waiter to join the leader's call
+	for c.Stats().Hits < 1 {
+		time.Sleep(time.Millisecond)
+	}
+	cancelLeader()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("leader got %v, want context.Canceled", err)
+	}
+	// the waiter runs the tool itself rather than inheriting the
+	// cancellation
+	if err := <-waiter; err != nil || result != "done" {
+		t.Errorf("waiter got %v, %v", result, err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("tool called %d times, want 2", got)
+	}
+
+	// a waiter whose own context ends stops waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	slow := c.Wrap(&core.Tool{Name: "blocked", WrappedToolFunction: func(ctx context.Context, args []byte) (interface{}, error) {
+		<-block
+		return nil, nil
+	}})[0]
+	go slow.WrappedToolFunction(context.Background(), []byte(`{}`))
+	for c.Stats().Misses < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := slow.WrappedToolFunction(ctx, []byte(`{}`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+type leaderKey struct{}
@@ -0,0 +1,240 @@
+package toolresult
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Render converts a tool result to text. Strings and byte slices are used as
+// is, everything else is marshalled to JSON so that structure survives.
+// Values that cannot be marshalled fall back to their %v formatting.
+func Render(result interface{}, indent bool) string {
+	switch v := result.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case json.RawMessage:
+		return string(v)
+	}
+
+	var raw []byte
+	var err error
+	if indent {
+		raw, err = json.MarshalIndent(result, "", "  ")
+	} else {
+		raw, err = json.Marshal(result)
+	}
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+
+	return string(raw)
+}
+
+// Renderer is a core.ToolResultRenderer that marshals results to JSON and
+// keeps them within a size budget. Oversized results are either truncated,
+// keeping their head and tail around a marker, or, when a Store is configured,
+// spilled to the store and replaced by a preview and a handle the LLM can
+// page through with the readToolResult tool.
+type Renderer struct {
+	maxBytes     int
+	pageBytes    int
+	indent       bool
+	store        Store
+	vecStore     core.VectorStorer
+	readToolName string
+}
+
+// RendererConfig holds configuration for a Renderer
+type RendererConfig struct {
+	// MaxBytes caps the rendered content of a tool message. Zero disables the
+	// cap.
+	// default 16KiB
+	MaxBytes int
+
+	// PageBytes is the default page size of readToolResult.
+	// default 8KiB
+	PageBytes int
+
+	// Indent pretty prints JSON results
+	Indent bool
+
+	// Store, when set, keeps the full content of oversized results
+	Store Store
+
+	// VecStore, when set, also receives spilled results, split in pages, so
+	// they can be found with the vector store search tool
+	VecStore core.VectorStorer
+
+	// ReadToolName is the name of the paging tool
+	// default "readToolResult"
+	ReadToolName string
+}
+
+// RendererConfigFunc is a function type that modifies RendererConfig
+type RendererConfigFunc func(*RendererConfig)
+
+func WithMaxBytes(n int) RendererConfigFunc {
+	return func(conf *RendererConfig) {
+		conf.MaxBytes = n
+	}
+}
+
+func WithPageBytes(n int) RendererConfigFunc {
+	return func(conf *RendererConfig) {
+		conf.PageBytes = n
+	}
+}
+
+func WithIndent() RendererConfigFunc {
+	return func(conf *RendererConfig) {
+		conf.Indent = true
+	}
+}
+
+// WithStore spills oversized results to the store instead of truncating them
+func WithStore(s Store) RendererConfigFunc {
+	return func(conf *RendererConfig) {
+		conf.Store = s
+	}
+}
+
+func WithVectorStore(vs core.VectorStorer) RendererConfigFunc {
+	return func(conf *RendererConfig) {
+		conf.VecStore = vs
+	}
+}
+
+func WithReadToolName(name string) RendererConfigFunc {
+	return func(conf *RendererConfig) {
+		conf.ReadToolName = name
+	}
+}
+
+// NewRenderer returns a new Renderer
+func NewRenderer(opts ...RendererConfigFunc) *Renderer {
+	conf := &RendererConfig{
+		MaxBytes:     16 * 1024,
+		PageBytes:    8 * 1024,
+		ReadToolName: "readToolResult",
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Renderer{
+		maxBytes:     conf.MaxBytes,
+		pageBytes:    conf.PageBytes,
+		indent:       conf.Indent,
+		store:        conf.Store,
+		vecStore:     conf.VecStore,
+		readToolName: conf.ReadToolName,
+	}
+}
+
+// RenderToolResult implements core.ToolResultRenderer
+func (r *Renderer) RenderToolResult(ctx context.Context, tc *core.ToolCall, result interface{}) (string, error) {
+	content := Render(result, r.indent)
+	if r.maxBytes <= 0 || len(content) <= r.maxBytes {
+		return content, nil
+	}
+
+	if r.store == nil {
+		return truncate(content, r.maxBytes), nil
+	}
+
+	return r.spill(ctx, tc, content)
+}
+
+// spill stores the full content and returns its head with instructions to
+// read the rest
+func (r *Renderer) spill(ctx context.Context, tc *core.ToolCall, content string) (string, error) {
+	handle, err := r.store.Put(ctx, content)
+	if err != nil {
+		return "", fmt.Errorf("error storing result of %s: %w", tc.Name, err)
+	}
+
+	if r.vecStore != nil {
+		if _, err := r.vecStore.Add(ctx, pages(content, r.pageBytes)); err != nil {
+			return "", fmt.Errorf("error indexing result of %s: %w", tc.Name, err)
+		}
+	}
+
+	note := func(shown int) string {
+		return fmt.Sprintf("\n[result is %d bytes, showing the first %d. Call %s with handle %q and offset %d to read more]",
+			len(content), shown, r.readToolName, handle, shown)
+	}
+
+	// leave room for the note itself
+	head := cut(content, max(r.maxBytes-len(note(len(content))), r.maxBytes/2))
+
+	return head + note(len(head)), nil
+}
+
+// truncate keeps the head and tail of content around a marker so that the
+// result fits in limit bytes
+func truncate(content string, limit int) string {
+	marker := func(dropped int) string {
+		return fmt.Sprintf("\n... [%d of %d bytes truncated] ...\n", dropped, len(content))
+	}
+	budget := max(limit-len(marker(len(content))), 0)
+
+	head := cut(content, budget*3/4)
+	tail := cutTail(content, budget-len(head))
+
+	return head + marker(len(content)-len(head)-len(tail)) + tail
+}
+
+// cut returns the longest prefix of s of at most n bytes that does not split
+// a UTF-8 sequence
+func cut(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+// cutTail returns the longest suffix of s of at most n bytes that does not
+// split a UTF-8 sequence
+func cutTail(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+
+	start := len(s) - n
+	for start < len(s) && !utf8.RuneStart(s[start]) {
+		start++
+	}
+
+	return s[start:]
+}
+
+// pages splits content into pages of at most size bytes
+func pages(content string, size int) []string {
+	out := []string{}
+	for len(content) > 0 {
+		page := cut(content, size)
+		if page == "" {
+			// size is smaller than a single rune
+			_, n := utf8.DecodeRuneInString(content)
+			page = content[:n]
+		}
+		out = append(out, page)
+		content = content[len(page):]
+	}
+
+	return out
+}
@@ -0,0 +1,212 @@
+package toolresult
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/joaopandolfi/core"
+)
+
+var call = &core.ToolCall{ID: "1", Name: "search"}
+
+// spillNote matches the note ending spilled results
+var spillNote = regexp.MustCompile(`\n\[result is (\d+) bytes, showing the first (\d+)\. Call (\w+) with handle "(tr_[0-9a-f]+)" and offset (\d+) to read more\]$`)
+
+// vecStore records the contents added to it
+type vecStore struct {
+	contents []string
+	err      error
+}
+
+func (s *vecStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	s.contents = append(s.contents, contents...)
+	return nil, s.err
+}
+
+func (s *vecStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	return nil, nil
+}
+
+func (s *vecStore) Close() error {
+	return nil
+}
+
+// failingStore fails every Put
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Put(ctx context.Context, content string) (string, error) {
+	return "", errors.New("disk full")
+}
+
+func TestRender(t *testing.T) {
+	tests := map[string]struct {
+		result interface{}
+		indent bool
+		want   string
+	}{
+		"nil":         {nil, false, ""},
+		"string":      {"plain \"text\"", false, `plain "text"`},
+		"bytes":       {[]byte("raw"), false, "raw"},
+		"raw json":    {json.RawMessage(`{"a": 1}`), true, `{"a": 1}`},
+		"map":         {map[string]interface{}{"b": []int{1, 2}, "a": "x"}, false, `{"a":"x","b":[1,2]}`},
+		"indented":    {map[string]int{"a": 1}, true, "{\n  \"a\": 1\n}"},
+		"struct":      {struct{ Name string }{"n"}, false, `{"Name":"n"}`},
+		"number":      {42, false, "42"},
+		"not json":    {math.Inf(1), false, "+Inf"},
+		"string list": {[]string{"a"}, false, `["a"]`},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := Render(tt.result, tt.indent); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderToolResultTruncates(t *testing.T) {
+	ascii := strings.Repeat("0123456789", 100)
+	marker := regexp.MustCompile(`\n\.\.\. \[(\d+) of (\d+) bytes truncated\] \.\.\.\n`)
+
+	tests := map[string]struct {
+		maxBytes  int
+		result    interface{}
+		truncated bool
+	}{
+		"fits":        {1000, ascii, false},
+		"no cap":      {0, ascii + ascii, false},
+		"truncated":   {200, ascii, true},
+		"multi byte":  {101, strings.Repeat("é", 500), true},
+		"json result": {100, map[string]string{"text": ascii}, true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := NewRenderer(WithMaxBytes(tt.maxBytes)).RenderToolResult(context.Background(), call, tt.result)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			full := Render(tt.result, false)
+			m := marker.FindStringSubmatchIndex(got)
+			if !tt.truncated {
+				if got != full {
+					t.Errorf("got %d bytes, want the %d bytes of the result", len(got), len(full))
+				}
+				return
+			}
+			if m == nil {
+				t.Fatalf("no truncation marker in %q", got)
+			}
+
+			head, tail := got[:m[0]], got[m[1]:]
+			dropped, total := got[m[2]:m[3]], got[m[4]:m[5]]
+			if len(got) > tt.maxBytes {
+				t.Errorf("got %d bytes, want at most %d", len(got), tt.maxBytes)
+			}
+			if !strings.HasPrefix(full, head) || !strings.HasSuffix(full, tail) || len(head) < len(tail) {
+				t.Errorf("got head %q and tail %q", head, tail)
+			}
+			if total != strconv.Itoa(len(full)) || dropped != strconv.Itoa(len(full)-len(head)-len(tail)) {
+				t.Errorf("marker says %s of %s bytes truncated, kept %d of %d", dropped, total, len(head)+len(tail), len(full))
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("split a rune: %q", got)
+			}
+		})
+	}
+}
+
+func TestRenderToolResultSpills(t *testing.T) {
+	content := strings.Repeat("abcdefghij", 300)
+	dirStore, err := NewDirStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		store Store
+		vecs  *vecStore
+	}{
+		"memory store":   {NewMemoryStore(10), nil},
+		"dir store":      {dirStore, nil},
+		"indexed pages":  {NewMemoryStore(10), &vecStore{}},
+		"indexing fails": {NewMemoryStore(10), &vecStore{err: errors.New("down")}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := []RendererConfigFunc{WithMaxBytes(1000), WithPageBytes(1024), WithStore(tt.store), WithReadToolName("readMore")}
+			if tt.vecs != nil {
+				opts = append(opts, WithVectorStore(tt.vecs))
+			}
+			r := NewRenderer(opts...)
+
+			got, err := r.RenderToolResult(context.Background(), call, content)
+			if tt.vecs != nil && tt.vecs.err != nil {
+				if err == nil || !strings.Contains(err.Error(), "error indexing result of search") {
+					t.Errorf("got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			m := spillNote.FindStringSubmatch(got)
+			if m == nil {
+				t.Fatalf("no spill note in %q", got)
+			}
+			head := strings.TrimSuffix(got, m[0])
+			if len(got) > 1000 || !strings.HasPrefix(content, head) || m[1] != "3000" || m[2] != strconv.Itoa(len(head)) || m[5] != m[2] || m[3] != "readMore" {
+				t.Errorf("got %d bytes ending in %q", len(got), m[0])
+			}
+
+			stored, err := tt.store.Get(context.Background(), m[4])
+			if err != nil || stored != content {
+				t.Errorf("stored %d bytes, %v", len(stored), err)
+			}
+			if tt.vecs != nil && (len(tt.vecs.contents) != 3 || strings.Join(tt.vecs.contents, "") != content) {
+				t.Errorf("indexed %d pages", len(tt.vecs.contents))
+			}
+		})
+	}
+
+	_, err = NewRenderer(WithMaxBytes(10), WithStore(failingStore{})).RenderToolResult(context.Background(), call, content)
+	if err == nil || !strings.Contains(err.Error(), "error storing result of search: disk full") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestPages(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		size    int
+		want    []string
+	}{
+		"empty":           {"", 4, []string{}},
+		"exact":           {"abcdefgh", 4, []string{"abcd", "efgh"}},
+		"remainder":       {"abcdefghi", 4, []string{"abcd", "efgh", "i"}},
+		"runes kept":      {"aéé", 2, []string{"a", "é", "é"}},
+		"page below rune": {"日本", 1, []string{"日", "本"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := pages(tt.content, tt.size)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") || len(got) != len(tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package toolresult
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned for unknown or evicted handles
+var ErrNotFound = errors.New("tool result not found")
+
+// Store keeps the full content of spilled tool results
+type Store interface {
+	// Put stores content and returns the handle it can be read back with
+	Put(ctx context.Context, content string) (string, error)
+
+	// Get returns the content stored under handle
+	Get(ctx context.Context, handle string) (string, error)
+}
+
+// newHandle returns a random, opaque handle
+func newHandle() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return "tr_" + hex.EncodeToString(b), nil
+}
+
+// MemoryStore is an in memory Store holding a bounded number of results.
+// The oldest result is evicted first.
+type MemoryStore struct {
+	mu         sync.Mutex
+	results    map[string]string
+	order      []string
+	maxEntries int
+}
+
+// NewMemoryStore returns a MemoryStore keeping at most maxEntries results.
+// A non positive maxEntries keeps everything.
+func NewMemoryStore(maxEntries int) *MemoryStore {
+	return &MemoryStore{
+		results:    map[string]string{},
+		maxEntries: maxEntries,
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, content string) (string, error) {
+	handle, err := newHandle()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results[handle] = content
+	s.order = append(s.order, handle)
+
+	for s.maxEntries > 0 && len(s.order) > s.maxEntries {
+		delete(s.results, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	return handle, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, handle string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.results[handle]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, handle)
+	}
+
+	return content, nil
+}
+
+// DirStore is a Store keeping one file per result in a directory, so that
+// results survive restarts and do not weigh on memory
+type DirStore struct {
+	dir string
+}
+
+// NewDirStore returns a DirStore writing to dir, creating it if needed
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating result store directory: %w", err)
+	}
+
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) Put(ctx context.Context, content string) (string, error) {
+	handle, err := newHandle()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(s.path(handle), []byte(content), 0o644); err != nil {
+		return "", fmt.Errorf("error writing tool result: %w", err)
+	}
+
+	return handle, nil
+}
+
+func (s *DirStore) Get(ctx context.Context, handle string) (string, error) {
+	// handles come from the LLM, never let them name another file
+	if !strings.HasPrefix(handle, "tr_") || strings.ContainsAny(handle, `/\.`) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, handle)
+	}
+
+	content, err := os.ReadFile(s.path(handle))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, handle)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading tool result: %w", err)
+	}
+
+	return string(content), nil
+}
+
+func (s *DirStore) path(handle string) string {
+	return filepath.Join(s.dir, handle+".txt")
+}
@@ -0,0 +1,73 @@
+package toolresult
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryStoreEvictsOldest(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2)
+
+	var handles []string
+	for _, content := range []string{"a", "b", "c"} {
+		handle, err := s.Put(ctx, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, handle)
+	}
+
+	if _, err := s.Get(ctx, handles[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for the oldest result, want ErrNotFound", err)
+	}
+	for i, want := range []string{"b", "c"} {
+		if got, err := s.Get(ctx, handles[i+1]); got != want || err != nil {
+			t.Errorf("got %q, %v, want %q", got, err, want)
+		}
+	}
+
+	unbounded := NewMemoryStore(0)
+	first, _ := unbounded.Put(ctx, "first")
+	for i := 0; i < 100; i++ {
+		unbounded.Put(ctx, "more")
+	}
+	if got, err := unbounded.Get(ctx, first); got != "first" || err != nil {
+		t.Errorf("got %q, %v without a bound", got, err)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "results")
+
+	s, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handle, err := s.Put(ctx, "stored content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// results survive the store
+	reopened, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reopened.Get(ctx, handle); got != "stored content" || err != nil {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dir), "tr_secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, handle := range []string{"tr_0000000000000000", "secret", "tr_../tr_secret", `tr_..\tr_secret`, "tr_x.txt", ""} {
+		if got, err := s.Get(ctx, handle); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) = %q, %v, want ErrNotFound", handle, got, err)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package toolresult
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Tools returns the readToolResult tool when results are spilled to a store
+// and nothing otherwise. The agent registers these tools automatically.
+func (r *Renderer) Tools() []*core.Tool {
+	if r.store == nil {
+		return nil
+	}
+
+	wrapped, err := core.WrapToolFunction(r.ReadToolResult)
+	if err != nil {
+		panic(err)
+	}
+
+	return []*core.Tool{
+		{
+			Name: r.readToolName,
+			Description: "Reads a page of a tool result that was too large to return at once. " +
+				"Use the handle and offset given at the end of the truncated result.",
+			WrappedToolFunction: wrapped,
+			JSONSchema:          []byte(readToolResultSchema),
+		},
+	}
+}
+
+const readToolResultSchema = `{
+  "type": "object",
+  "properties": {
+    "handle": {"type": "string", "description": "Handle of the stored result"},
+    "offset": {"type": "integer", "description": "Byte offset to start reading from"},
+    "limit": {"type": "integer", "description": "Maximum number of bytes to read"}
+  },
+  "required": ["handle"]
+}`
+
+type ReadToolResultArgs struct {
+	Handle string `json:"handle"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+// ReadToolResult returns a page of a stored result followed by a note with
+// the offset of the next page, if any
+func (r *Renderer) ReadToolResult(ctx context.Context, args *ReadToolResultArgs) (string, error) {
+	if r.store == nil {
+		return "", errors.New("no tool result store configured")
+	}
+
+	content, err := r.store.Get(ctx, args.Handle)
+	if err != nil {
+		return "", err
+	}
+
+	if args.Offset < 0 || args.Offset > len(content) {
+		return "", fmt.Errorf("offset %d out of range, result is %d bytes", args.Offset, len(content))
+	}
+
+	limit := r.pageBytes
+	if args.Limit > 0 {
+		limit = min(args.Limit, r.pageBytes)
+	}
+
+	// an offset pointing into a multi byte rune moves to the next rune
+	start := len(content) - len(cutTail(content, len(content)-args.Offset))
+	page := cut(content[start:], limit)
+	if page == "" && start < len(content) {
+		// limit is smaller than a single rune
+		_, n := utf8.DecodeRuneInString(content[start:])
+		page = content[start : start+n]
+	}
+	end := start + len(page)
+
+	if end >= len(content) {
+		return page + fmt.Sprintf("\n[end of result, bytes %d-%d of %d]", start, end, len(content)), nil
+	}
+
+	return page + fmt.Sprintf("\n[bytes %d-%d of %d, continue with offset %d]", start, end, len(content), end), nil
+}
@@ -0,0 +1,152 @@
+package toolresult
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pageNote matches the note ending a page that is not the last
+var pageNote = regexp.MustCompile(`\n\[bytes (\d+)-(\d+) of (\d+), continue with offset (\d+)\]$`)
+
+// endNote matches the note ending the last page
+var endNote = regexp.MustCompile(`\n\[end of result, bytes (\d+)-(\d+) of (\d+)\]$`)
+
+func newReader(t *testing.T, content string, opts ...RendererConfigFunc) (*Renderer, string) {
+	t.Helper()
+
+	store := NewMemoryStore(0)
+	handle, err := store.Put(context.Background(), content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewRenderer(append([]RendererConfigFunc{WithStore(store)}, opts...)...), handle
+}
+
+func TestReadToolResultPages(t *testing.T) {
+	tests := map[string]struct {
+		content   string
+		pageBytes int
+		limit     int
+		pages     int
+	}{
+		"one page":         {"short", 100, 0, 1},
+		"default limit":    {strings.Repeat("abcde", 10), 20, 0, 3},
+		"smaller limit":    {strings.Repeat("abcde", 10), 20, 10, 5},
+		"limit capped":     {strings.Repeat("abcde", 10), 20, 1000, 3},
+		"multi byte":       {strings.Repeat("aé日", 10), 5, 0, 15},
+		"limit below rune": {"日本語", 100, 1, 3},
+		"page of one rune": {"日本語", 3, 0, 3},
+		"empty result":     {"", 10, 0, 1},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r, handle := newReader(t, tt.content, WithPageBytes(tt.pageBytes))
+
+			var read strings.Builder
+			offset := 0
+			for i := 0; ; i++ {
+				if i == tt.pages {
+					t.Fatalf("more than %d pages, read %q", tt.pages, read.String())
+				}
+
+				out, err := r.ReadToolResult(context.Background(), &ReadToolResultArgs{Handle: handle, Offset: offset, Limit: tt.limit})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if m := endNote.FindStringSubmatch(out); m != nil {
+					read.WriteString(strings.TrimSuffix(out, m[0]))
+					if i != tt.pages-1 || m[1] != strconv.Itoa(offset) || m[2] != m[3] || m[3] != strconv.Itoa(len(tt.content)) {
+						t.Errorf("page %d ends with %q", i, m[0])
+					}
+					break
+				}
+
+				m := pageNote.FindStringSubmatch(out)
+				if m == nil {
+					t.Fatalf("no note in %q", out)
+				}
+				page := strings.TrimSuffix(out, m[0])
+				if m[1] != strconv.Itoa(offset) || m[2] != m[4] || m[4] != strconv.Itoa(offset+len(page)) || m[3] != strconv.Itoa(len(tt.content)) {
+					t.Errorf("page %q of bytes %d-%d ends with %q", page, offset, offset+len(page), m[0])
+				}
+				read.WriteString(page)
+				offset += len(page)
+			}
+
+			if read.String() != tt.content {
+				t.Errorf("read %q, want %q", read.String(), tt.content)
+			}
+		})
+	}
+}
+
+func TestReadToolResultOffsets(t *testing.T) {
+	r, handle := newReader(t, "aé日b", WithPageBytes(100))
+
+	tests := map[string]struct {
+		offset int
+		want   string
+		err    string
+	}{
+		"start":            {0, "aé日b\n[end of result, bytes 0-7 of 7]", ""},
+		"inside a rune":    {2, "日b\n[end of result, bytes 3-7 of 7]", ""},
+		"inside last rune": {4, "b\n[end of result, bytes 6-7 of 7]", ""},
+		"at the end":       {7, "\n[end of result, bytes 7-7 of 7]", ""},
+		"past the end":     {8, "", "offset 8 out of range, result is 7 bytes"},
+		"negative":         {-1, "", "offset -1 out of range, result is 7 bytes"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := r.ReadToolResult(context.Background(), &ReadToolResultArgs{Handle: handle, Offset: tt.offset})
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("got %q, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := r.ReadToolResult(context.Background(), &ReadToolResultArgs{Handle: "tr_unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v for an unknown handle, want ErrNotFound", err)
+	}
+	if _, err := NewRenderer().ReadToolResult(context.Background(), &ReadToolResultArgs{Handle: handle}); err == nil {
+		t.Error("read without a store")
+	}
+}
+
+func TestTools(t *testing.T) {
+	if tools := NewRenderer().Tools(); tools != nil {
+		t.Errorf("got %d tools without a store", len(tools))
+	}
+
+	r, handle := newReader(t, "stored", WithReadToolName("readMore"))
+	tools := r.Tools()
+	if len(tools) != 1 || tools[0].Name != "readMore" || !json.Valid(tools[0].JSONSchema) {
+		t.Fatalf("got tools %+v", tools)
+	}
+
+	args, _ := json.Marshal(&ReadToolResultArgs{Handle: handle})
+	got, err := tools[0].WrappedToolFunction(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "stored\n[end of result, bytes 0-6 of 6]" {
+		t.Errorf("got %v", got)
+	}
+}
@@ -1,10 +1,325 @@
 package agent
 
-import "github.com/joaopandolfi/core"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+)
+
+var (
+	// ErrDuplicateTool is returned when registering a tool whose name is taken
+	ErrDuplicateTool = errors.New("duplicate tool name")
+
+	// ErrToolNotFound is returned when a name or pattern matches no tool
+	ErrToolNotFound = errors.New("tool not found")
+)
 
 type ToolMap map[string]*core.Tool
 
-// GetTools returns the current set of available tools
-func (a *Agent) GetTools() []*core.Tool {
+// ToolInfo describes a registered tool
+type ToolInfo struct {
+	Name    string
+	Group   string
+	Enabled bool
+}
+
+type registryEntry struct {
+	tool    *core.Tool
+	group   string
+	enabled bool
+}
+
+// ToolRegistry holds the tools of an agent. Tools are listed sorted by name so
+// that the tools sent to a provider are identical from one step to the next.
+// Tools can be organised in groups and disabled without being removed.
+//
+// Methods taking patterns accept a tool name, "group.*" for every tool of a
+// group, "group.name" for a single tool of a group, or "*" for every tool.
+//
+// A ToolRegistry is safe for concurrent use.
+type ToolRegistry struct {
+	mu      sync.RWMutex
+	entries map[string]*registryEntry
+}
+
+// NewToolRegistry returns a registry holding the given tools
+func NewToolRegistry(tools ...*core.Tool) (*ToolRegistry, error) {
+	r := &ToolRegistry{entries: map[string]*registryEntry{}}
+
+	if err := r.Add(tools...); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Add registers enabled, ungrouped tools. Either all tools are added or, if
+// any is invalid or its name is taken, none is.
+func (r *ToolRegistry) Add(tools ...*core.Tool) error {
+	return r.AddGroup("", tools...)
+}
+
+// AddGroup registers enabled tools as members of a group
+func (r *ToolRegistry) AddGroup(group string, tools ...*core.Tool) error {
+	if strings.ContainsAny(group, ".*") {
+		return fmt.Errorf("invalid group name %q", group)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, tool := range tools {
+		if err := validateTool(tool); err != nil {
+			return err
+		}
+		if _, ok := r.entries[tool.Name]; ok || seen[tool.Name] {
+			return fmt.Errorf("%w: %s", ErrDuplicateTool, tool.Name)
+		}
+		seen[tool.Name] = true
+	}
+
+	for _, tool := range tools {
+		r.entries[tool.Name] = &registryEntry{tool: tool, group: group, enabled: true}
+	}
+
+	return nil
+}
+
+func validateTool(tool *core.Tool) error {
+	if tool == nil {
+		return errors.New("tool must not be nil")
+	}
+
+	if tool.Name == "" {
+		return errors.New("tool must have a name")
+	}
+
+	if tool.WrappedToolFunction == nil {
+		return fmt.Errorf("tool %s must have a function", tool.Name)
+	}
+
+	return nil
+}
+
+// Remove unregisters every tool matched by the patterns
+func (r *ToolRegistry) Remove(patterns ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names, err := r.match(patterns)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		delete(r.entries, name)
+	}
+
+	return nil
+}
+
+// Enable makes the tools matched by the patterns available again
+func (r *ToolRegistry) Enable(patterns ...string) error {
+	return r.setEnabled(patterns, true)
+}
+
+// Disable hides the tools matched by the patterns from the LLM and refuses
+// calls to them, without unregistering them
+func (r *ToolRegistry) Disable(patterns ...string) error {
+	return r.setEnabled(patterns, false)
+}
+
+func (r *ToolRegistry) setEnabled(patterns []string, enabled bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names, err := r.match(patterns)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		r.entries[name].enabled = enabled
+	}
+
 	return nil
 }
+
+// match resolves patterns to tool names. Every pattern must match at least
+// one tool. The caller must hold the lock.
+func (r *ToolRegistry) match(patterns []string) ([]string, error) {
+	names := []string{}
+	for _, pattern := range patterns {
+		matched := false
+		for name, e := range r.entries {
+			if matchPattern(pattern, name, e.group) {
+				names = append(names, name)
+				matched = true
+			}
+		}
+
+		if !matched {
+			return nil, fmt.Errorf("%w: %s", ErrToolNotFound, pattern)
+		}
+	}
+
+	return names, nil
+}
+
+func matchPattern(pattern, name, group string) bool {
+	if pattern == "*" || pattern == name {
+		return true
+	}
+
+	g, rest, ok := strings.Cut(pattern, ".")
+	if !ok || g != group {
+		return false
+	}
+
+	return rest == "*" || rest == name
+}
+
+// Get returns an enabled tool by name
+func (r *ToolRegistry) Get(name string) (*core.Tool, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.entries[name]
+	if !ok || !e.enabled {
+		return nil, false
+	}
+
+	return e.tool, true
+}
+
+// Tools returns the enabled tools sorted by name
+func (r *ToolRegistry) Tools() []*core.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tools := make([]*core.Tool, 0, len(r.entries))
+	for _, e := range r.entries {
+		if e.enabled {
+			tools = append(tools, e.tool)
+		}
+	}
+
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
+
+	return tools
+}
+
+// Map returns the enabled tools keyed by name
+func (r *ToolRegistry) Map() ToolMap {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m := ToolMap{}
+	for name, e := range r.entries {
+		if e.enabled {
+			m[name] = e.tool
+		}
+	}
+
+	return m
+}
+
+// List describes every registered tool, enabled or not, sorted by name
+func (r *ToolRegistry) List() []*ToolInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]*ToolInfo, 0, len(r.entries))
+	for name, e := range r.entries {
+		infos = append(infos, &ToolInfo{Name: name, Group: e.group, Enabled: e.enabled})
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+
+	return infos
+}
+
+// Clone returns an independent copy of the registry, i.e., to derive a tool
+// set for another run
+func (r *ToolRegistry) Clone() *ToolRegistry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c := &ToolRegistry{entries: make(map[string]*registryEntry, len(r.entries))}
+	for name, e := range r.entries {
+		copied := *e
+		c.entries[name] = &copied
+	}
+
+	return c
+}
+
+// Tools returns the agent's tool registry
+func (a *Agent) Tools() *ToolRegistry {
+	return a.tools.Load()
+}
+
+// SwapTools replaces the agent's tool registry and returns the previous one.
+// Steps already in flight keep the registry they started with: the tools
+// offered to the LLM and the tools its calls run come from the same registry.
+// Tools added to or removed from that registry in place do show up mid-step.
+func (a *Agent) SwapTools(r *ToolRegistry) *ToolRegistry {
+	return a.tools.Swap(r)
+}
+
+type stepToolsKey struct{}
+
+// withStepTools pins the agent's current registry for the step run with ctx
+func (a *Agent) withStepTools(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stepToolsKey{}, a.Tools())
+}
+
+// stepTools returns the registry pinned for the step of ctx, the agent's
+// current registry outside of a step
+func (a *Agent) stepTools(ctx context.Context) *ToolRegistry {
+	if r, ok := ctx.Value(stepToolsKey{}).(*ToolRegistry); ok {
+		return r
+	}
+
+	return a.Tools()
+}
+
+// GetTools returns the current set of enabled tools sorted by name
+func (a *Agent) GetTools() []*core.Tool {
+	return a.Tools().Tools()
+}
+
+// AddTool adds a tool to the agent's available tools
+func (a *Agent) AddTool(tool *core.Tool) error {
+	return a.Tools().Add(tool)
+}
+
+// AddToolGroup adds tools to the agent as members of a group
+func (a *Agent) AddToolGroup(group string, tools ...*core.Tool) error {
+	return a.Tools().AddGroup(group, tools...)
+}
+
+// RemoveTool removes the tools matched by the patterns
+func (a *Agent) RemoveTool(patterns ...string) error {
+	return a.Tools().Remove(patterns...)
+}
+
+// EnableTool enables the tools matched by the patterns
+func (a *Agent) EnableTool(patterns ...string) error {
+	return a.Tools().Enable(patterns...)
+}
+
+// DisableTool disables the tools matched by the patterns
+func (a *Agent) DisableTool(patterns ...string) error {
+	return a.Tools().Disable(patterns...)
+}
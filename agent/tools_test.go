@@ -0,0 +1,271 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/agent/bootstrap"
+)
+
+func namedTool(name string) *core.Tool {
+	return &core.Tool{
+		Name: name,
+		WrappedToolFunction: func(ctx context.Context, args []byte) (interface{}, error) {
+			return name, nil
+		},
+	}
+}
+
+func toolNames(tools []*core.Tool) string {
+	names := make([]string, len(tools))
+	for i, tool := range tools {
+		names[i] = tool.Name
+	}
+
+	return strings.Join(names, ",")
+}
+
+func newRegistry(t *testing.T) *ToolRegistry {
+	t.Helper()
+
+	r, err := NewToolRegistry(namedTool("zeta"), namedTool("alpha"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddGroup("fs", namedTool("read"), namedTool("write")); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddGroup("web", namedTool("fetch")); err != nil {
+		t.Fatal(err)
+	}
+
+	return r
+}
+
+func TestToolRegistryOrder(t *testing.T) {
+	r := newRegistry(t)
+
+	for i := 0; i < 10; i++ {
+		if got := toolNames(r.Tools()); got != "alpha,fetch,read,write,zeta" {
+			t.Fatalf("got %s", got)
+		}
+	}
+
+	infos := r.List()
+	if len(infos) != 5 || infos[0].Name != "alpha" || infos[2].Name != "read" || infos[2].Group != "fs" {
+		t.Errorf("got %+v", infos)
+	}
+}
+
+func TestToolRegistryDuplicates(t *testing.T) {
+	r := newRegistry(t)
+
+	tests := map[string][]*core.Tool{
+		"registered name":   {namedTool("alpha")},
+		"within the call":   {namedTool("beta"), namedTool("beta")},
+		"name of a group's": {namedTool("read")},
+	}
+	for name, tools := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := r.Add(tools...); !errors.Is(err, ErrDuplicateTool) {
+				t.Errorf("got %v, want ErrDuplicateTool", err)
+			}
+		})
+	}
+
+	// failed additions add nothing
+	if _, ok := r.Get("beta"); ok {
+		t.Error("beta was added")
+	}
+	if _, err := NewToolRegistry(namedTool("a"), namedTool("a")); !errors.Is(err, ErrDuplicateTool) {
+		t.Errorf("got %v, want ErrDuplicateTool", err)
+	}
+	if err := r.AddGroup("bad.group", namedTool("x")); err == nil {
+		t.Error("group name with a dot accepted")
+	}
+	if err := r.Add(&core.Tool{Name: "nofunc"}); err == nil {
+		t.Error("tool without a function accepted")
+	}
+}
+
+func TestToolRegistryPatterns(t *testing.T) {
+	tests := map[string]struct {
+		patterns []string
+		want     string
+		err      error
+	}{
+		"name":            {[]string{"alpha"}, "fetch,read,write,zeta", nil},
+		"name in a group": {[]string{"read"}, "alpha,fetch,write,zeta", nil},
+		"group":           {[]string{"fs.*"}, "alpha,fetch,zeta", nil},
+		"group and name":  {[]string{"fs.write"}, "alpha,fetch,read,zeta", nil},
+		"everything":      {[]string{"*"}, "", nil},
+		"several":         {[]string{"web.*", "zeta"}, "alpha,read,write", nil},
+		"wrong group":     {[]string{"web.read"}, "", ErrToolNotFound},
+		"unknown group":   {[]string{"db.*"}, "", ErrToolNotFound},
+		"unknown name":    {[]string{"alpha", "nope"}, "", ErrToolNotFound},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := newRegistry(t)
+
+			err := r.Disable(tt.patterns...)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				// nothing is disabled when a pattern matches nothing
+				if got := toolNames(r.Tools()); got != "alpha,fetch,read,write,zeta" {
+					t.Errorf("got %s after a failed Disable", got)
+				}
+				return
+			}
+
+			if got := toolNames(r.Tools()); got != tt.want {
+				t.Errorf("enabled %s, want %s", got, tt.want)
+			}
+			for _, info := range r.List() {
+				if _, ok := r.Get(info.Name); ok != info.Enabled {
+					t.Errorf("Get(%s) = %v, listed as enabled %v", info.Name, ok, info.Enabled)
+				}
+			}
+
+			if err := r.Enable(tt.patterns...); err != nil {
+				t.Fatal(err)
+			}
+			if got := toolNames(r.Tools()); got != "alpha,fetch,read,write,zeta" {
+				t.Errorf("got %s after Enable", got)
+			}
+
+			if err := r.Remove(tt.patterns...); err != nil {
+				t.Fatal(err)
+			}
+			if got := toolNames(r.Tools()); got != tt.want {
+				t.Errorf("kept %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolRegistryClone(t *testing.T) {
+	r := newRegistry(t)
+	if err := r.Disable("zeta"); err != nil {
+		t.Fatal(err)
+	}
+
+	c := r.Clone()
+	if err := c.Enable("zeta"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Remove("fs.*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add(namedTool("beta")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := toolNames(r.Tools()); got != "alpha,fetch,read,write" {
+		t.Errorf("original changed to %s", got)
+	}
+	if got := toolNames(c.Tools()); got != "alpha,beta,fetch,zeta" {
+		t.Errorf("clone has %s", got)
+	}
+}
+
+func TestToolRegistryConcurrent(t *testing.T) {
+	r := newRegistry(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				name := fmt.Sprintf("tool-%d-%d", i, j)
+				if err := r.Add(namedTool(name)); err != nil {
+					t.Error(err)
+					return
+				}
+				r.Tools()
+				r.Map()
+				r.List()
+				r.Get(name)
+				if err := r.Disable(name); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := r.Remove(name); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := toolNames(r.Tools()); got != "alpha,fetch,read,write,zeta" {
+		t.Errorf("got %s", got)
+	}
+}
+
+// swappingProvider swaps the tools of the agent while a step is in flight and
+// asks for a call of a tool of the registry the step started with
+type swappingProvider struct {
+	core.Provider
+	agent *Agent
+	swap  *ToolRegistry
+	steps int
+}
+
+func (p *swappingProvider) Generate(ctx context.Context, opts *core.GenerateOptions) (*core.Message, error) {
+	p.steps++
+	if p.steps > 1 {
+		return &core.Message{Role: core.AssistantMessageRole, Content: "done"}, nil
+	}
+
+	p.agent.SwapTools(p.swap)
+	return &core.Message{
+		Role:      core.AssistantMessageRole,
+		ToolCalls: []*core.ToolCall{{ID: "1", Name: "alpha", Arguments: []byte(`{}`)}},
+	}, nil
+}
+
+func TestSwapToolsKeepsStepRegistry(t *testing.T) {
+	logger := logr.Discard()
+	provider := &swappingProvider{swap: &ToolRegistry{entries: map[string]*registryEntry{}}}
+	a, err := NewAgent(
+		bootstrap.WithProvider(provider),
+		bootstrap.WithTools(namedTool("alpha")),
+		bootstrap.WithLogger(&logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.agent = a
+
+	agg, err := a.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result *core.ToolResult
+	for _, m := range agg.Messages {
+		if len(m.ToolResult) > 0 {
+			result = m.ToolResult[0]
+		}
+	}
+	if result == nil || result.Error != "" || result.Content != "alpha" {
+		t.Errorf("got tool result %+v, want the call to run on the step's registry", result)
+	}
+	if got := toolNames(a.GetTools()); got != "" {
+		t.Errorf("the next steps offer %s, want the swapped registry", got)
+	}
+}
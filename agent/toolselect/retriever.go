@@ -0,0 +1,342 @@
+package toolselect
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Retriever is a core.ToolSelector for large tool catalogues. It embeds the
+// name and description of every tool once and, at each step, offers the LLM
+// the tools most similar to the recent conversation, along with pinned tools,
+// tools the LLM found through the search tool and the search tool itself.
+//
+// Tools found through the search tool stay offered for the rest of the agent
+// run that found them (see core.RunID), so that runs sharing a Retriever do
+// not see each other's tools.
+type Retriever struct {
+	embedder       core.Embedder
+	topK           int
+	pinned         []string
+	queryMessages  int
+	searchToolName string
+	logger         *logr.Logger
+
+	mu        sync.Mutex
+	vectors   map[string]*toolVector
+	catalogue []*core.Tool
+	activated map[string]map[string]bool
+	runs      []string
+}
+
+// maxActiveRuns bounds how many runs the activated tools are remembered for,
+// since the Retriever is not told when a run ends
+const maxActiveRuns = 256
+
+// toolVector is the embedding of a tool, along with the text it was computed
+// from so that changed descriptions are re-embedded
+type toolVector struct {
+	text   string
+	vector core.Vec32
+}
+
+// RetrieverConfig holds configuration for a Retriever
+type RetrieverConfig struct {
+	// TopK is the number of retrieved tools offered at each step
+	// default 8
+	TopK int
+
+	// Pinned names tools that are offered at every step
+	Pinned []string
+
+	// QueryMessages is how many of the most recent messages make up the
+	// retrieval query
+	// default 3
+	QueryMessages int
+
+	// SearchToolName is the name of the tool searching the catalogue
+	// default "searchTools"
+	SearchToolName string
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// RetrieverConfigFunc is a function type that modifies RetrieverConfig
+type RetrieverConfigFunc func(*RetrieverConfig)
+
+func WithTopK(k int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.TopK = k
+	}
+}
+
+// WithPinned always offers the named tools
+func WithPinned(name ...string) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Pinned = append(conf.Pinned, name...)
+	}
+}
+
+func WithQueryMessages(n int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.QueryMessages = n
+	}
+}
+
+func WithSearchToolName(name string) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.SearchToolName = name
+	}
+}
+
+func WithLogger(l *logr.Logger) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewRetriever returns a new Retriever embedding tools with embedder
+func NewRetriever(embedder core.Embedder, opts ...RetrieverConfigFunc) *Retriever {
+	discard := logr.Discard()
+	conf := &RetrieverConfig{
+		TopK:           8,
+		QueryMessages:  3,
+		SearchToolName: "searchTools",
+		Logger:         &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Retriever{
+		embedder:       embedder,
+		topK:           conf.TopK,
+		pinned:         conf.Pinned,
+		queryMessages:  conf.QueryMessages,
+		searchToolName: conf.SearchToolName,
+		logger:         conf.Logger,
+		vectors:        map[string]*toolVector{},
+		activated:      map[string]map[string]bool{},
+	}
+}
+
+// SelectTools implements core.ToolSelector. The returned tools are sorted by
+// name so that prompts stay stable between steps.
+func (r *Retriever) SelectTools(ctx context.Context, messages []*core.Message, tools []*core.Tool) ([]*core.Tool, error) {
+	catalogue := make([]*core.Tool, 0, len(tools))
+	for _, t := range tools {
+		if t.Name != r.searchToolName {
+			catalogue = append(catalogue, t)
+		}
+	}
+
+	r.mu.Lock()
+	r.catalogue = catalogue
+	r.mu.Unlock()
+
+	// small catalogues are sent whole
+	if len(catalogue) <= r.topK+len(r.pinned) {
+		return tools, nil
+	}
+
+	query := queryText(messages, r.queryMessages)
+	if query == "" {
+		return tools, nil
+	}
+
+	ranked, err := r.rank(ctx, query, catalogue)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{r.searchToolName: true}
+	for _, name := range r.pinned {
+		selected[name] = true
+	}
+
+	r.mu.Lock()
+	for name := range r.activated[core.RunID(ctx)] {
+		selected[name] = true
+	}
+	r.mu.Unlock()
+
+	for _, s := range ranked[:min(r.topK, len(ranked))] {
+		selected[s.tool.Name] = true
+	}
+
+	out := []*core.Tool{}
+	for _, t := range tools {
+		if selected[t.Name] {
+			out = append(out, t)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+
+	r.logger.V(1).Info("selected tools", "count", len(out), "catalogue", len(catalogue))
+
+	return out, nil
+}
+
+// Reset forgets the tools activated through the search tool, in every run
+func (r *Retriever) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.activated = map[string]map[string]bool{}
+	r.runs = nil
+}
+
+// activate offers the named tools for the rest of the run of ctx. It must be
+// called with mu held.
+func (r *Retriever) activate(ctx context.Context, names []string) {
+	run := core.RunID(ctx)
+	activated, ok := r.activated[run]
+	if !ok {
+		activated = map[string]bool{}
+		r.activated[run] = activated
+		r.runs = append(r.runs, run)
+
+		if len(r.runs) > maxActiveRuns {
+			delete(r.activated, r.runs[0])
+			r.runs = r.runs[1:]
+		}
+	}
+
+	for _, name := range names {
+		activated[name] = true
+	}
+}
+
+type scoredTool struct {
+	tool  *core.Tool
+	score float32
+}
+
+// rank orders tools by descending similarity to the query
+func (r *Retriever) rank(ctx context.Context, query string, tools []*core.Tool) ([]*scoredTool, error) {
+	if err := r.embedTools(ctx, tools); err != nil {
+		return nil, err
+	}
+
+	q, err := r.embedder.GenerateEmbedding(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding tool query: %w", err)
+	}
+
+	r.mu.Lock()
+	scored := make([]*scoredTool, 0, len(tools))
+	for _, t := range tools {
+		scored = append(scored, &scoredTool{tool: t, score: cosine(q.Vector, r.vectors[t.Name].vector)})
+	}
+	r.mu.Unlock()
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		return scored[i].score > scored[j].score
+	})
+
+	return scored, nil
+}
+
+// embedTools embeds the tools that are new or whose description changed, in
+// a single call when the embedder is a core.BatchEmbedder
+func (r *Retriever) embedTools(ctx context.Context, tools []*core.Tool) error {
+	r.mu.Lock()
+	missing := []*core.Tool{}
+	texts := []string{}
+	for _, t := range tools {
+		if v, ok := r.vectors[t.Name]; !ok || v.text != toolText(t) {
+			missing = append(missing, t)
+			texts = append(texts, toolText(t))
+		}
+	}
+	r.mu.Unlock()
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	vectors := make([]core.Vec32, len(missing))
+	if batch, ok := r.embedder.(core.BatchEmbedder); ok {
+		embeddings, err := batch.GenerateEmbeddings(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("error embedding tools: %w", err)
+		}
+		if len(embeddings) != len(texts) {
+			return fmt.Errorf("error embedding tools: got %d embeddings for %d tools", len(embeddings), len(texts))
+		}
+		for i, e := range embeddings {
+			vectors[i] = e.Vector
+		}
+	} else {
+		for i, t := range missing {
+			e, err := r.embedder.GenerateEmbedding(ctx, texts[i])
+			if err != nil {
+				return fmt.Errorf("error embedding tool %s: %w", t.Name, err)
+			}
+			vectors[i] = e.Vector
+		}
+	}
+
+	r.mu.Lock()
+	for i, t := range missing {
+		r.vectors[t.Name] = &toolVector{text: texts[i], vector: vectors[i]}
+	}
+	r.mu.Unlock()
+
+	return nil
+}
+
+// toolText is the text a tool is embedded from
+func toolText(t *core.Tool) string {
+	return t.Name + ": " + t.Description
+}
+
+// queryText joins the content of the most recent user, assistant and tool
+// messages, newest last
+func queryText(messages []*core.Message, n int) string {
+	parts := []string{}
+	for i := len(messages) - 1; i >= 0 && len(parts) < n; i-- {
+		m := messages[i]
+		if m == nil || m.Role == core.SystemMessageRole || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		parts = append(parts, m.Content)
+	}
+
+	slices.Reverse(parts)
+
+	return strings.Join(parts, "\n")
+}
+
+func cosine(a, b core.Vec32) float32 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+
+	if na == 0 || nb == 0 {
+		return 0
+	}
+
+	return float32(dot / (math.Sqrt(na) * math.Sqrt(nb)))
+}
@@ -0,0 +1,114 @@
+package toolselect
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/embedder"
+)
+
+// countingEmbedder counts the calls made to a batch embedder
+type countingEmbedder struct {
+	*embedder.HashingEmbedder
+	single atomic.Int64
+	batch  atomic.Int64
+}
+
+func (c *countingEmbedder) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	c.single.Add(1)
+	return c.HashingEmbedder.GenerateEmbedding(ctx, content)
+}
+
+func (c *countingEmbedder) GenerateEmbeddings(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	c.batch.Add(1)
+	return c.HashingEmbedder.GenerateEmbeddings(ctx, contents)
+}
+
+func catalogue(n int) []*core.Tool {
+	tools := make([]*core.Tool, 0, n)
+	for i := 0; i < n; i++ {
+		tools = append(tools, &core.Tool{
+			Name:        fmt.Sprintf("tool%02d", i),
+			Description: fmt.Sprintf("handles topic %d", i),
+		})
+	}
+	tools = append(tools, &core.Tool{Name: "weather", Description: "gets the weather forecast of a city"})
+
+	return tools
+}
+
+func names(tools []*core.Tool) map[string]bool {
+	m := map[string]bool{}
+	for _, t := range tools {
+		m[t.Name] = true
+	}
+	return m
+}
+
+func TestRetrieverBatchesToolEmbeddings(t *testing.T) {
+	emb := &countingEmbedder{HashingEmbedder: embedder.NewHashingEmbedder()}
+	r := NewRetriever(emb, WithTopK(2))
+	tools := append(catalogue(30), r.Tools()...)
+	messages := []*core.Message{{Role: core.UserMessageRole, Content: "what is the weather forecast"}}
+
+	for step := 0; step < 2; step++ {
+		selected, err := r.SelectTools(context.Background(), messages, tools)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := names(selected); !got["weather"] || !got["searchTools"] || len(got) != 3 {
+			t.Errorf("step %d: selected %v", step, got)
+		}
+	}
+
+	// the catalogue is embedded once, in one call; the query at every step
+	if got := emb.batch.Load(); got != 1 {
+		t.Errorf("%d batch calls, want 1", got)
+	}
+	if got := emb.single.Load(); got != 2 {
+		t.Errorf("%d single calls, want 2", got)
+	}
+}
+
+func TestRetrieverActivationIsScopedToRun(t *testing.T) {
+	r := NewRetriever(embedder.NewHashingEmbedder(), WithTopK(1))
+	tools := append(catalogue(30), r.Tools()...)
+	messages := []*core.Message{{Role: core.UserMessageRole, Content: "what is the weather forecast"}}
+
+	first := core.WithRunID(context.Background(), "first")
+	if _, err := r.SelectTools(first, messages, tools); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.SearchTools(first, &SearchToolsArgs{Query: "handles topic 7", Limit: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	selected, err := r.SelectTools(first, messages, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !names(selected)["tool07"] {
+		t.Errorf("activated tool not offered in its run: %v", names(selected))
+	}
+
+	second := core.WithRunID(context.Background(), "second")
+	selected, err = r.SelectTools(second, messages, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(selected)["tool07"] {
+		t.Errorf("tool activated by another run offered: %v", names(selected))
+	}
+
+	r.Reset()
+	selected, err = r.SelectTools(first, messages, tools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names(selected)["tool07"] {
+		t.Errorf("tool offered after Reset: %v", names(selected))
+	}
+}
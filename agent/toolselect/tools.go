@@ -0,0 +1,83 @@
+package toolselect
+
+import (
+	"context"
+	"errors"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Tools returns the search tool of the retriever. The agent registers it
+// automatically.
+func (r *Retriever) Tools() []*core.Tool {
+	wrapped, err := core.WrapToolFunction(r.SearchTools)
+	if err != nil {
+		panic(err)
+	}
+
+	return []*core.Tool{
+		{
+			Name: r.searchToolName,
+			Description: "Searches the full catalogue of tools, of which only a few are offered at a time. " +
+				"Tools found become available from the next step on.",
+			WrappedToolFunction: wrapped,
+			JSONSchema:          []byte(searchToolsSchema),
+		},
+	}
+}
+
+const searchToolsSchema = `{
+  "type": "object",
+  "properties": {
+    "query": {"type": "string", "description": "What the needed tool should do"},
+    "limit": {"type": "integer", "description": "Maximum number of tools to return, defaults to 5"}
+  },
+  "required": ["query"]
+}`
+
+type SearchToolsArgs struct {
+	Query string `json:"query"`
+	Limit int    `json:"limit"`
+}
+
+// ToolInfo describes a tool found by SearchTools
+type ToolInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SearchTools finds the catalogue entries most relevant to the query and
+// activates them, so that they are offered at every following step of the
+// current run
+func (r *Retriever) SearchTools(ctx context.Context, args *SearchToolsArgs) ([]*ToolInfo, error) {
+	if args.Query == "" {
+		return nil, errors.New("query must not be empty")
+	}
+
+	limit := args.Limit
+	if limit <= 0 {
+		limit = 5
+	}
+
+	r.mu.Lock()
+	catalogue := r.catalogue
+	r.mu.Unlock()
+
+	ranked, err := r.rank(ctx, args.Query, catalogue)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []*ToolInfo{}
+	names := []string{}
+	for _, s := range ranked[:min(limit, len(ranked))] {
+		found = append(found, &ToolInfo{Name: s.tool.Name, Description: s.tool.Description})
+		names = append(names, s.tool.Name)
+	}
+
+	r.mu.Lock()
+	r.activate(ctx, names)
+	r.mu.Unlock()
+
+	return found, nil
+}
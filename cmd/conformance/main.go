@@ -0,0 +1,162 @@
+// Command conformance runs the vector store conformance suite against the
+// in-repo stores and against the Qdrant and Chroma adapters backed by their
+// local stand-ins, under every metric the adapters support. It exits with a
+// non-zero status when any case fails.
+//
+//	go run ./cmd/conformance [-stores memory,qdrant] [-v]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/chroma"
+	"github.com/joaopandolfi/core/vectorstore/chroma/chromatest"
+	"github.com/joaopandolfi/core/vectorstore/conformance"
+	"github.com/joaopandolfi/core/vectorstore/disk"
+	"github.com/joaopandolfi/core/vectorstore/hnsw"
+	"github.com/joaopandolfi/core/vectorstore/memory"
+	"github.com/joaopandolfi/core/vectorstore/qdrant"
+	"github.com/joaopandolfi/core/vectorstore/qdrant/qdranttest"
+)
+
+type target struct {
+	name    string
+	factory conformance.Factory
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run runs the suite and returns the exit status
+func run() int {
+	only := flag.String("stores", "", "comma separated stores to run, all by default")
+	verbose := flag.Bool("v", false, "list every case")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	tmp, err := os.MkdirTemp("", "conformance")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer os.RemoveAll(tmp)
+
+	qdrantServer := qdranttest.NewServer()
+	defer qdrantServer.Close()
+	chromaServer := chromatest.NewServer()
+	defer chromaServer.Close()
+
+	targets := []*target{
+		{name: "memory", factory: func(ctx context.Context, e core.Embedder) (core.MutableVectorStorer, error) {
+			return memory.NewMemoryVectorStore(e), nil
+		}},
+		{name: "hnsw", factory: func(ctx context.Context, e core.Embedder) (core.MutableVectorStorer, error) {
+			return hnsw.NewHNSWVectorStore(e), nil
+		}},
+		{name: "disk", factory: func(ctx context.Context, e core.Embedder) (core.MutableVectorStorer, error) {
+			dir, err := os.MkdirTemp(tmp, "disk")
+			if err != nil {
+				return nil, err
+			}
+			return disk.NewDiskVectorStore(dir, e)
+		}},
+	}
+	for _, m := range []vectorstore.Metric{vectorstore.Cosine, vectorstore.DotProduct, vectorstore.L2} {
+		targets = append(targets,
+			&target{name: "qdrant/" + m.String(), factory: qdrantFactory(qdrantServer, m)},
+			&target{name: "chroma/" + m.String(), factory: chromaFactory(chromaServer, m)},
+		)
+	}
+
+	failed := false
+	for _, t := range targets {
+		if *only != "" && !selected(*only, t.name) {
+			continue
+		}
+
+		results := conformance.NewSuite(t.factory).Run(ctx)
+
+		passed, skipped := 0, 0
+		for _, r := range results {
+			switch {
+			case r.Skipped:
+				skipped++
+			case r.Err == nil:
+				passed++
+			}
+			if *verbose {
+				fmt.Printf("  %-20s %s\n", r.Case, status(r))
+			}
+		}
+		fmt.Printf("%-16s %d passed, %d skipped, %d failed\n", t.name, passed, skipped, len(results)-passed-skipped)
+
+		for _, r := range results {
+			if r.Err == nil || r.Skipped {
+				continue
+			}
+			failed = true
+			fmt.Printf("  FAIL %s\n", r.Case)
+			for _, line := range strings.Split(r.Err.Error(), "\n") {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+
+	if failed {
+		return 1
+	}
+
+	return 0
+}
+
+// selected reports whether name, or the store it is a variant of, is listed
+func selected(list, name string) bool {
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == name || strings.HasPrefix(name, s+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func status(r *conformance.Result) string {
+	switch {
+	case r.Skipped && r.Err != nil:
+		return "skipped: " + r.Err.Error()
+	case r.Skipped:
+		return "skipped"
+	case r.Err != nil:
+		return "FAIL"
+	default:
+		return "ok"
+	}
+}
+
+// collections names a new collection per store, as the stand-ins are shared
+var collections atomic.Int64
+
+func qdrantFactory(srv *httptest.Server, m vectorstore.Metric) conformance.Factory {
+	return func(ctx context.Context, e core.Embedder) (core.MutableVectorStorer, error) {
+		name := fmt.Sprintf("conformance-%d", collections.Add(1))
+		return qdrant.NewQdrantVectorStore(srv.URL, name, e, qdrant.WithMetric(m)), nil
+	}
+}
+
+func chromaFactory(srv *httptest.Server, m vectorstore.Metric) conformance.Factory {
+	return func(ctx context.Context, e core.Embedder) (core.MutableVectorStorer, error) {
+		name := fmt.Sprintf("conformance-%d", collections.Add(1))
+		return chroma.NewChromaVectorStore(srv.URL, name, e, chroma.WithMetric(m)), nil
+	}
+}
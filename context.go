@@ -0,0 +1,35 @@
+package core
+
+import "context"
+
+type contextKey int
+
+const (
+	runIDKey contextKey = iota
+	idempotencyKeyKey
+)
+
+// WithRunID returns a context carrying the identifier of an agent run
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey, id)
+}
+
+// RunID returns the identifier of the agent run ctx belongs to, if any
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey).(string)
+	return id
+}
+
+// WithIdempotencyKey returns a context carrying the idempotency key of a tool
+// call. The agent sets it for every call it makes.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey, key)
+}
+
+// IdempotencyKey returns the idempotency key of the current tool call, if
+// any. The key is the same when a call is retried, so tools with side effects
+// can use it to perform them only once.
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey).(string)
+	return key
+}
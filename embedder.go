@@ -9,3 +9,13 @@ type Embedder interface {
 	// GenerateEmbedding generates vector embeddings based on input content
 	GenerateEmbedding(ctx context.Context, content string) (*Embedding, error)
 }
+
+// BatchEmbedder is implemented by embedders able to embed several contents
+// in a single call, which is much faster than a call per content for
+// ingestion. Use a type assertion on an Embedder to detect it.
+type BatchEmbedder interface {
+	Embedder
+
+	// GenerateEmbeddings generates the embeddings of contents, in order
+	GenerateEmbeddings(ctx context.Context, contents []string) ([]*Embedding, error)
+}
@@ -0,0 +1,227 @@
+package bert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// synthetic is the value i of the k-th tensor of the test model
+func synthetic(k, i int) float32 {
+	return float32(math.Sin(float64(k)*1.3+float64(i)*0.7) * 0.5)
+}
+
+// writeModel writes a one layer model with a hidden size of 4, two heads and
+// the test vocabulary to a new directory, with its tensors saved under the
+// "bert." prefix. The expected outputs below were computed from the same
+// weights by a float64 reference implementation of BERT.
+func writeModel(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	const h, inter, vocab, positions = 4, 8, 8, 8
+	const layer = "encoder.layer.0."
+
+	type spec struct {
+		name  string
+		shape []int
+	}
+	specs := []spec{
+		{"embeddings.word_embeddings.weight", []int{vocab, h}},
+		{"embeddings.position_embeddings.weight", []int{positions, h}},
+		{"embeddings.token_type_embeddings.weight", []int{1, h}},
+		{"embeddings.LayerNorm.weight", []int{h}},
+		{"embeddings.LayerNorm.bias", []int{h}},
+	}
+	for _, name := range []string{"attention.self.query", "attention.self.key", "attention.self.value", "attention.output.dense"} {
+		specs = append(specs, spec{layer + name + ".weight", []int{h, h}}, spec{layer + name + ".bias", []int{h}})
+	}
+	specs = append(specs,
+		spec{layer + "attention.output.LayerNorm.weight", []int{h}},
+		spec{layer + "attention.output.LayerNorm.bias", []int{h}},
+		spec{layer + "intermediate.dense.weight", []int{inter, h}},
+		spec{layer + "intermediate.dense.bias", []int{inter}},
+		spec{layer + "output.dense.weight", []int{h, inter}},
+		spec{layer + "output.dense.bias", []int{h}},
+		spec{layer + "output.LayerNorm.weight", []int{h}},
+		spec{layer + "output.LayerNorm.bias", []int{h}},
+	)
+
+	tensors := map[string]*testTensor{}
+	for k, s := range specs {
+		count := 1
+		for _, d := range s.shape {
+			count *= d
+		}
+
+		values := make([]float32, count)
+		for i := range values {
+			values[i] = synthetic(k, i)
+			if strings.HasSuffix(s.name, "LayerNorm.weight") {
+				values[i] += 1
+			}
+		}
+		tensors["bert."+s.name] = &testTensor{"F32", s.shape, f32Bytes(values...)}
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("config.json", fmt.Sprintf(`{"vocab_size": %d, "hidden_size": %d, "num_hidden_layers": 1, "num_attention_heads": 2,
+		"intermediate_size": %d, "hidden_act": "gelu", "max_position_embeddings": %d, "type_vocab_size": 1}`,
+		vocab, h, inter, positions))
+	write("vocab.txt", strings.Join(testVocab[:vocab], "\n"))
+	write("model.safetensors", string(encodeSafetensors(t, tensors)))
+	for name, content := range files {
+		write(name, content)
+	}
+
+	return dir
+}
+
+func checkVector(t *testing.T, got []float32, want []float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if math.Abs(float64(got[i])-want[i]) > 1e-4 {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestEmbedder(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		files map[string]string
+		opts  []EmbedderConfigFunc
+		text  string
+		want  []float64
+	}{
+		// [CLS] hello world ##s ! [SEP]
+		"mean pooling": {
+			nil, nil, "Hello worlds!",
+			[]float64{0.1081544744948325, -0.01848703702960307, 0.9614265402454226, -0.2522297500699109},
+		},
+		"short text": {
+			nil, nil, "hello",
+			[]float64{0.08175638963045256, 0.008316944397118527, 0.9771259937322903, -0.1961415651084013},
+		},
+		"unknown word": {
+			nil, nil, "xyz",
+			[]float64{0.1540524436212972, 0.06458728298371216, 0.7953354465148638, -0.5826987686687619},
+		},
+		"cls pooling": {
+			map[string]string{"1_Pooling/config.json": `{"pooling_mode_cls_token": true}`}, []EmbedderConfigFunc{WithNormalize(false)}, "Hello worlds!",
+			[]float64{0.24506881725992696, 0.5028250649905672, 2.488797666906985, -1.8923994378111135},
+		},
+		// [CLS] hello [SEP]
+		"max length": {
+			map[string]string{"sentence_bert_config.json": `{"max_seq_length": 3}`}, nil, "hello worlds!",
+			[]float64{0.08175638963045256, 0.008316944397118527, 0.9771259937322903, -0.1961415651084013},
+		},
+		"cased": {
+			map[string]string{"tokenizer_config.json": `{"do_lower_case": false}`}, nil, "Xyz",
+			[]float64{0.1540524436212972, 0.06458728298371216, 0.7953354465148638, -0.5826987686687619},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			e, err := NewEmbedder(writeModel(t, tt.files), tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			emb, err := e.GenerateEmbedding(ctx, tt.text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkVector(t, emb.Vector, tt.want)
+			if emb.Content != tt.text || e.Dimensions() != 4 {
+				t.Errorf("got %+v of %d dimensions", emb, e.Dimensions())
+			}
+		})
+	}
+}
+
+func TestEmbedderBatch(t *testing.T) {
+	e, err := NewEmbedder(writeModel(t, nil), WithConcurrency(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := []string{"hello", "Hello worlds!", "xyz", "hello", "worlds"}
+	embeddings, err := e.GenerateEmbeddings(context.Background(), contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, content := range contents {
+		one, err := e.GenerateEmbedding(context.Background(), content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if embeddings[i].Content != content {
+			t.Errorf("embedding %d is of %q", i, embeddings[i].Content)
+		}
+		checkVector(t, embeddings[i].Vector, []float64{
+			float64(one.Vector[0]), float64(one.Vector[1]), float64(one.Vector[2]), float64(one.Vector[3]),
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e.GenerateEmbeddings(ctx, contents); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if got := e.CountTokens("Hello worlds!"); got != 4 {
+		t.Errorf("counted %d tokens, want 4", got)
+	}
+}
+
+func TestNewEmbedderErrors(t *testing.T) {
+	tests := map[string]struct {
+		files  map[string]string
+		remove string
+		err    string
+	}{
+		"no config":         {nil, "config.json", "error reading config.json"},
+		"no weights":        {nil, "model.safetensors", "error reading weights"},
+		"no vocabulary":     {nil, "vocab.txt", "error opening vocabulary"},
+		"invalid heads":     {map[string]string{"config.json": `{"hidden_size": 4, "num_attention_heads": 3}`}, "", "invalid hidden size"},
+		"missing layer":     {map[string]string{"config.json": `{"hidden_size": 4, "num_attention_heads": 2, "num_hidden_layers": 2, "intermediate_size": 8}`}, "", "model has no tensor bert.encoder.layer.1"},
+		"wrong shape":       {map[string]string{"config.json": `{"hidden_size": 4, "num_attention_heads": 2, "num_hidden_layers": 1, "intermediate_size": 6}`}, "", "has shape [8 4], expected [6 4]"},
+		"activation":        {map[string]string{"config.json": `{"hidden_size": 4, "num_attention_heads": 2, "num_hidden_layers": 1, "intermediate_size": 8, "hidden_act": "swish"}`}, "", `unsupported activation "swish"`},
+		"vocabulary":        {map[string]string{"vocab.txt": strings.Join(append(testVocab, "extra"), "\n")}, "", "exceeds the 8 embeddings"},
+		"invalid json file": {map[string]string{"tokenizer_config.json": "{"}, "", "error decoding tokenizer_config.json"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := writeModel(t, tt.files)
+			if tt.remove != "" {
+				os.Remove(filepath.Join(dir, tt.remove))
+			}
+
+			if _, err := NewEmbedder(dir); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package bert
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Config is the architecture of a BERT model, as found in the config.json
+// file of Hugging Face models
+type Config struct {
+	VocabSize             int     `json:"vocab_size"`
+	HiddenSize            int     `json:"hidden_size"`
+	NumHiddenLayers       int     `json:"num_hidden_layers"`
+	NumAttentionHeads     int     `json:"num_attention_heads"`
+	IntermediateSize      int     `json:"intermediate_size"`
+	HiddenAct             string  `json:"hidden_act"`
+	MaxPositionEmbeddings int     `json:"max_position_embeddings"`
+	TypeVocabSize         int     `json:"type_vocab_size"`
+	LayerNormEps          float64 `json:"layer_norm_eps"`
+}
+
+// model is a BERT encoder
+type model struct {
+	conf *Config
+
+	wordEmbeddings     []float32
+	positionEmbeddings []float32
+	typeEmbeddings     []float32
+	embeddingsNorm     *layerNorm
+	layers             []*layer
+	act                func(float32) float32
+}
+
+type layer struct {
+	query, key, value *linear
+	attentionOut      *linear
+	attentionNorm     *layerNorm
+	intermediate      *linear
+	output            *linear
+	outputNorm        *layerNorm
+}
+
+// linear is a dense layer with weights stored out × in, row major, as
+// PyTorch does
+type linear struct {
+	in, out int
+	weight  []float32
+	bias    []float32
+}
+
+type layerNorm struct {
+	weight, bias []float32
+	eps          float32
+}
+
+// newModel assembles a model out of its tensors, accepting the names of both
+// bare encoders and those saved with a "bert." prefix, and the gamma and
+// beta names of older checkpoints
+func newModel(conf *Config, tensors map[string]*tensor) (*model, error) {
+	if conf.HiddenSize <= 0 || conf.NumAttentionHeads <= 0 || conf.HiddenSize%conf.NumAttentionHeads != 0 {
+		return nil, fmt.Errorf("invalid hidden size %d for %d attention heads", conf.HiddenSize, conf.NumAttentionHeads)
+	}
+
+	prefix := ""
+	for _, p := range []string{"", "bert.", "model."} {
+		if _, ok := tensors[p+"embeddings.word_embeddings.weight"]; ok {
+			prefix = p
+			break
+		}
+	}
+
+	get := func(name string, shape ...int) ([]float32, error) {
+		t, ok := tensors[prefix+name]
+		if !ok && strings.HasSuffix(name, "LayerNorm.weight") {
+			t, ok = tensors[prefix+strings.TrimSuffix(name, "weight")+"gamma"]
+		}
+		if !ok && strings.HasSuffix(name, "LayerNorm.bias") {
+			t, ok = tensors[prefix+strings.TrimSuffix(name, "bias")+"beta"]
+		}
+		if !ok {
+			return nil, fmt.Errorf("model has no tensor %s", prefix+name)
+		}
+
+		if len(t.shape) != len(shape) {
+			return nil, fmt.Errorf("tensor %s has shape %v, expected %v", name, t.shape, shape)
+		}
+		for i, d := range shape {
+			// a negative dimension is only known from the tensor
+			if d >= 0 && t.shape[i] != d {
+				return nil, fmt.Errorf("tensor %s has shape %v, expected %v", name, t.shape, shape)
+			}
+		}
+
+		return t.data, nil
+	}
+
+	var firstErr error
+	must := func(name string, shape ...int) []float32 {
+		data, err := get(name, shape...)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return data
+	}
+
+	h, inter := conf.HiddenSize, conf.IntermediateSize
+	eps := float32(conf.LayerNormEps)
+	if eps == 0 {
+		eps = 1e-12
+	}
+
+	newLinear := func(name string, in, out int) *linear {
+		return &linear{
+			in:     in,
+			out:    out,
+			weight: must(name+".weight", out, in),
+			bias:   must(name+".bias", out),
+		}
+	}
+	newNorm := func(name string) *layerNorm {
+		return &layerNorm{
+			weight: must(name+".weight", h),
+			bias:   must(name+".bias", h),
+			eps:    eps,
+		}
+	}
+
+	m := &model{
+		conf:               conf,
+		wordEmbeddings:     must("embeddings.word_embeddings.weight", -1, h),
+		positionEmbeddings: must("embeddings.position_embeddings.weight", -1, h),
+		embeddingsNorm:     newNorm("embeddings.LayerNorm"),
+	}
+
+	// models without token types, such as some distilled ones, add nothing
+	if _, ok := tensors[prefix+"embeddings.token_type_embeddings.weight"]; ok {
+		m.typeEmbeddings = must("embeddings.token_type_embeddings.weight", -1, h)
+	}
+
+	for i := 0; i < conf.NumHiddenLayers; i++ {
+		p := fmt.Sprintf("encoder.layer.%d.", i)
+		m.layers = append(m.layers, &layer{
+			query:         newLinear(p+"attention.self.query", h, h),
+			key:           newLinear(p+"attention.self.key", h, h),
+			value:         newLinear(p+"attention.self.value", h, h),
+			attentionOut:  newLinear(p+"attention.output.dense", h, h),
+			attentionNorm: newNorm(p + "attention.output.LayerNorm"),
+			intermediate:  newLinear(p+"intermediate.dense", h, inter),
+			output:        newLinear(p+"output.dense", inter, h),
+			outputNorm:    newNorm(p + "output.LayerNorm"),
+		})
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	switch conf.HiddenAct {
+	case "gelu", "":
+		m.act = gelu
+	case "gelu_new", "gelu_pytorch_tanh", "gelu_fast":
+		m.act = geluTanh
+	case "relu":
+		m.act = relu
+	default:
+		return nil, fmt.Errorf("unsupported activation %q", conf.HiddenAct)
+	}
+
+	return m, nil
+}
+
+// maxPositions returns the longest sequence the model accepts
+func (m *model) maxPositions() int {
+	return len(m.positionEmbeddings) / m.conf.HiddenSize
+}
+
+// forward returns the last hidden states of a sequence of token IDs, one row
+// of HiddenSize values per token
+func (m *model) forward(ids []int) ([]float32, error) {
+	h := m.conf.HiddenSize
+	n := len(ids)
+	if n > m.maxPositions() {
+		return nil, fmt.Errorf("sequence of %d tokens exceeds the %d positions of the model", n, m.maxPositions())
+	}
+
+	vocab := len(m.wordEmbeddings) / h
+	x := make([]float32, n*h)
+	for t, id := range ids {
+		if id < 0 || id >= vocab {
+			return nil, fmt.Errorf("token %d out of the vocabulary", id)
+		}
+
+		row := x[t*h : (t+1)*h]
+		word := m.wordEmbeddings[id*h : (id+1)*h]
+		pos := m.positionEmbeddings[t*h : (t+1)*h]
+		for i := range row {
+			row[i] = word[i] + pos[i]
+		}
+		if m.typeEmbeddings != nil {
+			// every token belongs to the first segment
+			for i := range row {
+				row[i] += m.typeEmbeddings[i]
+			}
+		}
+	}
+	m.embeddingsNorm.apply(x, n)
+
+	for _, l := range m.layers {
+		x = m.layerForward(l, x, n)
+	}
+
+	return x, nil
+}
+
+func (m *model) layerForward(l *layer, x []float32, n int) []float32 {
+	h := m.conf.HiddenSize
+	heads := m.conf.NumAttentionHeads
+	d := h / heads
+
+	q := l.query.apply(x, n)
+	k := l.key.apply(x, n)
+	v := l.value.apply(x, n)
+
+	context := make([]float32, n*h)
+	scale := float32(1 / math.Sqrt(float64(d)))
+	scores := make([]float32, n)
+	for head := 0; head < heads; head++ {
+		off := head * d
+		for i := 0; i < n; i++ {
+			qi := q[i*h+off : i*h+off+d]
+			for j := 0; j < n; j++ {
+				scores[j] = dot(qi, k[j*h+off:j*h+off+d]) * scale
+			}
+			softmax(scores)
+
+			out := context[i*h+off : i*h+off+d]
+			for j := 0; j < n; j++ {
+				axpy(scores[j], v[j*h+off:j*h+off+d], out)
+			}
+		}
+	}
+
+	attention := l.attentionOut.apply(context, n)
+	for i := range attention {
+		attention[i] += x[i]
+	}
+	l.attentionNorm.apply(attention, n)
+
+	inter := l.intermediate.apply(attention, n)
+	for i, val := range inter {
+		inter[i] = m.act(val)
+	}
+
+	out := l.output.apply(inter, n)
+	for i := range out {
+		out[i] += attention[i]
+	}
+	l.outputNorm.apply(out, n)
+
+	return out
+}
+
+// apply returns x W^T + b for n rows of x. Rows are spread over the CPUs
+// for long sequences.
+func (l *linear) apply(x []float32, n int) []float32 {
+	y := make([]float32, n*l.out)
+
+	rows := func(from, to int) {
+		for t := from; t < to; t++ {
+			xt := x[t*l.in : (t+1)*l.in]
+			yt := y[t*l.out : (t+1)*l.out]
+			for o := range yt {
+				yt[o] = dot(xt, l.weight[o*l.in:(o+1)*l.in]) + l.bias[o]
+			}
+		}
+	}
+
+	workers := min(runtime.GOMAXPROCS(0), n)
+	if workers <= 1 || n*l.in*l.out < 1<<20 {
+		rows(0, n)
+		return y
+	}
+
+	var wg sync.WaitGroup
+	per := (n + workers - 1) / workers
+	for from := 0; from < n; from += per {
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			rows(from, to)
+		}(from, min(from+per, n))
+	}
+	wg.Wait()
+
+	return y
+}
+
+// apply normalizes each of the n rows of x in place
+func (ln *layerNorm) apply(x []float32, n int) {
+	h := len(ln.weight)
+	for t := 0; t < n; t++ {
+		row := x[t*h : (t+1)*h]
+
+		var mean float32
+		for _, v := range row {
+			mean += v
+		}
+		mean /= float32(h)
+
+		var variance float32
+		for _, v := range row {
+			variance += (v - mean) * (v - mean)
+		}
+		variance /= float32(h)
+
+		inv := float32(1 / math.Sqrt(float64(variance+ln.eps)))
+		for i, v := range row {
+			row[i] = (v-mean)*inv*ln.weight[i] + ln.bias[i]
+		}
+	}
+}
+
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+
+	return s0 + s1 + s2 + s3
+}
+
+// axpy adds a × x to y
+func axpy(a float32, x, y []float32) {
+	x = x[:len(y)]
+	for i := range y {
+		y[i] += a * x[i]
+	}
+}
+
+func softmax(x []float32) {
+	maxV := x[0]
+	for _, v := range x[1:] {
+		maxV = max(maxV, v)
+	}
+
+	var sum float32
+	for i, v := range x {
+		x[i] = float32(math.Exp(float64(v - maxV)))
+		sum += x[i]
+	}
+	for i := range x {
+		x[i] /= sum
+	}
+}
+
+func gelu(x float32) float32 {
+	return 0.5 * x * float32(1+math.Erf(float64(x)/math.Sqrt2))
+}
+
+func geluTanh(x float32) float32 {
+	v := float64(x)
+	return float32(0.5 * v * (1 + math.Tanh(math.Sqrt(2/math.Pi)*(v+0.044715*v*v*v))))
+}
+
+func relu(x float32) float32 {
+	return max(x, 0)
+}
@@ -0,0 +1,116 @@
+package bert
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// tensor is a float32 tensor read from a safetensors file
+type tensor struct {
+	shape []int
+	data  []float32
+}
+
+// readSafetensors decodes the tensors of a safetensors file: an 8 byte
+// little-endian header length, a JSON header describing each tensor, then
+// the raw data. F32, F16 and BF16 tensors are converted to float32, others
+// are skipped.
+func readSafetensors(data []byte) (map[string]*tensor, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("safetensors file too short")
+	}
+
+	n := binary.LittleEndian.Uint64(data)
+	if n > uint64(len(data)-8) {
+		return nil, fmt.Errorf("safetensors header length %d out of range", n)
+	}
+
+	var header map[string]json.RawMessage
+	if err := json.Unmarshal(data[8:8+n], &header); err != nil {
+		return nil, fmt.Errorf("error decoding safetensors header: %w", err)
+	}
+	body := data[8+n:]
+
+	tensors := make(map[string]*tensor, len(header))
+	for name, raw := range header {
+		if name == "__metadata__" {
+			continue
+		}
+
+		var info struct {
+			DType   string   `json:"dtype"`
+			Shape   []int    `json:"shape"`
+			Offsets [2]int64 `json:"data_offsets"`
+		}
+		if err := json.Unmarshal(raw, &info); err != nil {
+			return nil, fmt.Errorf("error decoding tensor %s: %w", name, err)
+		}
+
+		begin, end := info.Offsets[0], info.Offsets[1]
+		if begin < 0 || end < begin || end > int64(len(body)) {
+			return nil, fmt.Errorf("tensor %s out of range", name)
+		}
+		raw := body[begin:end]
+
+		count := 1
+		for _, d := range info.Shape {
+			count *= d
+		}
+
+		var size int
+		switch info.DType {
+		case "F32":
+			size = 4
+		case "F16", "BF16":
+			size = 2
+		default:
+			continue
+		}
+		if len(raw) != count*size {
+			return nil, fmt.Errorf("tensor %s holds %d bytes for %d values", name, len(raw), count)
+		}
+
+		values := make([]float32, count)
+		for i := range values {
+			switch info.DType {
+			case "F32":
+				values[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[4*i:]))
+			case "F16":
+				values[i] = halfToFloat(binary.LittleEndian.Uint16(raw[2*i:]))
+			case "BF16":
+				values[i] = math.Float32frombits(uint32(binary.LittleEndian.Uint16(raw[2*i:])) << 16)
+			}
+		}
+
+		tensors[name] = &tensor{shape: info.Shape, data: values}
+	}
+
+	return tensors, nil
+}
+
+// halfToFloat converts an IEEE 754 half precision value
+func halfToFloat(h uint16) float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1F
+	frac := uint32(h) & 0x3FF
+
+	switch exp {
+	case 0:
+		if frac == 0 {
+			return math.Float32frombits(sign)
+		}
+		// subnormal: normalize it
+		e := uint32(127 - 15 + 1)
+		for frac&0x400 == 0 {
+			frac <<= 1
+			e--
+		}
+		return math.Float32frombits(sign | e<<23 | (frac&0x3FF)<<13)
+	case 0x1F:
+		return math.Float32frombits(sign | 0xFF<<23 | frac<<13)
+	}
+
+	return math.Float32frombits(sign | (exp+127-15)<<23 | frac<<13)
+}
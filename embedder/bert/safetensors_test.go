@@ -0,0 +1,121 @@
+package bert
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+type testTensor struct {
+	dtype string
+	shape []int
+	data  []byte
+}
+
+// encodeSafetensors lays tensors out in a safetensors file, in name order
+func encodeSafetensors(t *testing.T, tensors map[string]*testTensor) []byte {
+	t.Helper()
+
+	header := map[string]any{"__metadata__": map[string]string{"format": "pt"}}
+	var body []byte
+	for _, name := range slices.Sorted(maps.Keys(tensors)) {
+		tt := tensors[name]
+		header[name] = map[string]any{
+			"dtype":        tt.dtype,
+			"shape":        tt.shape,
+			"data_offsets": []int{len(body), len(body) + len(tt.data)},
+		}
+		body = append(body, tt.data...)
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(append(binary.LittleEndian.AppendUint64(nil, uint64(len(h))), h...), body...)
+}
+
+func f32Bytes(values ...float32) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.LittleEndian.AppendUint32(out, math.Float32bits(v))
+	}
+
+	return out
+}
+
+func u16Bytes(values ...uint16) []byte {
+	var out []byte
+	for _, v := range values {
+		out = binary.LittleEndian.AppendUint16(out, v)
+	}
+
+	return out
+}
+
+func TestReadSafetensors(t *testing.T) {
+	data := encodeSafetensors(t, map[string]*testTensor{
+		"f32":  {"F32", []int{2, 1}, f32Bytes(1.5, -2)},
+		"f16":  {"F16", []int{6}, u16Bytes(0x3C00, 0xC000, 0x3555, 0x0001, 0x8000, 0x7C00)},
+		"bf16": {"BF16", []int{2}, u16Bytes(0x3F80, 0x4049)},
+		"i64":  {"I64", []int{1}, make([]byte, 8)},
+	})
+
+	tensors, err := readSafetensors(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"f32":  "[2 1] [1.5 -2]",
+		"f16":  fmt.Sprintf("[6] [1 -2 0.33325195 %v -0 +Inf]", float32(math.Ldexp(1, -24))),
+		"bf16": "[2] [1 3.140625]",
+	}
+	if len(tensors) != len(want) {
+		t.Errorf("got %d tensors, want %d", len(tensors), len(want))
+	}
+	for name, w := range want {
+		tt, ok := tensors[name]
+		if !ok {
+			t.Errorf("%s missing", name)
+			continue
+		}
+		if got := fmt.Sprint(tt.shape, tt.data); got != w {
+			t.Errorf("%s: got %s, want %s", name, got, w)
+		}
+	}
+}
+
+func TestReadSafetensorsErrors(t *testing.T) {
+	valid := encodeSafetensors(t, map[string]*testTensor{"w": {"F32", []int{2}, f32Bytes(1, 2)}})
+	header := func(s string) []byte {
+		return append(binary.LittleEndian.AppendUint64(nil, uint64(len(s))), s...)
+	}
+
+	tests := map[string]struct {
+		data []byte
+		err  string
+	}{
+		"too short":         {valid[:7], "too short"},
+		"header too long":   {binary.LittleEndian.AppendUint64(nil, 100), "out of range"},
+		"invalid header":    {header("{"), "error decoding safetensors header"},
+		"invalid tensor":    {header(`{"w": []}`), "error decoding tensor w"},
+		"offsets past data": {header(`{"w": {"dtype": "F32", "shape": [1], "data_offsets": [0, 4]}}`), "tensor w out of range"},
+		"reversed offsets":  {append(header(`{"w": {"dtype": "F32", "shape": [1], "data_offsets": [4, 0]}}`), make([]byte, 4)...), "tensor w out of range"},
+		"size mismatch":     {append(header(`{"w": {"dtype": "F16", "shape": [3], "data_offsets": [0, 4]}}`), make([]byte, 4)...), "holds 4 bytes for 3 values"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := readSafetensors(tt.data); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package bert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Tokenizer is the WordPiece tokenizer of BERT models. It cleans and splits
+// text on whitespace and punctuation, then cuts each word into the longest
+// pieces found in the vocabulary, continuation pieces being prefixed with
+// "##". Words that cannot be cut become the unknown token.
+type Tokenizer struct {
+	vocab     map[string]int
+	tokens    []string
+	lowerCase bool
+	unknown   int
+	cls       int
+	sep       int
+}
+
+// maxWordRunes is the length beyond which words are not split but unknown
+const maxWordRunes = 100
+
+// NewTokenizer returns a new Tokenizer reading a vocab.txt file, one token
+// per line. Uncased models need lowerCase, which also strips accents.
+func NewTokenizer(vocab io.Reader, lowerCase bool) (*Tokenizer, error) {
+	t := &Tokenizer{vocab: map[string]int{}, lowerCase: lowerCase}
+
+	scanner := bufio.NewScanner(vocab)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for id := 0; scanner.Scan(); id++ {
+		token := strings.TrimRight(scanner.Text(), "\r")
+		t.tokens = append(t.tokens, token)
+		if _, ok := t.vocab[token]; !ok {
+			t.vocab[token] = id
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading vocabulary: %w", err)
+	}
+
+	for name, id := range map[string]*int{"[UNK]": &t.unknown, "[CLS]": &t.cls, "[SEP]": &t.sep} {
+		v, ok := t.vocab[name]
+		if !ok {
+			return nil, fmt.Errorf("vocabulary has no %s token", name)
+		}
+		*id = v
+	}
+
+	return t, nil
+}
+
+// Len returns the size of the vocabulary
+func (t *Tokenizer) Len() int {
+	return len(t.tokens)
+}
+
+// Encode returns the token IDs of text framed by the [CLS] and [SEP] tokens,
+// truncated to at most maxLength IDs
+func (t *Tokenizer) Encode(text string, maxLength int) []int {
+	ids := []int{t.cls}
+	for _, word := range t.words(text) {
+		ids = append(ids, t.pieces(word)...)
+		if len(ids) >= maxLength-1 {
+			ids = ids[:max(maxLength-1, 1)]
+			break
+		}
+	}
+
+	return append(ids, t.sep)
+}
+
+// Tokens returns the WordPiece tokens of text, without special tokens
+func (t *Tokenizer) Tokens(text string) []string {
+	var out []string
+	for _, word := range t.words(text) {
+		for _, id := range t.pieces(word) {
+			out = append(out, t.tokens[id])
+		}
+	}
+
+	return out
+}
+
+// words applies the basic tokenization: cleaning, lower casing and accent
+// stripping for uncased models, and splitting on whitespace, punctuation and
+// around CJK ideographs
+func (t *Tokenizer) words(text string) []string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == 0 || r == unicode.ReplacementChar || isControl(r):
+		case unicode.IsSpace(r):
+			b.WriteByte(' ')
+		case isCJK(r):
+			b.WriteByte(' ')
+			b.WriteRune(r)
+			b.WriteByte(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	var words []string
+	for _, word := range strings.Fields(b.String()) {
+		if t.lowerCase {
+			word = stripAccents(strings.ToLower(word))
+		}
+
+		start := 0
+		for i, r := range word {
+			if isPunctuation(r) {
+				if i > start {
+					words = append(words, word[start:i])
+				}
+				words = append(words, string(r))
+				start = i + len(string(r))
+			}
+		}
+		if start < len(word) {
+			words = append(words, word[start:])
+		}
+	}
+
+	return words
+}
+
+// pieces cuts a word greedily into the longest vocabulary pieces
+func (t *Tokenizer) pieces(word string) []int {
+	runes := []rune(word)
+	if len(runes) > maxWordRunes {
+		return []int{t.unknown}
+	}
+
+	var ids []int
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		found := -1
+		for ; end > start; end-- {
+			piece := string(runes[start:end])
+			if start > 0 {
+				piece = "##" + piece
+			}
+			if id, ok := t.vocab[piece]; ok {
+				found = id
+				break
+			}
+		}
+
+		if found < 0 {
+			return []int{t.unknown}
+		}
+		ids = append(ids, found)
+		start = end
+	}
+
+	return ids
+}
+
+func stripAccents(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' || r == '\r' {
+		return false
+	}
+
+	return unicode.IsControl(r) || unicode.Is(unicode.Cf, r)
+}
+
+// isPunctuation follows BERT in treating every non alphanumeric ASCII
+// character as punctuation, besides the Unicode punctuation classes
+func isPunctuation(r rune) bool {
+	if (r >= 33 && r <= 47) || (r >= 58 && r <= 64) || (r >= 91 && r <= 96) || (r >= 123 && r <= 126) {
+		return true
+	}
+
+	return unicode.IsPunct(r)
+}
+
+func isCJK(r rune) bool {
+	return (r >= 0x4E00 && r <= 0x9FFF) ||
+		(r >= 0x3400 && r <= 0x4DBF) ||
+		(r >= 0x20000 && r <= 0x2A6DF) ||
+		(r >= 0x2A700 && r <= 0x2B73F) ||
+		(r >= 0x2B740 && r <= 0x2B81F) ||
+		(r >= 0x2B820 && r <= 0x2CEAF) ||
+		(r >= 0xF900 && r <= 0xFAFF) ||
+		(r >= 0x2F800 && r <= 0x2FA1F)
+}
@@ -0,0 +1,91 @@
+package bert
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var testVocab = []string{
+	"[PAD]", "[UNK]", "[CLS]", "[SEP]", "hello", "world", "##s", "!", ",", "cafe", "un", "##aff", "##able", "中",
+}
+
+func newTokenizer(t *testing.T, lowerCase bool) *Tokenizer {
+	t.Helper()
+
+	tokenizer, err := NewTokenizer(strings.NewReader(strings.Join(testVocab, "\n")+"\n"), lowerCase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return tokenizer
+}
+
+func TestTokenizerTokens(t *testing.T) {
+	tests := map[string]struct {
+		text      string
+		lowerCase bool
+		want      string
+	}{
+		"punctuation":        {"Hello, World!", true, "[hello , world !]"},
+		"accents":            {"Café", true, "[cafe]"},
+		"continuation":       {"worlds", true, "[world ##s]"},
+		"several pieces":     {"unaffable", true, "[un ##aff ##able]"},
+		"unknown word":       {"hello xyz", true, "[hello [UNK]]"},
+		"unknown piece":      {"worldz", true, "[[UNK]]"},
+		"cjk":                {"world中hello", true, "[world 中 hello]"},
+		"control characters": {"hel\x00lo\tworld\u200b", true, "[hello world]"},
+		"too long":           {strings.Repeat("s", maxWordRunes+1), true, "[[UNK]]"},
+		"cased":              {"Hello world", false, "[[UNK] world]"},
+		"cased accents":      {"café", false, "[[UNK]]"},
+		"empty":              {" \n ", true, "[]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fmt.Sprint(newTokenizer(t, tt.lowerCase).Tokens(tt.text)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizerEncode(t *testing.T) {
+	tokenizer := newTokenizer(t, true)
+
+	tests := map[string]struct {
+		text      string
+		maxLength int
+		want      string
+	}{
+		"fits":           {"hello worlds", 10, "[2 4 5 6 3]"},
+		"exact":          {"hello worlds", 5, "[2 4 5 6 3]"},
+		"truncated":      {"hello world hello world", 4, "[2 4 5 3]"},
+		"within a word":  {"hello worlds", 4, "[2 4 5 3]"},
+		"special tokens": {"hello", 2, "[2 3]"},
+		"empty":          {"", 10, "[2 3]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fmt.Sprint(tokenizer.Encode(tt.text, tt.maxLength)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenizerSpecialTokens(t *testing.T) {
+	if _, err := NewTokenizer(strings.NewReader("[CLS]\n[SEP]\nhello\n"), true); err == nil {
+		t.Error("vocabulary without [UNK] accepted")
+	}
+
+	// Windows line endings
+	tokenizer, err := NewTokenizer(strings.NewReader(strings.Join(testVocab, "\r\n")), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(tokenizer.Tokens("hello")); got != "[hello]" || tokenizer.Len() != len(testVocab) {
+		t.Errorf("got %s of %d tokens", got, tokenizer.Len())
+	}
+}
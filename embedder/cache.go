@@ -0,0 +1,306 @@
+package embedder
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Cache stores vectors by key. Implementations must be safe for concurrent
+// use.
+type Cache interface {
+	// Get returns the vector stored under key, if any
+	Get(ctx context.Context, key string) (core.Vec32, bool, error)
+
+	// Set stores a vector under key
+	Set(ctx context.Context, key string, vector core.Vec32) error
+}
+
+// CachedEmbedder is a core.BatchEmbedder remembering the vectors of the
+// contents it embeds, keyed by a hash of the content, so that re-embedding
+// unchanged contents costs nothing. The key also covers a namespace, which
+// should name the model: vectors of different models must not be mixed.
+//
+// Embeddings carry the vector and the content only, cached or not: IDs and
+// metadata set by the wrapped embedder are not kept. Cache failures are
+// logged and otherwise ignored, the contents being embedded as if they were
+// not cached.
+//
+// The contents missing from the cache are sent to the wrapped embedder in a
+// single GenerateEmbeddings call, however many they are. Wrap embedders of
+// APIs limiting batch sizes in a Parallel first, which splits batches up.
+type CachedEmbedder struct {
+	embedder  core.Embedder
+	cache     Cache
+	namespace string
+	logger    *logr.Logger
+
+	mu     sync.Mutex
+	hits   uint64
+	misses uint64
+}
+
+// CacheStats are the hit and miss counters of a CachedEmbedder
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// CachedEmbedderConfig holds configuration for a CachedEmbedder
+type CachedEmbedderConfig struct {
+	// Namespace is part of every key, typically the model name
+	// default none
+	Namespace string
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// CachedEmbedderConfigFunc is a function type that modifies CachedEmbedderConfig
+type CachedEmbedderConfigFunc func(*CachedEmbedderConfig)
+
+func WithNamespace(namespace string) CachedEmbedderConfigFunc {
+	return func(conf *CachedEmbedderConfig) {
+		conf.Namespace = namespace
+	}
+}
+
+func WithLogger(l *logr.Logger) CachedEmbedderConfigFunc {
+	return func(conf *CachedEmbedderConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewCachedEmbedder returns a new CachedEmbedder embedding the contents
+// missing from cache with embedder
+func NewCachedEmbedder(embedder core.Embedder, cache Cache, opts ...CachedEmbedderConfigFunc) *CachedEmbedder {
+	discard := logr.Discard()
+	conf := &CachedEmbedderConfig{
+		Logger: &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &CachedEmbedder{
+		embedder:  embedder,
+		cache:     cache,
+		namespace: conf.Namespace,
+		logger:    conf.Logger,
+	}
+}
+
+// Key returns the cache key of content
+func (c *CachedEmbedder) Key(content string) string {
+	h := sha256.New()
+	h.Write([]byte(c.namespace))
+	h.Write([]byte{0})
+	h.Write([]byte(content))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *CachedEmbedder) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	embeddings, err := c.GenerateEmbeddings(ctx, []string{content})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
+}
+
+// GenerateEmbeddings returns the cached embeddings of contents and embeds
+// the others, in a single call when the wrapped embedder is a
+// core.BatchEmbedder. Duplicate contents are embedded once and counted as
+// hits after the first.
+func (c *CachedEmbedder) GenerateEmbeddings(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	out := make([]*core.Embedding, len(contents))
+	keys := make([]string, len(contents))
+
+	// positions of the contents to embed, by key
+	pending := map[string][]int{}
+	var missing, missingKeys []string
+
+	for i, content := range contents {
+		keys[i] = c.Key(content)
+		if _, ok := pending[keys[i]]; ok {
+			pending[keys[i]] = append(pending[keys[i]], i)
+			continue
+		}
+
+		vector, ok, err := c.cache.Get(ctx, keys[i])
+		if err != nil {
+			c.logger.Error(err, "Could not read the embedding cache")
+		}
+		if ok {
+			out[i] = &core.Embedding{Vector: vector, Content: content}
+			continue
+		}
+
+		pending[keys[i]] = []int{i}
+		missing = append(missing, content)
+		missingKeys = append(missingKeys, keys[i])
+	}
+
+	c.mu.Lock()
+	c.misses += uint64(len(missing))
+	c.hits += uint64(len(contents) - len(missing))
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	generated, err := c.generate(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for n, e := range generated {
+		key := missingKeys[n]
+		if err := c.cache.Set(ctx, key, e.Vector); err != nil {
+			c.logger.Error(err, "Could not write the embedding cache")
+		}
+
+		for _, i := range pending[key] {
+			out[i] = &core.Embedding{Vector: e.Vector, Content: contents[i]}
+		}
+	}
+
+	return out, nil
+}
+
+// generate embeds contents with the wrapped embedder
+func (c *CachedEmbedder) generate(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	var embeddings []*core.Embedding
+	if batch, ok := c.embedder.(core.BatchEmbedder); ok && len(contents) > 1 {
+		var err error
+		embeddings, err = batch.GenerateEmbeddings(ctx, contents)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		for _, content := range contents {
+			e, err := c.embedder.GenerateEmbedding(ctx, content)
+			if err != nil {
+				return nil, err
+			}
+			embeddings = append(embeddings, e)
+		}
+	}
+
+	if len(embeddings) != len(contents) {
+		return nil, fmt.Errorf("embedder returned %d embeddings for %d contents", len(embeddings), len(contents))
+	}
+
+	return embeddings, nil
+}
+
+// Stats returns the hit and miss counters of the embedder
+func (c *CachedEmbedder) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{Hits: c.hits, Misses: c.misses}
+}
+
+// MemoryCache is a Cache keeping copies of vectors in memory, evicting the
+// least recently used ones beyond a maximum number of entries
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryEntry struct {
+	key    string
+	vector core.Vec32
+}
+
+// MemoryCacheConfig holds configuration for a MemoryCache
+type MemoryCacheConfig struct {
+	// MaxEntries caps the number of cached vectors, least recently used
+	// vectors are evicted first. Zero or less removes the cap.
+	// default 100000
+	MaxEntries int
+}
+
+// MemoryCacheConfigFunc is a function type that modifies MemoryCacheConfig
+type MemoryCacheConfigFunc func(*MemoryCacheConfig)
+
+func WithMaxEntries(n int) MemoryCacheConfigFunc {
+	return func(conf *MemoryCacheConfig) {
+		conf.MaxEntries = n
+	}
+}
+
+// NewMemoryCache returns a new MemoryCache
+func NewMemoryCache(opts ...MemoryCacheConfigFunc) *MemoryCache {
+	conf := &MemoryCacheConfig{
+		MaxEntries: 100000,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &MemoryCache{
+		maxEntries: conf.MaxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (core.Vec32, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	c.lru.MoveToFront(elem)
+
+	return append(core.Vec32(nil), elem.Value.(*memoryEntry).vector...), true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, vector core.Vec32) error {
+	vector = append(core.Vec32(nil), vector...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*memoryEntry).vector = vector
+		c.lru.MoveToFront(elem)
+		return nil
+	}
+
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key: key, vector: vector})
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+
+	return nil
+}
+
+// Len returns the number of cached vectors
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
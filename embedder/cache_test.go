@@ -0,0 +1,143 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+// failingCache fails every read and write
+type failingCache struct{}
+
+func (failingCache) Get(ctx context.Context, key string) (core.Vec32, bool, error) {
+	return nil, false, errors.New("cache down")
+}
+
+func (failingCache) Set(ctx context.Context, key string, vector core.Vec32) error {
+	return errors.New("cache down")
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	e := &fakeBatchEmbedder{}
+	c := NewCachedEmbedder(e, NewMemoryCache(), WithNamespace("model"))
+	ctx := context.Background()
+
+	first := []string{"a", "bb", "a", "ccc"}
+	embeddings, err := c.GenerateEmbeddings(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, first, embeddings)
+	if fmt.Sprint(e.batches) != "[3]" || fmt.Sprint(e.contents) != "[a bb ccc]" {
+		t.Errorf("embedded %v in batches %v, want the duplicate embedded once", e.contents, e.batches)
+	}
+	if got := c.Stats(); got != (CacheStats{Hits: 1, Misses: 3}) {
+		t.Errorf("got %+v", got)
+	}
+
+	second := []string{"ccc", "dddd", "bb", "dddd"}
+	embeddings, err = c.GenerateEmbeddings(ctx, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkOrder(t, second, embeddings)
+	if fmt.Sprint(e.contents) != "[a bb ccc dddd]" {
+		t.Errorf("embedded %v", e.contents)
+	}
+	// a single content is embedded without a batch
+	if fmt.Sprint(e.batches) != "[3]" {
+		t.Errorf("got batches %v", e.batches)
+	}
+	if got := c.Stats(); got != (CacheStats{Hits: 4, Misses: 4}) {
+		t.Errorf("got %+v", got)
+	}
+
+	// hits and misses look the same
+	for _, emb := range embeddings {
+		if emb.ID != "" || emb.Metadata != nil {
+			t.Errorf("got %+v, want the vector and the content only", emb)
+		}
+	}
+
+	emb, err := c.GenerateEmbedding(ctx, "bb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if emb.Content != "bb" || emb.Vector[0] != 2 || len(e.contents) != 4 {
+		t.Errorf("got %+v after %v", emb, e.contents)
+	}
+}
+
+func TestCachedEmbedderKey(t *testing.T) {
+	a := NewCachedEmbedder(&fakeEmbedder{}, NewMemoryCache(), WithNamespace("a"))
+	b := NewCachedEmbedder(&fakeEmbedder{}, NewMemoryCache(), WithNamespace("b"))
+
+	if a.Key("x") == b.Key("x") {
+		t.Error("namespaces share keys")
+	}
+	if a.Key("x") != a.Key("x") || a.Key("x") == a.Key("y") {
+		t.Error("keys do not follow contents")
+	}
+}
+
+func TestCachedEmbedderErrors(t *testing.T) {
+	ctx := context.Background()
+
+	// cache failures fall back to embedding
+	e := &fakeEmbedder{}
+	c := NewCachedEmbedder(e, failingCache{})
+	for i := 0; i < 2; i++ {
+		if _, err := c.GenerateEmbeddings(ctx, []string{"a", "b"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(e.contents) != 4 {
+		t.Errorf("embedded %v", e.contents)
+	}
+
+	// embedder failures are returned and cache nothing
+	cache := NewMemoryCache()
+	c = NewCachedEmbedder(&fakeEmbedder{}, cache)
+	if _, err := c.GenerateEmbeddings(ctx, []string{"a", "fail"}); err == nil {
+		t.Error("embedder error lost")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("%d vectors cached", cache.Len())
+	}
+
+	c = NewCachedEmbedder(&fakeBatchEmbedder{short: true}, cache)
+	if _, err := c.GenerateEmbeddings(ctx, []string{"a", "b"}); err == nil {
+		t.Error("missing embeddings accepted")
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(WithMaxEntries(2))
+
+	vector := core.Vec32{1, 2}
+	c.Set(ctx, "a", vector)
+	vector[0] = 9
+	c.Set(ctx, "b", core.Vec32{3})
+
+	got, ok, _ := c.Get(ctx, "a")
+	if !ok || got[0] != 1 {
+		t.Fatalf("got %v, %v", got, ok)
+	}
+	got[1] = 9
+
+	// b is now the least recently used
+	c.Set(ctx, "c", core.Vec32{4})
+	if _, ok, _ := c.Get(ctx, "b"); ok {
+		t.Error("b not evicted")
+	}
+	if got, ok, _ := c.Get(ctx, "a"); !ok || got[1] != 2 {
+		t.Errorf("got %v, %v", got, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("got %d entries", c.Len())
+	}
+}
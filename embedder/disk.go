@@ -0,0 +1,111 @@
+package embedder
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/joaopandolfi/core"
+)
+
+// ErrCorrupt is returned for cache files whose checksum does not match
+var ErrCorrupt = errors.New("corrupt cache entry")
+
+// DiskCache is a Cache keeping each vector in a file of its own, spread over
+// 256 sub-directories, so that it survives restarts and can be shared by
+// processes. Files hold the vector as little-endian float32 values followed
+// by a CRC-32C of them, and are written to a temporary file first then
+// renamed, so readers never see a partial vector.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a new DiskCache storing its files under dir, creating
+// it if needed
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	return &DiskCache{dir: dir}, nil
+}
+
+var safeKey = regexp.MustCompile(`^[0-9A-Za-z_-]{3,128}$`)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// path returns the file of key. Keys unfit for a file name are hashed.
+func (c *DiskCache) path(key string) string {
+	if !safeKey.MatchString(key) {
+		sum := sha256.Sum256([]byte(key))
+		key = hex.EncodeToString(sum[:])
+	}
+
+	return filepath.Join(c.dir, key[:2], key)
+}
+
+func (c *DiskCache) Get(ctx context.Context, key string) (core.Vec32, bool, error) {
+	data, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading cache entry: %w", err)
+	}
+
+	if len(data) < 4 || len(data)%4 != 0 {
+		return nil, false, ErrCorrupt
+	}
+
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, castagnoli) != sum {
+		return nil, false, ErrCorrupt
+	}
+
+	vector := make(core.Vec32, len(body)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(body[4*i:]))
+	}
+
+	return vector, true, nil
+}
+
+func (c *DiskCache) Set(ctx context.Context, key string, vector core.Vec32) error {
+	data := make([]byte, 4*len(vector)+4)
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	binary.LittleEndian.PutUint32(data[4*len(vector):], crc32.Checksum(data[:4*len(vector)], castagnoli))
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating cache entry: %w", err)
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("error writing cache entry: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+func TestDiskCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	c, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := map[string]core.Vec32{
+		"abc123":                  {1.5, -2, 0},
+		"key with spaces/slashes": {3},
+		"empty":                   {},
+	}
+	for key, vector := range keys {
+		if err := c.Set(ctx, key, vector); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// another cache on the same directory sees the entries
+	c, err = NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range keys {
+		got, ok, err := c.Get(ctx, key)
+		if err != nil || !ok || len(got) != len(want) {
+			t.Fatalf("%s: got %v, %v, %v", key, got, ok, err)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: got %v, want %v", key, got, want)
+			}
+		}
+	}
+
+	if _, ok, err := c.Get(ctx, "missing"); ok || err != nil {
+		t.Errorf("got %v, %v for a missing key", ok, err)
+	}
+	if _, err := os.Stat(c.path("abc123")); err != nil {
+		t.Errorf("safe key not used as the file name: %v", err)
+	}
+	if strings.Contains(c.path("key with spaces/slashes"), " ") {
+		t.Errorf("unsafe key used as the file name: %s", c.path("key with spaces/slashes"))
+	}
+}
+
+func TestDiskCacheCorrupt(t *testing.T) {
+	ctx := context.Background()
+	c, err := NewDiskCache(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(ctx, "abc123", core.Vec32{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(c.path("abc123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), data...)
+	flipped[0] ^= 1
+
+	tests := map[string][]byte{
+		"flipped bit": flipped,
+		"truncated":   data[:len(data)-4],
+		"odd length":  data[:len(data)-1],
+		"empty":       {},
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(c.path("abc123"), content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, err := c.Get(ctx, "abc123"); ok || !errors.Is(err, ErrCorrupt) {
+				t.Errorf("got %v, %v, want ErrCorrupt", ok, err)
+			}
+		})
+	}
+}
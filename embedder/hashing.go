@@ -0,0 +1,181 @@
+package embedder
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore/bm25"
+)
+
+// HashingEmbedder embeds text without any model by hashing its terms and
+// their character n-grams into a fixed number of dimensions, with a hashed
+// sign so that collisions cancel out instead of piling up (Weinberger et al.,
+// 2009). Terms are weighted by the logarithm of their frequency and vectors
+// are normalized.
+//
+// Texts sharing words or word fragments get similar vectors, which makes it
+// a deterministic, dependency free embedder for tests and a fallback for
+// offline deployments. It captures no meaning beyond shared vocabulary:
+// "car" and "automobile" are unrelated to it.
+type HashingEmbedder struct {
+	dimensions int
+	tokenizer  bm25.Tokenizer
+	minN, maxN int
+	ngramScale float64
+}
+
+// HashingEmbedderConfig holds configuration for a HashingEmbedder
+type HashingEmbedderConfig struct {
+	// Dimensions of the vectors
+	// default 512
+	Dimensions int
+
+	// Tokenizer splitting text into terms
+	// default a bm25.TextTokenizer dropping bm25.EnglishStopWords
+	Tokenizer bm25.Tokenizer
+
+	// MinNGram and MaxNGram bound the length in runes of the character
+	// n-grams hashed besides whole terms, which matches variants and typos.
+	// A MaxNGram of zero disables n-grams.
+	// default 3 and 5
+	MinNGram, MaxNGram int
+
+	// NGramWeight is the total weight of the n-grams of a term, relative to
+	// the term itself
+	// default 1
+	NGramWeight float64
+}
+
+// HashingEmbedderConfigFunc is a function type that modifies HashingEmbedderConfig
+type HashingEmbedderConfigFunc func(*HashingEmbedderConfig)
+
+func WithDimensions(n int) HashingEmbedderConfigFunc {
+	return func(conf *HashingEmbedderConfig) {
+		conf.Dimensions = n
+	}
+}
+
+func WithTokenizer(t bm25.Tokenizer) HashingEmbedderConfigFunc {
+	return func(conf *HashingEmbedderConfig) {
+		conf.Tokenizer = t
+	}
+}
+
+func WithNGrams(minN, maxN int) HashingEmbedderConfigFunc {
+	return func(conf *HashingEmbedderConfig) {
+		conf.MinNGram, conf.MaxNGram = minN, maxN
+	}
+}
+
+func WithNGramWeight(w float64) HashingEmbedderConfigFunc {
+	return func(conf *HashingEmbedderConfig) {
+		conf.NGramWeight = w
+	}
+}
+
+// NewHashingEmbedder returns a new HashingEmbedder
+func NewHashingEmbedder(opts ...HashingEmbedderConfigFunc) *HashingEmbedder {
+	conf := &HashingEmbedderConfig{
+		Dimensions:  512,
+		Tokenizer:   bm25.NewTextTokenizer(bm25.WithStopWords(bm25.EnglishStopWords...)),
+		MinNGram:    3,
+		MaxNGram:    5,
+		NGramWeight: 1,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	minN := max(conf.MinNGram, 1)
+	return &HashingEmbedder{
+		dimensions: max(conf.Dimensions, 1),
+		tokenizer:  conf.Tokenizer,
+		minN:       minN,
+		maxN:       conf.MaxNGram,
+		ngramScale: conf.NGramWeight,
+	}
+}
+
+func (h *HashingEmbedder) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	return &core.Embedding{Vector: h.Vector(content), Content: content}, nil
+}
+
+func (h *HashingEmbedder) GenerateEmbeddings(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	out := make([]*core.Embedding, len(contents))
+	for i, content := range contents {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		out[i] = &core.Embedding{Vector: h.Vector(content), Content: content}
+	}
+
+	return out, nil
+}
+
+// Vector returns the normalized vector of text, all zeros for text without
+// terms
+func (h *HashingEmbedder) Vector(text string) core.Vec32 {
+	counts := map[string]int{}
+	for _, term := range h.tokenizer.Tokenize(text) {
+		counts[term]++
+	}
+
+	acc := make([]float64, h.dimensions)
+	for term, n := range counts {
+		weight := 1 + math.Log(float64(n))
+		h.add(acc, "w:"+term, weight)
+
+		grams := h.ngrams(term)
+		for _, g := range grams {
+			h.add(acc, "g:"+g, weight*h.ngramScale/float64(len(grams)))
+		}
+	}
+
+	var norm float64
+	for _, v := range acc {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	vector := make(core.Vec32, h.dimensions)
+	if norm > 0 {
+		for i, v := range acc {
+			vector[i] = float32(v / norm)
+		}
+	}
+
+	return vector
+}
+
+// add hashes a feature into acc
+func (h *HashingEmbedder) add(acc []float64, feature string, weight float64) {
+	hash := fnv.New64a()
+	hash.Write([]byte(feature))
+	sum := hash.Sum64()
+
+	if sum>>63 == 1 {
+		weight = -weight
+	}
+	acc[(sum&(1<<63-1))%uint64(len(acc))] += weight
+}
+
+// ngrams returns the character n-grams of a term framed by < and >, so that
+// prefixes and suffixes are told apart from inner fragments
+func (h *HashingEmbedder) ngrams(term string) []string {
+	if h.maxN <= 0 {
+		return nil
+	}
+
+	runes := []rune("<" + term + ">")
+	var out []string
+	for n := h.minN; n <= h.maxN; n++ {
+		for i := 0; i+n <= len(runes); i++ {
+			out = append(out, string(runes[i:i+n]))
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,120 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+func cosine(a, b core.Vec32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+
+	return dot
+}
+
+func TestHashingEmbedderVector(t *testing.T) {
+	h := NewHashingEmbedder()
+
+	v := h.Vector("The quick brown fox jumps over the lazy dog")
+	if len(v) != 512 {
+		t.Fatalf("got %d dimensions", len(v))
+	}
+	if norm := math.Sqrt(cosine(v, v)); math.Abs(norm-1) > 1e-6 {
+		t.Errorf("got norm %v", norm)
+	}
+	if fmt.Sprint(v) != fmt.Sprint(NewHashingEmbedder().Vector("The quick brown fox jumps over the lazy dog")) {
+		t.Error("vectors differ between embedders")
+	}
+
+	for _, text := range []string{"", "  ", "the of and"} {
+		for _, x := range h.Vector(text) {
+			if x != 0 {
+				t.Errorf("%q: got a non zero vector", text)
+				break
+			}
+		}
+	}
+
+	if got := len(NewHashingEmbedder(WithDimensions(16)).Vector("fox")); got != 16 {
+		t.Errorf("got %d dimensions, want 16", got)
+	}
+}
+
+func TestHashingEmbedderSimilarity(t *testing.T) {
+	tests := map[string]struct {
+		opts                  []HashingEmbedderConfigFunc
+		text, closer, further string
+	}{
+		"shared words":   {nil, "database connection timeout", "connection timeout in the database pool", "sunny weather at the beach"},
+		"typos":          {nil, "authentication", "authentcation", "authorization"},
+		"word fragments": {nil, "kubernetes", "kubernetes-cluster", "postgres"},
+		// without n-grams, typos share nothing
+		"no n-grams": {[]HashingEmbedderConfigFunc{WithNGrams(0, 0)}, "invoice total", "invoice", "invoise total"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := NewHashingEmbedder(tt.opts...)
+
+			v := h.Vector(tt.text)
+			closer, further := cosine(v, h.Vector(tt.closer)), cosine(v, h.Vector(tt.further))
+			if closer <= further {
+				t.Errorf("%q scores %v, %q scores %v", tt.closer, closer, tt.further, further)
+			}
+		})
+	}
+}
+
+func TestHashingEmbedderNGrams(t *testing.T) {
+	tests := map[string]struct {
+		minN, maxN int
+		want       string
+	}{
+		"default":  {3, 5, "[<ca cat at> <cat cat> <cat>]"},
+		"bigrams":  {2, 2, "[<c ca at t>]"},
+		"too long": {6, 7, "[]"},
+		"disabled": {3, 0, "[]"},
+		"min zero": {0, 1, "[< c a t >]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := NewHashingEmbedder(WithNGrams(tt.minN, tt.maxN))
+			if got := fmt.Sprint(h.ngrams("cat")); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashingEmbedderBatch(t *testing.T) {
+	h := NewHashingEmbedder(WithDimensions(64), WithNGramWeight(0.5))
+	contents := []string{"alpha", "beta gamma", ""}
+
+	embeddings, err := h.GenerateEmbeddings(context.Background(), contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, content := range contents {
+		one, err := h.GenerateEmbedding(context.Background(), content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if embeddings[i].Content != content || fmt.Sprint(embeddings[i].Vector) != fmt.Sprint(one.Vector) {
+			t.Errorf("embedding %d differs from the single one", i)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h.GenerateEmbeddings(ctx, contents); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
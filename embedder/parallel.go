@@ -0,0 +1,149 @@
+// Package embedder holds core.Embedder building blocks: an adapter embedding
+// batches concurrently and a content keyed cache so that unchanged contents
+// are never embedded twice.
+package embedder
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Parallel turns an Embedder into a core.BatchEmbedder. Contents are embedded
+// concurrently, one per call, or in sub-batches of BatchSize when the wrapped
+// embedder is itself a core.BatchEmbedder, which keeps requests under the
+// batch limits of embedding APIs.
+type Parallel struct {
+	embedder    core.Embedder
+	concurrency int
+	batchSize   int
+}
+
+// ParallelConfig holds configuration for a Parallel embedder
+type ParallelConfig struct {
+	// Concurrency is the number of calls made at once
+	// default 8
+	Concurrency int
+
+	// BatchSize is the number of contents per call to a wrapped
+	// core.BatchEmbedder
+	// default 64
+	BatchSize int
+}
+
+// ParallelConfigFunc is a function type that modifies ParallelConfig
+type ParallelConfigFunc func(*ParallelConfig)
+
+func WithConcurrency(n int) ParallelConfigFunc {
+	return func(conf *ParallelConfig) {
+		conf.Concurrency = n
+	}
+}
+
+func WithBatchSize(n int) ParallelConfigFunc {
+	return func(conf *ParallelConfig) {
+		conf.BatchSize = n
+	}
+}
+
+// NewParallel returns a new Parallel embedder wrapping embedder
+func NewParallel(embedder core.Embedder, opts ...ParallelConfigFunc) *Parallel {
+	conf := &ParallelConfig{
+		Concurrency: 8,
+		BatchSize:   64,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Parallel{
+		embedder:    embedder,
+		concurrency: max(conf.Concurrency, 1),
+		batchSize:   max(conf.BatchSize, 1),
+	}
+}
+
+func (p *Parallel) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	return p.embedder.GenerateEmbedding(ctx, content)
+}
+
+// GenerateEmbeddings embeds contents concurrently. The first error cancels
+// the calls not yet made.
+func (p *Parallel) GenerateEmbeddings(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	size := 1
+	batch, isBatch := p.embedder.(core.BatchEmbedder)
+	if isBatch {
+		size = p.batchSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	out := make([]*core.Embedding, len(contents))
+	starts := make(chan int)
+
+	workers := min(p.concurrency, (len(contents)+size-1)/size)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range starts {
+				end := min(start+size, len(contents))
+
+				var err error
+				if isBatch {
+					err = p.batch(ctx, batch, contents[start:end], out[start:end])
+				} else {
+					out[start], err = p.embedder.GenerateEmbedding(ctx, contents[start])
+				}
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for start := 0; start < len(contents); start += size {
+		select {
+		case starts <- start:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(starts)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func (p *Parallel) batch(ctx context.Context, batch core.BatchEmbedder, contents []string, out []*core.Embedding) error {
+	embeddings, err := batch.GenerateEmbeddings(ctx, contents)
+	if err != nil {
+		return err
+	}
+	if len(embeddings) != len(contents) {
+		return fmt.Errorf("embedder returned %d embeddings for %d contents", len(embeddings), len(contents))
+	}
+
+	copy(out, embeddings)
+	return nil
+}
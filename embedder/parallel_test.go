@@ -0,0 +1,153 @@
+package embedder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+// fakeEmbedder embeds a content into a vector holding its length, failing on
+// the content "fail", and records its calls
+type fakeEmbedder struct {
+	mu       sync.Mutex
+	contents []string
+
+	active, maxActive atomic.Int32
+}
+
+func (e *fakeEmbedder) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	if n := e.active.Add(1); n > e.maxActive.Load() {
+		e.maxActive.Store(n)
+	}
+	defer e.active.Add(-1)
+
+	e.mu.Lock()
+	e.contents = append(e.contents, content)
+	e.mu.Unlock()
+
+	if content == "fail" {
+		return nil, errors.New("embedding failed")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return &core.Embedding{ID: "id-" + content, Vector: core.Vec32{float32(len(content))}, Content: content}, nil
+}
+
+// fakeBatchEmbedder is a fakeEmbedder recording the size of its batches
+type fakeBatchEmbedder struct {
+	fakeEmbedder
+	batches []int
+	short   bool
+}
+
+func (e *fakeBatchEmbedder) GenerateEmbeddings(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	e.mu.Lock()
+	e.batches = append(e.batches, len(contents))
+	e.mu.Unlock()
+
+	out := make([]*core.Embedding, 0, len(contents))
+	for _, content := range contents {
+		emb, err := e.GenerateEmbedding(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, emb)
+	}
+	if e.short {
+		out = out[1:]
+	}
+
+	return out, nil
+}
+
+func contentsOf(n int) []string {
+	contents := make([]string, n)
+	for i := range contents {
+		contents[i] = fmt.Sprintf("content %d %s", i, strings.Repeat("x", i))
+	}
+
+	return contents
+}
+
+func checkOrder(t *testing.T, contents []string, embeddings []*core.Embedding) {
+	t.Helper()
+
+	if len(embeddings) != len(contents) {
+		t.Fatalf("got %d embeddings for %d contents", len(embeddings), len(contents))
+	}
+	for i, e := range embeddings {
+		if e.Content != contents[i] || e.Vector[0] != float32(len(contents[i])) {
+			t.Errorf("embedding %d is of %q", i, e.Content)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	contents := contentsOf(50)
+
+	t.Run("one call per content", func(t *testing.T) {
+		e := &fakeEmbedder{}
+		embeddings, err := NewParallel(e, WithConcurrency(4)).GenerateEmbeddings(context.Background(), contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkOrder(t, contents, embeddings)
+		if len(e.contents) != len(contents) {
+			t.Errorf("%d calls for %d contents", len(e.contents), len(contents))
+		}
+		if e.maxActive.Load() > 4 {
+			t.Errorf("%d calls at once, want at most 4", e.maxActive.Load())
+		}
+	})
+
+	t.Run("sub-batches", func(t *testing.T) {
+		e := &fakeBatchEmbedder{}
+		embeddings, err := NewParallel(e, WithConcurrency(1), WithBatchSize(16)).GenerateEmbeddings(context.Background(), contents)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkOrder(t, contents, embeddings)
+		if fmt.Sprint(e.batches) != "[16 16 16 2]" {
+			t.Errorf("got batches %v", e.batches)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		failing := append(contentsOf(3), "fail")
+		if _, err := NewParallel(&fakeEmbedder{}).GenerateEmbeddings(context.Background(), failing); err == nil || err.Error() != "embedding failed" {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("short batch", func(t *testing.T) {
+		if _, err := NewParallel(&fakeBatchEmbedder{short: true}).GenerateEmbeddings(context.Background(), contents); err == nil {
+			t.Error("missing embeddings accepted")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := NewParallel(&fakeEmbedder{}).GenerateEmbeddings(ctx, contents); !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("nothing to embed", func(t *testing.T) {
+		embeddings, err := NewParallel(&fakeEmbedder{}).GenerateEmbeddings(context.Background(), nil)
+		if err != nil || len(embeddings) != 0 {
+			t.Errorf("got %v, %v", embeddings, err)
+		}
+	})
+}
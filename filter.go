@@ -0,0 +1,347 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrInvalidFilter is returned for searches whose filter is malformed
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// FilterOp is the operator of a Filter
+type FilterOp string
+
+const (
+	// FilterEq matches embeddings whose field equals Value. A list field
+	// matches when any of its elements does.
+	FilterEq FilterOp = "eq"
+	// FilterIn matches embeddings whose field equals one of Values
+	FilterIn FilterOp = "in"
+	// FilterRange matches embeddings whose field lies within the bounds set
+	// among Gt, Gte, Lt and Lte
+	FilterRange FilterOp = "range"
+	// FilterExists matches embeddings having the field
+	FilterExists FilterOp = "exists"
+	// FilterAnd matches embeddings matching every one of Filters
+	FilterAnd FilterOp = "and"
+	// FilterOr matches embeddings matching any of Filters
+	FilterOr FilterOp = "or"
+	// FilterNot matches embeddings not matching its single filter
+	FilterNot FilterOp = "not"
+)
+
+// Filter is an expression over the metadata of embeddings restricting a
+// search. It marshals to JSON as is, for instance:
+//
+//	{"op": "and", "filters": [
+//	  {"op": "eq", "field": "tenant", "value": "acme"},
+//	  {"op": "range", "field": "published", "gte": "2024-01-01"}
+//	]}
+//
+// Values compare as numbers when both sides are numeric, as times when
+// either side is a time.Time and the other a time or an RFC 3339 string, as
+// strings or booleans otherwise. Values of different kinds never match.
+type Filter struct {
+	Op    FilterOp `json:"op"`
+	Field string   `json:"field,omitempty"`
+
+	Value  interface{}   `json:"value,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+
+	Gt  interface{} `json:"gt,omitempty"`
+	Gte interface{} `json:"gte,omitempty"`
+	Lt  interface{} `json:"lt,omitempty"`
+	Lte interface{} `json:"lte,omitempty"`
+
+	Filters []*Filter `json:"filters,omitempty"`
+}
+
+// Eq returns a filter matching embeddings whose field equals value
+func Eq(field string, value interface{}) *Filter {
+	return &Filter{Op: FilterEq, Field: field, Value: value}
+}
+
+// In returns a filter matching embeddings whose field equals one of values
+func In(field string, values ...interface{}) *Filter {
+	return &Filter{Op: FilterIn, Field: field, Values: values}
+}
+
+// Range returns a filter matching embeddings whose field lies between gte
+// and lte, both inclusive. A nil bound is left open.
+func Range(field string, gte, lte interface{}) *Filter {
+	return &Filter{Op: FilterRange, Field: field, Gte: gte, Lte: lte}
+}
+
+// Exists returns a filter matching embeddings having the field
+func Exists(field string) *Filter {
+	return &Filter{Op: FilterExists, Field: field}
+}
+
+// And returns a filter matching embeddings matching every filter
+func And(filters ...*Filter) *Filter {
+	return &Filter{Op: FilterAnd, Filters: filters}
+}
+
+// Or returns a filter matching embeddings matching any filter
+func Or(filters ...*Filter) *Filter {
+	return &Filter{Op: FilterOr, Filters: filters}
+}
+
+// Not returns a filter matching embeddings not matching f
+func Not(f *Filter) *Filter {
+	return &Filter{Op: FilterNot, Filters: []*Filter{f}}
+}
+
+// Validate reports whether the filter is well formed
+func (f *Filter) Validate() error {
+	if f == nil {
+		return fmt.Errorf("%w: nil filter", ErrInvalidFilter)
+	}
+
+	switch f.Op {
+	case FilterEq, FilterExists:
+	case FilterIn:
+		if len(f.Values) == 0 {
+			return fmt.Errorf("%w: %q needs values", ErrInvalidFilter, f.Op)
+		}
+	case FilterRange:
+		if f.Gt == nil && f.Gte == nil && f.Lt == nil && f.Lte == nil {
+			return fmt.Errorf("%w: %q needs at least one bound", ErrInvalidFilter, f.Op)
+		}
+	case FilterAnd, FilterOr, FilterNot:
+		if len(f.Filters) == 0 || (f.Op == FilterNot && len(f.Filters) != 1) {
+			return fmt.Errorf("%w: wrong number of filters for %q", ErrInvalidFilter, f.Op)
+		}
+		for _, sub := range f.Filters {
+			if err := sub.Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, f.Op)
+	}
+
+	if f.Field == "" {
+		return fmt.Errorf("%w: %q needs a field", ErrInvalidFilter, f.Op)
+	}
+
+	return nil
+}
+
+// Match reports whether metadata satisfies the filter. A nil filter matches
+// everything.
+func (f *Filter) Match(metadata map[string]interface{}) bool {
+	if f == nil {
+		return true
+	}
+
+	switch f.Op {
+	case FilterAnd:
+		for _, sub := range f.Filters {
+			if !sub.Match(metadata) {
+				return false
+			}
+		}
+		return true
+	case FilterOr:
+		for _, sub := range f.Filters {
+			if sub.Match(metadata) {
+				return true
+			}
+		}
+		return false
+	case FilterNot:
+		return len(f.Filters) == 1 && !f.Filters[0].Match(metadata)
+	}
+
+	value, ok := metadata[f.Field]
+	if !ok || value == nil {
+		return false
+	}
+
+	switch f.Op {
+	case FilterExists:
+		return true
+	case FilterEq:
+		return anyElement(value, func(v interface{}) bool {
+			c, ok := compareValues(v, f.Value)
+			return ok && c == 0
+		})
+	case FilterIn:
+		return anyElement(value, func(v interface{}) bool {
+			for _, want := range f.Values {
+				if c, ok := compareValues(v, want); ok && c == 0 {
+					return true
+				}
+			}
+			return false
+		})
+	case FilterRange:
+		return anyElement(value, f.inRange)
+	}
+
+	return false
+}
+
+func (f *Filter) inRange(v interface{}) bool {
+	bounds := []struct {
+		bound  interface{}
+		accept func(int) bool
+	}{
+		{f.Gt, func(c int) bool { return c > 0 }},
+		{f.Gte, func(c int) bool { return c >= 0 }},
+		{f.Lt, func(c int) bool { return c < 0 }},
+		{f.Lte, func(c int) bool { return c <= 0 }},
+	}
+
+	for _, b := range bounds {
+		if b.bound == nil {
+			continue
+		}
+
+		c, ok := compareValues(v, b.bound)
+		if !ok || !b.accept(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// anyElement applies match to value, or to each of its elements when it is a
+// list
+func anyElement(value interface{}, match func(interface{}) bool) bool {
+	rv := reflect.ValueOf(value)
+	if (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return match(value)
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if match(rv.Index(i).Interface()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compareValues orders a against b, reporting false when they are not
+// comparable
+func compareValues(a, b interface{}) (int, bool) {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		return cmpOrdered(fa, fb), true
+	}
+
+	ta, aTime := toTime(a, false)
+	tb, bTime := toTime(b, false)
+	if aTime || bTime {
+		if !aTime {
+			ta, aTime = toTime(a, true)
+		}
+		if !bTime {
+			tb, bTime = toTime(b, true)
+		}
+		if !aTime || !bTime {
+			return 0, false
+		}
+		return ta.Compare(tb), true
+	}
+
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(a, b), true
+	case bool:
+		b, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case a == b:
+			return 0, true
+		case b:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+
+	return 0, false
+}
+
+func cmpOrdered(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// toTime converts v to a time. Strings, in RFC 3339 or as a plain date, are
+// only parsed when parse is set.
+func toTime(v interface{}, parse bool) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		if !parse {
+			return time.Time{}, false
+		}
+		for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
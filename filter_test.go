@@ -0,0 +1,210 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompareValues(t *testing.T) {
+	day := time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		a, b interface{}
+		want int
+		ok   bool
+	}{
+		"ints":                 {3, 3, 0, true},
+		"int and float":        {3, 3.0, 0, true},
+		"int and float order":  {2, 2.5, -1, true},
+		"float32 and int64":    {float32(2.5), int64(2), 1, true},
+		"uint and int8":        {uint(7), int8(7), 0, true},
+		"json number":          {json.Number("10"), 9, 1, true},
+		"invalid json number":  {json.Number("x"), 1, 0, false},
+		"number and string":    {1, "1", 0, false},
+		"string and number":    {"1", 1, 0, false},
+		"strings":              {"apple", "banana", -1, true},
+		"numeric strings":      {"10", "9", -1, true},
+		"times":                {day, day.Add(time.Hour), -1, true},
+		"time and rfc 3339":    {day, "2024-03-15T00:00:00Z", 0, true},
+		"time and offset":      {day, "2024-03-15T01:00:00+01:00", 0, true},
+		"rfc 3339 and time":    {"2024-03-16T00:00:00Z", day, 1, true},
+		"time and date":        {day, "2024-03-14", 1, true},
+		"time and nanoseconds": {day, "2024-03-15T00:00:00.000000001Z", -1, true},
+		"time and bad string":  {day, "15/03/2024", 0, false},
+		"time and number":      {day, 1710460800, 0, false},
+		"bools":                {false, true, -1, true},
+		"equal bools":          {true, true, 0, true},
+		"bool and string":      {true, "true", 0, false},
+		"unsupported":          {[]int{1}, []int{1}, 0, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := compareValues(tt.a, tt.b)
+			if ok != tt.ok || (ok && got != tt.want) {
+				t.Errorf("got %d, %v, want %d, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	metadata := map[string]interface{}{
+		"source":    "handbook.pdf",
+		"page":      12,
+		"score":     0.75,
+		"year":      int64(2024),
+		"published": time.Date(2024, 3, 15, 9, 30, 0, 0, time.UTC),
+		"updated":   "2024-06-01T12:00:00Z",
+		"tags":      []string{"hr", "leave"},
+		"versions":  []interface{}{1, 2.5, "beta"},
+		"draft":     false,
+		"checksum":  []byte("abc"),
+		"deleted":   nil,
+	}
+
+	tests := map[string]struct {
+		filter *Filter
+		want   bool
+	}{
+		"nil filter":              {nil, true},
+		"eq string":               {Eq("source", "handbook.pdf"), true},
+		"eq other string":         {Eq("source", "faq.md"), false},
+		"eq int as float":         {Eq("page", 12.0), true},
+		"eq float as int":         {Eq("score", 1), false},
+		"eq int64 as int":         {Eq("year", 2024), true},
+		"eq number as string":     {Eq("page", "12"), false},
+		"eq bool":                 {Eq("draft", false), true},
+		"eq missing field":        {Eq("author", "x"), false},
+		"eq nil field":            {Eq("deleted", nil), false},
+		"eq list element":         {Eq("tags", "leave"), true},
+		"eq no list element":      {Eq("tags", "pay"), false},
+		"eq mixed list":           {Eq("versions", 2.5), true},
+		"eq mixed list string":    {Eq("versions", "beta"), true},
+		"eq bytes are no list":    {Eq("checksum", 97), false},
+		"in":                      {In("source", "faq.md", "handbook.pdf"), true},
+		"in none":                 {In("source", "faq.md", "policy.md"), false},
+		"in number":               {In("page", 11, 12.0), true},
+		"in list":                 {In("tags", "pay", "hr"), true},
+		"in list none":            {In("tags", "pay", "it"), false},
+		"range ints":              {Range("page", 10, 12), true},
+		"range bounds inclusive":  {Range("page", 12, 12), true},
+		"range below":             {Range("page", 13, nil), false},
+		"range open low":          {Range("score", nil, 1), true},
+		"range gt exclusive":      {&Filter{Op: FilterRange, Field: "page", Gt: 12}, false},
+		"range lt exclusive":      {&Filter{Op: FilterRange, Field: "page", Lt: 12}, false},
+		"range gt and lt":         {&Filter{Op: FilterRange, Field: "score", Gt: 0.5, Lt: 0.8}, true},
+		"range time by string":    {Range("published", "2024-03-01", "2024-03-31"), true},
+		"range time by rfc 3339":  {Range("published", "2024-03-15T09:30:00Z", nil), true},
+		"range time after":        {Range("published", "2024-03-15T09:30:01Z", nil), false},
+		"range time by time":      {Range("published", nil, time.Date(2024, 3, 15, 10, 30, 0, 0, time.FixedZone("CET", 3600))), true},
+		"range time bad bound":    {Range("published", "March 2024", nil), false},
+		"range rfc 3339 strings":  {Range("updated", "2024-01-01T00:00:00Z", "2024-12-31T00:00:00Z"), true},
+		"range string to time":    {Range("updated", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC), nil), true},
+		"range strings":           {Range("source", "a", "i"), true},
+		"range strings outside":   {Range("source", "i", nil), false},
+		"range number and string": {Range("page", "1", "99"), false},
+		"range list":              {Range("versions", 2, 3), true},
+		"range list none":         {Range("tags", "m", "z"), false},
+		"exists":                  {Exists("tags"), true},
+		"exists missing":          {Exists("author"), false},
+		"exists nil":              {Exists("deleted"), false},
+		"and":                     {And(Eq("source", "handbook.pdf"), Range("page", 10, nil)), true},
+		"and one fails":           {And(Eq("source", "handbook.pdf"), Range("page", 20, nil)), false},
+		"or":                      {Or(Eq("source", "faq.md"), Eq("tags", "hr")), true},
+		"or none":                 {Or(Eq("source", "faq.md"), Exists("author")), false},
+		"not":                     {Not(Eq("source", "faq.md")), true},
+		"not matching":            {Not(Exists("tags")), false},
+		"not missing field":       {Not(Eq("author", "x")), true},
+		"not not":                 {Not(Not(Eq("draft", false))), true},
+		"not with two filters":    {&Filter{Op: FilterNot, Filters: []*Filter{Exists("a"), Exists("b")}}, false},
+		"unknown operator":        {&Filter{Op: "like", Field: "source", Value: "handbook.pdf"}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.filter.Match(metadata); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterJSON(t *testing.T) {
+	f := And(
+		Eq("tenant", "acme"),
+		Range("published", "2024-01-01", nil),
+		Not(In("year", 2020, 2021)),
+	)
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"op":"and","filters":[{"op":"eq","field":"tenant","value":"acme"},` +
+		`{"op":"range","field":"published","gte":"2024-01-01"},` +
+		`{"op":"not","filters":[{"op":"in","field":"year","values":[2020,2021]}]}]}`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	// numbers decode as float64 and still match integers
+	decoded := &Filter{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := map[string]interface{}{"tenant": "acme", "published": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), "year": 2024}
+	if !decoded.Match(metadata) {
+		t.Error("decoded filter does not match")
+	}
+	metadata["year"] = 2021
+	if decoded.Match(metadata) {
+		t.Error("decoded filter matches an excluded year")
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	tests := map[string]struct {
+		filter *Filter
+		valid  bool
+	}{
+		"eq":                 {Eq("a", 1), true},
+		"eq nil value":       {Eq("a", nil), true},
+		"exists":             {Exists("a"), true},
+		"in":                 {In("a", 1), true},
+		"range":              {Range("a", 1, nil), true},
+		"range gt":           {&Filter{Op: FilterRange, Field: "a", Gt: 1}, true},
+		"nested":             {And(Or(Eq("a", 1), Not(Exists("b"))), In("c", "x")), true},
+		"nil":                {nil, false},
+		"no field":           {Eq("", 1), false},
+		"no operator":        {&Filter{Field: "a"}, false},
+		"unknown operator":   {&Filter{Op: "like", Field: "a"}, false},
+		"in without values":  {In("a"), false},
+		"range no bounds":    {Range("a", nil, nil), false},
+		"and empty":          {And(), false},
+		"or empty":           {Or(), false},
+		"not empty":          {&Filter{Op: FilterNot}, false},
+		"not two":            {&Filter{Op: FilterNot, Filters: []*Filter{Exists("a"), Exists("b")}}, false},
+		"nested invalid":     {And(Eq("a", 1), Or(In("b"))), false},
+		"nested nil":         {Or(Eq("a", 1), nil), false},
+		"range field needed": {&Filter{Op: FilterRange, Gte: 1}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.filter.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidFilter) {
+				t.Errorf("got %v, want ErrInvalidFilter", err)
+			}
+		})
+	}
+}
@@ -1,5 +1,16 @@
 module github.com/joaopandolfi/core
 
-go 1.23.3
+go 1.25.0
 
-require github.com/go-logr/logr v1.4.2
+require (
+	github.com/dop251/goja v0.0.0-20241024094426-79f3a7efcdbd
+	github.com/go-logr/logr v1.4.2
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/dlclark/regexp2 v1.11.4 // indirect
+	github.com/go-sourcemap/sourcemap v2.1.3+incompatible // indirect
+	github.com/google/pprof v0.0.0-20230207041349-798e818bf904 // indirect
+)
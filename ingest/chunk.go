@@ -0,0 +1,477 @@
+package ingest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chunker splits a document into chunks small enough to embed
+type Chunker interface {
+	Chunk(doc *Document) []*Document
+}
+
+// ChunkerFunc adapts a function to the Chunker interface
+type ChunkerFunc func(doc *Document) []*Document
+
+func (f ChunkerFunc) Chunk(doc *Document) []*Document {
+	return f(doc)
+}
+
+// LengthFunc measures text for chunk sizes, for instance in tokens
+type LengthFunc func(text string) int
+
+// RuneCount measures text in runes. It is the default LengthFunc.
+func RuneCount(text string) int {
+	return utf8.RuneCountInString(text)
+}
+
+// ChunkConfig holds configuration shared by the chunkers
+type ChunkConfig struct {
+	// Size is the maximum length of a chunk
+	// default 1000
+	Size int
+
+	// Overlap is the length of text repeated from the end of a chunk at the
+	// start of the next one, keeping context across boundaries. The
+	// sentence chunker counts it in sentences.
+	// default 100, 1 for the sentence chunker
+	Overlap int
+
+	// Length measures text
+	// default RuneCount
+	Length LengthFunc
+
+	// Separators tried in order by the recursive chunker, the empty string
+	// splitting between runes
+	// default paragraphs, lines, sentences, words, runes
+	Separators []string
+}
+
+// ChunkConfigFunc is a function type that modifies ChunkConfig
+type ChunkConfigFunc func(*ChunkConfig)
+
+func WithSize(size int) ChunkConfigFunc {
+	return func(conf *ChunkConfig) {
+		conf.Size = size
+	}
+}
+
+func WithOverlap(overlap int) ChunkConfigFunc {
+	return func(conf *ChunkConfig) {
+		conf.Overlap = overlap
+	}
+}
+
+func WithLength(f LengthFunc) ChunkConfigFunc {
+	return func(conf *ChunkConfig) {
+		conf.Length = f
+	}
+}
+
+func WithSeparators(separators ...string) ChunkConfigFunc {
+	return func(conf *ChunkConfig) {
+		conf.Separators = separators
+	}
+}
+
+func newChunkConfig(overlap int, opts []ChunkConfigFunc) *ChunkConfig {
+	conf := &ChunkConfig{
+		Size:       1000,
+		Overlap:    overlap,
+		Length:     RuneCount,
+		Separators: []string{"\n\n", "\n", ". ", " ", ""},
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	conf.Size = max(conf.Size, 1)
+	conf.Overlap = min(max(conf.Overlap, 0), conf.Size-1)
+
+	return conf
+}
+
+// chunksOf turns texts into chunks of doc, numbered in order. Chunks inherit
+// the metadata of doc and get the "document_id" and "chunk" fields, plus
+// extra fields when set.
+func chunksOf(doc *Document, texts []string, extra []map[string]interface{}) []*Document {
+	out := make([]*Document, 0, len(texts))
+	for i, text := range texts {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		metadata := make(map[string]interface{}, len(doc.Metadata)+3)
+		for k, v := range doc.Metadata {
+			metadata[k] = v
+		}
+		if extra != nil {
+			for k, v := range extra[i] {
+				metadata[k] = v
+			}
+		}
+
+		n := len(out)
+		metadata[MetaDocumentID] = doc.ID
+		metadata[MetaChunk] = n
+
+		out = append(out, &Document{
+			ID:       fmt.Sprintf("%s#%d", doc.ID, n),
+			Content:  strings.TrimSpace(text),
+			Metadata: metadata,
+		})
+	}
+
+	return out
+}
+
+// FixedSizeChunker cuts text into chunks of a fixed length, moving cuts back
+// to the nearest whitespace when there is some in the last fifth of a chunk
+type FixedSizeChunker struct {
+	conf *ChunkConfig
+}
+
+// NewFixedSizeChunker returns a new FixedSizeChunker
+func NewFixedSizeChunker(opts ...ChunkConfigFunc) *FixedSizeChunker {
+	return &FixedSizeChunker{conf: newChunkConfig(100, opts)}
+}
+
+func (c *FixedSizeChunker) Chunk(doc *Document) []*Document {
+	return chunksOf(doc, c.split(doc.Content), nil)
+}
+
+func (c *FixedSizeChunker) split(text string) []string {
+	runes := []rune(text)
+	var out []string
+
+	for start := 0; start < len(runes); {
+		end := c.fit(runes, start)
+		if end < len(runes) {
+			// back off to a word boundary
+			for cut := end; cut > start+(end-start)*4/5; cut-- {
+				if isSpace(runes[cut-1]) {
+					end = cut
+					break
+				}
+			}
+		}
+
+		out = append(out, string(runes[start:end]))
+		if end >= len(runes) {
+			break
+		}
+
+		next := c.back(runes, start, end)
+		start = max(next, start+1)
+	}
+
+	return out
+}
+
+// fit returns the end of the longest chunk starting at start
+func (c *FixedSizeChunker) fit(runes []rune, start int) int {
+	end := min(start+c.conf.Size, len(runes))
+	for end > start+1 && c.conf.Length(string(runes[start:end])) > c.conf.Size {
+		end--
+	}
+
+	return end
+}
+
+// back returns the start of the next chunk, overlapping the end of the
+// current one
+func (c *FixedSizeChunker) back(runes []rune, start, end int) int {
+	if c.conf.Overlap == 0 {
+		return end
+	}
+
+	next := end
+	for next > start && c.conf.Length(string(runes[next-1:end])) <= c.conf.Overlap {
+		next--
+	}
+
+	// start the overlap on a word
+	if next > start && !isSpace(runes[next-1]) {
+		for next < end && !isSpace(runes[next-1]) {
+			next++
+		}
+	}
+
+	return next
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
+}
+
+// RecursiveChunker splits text on the coarsest separator that occurs in it,
+// paragraphs first, then merges the pieces back into chunks up to the size.
+// Pieces still too long are split again on the next separator. Chunks follow
+// the structure of the text as much as the size allows.
+type RecursiveChunker struct {
+	conf *ChunkConfig
+}
+
+// NewRecursiveChunker returns a new RecursiveChunker
+func NewRecursiveChunker(opts ...ChunkConfigFunc) *RecursiveChunker {
+	return &RecursiveChunker{conf: newChunkConfig(100, opts)}
+}
+
+func (c *RecursiveChunker) Chunk(doc *Document) []*Document {
+	return chunksOf(doc, c.split(doc.Content, c.conf.Separators), nil)
+}
+
+func (c *RecursiveChunker) split(text string, separators []string) []string {
+	if c.conf.Length(text) <= c.conf.Size {
+		return []string{text}
+	}
+
+	// pick the first separator present in the text
+	sep, rest := "", []string(nil)
+	for i, s := range separators {
+		if s == "" || strings.Contains(text, s) {
+			sep, rest = s, separators[i+1:]
+			break
+		}
+	}
+
+	var pieces []string
+	if sep == "" {
+		for _, r := range text {
+			pieces = append(pieces, string(r))
+		}
+	} else {
+		parts := strings.SplitAfter(text, sep)
+		for _, p := range parts {
+			if p != "" {
+				pieces = append(pieces, p)
+			}
+		}
+	}
+
+	// pieces still too long are split with the finer separators, between
+	// merged runs of the others
+	var out, run []string
+	for _, p := range pieces {
+		if c.conf.Length(p) <= c.conf.Size || len(rest) == 0 {
+			run = append(run, p)
+			continue
+		}
+
+		out = append(out, c.merge(run)...)
+		out = append(out, c.split(p, rest)...)
+		run = nil
+	}
+
+	return append(out, c.merge(run)...)
+}
+
+// merge joins consecutive pieces into chunks up to the size, starting each
+// chunk with the trailing pieces of the previous one up to the overlap
+func (c *RecursiveChunker) merge(pieces []string) []string {
+	var (
+		out     []string
+		current []string
+		lengths []int
+		total   int
+	)
+
+	for _, p := range pieces {
+		l := c.conf.Length(p)
+		if total+l > c.conf.Size && len(current) > 0 {
+			out = append(out, strings.Join(current, ""))
+
+			// drop leading pieces until what is left fits the overlap and
+			// leaves room for the new piece
+			for len(current) > 0 && (total > c.conf.Overlap || total+l > c.conf.Size) {
+				total -= lengths[0]
+				current, lengths = current[1:], lengths[1:]
+			}
+		}
+
+		current = append(current, p)
+		lengths = append(lengths, l)
+		total += l
+	}
+
+	if len(current) > 0 {
+		out = append(out, strings.Join(current, ""))
+	}
+
+	return out
+}
+
+// MarkdownChunker splits Markdown along its headings, recording the path of
+// headings leading to each chunk in its "section" metadata field, such as
+// "Install > Linux". Sections longer than the size are split further by a
+// RecursiveChunker, each piece starting with the section heading. Headings
+// inside fenced code blocks are ignored.
+type MarkdownChunker struct {
+	conf *ChunkConfig
+}
+
+// NewMarkdownChunker returns a new MarkdownChunker
+func NewMarkdownChunker(opts ...ChunkConfigFunc) *MarkdownChunker {
+	return &MarkdownChunker{conf: newChunkConfig(100, opts)}
+}
+
+var headingPattern = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+func (c *MarkdownChunker) Chunk(doc *Document) []*Document {
+	type section struct {
+		path string
+		text strings.Builder
+	}
+
+	var (
+		sections []*section
+		headings []string
+		inFence  bool
+	)
+	current := &section{}
+	sections = append(sections, current)
+
+	for _, line := range strings.SplitAfter(doc.Content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+
+		if m := headingPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n")); m != nil && !inFence {
+			level := len(m[1])
+			if len(headings) >= level {
+				headings = headings[:level-1]
+			}
+			for len(headings) < level-1 {
+				headings = append(headings, "")
+			}
+			headings = append(headings, m[2])
+
+			current = &section{path: joinHeadings(headings)}
+			sections = append(sections, current)
+		}
+
+		current.text.WriteString(line)
+	}
+
+	var (
+		texts []string
+		extra []map[string]interface{}
+	)
+	for _, s := range sections {
+		text := s.text.String()
+		meta := map[string]interface{}{}
+		if s.path != "" {
+			meta[MetaSection] = s.path
+		}
+
+		if c.conf.Length(text) <= c.conf.Size {
+			texts = append(texts, text)
+			extra = append(extra, meta)
+			continue
+		}
+
+		// sections split further repeat their heading at the top of each
+		// piece, so that no piece is left without its context
+		heading, body := "", text
+		if s.path != "" {
+			heading, body, _ = strings.Cut(text, "\n")
+			heading += "\n\n"
+		}
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+
+		sub := &RecursiveChunker{conf: c.conf}
+		if h := c.conf.Length(heading); h < c.conf.Size/2 {
+			conf := *c.conf
+			conf.Size -= h
+			conf.Overlap = min(conf.Overlap, conf.Size-1)
+			sub.conf = &conf
+		} else {
+			heading = ""
+		}
+
+		for _, piece := range sub.split(strings.TrimLeft(body, "\n"), c.conf.Separators) {
+			if strings.TrimSpace(piece) == "" {
+				continue
+			}
+			texts = append(texts, heading+strings.TrimSpace(piece))
+			extra = append(extra, meta)
+		}
+	}
+
+	return chunksOf(doc, texts, extra)
+}
+
+func joinHeadings(headings []string) string {
+	var parts []string
+	for _, h := range headings {
+		if h != "" {
+			parts = append(parts, h)
+		}
+	}
+
+	return strings.Join(parts, " > ")
+}
+
+// SentenceChunker groups whole sentences into chunks up to the size. Its
+// overlap counts sentences. A sentence longer than the size forms a chunk
+// of its own.
+type SentenceChunker struct {
+	conf *ChunkConfig
+}
+
+// NewSentenceChunker returns a new SentenceChunker
+func NewSentenceChunker(opts ...ChunkConfigFunc) *SentenceChunker {
+	return &SentenceChunker{conf: newChunkConfig(1, opts)}
+}
+
+// sentenceEnd matches the end of a sentence: terminal punctuation, optional
+// closing quotes or brackets, then whitespace
+var sentenceEnd = regexp.MustCompile(`[.!?…]+["'”’)\]]*\s+`)
+
+// Sentences splits text into sentences, keeping their trailing whitespace
+func Sentences(text string) []string {
+	var out []string
+	start := 0
+	for _, loc := range sentenceEnd.FindAllStringIndex(text, -1) {
+		out = append(out, text[start:loc[1]])
+		start = loc[1]
+	}
+	if start < len(text) {
+		out = append(out, text[start:])
+	}
+
+	return out
+}
+
+func (c *SentenceChunker) Chunk(doc *Document) []*Document {
+	sentences := Sentences(doc.Content)
+
+	var texts []string
+	for start := 0; start < len(sentences); {
+		end := start + 1
+		length := c.conf.Length(sentences[start])
+		for end < len(sentences) {
+			l := c.conf.Length(sentences[end])
+			if length+l > c.conf.Size {
+				break
+			}
+			length += l
+			end++
+		}
+
+		texts = append(texts, strings.Join(sentences[start:end], ""))
+		if end >= len(sentences) {
+			break
+		}
+
+		start = max(end-c.conf.Overlap, start+1)
+	}
+
+	return chunksOf(doc, texts, nil)
+}
@@ -0,0 +1,253 @@
+package ingest
+
+import (
+	"context"
+	"html"
+	"io"
+	"strings"
+)
+
+// HTMLLoader reads an HTML page as a single document of plain text. Scripts,
+// styles and other non-content elements are dropped, block elements start
+// new lines, and headings are rendered as Markdown headings so that
+// documents can be cut along them by a MarkdownChunker. The title is taken
+// from the title element or else from the first h1.
+type HTMLLoader struct{}
+
+// NewHTMLLoader returns a new HTMLLoader
+func NewHTMLLoader() *HTMLLoader {
+	return &HTMLLoader{}
+}
+
+func (l *HTMLLoader) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	page, err := readText(r)
+	if err != nil {
+		return nil, err
+	}
+
+	text, title := HTMLText(page)
+
+	metadata := map[string]interface{}{MetaSource: source, MetaFormat: "html"}
+	if title != "" {
+		metadata[MetaTitle] = title
+	}
+
+	return []*Document{{ID: source, Content: text, Metadata: metadata}}, nil
+}
+
+// skippedElements hold no readable content
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"svg": true, "canvas": true, "iframe": true, "object": true, "head": true,
+}
+
+// blockElements start on a new line
+var blockElements = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true,
+	"header": true, "footer": true, "nav": true, "aside": true, "blockquote": true,
+	"pre": true, "ul": true, "ol": true, "dl": true, "dt": true, "dd": true,
+	"table": true, "tr": true, "form": true, "fieldset": true, "figure": true,
+	"figcaption": true, "hr": true, "address": true, "details": true, "summary": true,
+}
+
+// HTMLText returns the readable text of an HTML page along with its title
+func HTMLText(page string) (text, title string) {
+	var (
+		b       strings.Builder
+		skip    string
+		pre     int
+		inTitle bool
+		titleB  strings.Builder
+		h1      strings.Builder
+		inH1    bool
+	)
+
+	for len(page) > 0 {
+		lt := strings.IndexByte(page, '<')
+		if lt < 0 {
+			lt = len(page)
+		}
+
+		if lt > 0 {
+			chunk := html.UnescapeString(page[:lt])
+			switch {
+			case inTitle:
+				titleB.WriteString(chunk)
+			case skip != "":
+			case pre > 0:
+				b.WriteString(chunk)
+			default:
+				writeCollapsed(&b, chunk)
+				if inH1 {
+					h1.WriteString(chunk)
+				}
+			}
+			page = page[lt:]
+			continue
+		}
+
+		// comments, doctypes and processing instructions
+		if strings.HasPrefix(page, "<!--") {
+			end := strings.Index(page, "-->")
+			if end < 0 {
+				break
+			}
+			page = page[end+3:]
+			continue
+		}
+		if strings.HasPrefix(page, "<!") || strings.HasPrefix(page, "<?") {
+			end := strings.IndexByte(page, '>')
+			if end < 0 {
+				break
+			}
+			page = page[end+1:]
+			continue
+		}
+
+		name, closing, end := parseTag(page)
+		if end < 0 {
+			// a lone '<' is text
+			if skip == "" && !inTitle {
+				b.WriteByte('<')
+			}
+			page = page[1:]
+			continue
+		}
+		page = page[end:]
+
+		if skip != "" {
+			if closing && name == skip {
+				skip = ""
+			}
+			continue
+		}
+
+		switch {
+		case name == "title":
+			inTitle = !closing
+		case skippedElements[name] && !closing:
+			skip = name
+		case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+			newParagraph(&b)
+			if !closing {
+				b.WriteString(strings.Repeat("#", int(name[1]-'0')) + " ")
+				inH1 = name == "h1" && h1.Len() == 0
+			} else {
+				inH1 = false
+			}
+		case name == "br":
+			b.WriteByte('\n')
+		case name == "li":
+			if !closing {
+				newLine(&b)
+				b.WriteString("- ")
+			}
+		case name == "td" || name == "th":
+			if closing {
+				b.WriteString(" | ")
+			}
+		case blockElements[name]:
+			if name == "pre" {
+				if closing {
+					pre = max(pre-1, 0)
+				} else {
+					pre++
+				}
+			}
+			if name == "p" || name == "pre" || name == "blockquote" || name == "table" {
+				newParagraph(&b)
+			} else {
+				newLine(&b)
+			}
+		}
+	}
+
+	title = strings.Join(strings.Fields(titleB.String()), " ")
+	if title == "" {
+		title = strings.Join(strings.Fields(h1.String()), " ")
+	}
+
+	return cleanText(b.String()), title
+}
+
+// parseTag reads the tag at the start of s, returning its lower case name,
+// whether it is a closing tag and the length of the tag, -1 when s does not
+// start with a tag
+func parseTag(s string) (name string, closing bool, end int) {
+	i := 1
+	if i < len(s) && s[i] == '/' {
+		closing = true
+		i++
+	}
+
+	start := i
+	for i < len(s) && (isLetter(s[i]) || (i > start && s[i] >= '0' && s[i] <= '9')) {
+		i++
+	}
+	if i == start {
+		return "", false, -1
+	}
+	name = strings.ToLower(s[start:i])
+
+	// skip attributes, minding quoted values that may contain '>'
+	var quote byte
+	for ; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return name, closing, i + 1
+		}
+	}
+
+	return "", false, -1
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// writeCollapsed writes text with its runs of whitespace collapsed into
+// single spaces
+func writeCollapsed(b *strings.Builder, text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		if text != "" {
+			b.WriteByte(' ')
+		}
+		return
+	}
+
+	if isSpace(rune(text[0])) {
+		b.WriteByte(' ')
+	}
+	b.WriteString(strings.Join(fields, " "))
+	if isSpace(rune(text[len(text)-1])) {
+		b.WriteByte(' ')
+	}
+}
+
+func newLine(b *strings.Builder) {
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte('\n')
+	}
+}
+
+func newParagraph(b *strings.Builder) {
+	if b.Len() == 0 {
+		return
+	}
+
+	s := b.String()
+	switch {
+	case strings.HasSuffix(s, "\n\n"):
+	case strings.HasSuffix(s, "\n"):
+		b.WriteByte('\n')
+	default:
+		b.WriteString("\n\n")
+	}
+}
@@ -0,0 +1,448 @@
+// Package ingest turns files into searchable embeddings: loaders read
+// documents out of common formats, chunkers cut them into passages, and a
+// Pipeline embeds the passages in concurrent batches and stores them in a
+// core.VectorStorer.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// ErrUnsupportedFormat is returned for files no loader is registered for
+var ErrUnsupportedFormat = errors.New("unsupported file format")
+
+// Metadata fields set by the loaders and chunkers
+const (
+	// MetaSource is the file or URL a document was loaded from
+	MetaSource = "source"
+
+	// MetaFormat is the format of the source, such as "markdown" or "pdf"
+	MetaFormat = "format"
+
+	// MetaTitle is the title of a document, when its format has one
+	MetaTitle = "title"
+
+	// MetaPage is the 1-based page number of a PDF page
+	MetaPage = "page"
+
+	// MetaPages is the number of pages of a PDF
+	MetaPages = "pages"
+
+	// MetaRow is the 1-based record number of a CSV row or JSON item
+	MetaRow = "row"
+
+	// MetaDocumentID is the ID of the document a chunk was cut from
+	MetaDocumentID = "document_id"
+
+	// MetaChunk is the 0-based position of a chunk in its document
+	MetaChunk = "chunk"
+
+	// MetaSection is the path of Markdown headings leading to a chunk
+	MetaSection = "section"
+)
+
+// Document is a piece of text along with metadata describing where it comes
+// from. Loaders return documents, and chunkers cut them into smaller ones.
+type Document struct {
+	ID       string
+	Content  string
+	Metadata map[string]interface{}
+}
+
+// Stats reports what an ingestion stored
+type Stats struct {
+	Documents int
+	Chunks    int
+	Duration  time.Duration
+}
+
+// Pipeline chunks documents, embeds the chunks and stores them. Stores
+// implementing core.MutableVectorStorer keep the chunk IDs and metadata, and
+// the chunks previously stored for a document are replaced when it is
+// ingested again. Other stores only receive the chunk contents, which they
+// embed themselves.
+type Pipeline struct {
+	embedder    core.Embedder
+	store       core.VectorStorer
+	chunker     Chunker
+	chunkers    map[string]Chunker
+	loaders     map[string]Loader
+	batchSize   int
+	concurrency int
+	logger      *logr.Logger
+}
+
+// PipelineConfig holds configuration for a Pipeline
+type PipelineConfig struct {
+	// Chunker cutting documents whose format has no chunker of its own
+	// default NewRecursiveChunker()
+	Chunker Chunker
+
+	// Chunkers by document format, taking precedence over Chunker
+	// default a MarkdownChunker for "markdown" and "html"
+	Chunkers map[string]Chunker
+
+	// Loaders by file extension, such as ".md"
+	// default DefaultLoaders()
+	Loaders map[string]Loader
+
+	// BatchSize is the number of chunks embedded and stored at a time
+	// default 32
+	BatchSize int
+
+	// Concurrency is the number of batches processed at once
+	// default 4
+	Concurrency int
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// PipelineConfigFunc is a function type that modifies PipelineConfig
+type PipelineConfigFunc func(*PipelineConfig)
+
+// WithChunker sets the chunker used for every format, replacing the format
+// specific defaults
+func WithChunker(c Chunker) PipelineConfigFunc {
+	return func(conf *PipelineConfig) {
+		conf.Chunker = c
+		conf.Chunkers = map[string]Chunker{}
+	}
+}
+
+// WithFormatChunker sets the chunker used for documents of a format
+func WithFormatChunker(format string, c Chunker) PipelineConfigFunc {
+	return func(conf *PipelineConfig) {
+		conf.Chunkers[format] = c
+	}
+}
+
+// WithLoader sets the loader used for files with the given extension
+func WithLoader(ext string, l Loader) PipelineConfigFunc {
+	return func(conf *PipelineConfig) {
+		conf.Loaders[strings.ToLower(ext)] = l
+	}
+}
+
+func WithBatchSize(n int) PipelineConfigFunc {
+	return func(conf *PipelineConfig) {
+		conf.BatchSize = n
+	}
+}
+
+func WithConcurrency(n int) PipelineConfigFunc {
+	return func(conf *PipelineConfig) {
+		conf.Concurrency = n
+	}
+}
+
+func WithLogger(l *logr.Logger) PipelineConfigFunc {
+	return func(conf *PipelineConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewPipeline returns a new Pipeline embedding chunks with embedder and
+// storing them in store. A nil embedder leaves embedding to the store. Stores
+// not implementing core.MutableVectorStorer lose the chunk metadata, such as
+// the source and page of a chunk, and cannot have chunks replaced; a warning
+// is logged for them.
+func NewPipeline(embedder core.Embedder, store core.VectorStorer, opts ...PipelineConfigFunc) *Pipeline {
+	discard := logr.Discard()
+	markdown := NewMarkdownChunker()
+	conf := &PipelineConfig{
+		Chunker:     NewRecursiveChunker(),
+		Chunkers:    map[string]Chunker{"markdown": markdown, "html": markdown},
+		Loaders:     DefaultLoaders(),
+		BatchSize:   32,
+		Concurrency: 4,
+		Logger:      &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if _, ok := store.(core.MutableVectorStorer); !ok {
+		conf.Logger.V(-1).Info("Store is not mutable, chunks are stored without their metadata")
+	}
+
+	return &Pipeline{
+		embedder:    embedder,
+		store:       store,
+		chunker:     conf.Chunker,
+		chunkers:    conf.Chunkers,
+		loaders:     conf.Loaders,
+		batchSize:   max(conf.BatchSize, 1),
+		concurrency: max(conf.Concurrency, 1),
+		logger:      conf.Logger,
+	}
+}
+
+// Chunk cuts documents into chunks with the chunker of their format
+func (p *Pipeline) Chunk(docs ...*Document) []*Document {
+	var chunks []*Document
+	for _, doc := range docs {
+		chunker := p.chunker
+		if format, ok := doc.Metadata[MetaFormat].(string); ok {
+			if c, ok := p.chunkers[format]; ok {
+				chunker = c
+			}
+		}
+
+		chunks = append(chunks, chunker.Chunk(doc)...)
+	}
+
+	return chunks
+}
+
+// Ingest chunks, embeds and stores documents. Documents without an ID get a
+// random one. The chunks of a document already in a mutable store are
+// replaced: new chunks are upserted first, then the previous chunks left
+// over are deleted, so that a document stays searchable throughout. On
+// error, the chunks of some documents may already be stored, next to their
+// previous ones.
+func (p *Pipeline) Ingest(ctx context.Context, docs ...*Document) (*Stats, error) {
+	start := time.Now()
+
+	for _, doc := range docs {
+		if doc.ID == "" {
+			doc.ID = vectorstore.NewID()
+		}
+	}
+
+	chunks := p.Chunk(docs...)
+
+	if err := p.storeChunks(ctx, chunks); err != nil {
+		return nil, err
+	}
+
+	if mutable, ok := p.store.(core.MutableVectorStorer); ok {
+		counts := make(map[string]int, len(docs))
+		for _, chunk := range chunks {
+			counts[chunk.Metadata[MetaDocumentID].(string)]++
+		}
+
+		for _, doc := range docs {
+			// chunks are numbered from 0, those past the new count are stale
+			n, err := mutable.DeleteWhere(ctx, core.And(
+				core.Eq(MetaDocumentID, doc.ID),
+				core.Range(MetaChunk, counts[doc.ID], nil),
+			))
+			if err != nil {
+				return nil, fmt.Errorf("error removing previous chunks of %q: %w", doc.ID, err)
+			}
+			if n > 0 {
+				p.logger.V(1).Info("Replacing document", "id", doc.ID, "staleChunks", n)
+			}
+		}
+	}
+
+	stats := &Stats{
+		Documents: len(docs),
+		Chunks:    len(chunks),
+		Duration:  time.Since(start),
+	}
+	p.logger.Info("Ingested documents", "documents", stats.Documents, "chunks", stats.Chunks, "duration", stats.Duration)
+
+	return stats, nil
+}
+
+// storeChunks embeds and stores chunks in batches, processing up to concurrency
+// batches at once. The first error cancels the remaining batches.
+func (p *Pipeline) storeChunks(ctx context.Context, chunks []*Document) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	batches := make(chan []*Document)
+
+	for i := 0; i < min(p.concurrency, (len(chunks)+p.batchSize-1)/p.batchSize); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := p.storeBatch(ctx, batch); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+feed:
+	for start := 0; start < len(chunks); start += p.batchSize {
+		select {
+		case batches <- chunks[start:min(start+p.batchSize, len(chunks))]:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(batches)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	return ctx.Err()
+}
+
+func (p *Pipeline) storeBatch(ctx context.Context, batch []*Document) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	mutable, ok := p.store.(core.MutableVectorStorer)
+	if !ok {
+		contents := make([]string, len(batch))
+		for i, chunk := range batch {
+			contents[i] = chunk.Content
+		}
+
+		if _, err := p.store.Add(ctx, contents); err != nil {
+			return fmt.Errorf("error storing chunks: %w", err)
+		}
+		return nil
+	}
+
+	embeddings := make([]*core.Embedding, len(batch))
+	for i, chunk := range batch {
+		embeddings[i] = &core.Embedding{
+			ID:       chunk.ID,
+			Content:  chunk.Content,
+			Metadata: chunk.Metadata,
+		}
+	}
+
+	if p.embedder != nil {
+		if err := vectorstore.EmbedMissing(ctx, p.embedder, embeddings); err != nil {
+			return err
+		}
+	}
+
+	if err := mutable.Upsert(ctx, embeddings...); err != nil {
+		return fmt.Errorf("error storing chunks: %w", err)
+	}
+
+	return nil
+}
+
+// LoadFile reads a file with the loader registered for its extension
+func (p *Pipeline) LoadFile(ctx context.Context, path string) ([]*Document, error) {
+	loader, ok := p.loaders[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+
+	docs, err := loader.Load(ctx, f, path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %w", path, err)
+	}
+
+	return docs, nil
+}
+
+// IngestFiles loads and ingests files. In a mutable store, the chunks of
+// documents a file no longer yields, such as the pages a PDF lost since it
+// was last ingested, are deleted.
+func (p *Pipeline) IngestFiles(ctx context.Context, paths ...string) (*Stats, error) {
+	var docs []*Document
+	loaded := make(map[string][]*Document, len(paths))
+	for _, path := range paths {
+		fileDocs, err := p.LoadFile(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		loaded[path] = fileDocs
+		docs = append(docs, fileDocs...)
+	}
+
+	stats, err := p.Ingest(ctx, docs...)
+	if err != nil {
+		return nil, err
+	}
+
+	mutable, ok := p.store.(core.MutableVectorStorer)
+	if !ok {
+		return stats, nil
+	}
+
+	for _, path := range paths {
+		filter := core.Eq(MetaSource, path)
+		if fileDocs := loaded[path]; len(fileDocs) > 0 {
+			ids := make([]interface{}, len(fileDocs))
+			for i, doc := range fileDocs {
+				ids[i] = doc.ID
+			}
+			filter = core.And(filter, core.Not(core.In(MetaDocumentID, ids...)))
+		}
+
+		n, err := mutable.DeleteWhere(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("error removing previous chunks of %s: %w", path, err)
+		}
+		if n > 0 {
+			p.logger.V(1).Info("Removed chunks of documents no longer in file", "source", path, "staleChunks", n)
+		}
+	}
+
+	return stats, nil
+}
+
+// IngestDir ingests every file under root with a registered loader, skipping
+// hidden files and directories
+func (p *Pipeline) IngestDir(ctx context.Context, root string) (*Stats, error) {
+	var paths []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if path != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.IsDir() {
+			if _, ok := p.loaders[strings.ToLower(filepath.Ext(path))]; ok {
+				paths = append(paths, path)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %w", root, err)
+	}
+
+	return p.IngestFiles(ctx, paths...)
+}
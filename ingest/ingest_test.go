@@ -0,0 +1,145 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/embedder"
+	"github.com/joaopandolfi/core/vectorstore/memory"
+)
+
+// failingEmbedder fails once fail is set
+type failingEmbedder struct {
+	core.Embedder
+	fail bool
+}
+
+func (e *failingEmbedder) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	if e.fail {
+		return nil, errors.New("embedder down")
+	}
+	return e.Embedder.GenerateEmbedding(ctx, content)
+}
+
+// lineChunker cuts documents at every line
+var lineChunker = ChunkerFunc(func(doc *Document) []*Document {
+	return chunksOf(doc, strings.Split(doc.Content, "\n"), nil)
+})
+
+func storedChunks(t *testing.T, store *memory.MemoryVectorStore, docID string) []string {
+	t.Helper()
+
+	results, err := store.Search(context.Background(), &core.SearchParams{
+		Query:  "a",
+		Limit:  100,
+		Filter: core.Eq(MetaDocumentID, docID),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contents := make([]string, len(results))
+	for i, r := range results {
+		contents[i] = r.Embedding.Content
+	}
+	sort.Strings(contents)
+
+	return contents
+}
+
+func TestIngestReplacesChunks(t *testing.T) {
+	ctx := context.Background()
+	hashing := embedder.NewHashingEmbedder(embedder.WithDimensions(64))
+	emb := &failingEmbedder{Embedder: hashing}
+	store := memory.NewMemoryVectorStore(hashing)
+	p := NewPipeline(emb, store, WithChunker(lineChunker), WithBatchSize(1))
+
+	if _, err := p.Ingest(ctx, &Document{ID: "doc", Content: "a\nb\nc"}, &Document{ID: "other", Content: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedChunks(t, store, "doc"); strings.Join(got, ",") != "a,b,c" {
+		t.Fatalf("got %v", got)
+	}
+
+	// a failed ingestion keeps the previous chunks
+	emb.fail = true
+	if _, err := p.Ingest(ctx, &Document{ID: "doc", Content: "d"}); err == nil {
+		t.Fatal("ingestion with a failing embedder succeeded")
+	}
+	if got := storedChunks(t, store, "doc"); strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("after a failed ingestion: got %v", got)
+	}
+
+	emb.fail = false
+	stats, err := p.Ingest(ctx, &Document{ID: "doc", Content: "d\ne"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Chunks != 2 {
+		t.Errorf("got %d chunks, want 2", stats.Chunks)
+	}
+	if got := storedChunks(t, store, "doc"); strings.Join(got, ",") != "d,e" {
+		t.Errorf("got %v, want the new chunks only", got)
+	}
+	if got := storedChunks(t, store, "other"); strings.Join(got, ",") != "x" {
+		t.Errorf("other document: got %v", got)
+	}
+}
+
+func TestIngestFilesRemovesLostDocuments(t *testing.T) {
+	ctx := context.Background()
+	hashing := embedder.NewHashingEmbedder(embedder.WithDimensions(64))
+	store := memory.NewMemoryVectorStore(hashing)
+	p := NewPipeline(hashing, store)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "items.csv")
+	other := filepath.Join(dir, "other.csv")
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(path, "name\na\nb\nc\n")
+	write(other, "name\nx\n")
+
+	if _, err := p.IngestFiles(ctx, path, other); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedChunks(t, store, path+"[3]"); len(got) != 1 {
+		t.Fatalf("got %v for the third row", got)
+	}
+
+	// the file lost its last row
+	write(path, "name\na\nb\n")
+	if _, err := p.IngestFiles(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedChunks(t, store, path+"[3]"); len(got) != 0 {
+		t.Errorf("got %v, want the chunks of the lost row removed", got)
+	}
+	if got := storedChunks(t, store, path+"[2]"); len(got) != 1 {
+		t.Errorf("got %v for the second row", got)
+	}
+	if got := storedChunks(t, store, other+"[1]"); len(got) != 1 {
+		t.Errorf("got %v for the row of another file", got)
+	}
+
+	// the file lost every row
+	write(path, "name\n")
+	if _, err := p.IngestFiles(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{path + "[1]", path + "[2]"} {
+		if got := storedChunks(t, store, id); len(got) != 0 {
+			t.Errorf("got %v for %s, want it removed", got, id)
+		}
+	}
+}
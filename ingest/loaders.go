@@ -0,0 +1,418 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Loader reads documents out of a source. The source names where r comes
+// from, such as a path, and is recorded in the "source" metadata field.
+type Loader interface {
+	Load(ctx context.Context, r io.Reader, source string) ([]*Document, error)
+}
+
+// LoaderFunc adapts a function to the Loader interface
+type LoaderFunc func(ctx context.Context, r io.Reader, source string) ([]*Document, error)
+
+func (f LoaderFunc) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	return f(ctx, r, source)
+}
+
+// DefaultLoaders returns the loaders for the supported formats, by file
+// extension
+func DefaultLoaders() map[string]Loader {
+	text := NewTextLoader()
+	markdown := NewMarkdownLoader()
+	html := NewHTMLLoader()
+	jsonLoader := NewJSONLoader()
+
+	return map[string]Loader{
+		".txt":      text,
+		".text":     text,
+		".log":      text,
+		".md":       markdown,
+		".markdown": markdown,
+		".html":     html,
+		".htm":      html,
+		".json":     jsonLoader,
+		".jsonl":    jsonLoader,
+		".ndjson":   jsonLoader,
+		".csv":      NewCSVLoader(),
+		".tsv":      NewCSVLoader(WithComma('\t')),
+		".pdf":      NewPDFLoader(),
+	}
+}
+
+func readText(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("error reading source: %w", err)
+	}
+
+	// drop a byte order mark and normalize line endings
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	return text, nil
+}
+
+// TextLoader reads a source as a single plain text document
+type TextLoader struct{}
+
+// NewTextLoader returns a new TextLoader
+func NewTextLoader() *TextLoader {
+	return &TextLoader{}
+}
+
+func (l *TextLoader) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	text, err := readText(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Document{{
+		ID:       source,
+		Content:  text,
+		Metadata: map[string]interface{}{MetaSource: source, MetaFormat: "text"},
+	}}, nil
+}
+
+// MarkdownLoader reads a source as a single Markdown document. The fields of
+// a YAML front matter block become metadata, and the title is taken from
+// its "title" field or else from the first heading.
+type MarkdownLoader struct{}
+
+// NewMarkdownLoader returns a new MarkdownLoader
+func NewMarkdownLoader() *MarkdownLoader {
+	return &MarkdownLoader{}
+}
+
+var frontMatterPattern = regexp.MustCompile(`(?s)\A---\n(.*?)\n(?:---|\.\.\.)\n`)
+
+func (l *MarkdownLoader) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	text, err := readText(r)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{}
+	if m := frontMatterPattern.FindStringSubmatchIndex(text); m != nil {
+		var fields map[string]interface{}
+		if err := yaml.Unmarshal([]byte(text[m[2]:m[3]]), &fields); err != nil {
+			return nil, fmt.Errorf("error parsing front matter: %w", err)
+		}
+		for k, v := range fields {
+			metadata[k] = v
+		}
+		text = text[m[1]:]
+	}
+
+	if _, ok := metadata[MetaTitle]; !ok {
+		for _, line := range strings.Split(text, "\n") {
+			if m := headingPattern.FindStringSubmatch(line); m != nil {
+				metadata[MetaTitle] = m[2]
+				break
+			}
+		}
+	}
+
+	metadata[MetaSource] = source
+	metadata[MetaFormat] = "markdown"
+
+	return []*Document{{ID: source, Content: text, Metadata: metadata}}, nil
+}
+
+// JSONLoader reads JSON, JSON arrays or JSON lines, one document per object.
+// The content of a document is the string in its content field, or the
+// indented JSON of the object when it has none; the other scalar fields
+// become metadata.
+type JSONLoader struct {
+	contentFields []string
+}
+
+// JSONLoaderConfig holds configuration for a JSONLoader
+type JSONLoaderConfig struct {
+	// ContentFields are the fields tried in order for the content
+	// default "content", "text", "body"
+	ContentFields []string
+}
+
+// JSONLoaderConfigFunc is a function type that modifies JSONLoaderConfig
+type JSONLoaderConfigFunc func(*JSONLoaderConfig)
+
+func WithContentFields(fields ...string) JSONLoaderConfigFunc {
+	return func(conf *JSONLoaderConfig) {
+		conf.ContentFields = fields
+	}
+}
+
+// NewJSONLoader returns a new JSONLoader
+func NewJSONLoader(opts ...JSONLoaderConfigFunc) *JSONLoader {
+	conf := &JSONLoaderConfig{
+		ContentFields: []string{"content", "text", "body"},
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &JSONLoader{contentFields: conf.ContentFields}
+}
+
+func (l *JSONLoader) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	// a stream of values covers plain JSON and JSON lines alike
+	var items []interface{}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	for {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("error decoding json: %w", err)
+		}
+
+		if arr, ok := v.([]interface{}); ok {
+			items = append(items, arr...)
+		} else {
+			items = append(items, v)
+		}
+	}
+
+	docs := make([]*Document, 0, len(items))
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		doc, err := l.document(item)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(doc.Content) == "" {
+			continue
+		}
+
+		if len(items) == 1 {
+			doc.ID = source
+		} else {
+			doc.ID = fmt.Sprintf("%s[%d]", source, i+1)
+			doc.Metadata[MetaRow] = i + 1
+		}
+		doc.Metadata[MetaSource] = source
+		doc.Metadata[MetaFormat] = "json"
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+func (l *JSONLoader) document(item interface{}) (*Document, error) {
+	doc := &Document{Metadata: map[string]interface{}{}}
+
+	obj, ok := item.(map[string]interface{})
+	if !ok {
+		if s, ok := item.(string); ok {
+			doc.Content = s
+			return doc, nil
+		}
+		content, err := json.MarshalIndent(item, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error encoding json: %w", err)
+		}
+		doc.Content = string(content)
+		return doc, nil
+	}
+
+	contentField := ""
+	for _, field := range l.contentFields {
+		if s, ok := obj[field].(string); ok {
+			doc.Content, contentField = s, field
+			break
+		}
+	}
+
+	if contentField == "" {
+		content, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("error encoding json: %w", err)
+		}
+		doc.Content = string(content)
+	}
+
+	for k, v := range obj {
+		if k == contentField {
+			continue
+		}
+
+		if v, ok := scalar(v); ok {
+			doc.Metadata[k] = v
+			continue
+		}
+
+		// lists of scalars, such as tags, are kept
+		if list, ok := v.([]interface{}); ok {
+			values := make([]interface{}, 0, len(list))
+			for _, item := range list {
+				if item, ok := scalar(item); ok {
+					values = append(values, item)
+				}
+			}
+			if len(values) == len(list) {
+				doc.Metadata[k] = values
+			}
+		}
+	}
+
+	return doc, nil
+}
+
+// scalar converts a decoded JSON string, boolean or number to a metadata
+// value, numbers becoming int64 or float64
+func scalar(v interface{}) (interface{}, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, true
+		}
+		f, err := v.Float64()
+		return f, err == nil
+	case string, bool:
+		return v, true
+	}
+
+	return nil, false
+}
+
+// CSVLoader reads a CSV file with a header row, one document per row. The
+// content of a document lists the content columns as "column: value" lines
+// and the other columns become metadata.
+type CSVLoader struct {
+	comma          rune
+	contentColumns []string
+}
+
+// CSVLoaderConfig holds configuration for a CSVLoader
+type CSVLoaderConfig struct {
+	// Comma is the field delimiter
+	// default ','
+	Comma rune
+
+	// ContentColumns are the columns making up the content
+	// default every column
+	ContentColumns []string
+}
+
+// CSVLoaderConfigFunc is a function type that modifies CSVLoaderConfig
+type CSVLoaderConfigFunc func(*CSVLoaderConfig)
+
+func WithComma(comma rune) CSVLoaderConfigFunc {
+	return func(conf *CSVLoaderConfig) {
+		conf.Comma = comma
+	}
+}
+
+func WithContentColumns(columns ...string) CSVLoaderConfigFunc {
+	return func(conf *CSVLoaderConfig) {
+		conf.ContentColumns = columns
+	}
+}
+
+// NewCSVLoader returns a new CSVLoader
+func NewCSVLoader(opts ...CSVLoaderConfigFunc) *CSVLoader {
+	conf := &CSVLoaderConfig{
+		Comma: ',',
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &CSVLoader{comma: conf.Comma, contentColumns: conf.ContentColumns}
+}
+
+func (l *CSVLoader) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	text, err := readText(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := csv.NewReader(strings.NewReader(text))
+	cr.Comma = l.comma
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading csv header: %w", err)
+	}
+
+	content := make([]bool, len(header))
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		content[i] = len(l.contentColumns) == 0
+		for _, c := range l.contentColumns {
+			if strings.EqualFold(c, header[i]) {
+				content[i] = true
+			}
+		}
+	}
+
+	var docs []*Document
+	for row := 1; ; row++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading csv row %d: %w", row, err)
+		}
+
+		var b strings.Builder
+		metadata := map[string]interface{}{
+			MetaSource: source,
+			MetaFormat: "csv",
+			MetaRow:    row,
+		}
+		for i, value := range record {
+			if i >= len(header) || strings.TrimSpace(value) == "" {
+				continue
+			}
+			if content[i] {
+				fmt.Fprintf(&b, "%s: %s\n", header[i], value)
+			} else {
+				metadata[header[i]] = value
+			}
+		}
+
+		if b.Len() == 0 {
+			continue
+		}
+
+		docs = append(docs, &Document{
+			ID:       fmt.Sprintf("%s[%d]", source, row),
+			Content:  b.String(),
+			Metadata: metadata,
+		})
+	}
+
+	return docs, nil
+}
@@ -0,0 +1,980 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrEncryptedPDF is returned for encrypted PDFs, whose text cannot be read
+// without decrypting them first
+var ErrEncryptedPDF = errors.New("pdf is encrypted")
+
+// PDFLoader extracts the text of a PDF, one document per page with its
+// number in the "page" metadata field. It understands uncompressed and
+// Flate compressed streams, object streams and ToUnicode font maps, which
+// covers the PDFs produced by office suites, browsers and LaTeX. Scanned
+// pages hold no text and yield nothing; there is no OCR.
+type PDFLoader struct{}
+
+// NewPDFLoader returns a new PDFLoader
+func NewPDFLoader() *PDFLoader {
+	return &PDFLoader{}
+}
+
+func (l *PDFLoader) Load(ctx context.Context, r io.Reader, source string) ([]*Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading pdf: %w", err)
+	}
+
+	pages, err := PDFText(data)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*Document, 0, len(pages))
+	for i, text := range pages {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		docs = append(docs, &Document{
+			ID:      fmt.Sprintf("%s[%d]", source, i+1),
+			Content: text,
+			Metadata: map[string]interface{}{
+				MetaSource: source,
+				MetaFormat: "pdf",
+				MetaPage:   i + 1,
+				MetaPages:  len(pages),
+			},
+		})
+	}
+
+	return docs, nil
+}
+
+// PDFText returns the text of each page of a PDF. Malformed files the parser
+// cannot make sense of are reported as errors rather than crashing the
+// caller.
+func PDFText(data []byte) (pages []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("error parsing pdf: %v", r)
+		}
+	}()
+
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return nil, errors.New("not a pdf")
+	}
+
+	doc := &pdfDocument{objects: map[int]any{}}
+	doc.scan(data)
+
+	if bytes.Contains(data, []byte("/Encrypt")) && doc.encrypted() {
+		return nil, ErrEncryptedPDF
+	}
+
+	dicts := doc.pages()
+	pages = make([]string, len(dicts))
+	for i, page := range dicts {
+		pages[i] = doc.pageText(page)
+	}
+
+	return pages, nil
+}
+
+// pdf objects are decoded to nil, bool, float64, []byte for strings,
+// pdfName, pdfRef, []any, pdfDict, *pdfStream, or pdfKeyword for operators
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfDict    map[string]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+type pdfDocument struct {
+	objects map[int]any
+	trailer []pdfDict
+	cmaps   map[int]*cmap
+}
+
+var (
+	objPattern     = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	trailerPattern = regexp.MustCompile(`trailer\s*<<`)
+)
+
+// scan collects every indirect object of the file, later definitions, from
+// incremental updates, replacing earlier ones. Objects packed in object
+// streams are added unless defined directly.
+func (d *pdfDocument) scan(data []byte) {
+	for _, m := range objPattern.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[m[2]:m[3]]))
+		lx := &pdfLexer{data: data, pos: m[1]}
+		obj, err := lx.object()
+		if err == nil {
+			d.objects[num] = obj
+		}
+	}
+
+	for _, m := range trailerPattern.FindAllIndex(data, -1) {
+		lx := &pdfLexer{data: data, pos: m[0] + len("trailer")}
+		if obj, err := lx.object(); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				d.trailer = append(d.trailer, dict)
+			}
+		}
+	}
+
+	var streams []*pdfStream
+	for _, obj := range d.objects {
+		if s, ok := obj.(*pdfStream); ok {
+			switch s.dict["Type"] {
+			case pdfName("ObjStm"):
+				streams = append(streams, s)
+			case pdfName("XRef"):
+				// cross-reference streams carry the trailer entries
+				d.trailer = append(d.trailer, s.dict)
+			}
+		}
+	}
+
+	for _, s := range streams {
+		d.unpack(s)
+	}
+}
+
+// unpack adds the objects of an object stream
+func (d *pdfDocument) unpack(s *pdfStream) {
+	data, err := d.decode(s)
+	if err != nil {
+		return
+	}
+
+	n, _ := d.resolve(s.dict["N"]).(float64)
+	first, _ := d.resolve(s.dict["First"]).(float64)
+	if int(first) > len(data) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, err1 := header.object()
+		off, err2 := header.object()
+		if err1 != nil || err2 != nil {
+			return
+		}
+
+		numF, ok1 := num.(float64)
+		offF, ok2 := off.(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, ok := d.objects[int(numF)]; ok {
+			continue
+		}
+
+		lx := &pdfLexer{data: data, pos: int(first) + int(offF)}
+		if obj, err := lx.object(); err == nil {
+			d.objects[int(numF)] = obj
+		}
+	}
+}
+
+func (d *pdfDocument) encrypted() bool {
+	for _, t := range d.trailer {
+		if _, ok := t["Encrypt"]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolve follows references
+func (d *pdfDocument) resolve(obj any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = d.objects[ref.num]
+	}
+
+	return nil
+}
+
+func (d *pdfDocument) dict(obj any) pdfDict {
+	switch v := d.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+
+	return nil
+}
+
+// decode returns the decoded content of a stream
+func (d *pdfDocument) decode(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case nil:
+	case pdfName:
+		filters = []any{f}
+	case []any:
+		filters = f
+	}
+
+	data := s.raw
+	for _, f := range filters {
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// truncated streams still yield what could be inflated
+			out, err := io.ReadAll(zr)
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			data = out
+		default:
+			return nil, fmt.Errorf("unsupported filter %v", f)
+		}
+	}
+
+	return data, nil
+}
+
+// pages returns the page dictionaries in order, following the page tree from
+// the catalog, or in file order for files whose tree cannot be followed
+func (d *pdfDocument) pages() []pdfDict {
+	var out []pdfDict
+
+	var walk func(node any, depth int)
+	walk = func(node any, depth int) {
+		dict := d.dict(node)
+		if dict == nil || depth > 64 {
+			return
+		}
+
+		switch dict["Type"] {
+		case pdfName("Page"):
+			out = append(out, dict)
+		default:
+			kids, _ := d.resolve(dict["Kids"]).([]any)
+			for _, kid := range kids {
+				walk(kid, depth+1)
+			}
+		}
+	}
+
+	for _, t := range d.trailer {
+		if root := d.dict(t["Root"]); root != nil {
+			walk(root["Pages"], 0)
+			if len(out) > 0 {
+				return out
+			}
+		}
+	}
+
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if dict, ok := d.objects[num].(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			out = append(out, dict)
+		}
+	}
+
+	return out
+}
+
+// inherited looks a key up on a page and its ancestors
+func (d *pdfDocument) inherited(page pdfDict, key string) any {
+	node := page
+	for i := 0; node != nil && i < 64; i++ {
+		if v, ok := node[key]; ok {
+			return d.resolve(v)
+		}
+		node = d.dict(node["Parent"])
+	}
+
+	return nil
+}
+
+func (d *pdfDocument) pageText(page pdfDict) string {
+	var content []byte
+	switch c := d.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		content, _ = d.decode(c)
+	case []any:
+		for _, part := range c {
+			if s, ok := d.resolve(part).(*pdfStream); ok {
+				data, _ := d.decode(s)
+				content = append(content, data...)
+				content = append(content, '\n')
+			}
+		}
+	}
+
+	fonts := map[string]*cmap{}
+	if resources := d.dict(d.inherited(page, "Resources")); resources != nil {
+		for name, ref := range d.dict(resources["Font"]) {
+			fonts[name] = d.fontMap(ref)
+		}
+	}
+
+	return cleanText(d.interpret(content, fonts))
+}
+
+// fontMap returns the ToUnicode map of a font, nil when it has none
+func (d *pdfDocument) fontMap(font any) *cmap {
+	ref, isRef := font.(pdfRef)
+	if isRef {
+		if d.cmaps == nil {
+			d.cmaps = map[int]*cmap{}
+		}
+		if m, ok := d.cmaps[ref.num]; ok {
+			return m
+		}
+	}
+
+	var m *cmap
+	if dict := d.dict(font); dict != nil {
+		if s, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+			if data, err := d.decode(s); err == nil {
+				m = parseCMap(data)
+			}
+		}
+	}
+
+	if isRef {
+		d.cmaps[ref.num] = m
+	}
+	return m
+}
+
+// interpret runs the text operators of a content stream
+func (d *pdfDocument) interpret(content []byte, fonts map[string]*cmap) string {
+	var (
+		b        strings.Builder
+		operands []any
+		font     *cmap
+		lastY    float64
+		hasY     bool
+	)
+
+	newline := func() {
+		b.WriteByte('\n')
+	}
+	space := func() {
+		b.WriteByte(' ')
+	}
+	show := func(s any) {
+		if str, ok := s.([]byte); ok {
+			b.WriteString(font.decode(str))
+		}
+	}
+	number := func(i int) float64 {
+		if i < 0 || i >= len(operands) {
+			return 0
+		}
+		f, _ := operands[i].(float64)
+		return f
+	}
+
+	lx := &pdfLexer{data: content}
+	for {
+		obj, err := lx.object()
+		if err != nil {
+			break
+		}
+
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok {
+					font = fonts[string(name)]
+				}
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			newline()
+			if len(operands) > 0 {
+				show(operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				items, _ := operands[len(operands)-1].([]any)
+				for _, item := range items {
+					// a wide negative kerning separates words
+					if f, ok := item.(float64); ok && f < -200 {
+						space()
+					}
+					show(item)
+				}
+			}
+		case "Td", "TD":
+			if number(1) != 0 {
+				newline()
+			} else if number(0) > 0 {
+				space()
+			}
+		case "Tm":
+			y := number(5)
+			if hasY && y != lastY {
+				newline()
+			} else {
+				space()
+			}
+			lastY, hasY = y, true
+		case "T*":
+			newline()
+		case "ET":
+			space()
+		case "BI":
+			lx.skipInlineImage()
+		}
+
+		operands = operands[:0]
+	}
+
+	return b.String()
+}
+
+var (
+	spaceRuns   = regexp.MustCompile(`[ \t\f\v]+`)
+	newlineRuns = regexp.MustCompile(`\n\s*\n\s*\n+`)
+)
+
+func cleanText(s string) string {
+	s = spaceRuns.ReplaceAllString(s, " ")
+	s = strings.ReplaceAll(s, " \n", "\n")
+	s = strings.ReplaceAll(s, "\n ", "\n")
+	s = newlineRuns.ReplaceAllString(s, "\n\n")
+
+	return strings.TrimSpace(s)
+}
+
+// cmap maps character codes to text
+type cmap struct {
+	width int
+	codes map[uint32]string
+}
+
+// decode turns the bytes of a string into text, through the map when the
+// font has one, as Latin-1 otherwise
+func (m *cmap) decode(s []byte) string {
+	if m == nil {
+		return latin1(s)
+	}
+
+	var b strings.Builder
+	for i := 0; i+m.width <= len(s); i += m.width {
+		code := uint32(0)
+		for _, c := range s[i : i+m.width] {
+			code = code<<8 | uint32(c)
+		}
+
+		if text, ok := m.codes[code]; ok {
+			b.WriteString(text)
+		} else if m.width == 1 {
+			b.WriteString(latin1(s[i : i+1]))
+		}
+	}
+
+	return b.String()
+}
+
+// winAnsi holds the characters of the Windows-1252 range where it departs
+// from Latin-1
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž', 0x91: '‘',
+	0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜',
+	0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+func latin1(s []byte) string {
+	runes := make([]rune, 0, len(s))
+	for _, c := range s {
+		if r, ok := winAnsi[c]; ok {
+			runes = append(runes, r)
+		} else {
+			runes = append(runes, rune(c))
+		}
+	}
+
+	return string(runes)
+}
+
+// parseCMap reads the code space and the bfchar and bfrange sections of a
+// ToUnicode map
+func parseCMap(data []byte) *cmap {
+	m := &cmap{width: 1, codes: map[uint32]string{}}
+
+	var operands []any
+	lx := &pdfLexer{data: data}
+	section := ""
+	for {
+		obj, err := lx.object()
+		if err != nil {
+			break
+		}
+
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section = string(op)
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].([]byte); ok && len(lo) > 0 {
+					m.width = len(lo)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].([]byte)
+				dst, ok2 := operands[i+1].([]byte)
+				if ok1 && ok2 {
+					m.codes[codeOf(src)] = utf16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].([]byte)
+				hi, ok2 := operands[i+1].([]byte)
+				if !ok1 || !ok2 {
+					continue
+				}
+
+				from, to := codeOf(lo), codeOf(hi)
+				if to < from || to-from > 0xFFFF {
+					continue
+				}
+
+				switch dst := operands[i+2].(type) {
+				case []byte:
+					// consecutive codes map to consecutive characters
+					base := []rune(utf16BE(dst))
+					if len(base) == 0 {
+						continue
+					}
+					for c := from; c <= to; c++ {
+						r := append([]rune(nil), base...)
+						r[len(r)-1] += rune(c - from)
+						m.codes[c] = string(r)
+					}
+				case []any:
+					for j, item := range dst {
+						if s, ok := item.([]byte); ok && from+uint32(j) <= to {
+							m.codes[from+uint32(j)] = utf16BE(s)
+						}
+					}
+				}
+			}
+		}
+
+		if section != "" && strings.HasPrefix(string(op), "end") {
+			section = ""
+		}
+		operands = operands[:0]
+	}
+
+	return m
+}
+
+func codeOf(b []byte) uint32 {
+	code := uint32(0)
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+
+	return code
+}
+
+func utf16BE(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// pdfLexer reads PDF objects, and the operators of content streams
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEnd = errors.New("end of data")
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// object reads the next object. Integers followed by a generation and R
+// form a reference; dictionaries followed by a stream keyword form a stream.
+func (l *pdfLexer) object() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEnd
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literal(), nil
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		dict, err := l.dictionary()
+		if err != nil {
+			return nil, err
+		}
+		return l.maybeStream(dict), nil
+	case c == '<':
+		return l.hex(), nil
+	case c == '[':
+		l.pos++
+		var arr []any
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, errPDFEnd
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return arr, nil
+			}
+			obj, err := l.object()
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, obj)
+		}
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return pdfKeyword(string(c)), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number(), nil
+	}
+
+	word := l.word()
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		l.pos++
+	}
+
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) number() any {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && (l.data[l.pos] == '.' || (l.data[l.pos] >= '0' && l.data[l.pos] <= '9')) {
+		l.pos++
+	}
+
+	f, _ := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+
+	// an integer may start a reference: num gen R
+	if isInteger(l.data[start:l.pos]) {
+		save := l.pos
+		l.skipSpace()
+		genStart := l.pos
+		for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+			l.pos++
+		}
+		if l.pos > genStart {
+			gen, _ := strconv.Atoi(string(l.data[genStart:l.pos]))
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+				(l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+				l.pos++
+				return pdfRef{num: int(f), gen: gen}
+			}
+		}
+		l.pos = save
+	}
+
+	return f
+}
+
+func isInteger(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return len(b) > 0
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+
+	return pdfName(b)
+}
+
+func (l *pdfLexer) literal() []byte {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = append(b, byte(v))
+				} else {
+					b = append(b, e)
+				}
+			}
+			continue
+		}
+
+		b = append(b, c)
+	}
+
+	return b
+}
+
+func (l *pdfLexer) hex() []byte {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		c := l.data[l.pos]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		v, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		b[i] = byte(v)
+	}
+
+	return b
+}
+
+func (l *pdfLexer) dictionary() (pdfDict, error) {
+	dict := pdfDict{}
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return dict, nil
+		}
+
+		key, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			// skip whatever is not a key
+			continue
+		}
+
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		dict[string(name)] = value
+	}
+}
+
+var endstream = []byte("endstream")
+
+func (l *pdfLexer) maybeStream(dict pdfDict) any {
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return dict
+	}
+
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// trust a direct length when it lands on endstream, otherwise search
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && n <= float64(len(l.data)-start) {
+		end := start + int(n)
+		rest := bytes.TrimLeft(l.data[end:], "\r\n \t")
+		if bytes.HasPrefix(rest, endstream) {
+			l.pos = end
+			l.skipSpace()
+			l.pos += len(endstream)
+			return &pdfStream{dict: dict, raw: l.data[start:end]}
+		}
+	}
+
+	i := bytes.Index(l.data[start:], endstream)
+	if i < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, raw: l.data[start:]}
+	}
+
+	end := start + i
+	l.pos = end + len(endstream)
+	raw := bytes.TrimRight(l.data[start:end], "\r\n")
+
+	return &pdfStream{dict: dict, raw: raw}
+}
+
+// skipInlineImage moves past the data of an inline image, up to its EI
+// operator
+func (l *pdfLexer) skipInlineImage() {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 2
+
+	for {
+		j := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if j < 0 {
+			l.pos = len(l.data)
+			return
+		}
+
+		at := l.pos + j
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
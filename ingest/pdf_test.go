@@ -0,0 +1,101 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a PDF with a page per content stream. Streams whose
+// length is set are declared with it instead of their actual length.
+func buildPDF(contents []string, filter string, length *int) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+
+	kids := []string{}
+	for i := range contents {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+	fmt.Fprintf(&b, "1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	fmt.Fprintf(&b, "2 0 obj << /Type /Pages /Kids [%s] /Count %d >> endobj\n", strings.Join(kids, " "), len(contents))
+	fmt.Fprintf(&b, "3 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n")
+
+	for i, content := range contents {
+		data := []byte(content)
+		if filter == "FlateDecode" {
+			var z bytes.Buffer
+			w := zlib.NewWriter(&z)
+			w.Write(data)
+			w.Close()
+			data = z.Bytes()
+		}
+
+		n := len(data)
+		if length != nil {
+			n = *length
+		}
+		dict := fmt.Sprintf("/Length %d", n)
+		if filter != "" {
+			dict += " /Filter /" + filter
+		}
+
+		fmt.Fprintf(&b, "%d 0 obj << /Type /Page /Parent 2 0 R /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >> endobj\n", 4+2*i, 5+2*i)
+		fmt.Fprintf(&b, "%d 0 obj << %s >>\nstream\n", 5+2*i, dict)
+		b.Write(data)
+		b.WriteString("\nendstream\nendobj\n")
+	}
+
+	b.WriteString("trailer << /Root 1 0 R >>\n%%EOF\n")
+
+	return b.Bytes()
+}
+
+func TestPDFText(t *testing.T) {
+	for _, filter := range []string{"", "FlateDecode"} {
+		data := buildPDF([]string{"BT /F1 12 Tf (Hello) Tj ET", "BT /F1 12 Tf [(Wor) -20 (ld)] TJ ET"}, filter, nil)
+
+		pages, err := PDFText(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != 2 || !strings.Contains(pages[0], "Hello") || !strings.Contains(pages[1], "World") {
+			t.Errorf("filter %q: got pages %q", filter, pages)
+		}
+	}
+}
+
+func TestPDFTextBadLength(t *testing.T) {
+	for _, n := range []int{-1, -1 << 40, 1 << 40} {
+		pages, err := PDFText(buildPDF([]string{"BT (Hello) Tj ET"}, "", &n))
+		if err != nil {
+			t.Fatalf("length %d: %v", n, err)
+		}
+		if len(pages) != 1 || !strings.Contains(pages[0], "Hello") {
+			t.Errorf("length %d: got pages %q", n, pages)
+		}
+	}
+}
+
+func FuzzPDFText(f *testing.F) {
+	negative := -7
+	for _, seed := range [][]byte{
+		buildPDF([]string{"BT /F1 12 Tf (Hello) Tj ET"}, "", nil),
+		buildPDF([]string{"BT (a) Tj ET", "BT [(b) 10 (c)] TJ ET"}, "FlateDecode", nil),
+		buildPDF([]string{"BT (Hello) Tj ET"}, "", &negative),
+		buildPDF([]string{"BT <48656c6c6f> Tj T* (\\(x\\)) ' ET"}, "", nil),
+		[]byte("%PDF-1.7\n1 0 obj << /Length 5 >> stream\nabc"),
+		[]byte("%PDF-1.7\n1 0 obj [1 2 (a) <0102> /N << /K [ ] >>"),
+		[]byte("%PDF-"),
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pages, err := PDFText(data)
+		if err == nil && pages == nil {
+			t.Error("nil pages without error")
+		}
+	})
+}
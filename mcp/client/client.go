@@ -0,0 +1,439 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// Client is a Model Context Protocol client. It speaks JSON-RPC to a single MCP
+// server over any Transport and exposes the server's tools, resources and prompts.
+type Client struct {
+	transport Transport
+	info      mcp.Implementation
+	onNotify  func(*mcp.Message)
+	logger    *logr.Logger
+
+	nextID atomic.Int64
+
+	mu      sync.Mutex
+	pending map[string]chan *mcp.Message
+	closed  bool
+
+	server *mcp.InitializeResult
+	done   chan struct{}
+
+	// notifications queues the notifications of the server for onNotify,
+	// which runs on a goroutine of its own so that it may call the client
+	notifyMu      sync.Mutex
+	notifyReady   *sync.Cond
+	notifications []*mcp.Message
+	notifyClosed  bool
+}
+
+// ClientConfig holds configuration for a Client
+type ClientConfig struct {
+	// ClientInfo is reported to the server during initialization
+	ClientInfo mcp.Implementation
+
+	// NotificationHandler is called for every notification sent by the server
+	// (i.e., progress or list changed notifications), in order, on a
+	// goroutine of its own: it may call the client, and delays no response
+	NotificationHandler func(*mcp.Message)
+
+	// The provided logr.Logger
+	Logger *logr.Logger
+}
+
+// ClientConfigFunc is a function type that modifies ClientConfig
+type ClientConfigFunc func(*ClientConfig)
+
+func WithClientInfo(name, version string) ClientConfigFunc {
+	return func(conf *ClientConfig) {
+		conf.ClientInfo = mcp.Implementation{Name: name, Version: version}
+	}
+}
+
+func WithNotificationHandler(h func(*mcp.Message)) ClientConfigFunc {
+	return func(conf *ClientConfig) {
+		conf.NotificationHandler = h
+	}
+}
+
+func WithLogger(l *logr.Logger) ClientConfigFunc {
+	return func(conf *ClientConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewClient returns a new Client talking over the given transport. The client
+// must be initialized with Initialize before any other call.
+func NewClient(t Transport, opts ...ClientConfigFunc) *Client {
+	conf := &ClientConfig{
+		ClientInfo: mcp.Implementation{
+			Name:    "agent-api",
+			Version: "0.0.0",
+		},
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if conf.Logger == nil {
+		l := logr.Discard()
+		conf.Logger = &l
+	}
+
+	c := &Client{
+		transport: t,
+		info:      conf.ClientInfo,
+		onNotify:  conf.NotificationHandler,
+		logger:    conf.Logger,
+		pending:   map[string]chan *mcp.Message{},
+		done:      make(chan struct{}),
+	}
+	c.notifyReady = sync.NewCond(&c.notifyMu)
+
+	go c.listen()
+	if c.onNotify != nil {
+		go c.dispatchNotifications()
+	}
+
+	return c
+}
+
+// listen dispatches inbound messages until the transport closes
+func (c *Client) listen() {
+	defer close(c.done)
+
+	for m := range c.transport.Receive() {
+		switch {
+		case m.IsResponse():
+			c.mu.Lock()
+			ch, ok := c.pending[string(m.ID)]
+			delete(c.pending, string(m.ID))
+			c.mu.Unlock()
+
+			if ok {
+				ch <- m
+			}
+
+		case m.IsNotification():
+			if c.onNotify != nil {
+				c.notifyMu.Lock()
+				c.notifications = append(c.notifications, m)
+				c.notifyMu.Unlock()
+				c.notifyReady.Signal()
+			}
+
+		case m.IsRequest():
+			c.handleServerRequest(m)
+		}
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+
+	c.notifyMu.Lock()
+	c.notifyClosed = true
+	c.notifyMu.Unlock()
+	c.notifyReady.Signal()
+}
+
+// dispatchNotifications hands queued notifications to the handler, in the
+// order they arrived, until the transport closes and the queue is empty
+func (c *Client) dispatchNotifications() {
+	for {
+		c.notifyMu.Lock()
+		for len(c.notifications) == 0 && !c.notifyClosed {
+			c.notifyReady.Wait()
+		}
+		if len(c.notifications) == 0 {
+			c.notifyMu.Unlock()
+			return
+		}
+		m := c.notifications[0]
+		c.notifications[0] = nil
+		c.notifications = c.notifications[1:]
+		c.notifyMu.Unlock()
+
+		c.onNotify(m)
+	}
+}
+
+// handleServerRequest answers requests initiated by the server. Only ping is
+// supported, everything else is rejected.
+func (c *Client) handleServerRequest(m *mcp.Message) {
+	var resp *mcp.Message
+	if m.Method == mcp.MethodPing {
+		resp, _ = mcp.NewResponse(m.ID, struct{}{})
+	} else {
+		resp = mcp.NewErrorResponse(m.ID, mcp.MethodNotFound, fmt.Sprintf("method %s not supported by client", m.Method))
+	}
+
+	if err := c.transport.Send(context.Background(), resp); err != nil {
+		c.logger.Error(err, "failed to answer server request", "method", m.Method)
+	}
+}
+
+// call sends a request and unmarshals its result into out. If ctx is cancelled
+// before the response arrives the server is sent a cancellation notification.
+func (c *Client) call(ctx context.Context, method string, params any, out any) error {
+	req, err := mcp.NewRequest(c.nextID.Add(1), method, params)
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *mcp.Message, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrTransportClosed
+	}
+	c.pending[string(req.ID)] = ch
+	c.mu.Unlock()
+
+	c.logger.V(1).Info("sending mcp request", "method", method, "id", string(req.ID))
+	if err := c.transport.Send(ctx, req); err != nil {
+		c.forget(req.ID)
+		return err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return ErrTransportClosed
+		}
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, out); err != nil {
+			return fmt.Errorf("error unmarshaling %s result: %w", method, err)
+		}
+		return nil
+
+	case <-ctx.Done():
+		c.forget(req.ID)
+
+		cancel, err := mcp.NewNotification(mcp.NotificationCancelled, &mcp.CancelledNotificationParams{
+			RequestID: req.ID,
+			Reason:    ctx.Err().Error(),
+		})
+		if err == nil {
+			c.transport.Send(context.Background(), cancel)
+		}
+
+		return ctx.Err()
+	}
+}
+
+func (c *Client) forget(id json.RawMessage) {
+	c.mu.Lock()
+	delete(c.pending, string(id))
+	c.mu.Unlock()
+}
+
+func (c *Client) notify(ctx context.Context, method string, params any) error {
+	m, err := mcp.NewNotification(method, params)
+	if err != nil {
+		return err
+	}
+
+	return c.transport.Send(ctx, m)
+}
+
+// Initialize performs the MCP handshake and returns the server's description
+func (c *Client) Initialize(ctx context.Context) (*mcp.InitializeResult, error) {
+	result := &mcp.InitializeResult{}
+	err := c.call(ctx, mcp.MethodInitialize, &mcp.InitializeParams{
+		ProtocolVersion: mcp.ProtocolVersion,
+		Capabilities:    mcp.ClientCapabilities{},
+		ClientInfo:      c.info,
+	}, result)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing mcp session: %w", err)
+	}
+
+	if err := c.notify(ctx, mcp.NotificationInitialized, nil); err != nil {
+		return nil, fmt.Errorf("error sending initialized notification: %w", err)
+	}
+
+	c.mu.Lock()
+	c.server = result
+	c.mu.Unlock()
+
+	return result, nil
+}
+
+// ServerInfo returns the result of a previous Initialize call, or nil
+func (c *Client) ServerInfo() *mcp.InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.server
+}
+
+// Ping checks that the server is alive
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, mcp.MethodPing, nil, nil)
+}
+
+// ListTools returns every tool exposed by the server, following pagination
+func (c *Client) ListTools(ctx context.Context) ([]*mcp.Tool, error) {
+	tools := []*mcp.Tool{}
+	params := &mcp.PaginatedParams{}
+
+	for {
+		result := &mcp.ListToolsResult{}
+		if err := c.call(ctx, mcp.MethodToolsList, params, result); err != nil {
+			return nil, err
+		}
+
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes the named tool with raw JSON arguments. When a notification
+// handler is configured the server is asked to report progress.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*mcp.CallToolResult, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+
+	params := &mcp.CallToolParams{
+		Name:      name,
+		Arguments: args,
+	}
+	if c.onNotify != nil {
+		token := strconv.Quote(fmt.Sprintf("%s-%d", name, c.nextID.Add(1)))
+		params.Meta = &mcp.RequestMeta{ProgressToken: json.RawMessage(token)}
+	}
+
+	result := &mcp.CallToolResult{}
+	err := c.call(ctx, mcp.MethodToolsCall, params, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListResources returns every resource exposed by the server, following pagination
+func (c *Client) ListResources(ctx context.Context) ([]*mcp.Resource, error) {
+	resources := []*mcp.Resource{}
+	params := &mcp.PaginatedParams{}
+
+	for {
+		result := &mcp.ListResourcesResult{}
+		if err := c.call(ctx, mcp.MethodResourcesList, params, result); err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, result.Resources...)
+		if result.NextCursor == "" {
+			return resources, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// ReadResource returns the contents of the resource at uri
+func (c *Client) ReadResource(ctx context.Context, uri string) ([]*mcp.ResourceContents, error) {
+	result := &mcp.ReadResourceResult{}
+	err := c.call(ctx, mcp.MethodResourcesRead, &mcp.ReadResourceParams{URI: uri}, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Contents, nil
+}
+
+// ListPrompts returns every prompt exposed by the server, following pagination
+func (c *Client) ListPrompts(ctx context.Context) ([]*mcp.Prompt, error) {
+	prompts := []*mcp.Prompt{}
+	params := &mcp.PaginatedParams{}
+
+	for {
+		result := &mcp.ListPromptsResult{}
+		if err := c.call(ctx, mcp.MethodPromptsList, params, result); err != nil {
+			return nil, err
+		}
+
+		prompts = append(prompts, result.Prompts...)
+		if result.NextCursor == "" {
+			return prompts, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// GetPrompt renders the named prompt with the given arguments
+func (c *Client) GetPrompt(ctx context.Context, name string, args map[string]string) (*mcp.GetPromptResult, error) {
+	result := &mcp.GetPromptResult{}
+	err := c.call(ctx, mcp.MethodPromptsGet, &mcp.GetPromptParams{
+		Name:      name,
+		Arguments: args,
+	}, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PromptMessages converts a rendered MCP prompt to core messages. Non-text
+// content is dropped.
+func PromptMessages(p *mcp.GetPromptResult) []*core.Message {
+	messages := make([]*core.Message, 0, len(p.Messages))
+	for _, m := range p.Messages {
+		if m.Content == nil || m.Content.Type != "text" {
+			continue
+		}
+
+		role := core.UserMessageRole
+		if m.Role == string(core.AssistantMessageRole) {
+			role = core.AssistantMessageRole
+		}
+
+		messages = append(messages, &core.Message{
+			Role:    role,
+			Content: m.Content.Text,
+		})
+	}
+
+	return messages
+}
+
+// Close closes the underlying transport and waits for the listener to exit
+func (c *Client) Close() error {
+	err := c.transport.Close()
+	<-c.done
+
+	if errors.Is(err, ErrTransportClosed) {
+		return nil
+	}
+
+	return err
+}
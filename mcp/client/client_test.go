@@ -0,0 +1,380 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/mcp"
+	"github.com/joaopandolfi/core/mcp/server"
+)
+
+// TestMain runs the test binary as an MCP stdio server when asked to, so that
+// the stdio transport is tested against a real process
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_TEST_STDIO_SERVER") == "1" {
+		s, err := newServer()
+		if err == nil {
+			err = s.ServeStdio(context.Background())
+		}
+		if err != nil {
+			os.Stderr.WriteString(err.Error() + "\n")
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+type echoArgs struct {
+	Text string `json:"text"`
+}
+
+func newServer() (*server.Server, error) {
+	echo, err := core.WrapToolFunction(func(ctx context.Context, args *echoArgs) (string, error) {
+		return args.Text, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fail, err := core.WrapToolFunction(func(ctx context.Context, args *echoArgs) (string, error) {
+		return "", errors.New("failed: " + args.Text)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return server.NewServer(
+		server.WithServerInfo("test-server", "1.0.0"),
+		server.WithTools(
+			&core.Tool{Name: "echo", Description: "echoes text", WrappedToolFunction: echo},
+			&core.Tool{Name: "fail", Description: "always fails", WrappedToolFunction: fail},
+		),
+	)
+}
+
+type toolList []*core.Tool
+
+func (l *toolList) AddTool(tool *core.Tool) error {
+	*l = append(*l, tool)
+	return nil
+}
+
+// testClient checks a client initialized over any transport
+func testClient(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+
+	info, err := c.Initialize(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ServerInfo.Name != "test-server" {
+		t.Errorf("server name %q", info.ServerInfo.Name)
+	}
+
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("ping: %v", err)
+	}
+
+	var tools toolList
+	if err := c.RegisterTools(ctx, &tools, "remote_"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tools) != 2 || tools[0].Name != "remote_echo" || tools[1].Name != "remote_fail" {
+		t.Fatalf("got tools %v", tools)
+	}
+
+	content, err := tools[0].WrappedToolFunction(ctx, []byte(`{"text":"hello"}`))
+	if err != nil || content != "hello" {
+		t.Errorf("echo: got %v, %v", content, err)
+	}
+
+	if _, err := tools[1].WrappedToolFunction(ctx, []byte(`{"text":"boom"}`)); err == nil || err.Error() != "failed: boom" {
+		t.Errorf("fail: got %v", err)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	s, err := newServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+
+	c := NewClient(NewHTTPTransport(srv.URL))
+	defer c.Close()
+
+	testClient(t, c)
+}
+
+func TestStdioClient(t *testing.T) {
+	transport, err := NewStdioTransport(os.Args[0], []string{"-test.run=^$"}, []string{"MCP_TEST_STDIO_SERVER=1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(transport)
+	defer c.Close()
+
+	testClient(t, c)
+}
+
+// fakeServer is a Transport answering requests with handle as they are sent
+type fakeServer struct {
+	handle func(method string, params json.RawMessage) (any, error)
+	inbox  chan *mcp.Message
+
+	mu       sync.Mutex
+	requests []*mcp.Message
+	closed   bool
+}
+
+func newFakeServer(handle func(method string, params json.RawMessage) (any, error)) *fakeServer {
+	return &fakeServer{handle: handle, inbox: make(chan *mcp.Message, 64)}
+}
+
+func (s *fakeServer) Send(ctx context.Context, m *mcp.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrTransportClosed
+	}
+	if !m.IsRequest() {
+		return nil
+	}
+	s.requests = append(s.requests, m)
+
+	result, err := s.handle(m.Method, m.Params)
+	var rpcErr *mcp.Error
+	switch {
+	case errors.As(err, &rpcErr):
+		s.inbox <- mcp.NewErrorResponse(m.ID, rpcErr.Code, rpcErr.Message)
+	case err != nil:
+		return err
+	default:
+		resp, err := mcp.NewResponse(m.ID, result)
+		if err != nil {
+			return err
+		}
+		s.inbox <- resp
+	}
+
+	return nil
+}
+
+// push sends a notification to the client
+func (s *fakeServer) push(t *testing.T, method string, params any) {
+	t.Helper()
+
+	m, err := mcp.NewNotification(method, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.inbox <- m
+}
+
+func (s *fakeServer) Receive() <-chan *mcp.Message {
+	return s.inbox
+}
+
+func (s *fakeServer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.closed {
+		s.closed = true
+		close(s.inbox)
+	}
+
+	return nil
+}
+
+// paginated answers list requests with one page per cursor
+func paginated[T any](params json.RawMessage, pages [][]T, result func(items []T, next string) any) (any, error) {
+	p := &mcp.PaginatedParams{}
+	if err := json.Unmarshal(params, p); err != nil {
+		return nil, err
+	}
+
+	page := 0
+	if p.Cursor != "" {
+		fmt.Sscanf(p.Cursor, "page-%d", &page)
+	}
+	next := ""
+	if page+1 < len(pages) {
+		next = fmt.Sprintf("page-%d", page+1)
+	}
+
+	return result(pages[page], next), nil
+}
+
+func TestResourcesAndPrompts(t *testing.T) {
+	ctx := context.Background()
+
+	s := newFakeServer(func(method string, params json.RawMessage) (any, error) {
+		switch method {
+		case mcp.MethodResourcesList:
+			return paginated(params, [][]*mcp.Resource{
+				{{URI: "file:///a.md", Name: "a"}, {URI: "file:///b.md", Name: "b"}},
+				{{URI: "file:///c.png", Name: "c", MimeType: "image/png"}},
+			}, func(items []*mcp.Resource, next string) any {
+				return &mcp.ListResourcesResult{Resources: items, NextCursor: next}
+			})
+
+		case mcp.MethodResourcesRead:
+			p := &mcp.ReadResourceParams{}
+			json.Unmarshal(params, p)
+			if p.URI != "file:///a.md" {
+				return nil, &mcp.Error{Code: mcp.InvalidParams, Message: "unknown resource " + p.URI}
+			}
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{URI: p.URI, MimeType: "text/markdown", Text: "# A"}}}, nil
+
+		case mcp.MethodPromptsList:
+			return paginated(params, [][]*mcp.Prompt{
+				{{Name: "summarize", Arguments: []*mcp.PromptArgument{{Name: "topic", Required: true}}}},
+				{{Name: "review"}},
+				{{Name: "translate"}},
+			}, func(items []*mcp.Prompt, next string) any {
+				return &mcp.ListPromptsResult{Prompts: items, NextCursor: next}
+			})
+
+		case mcp.MethodPromptsGet:
+			p := &mcp.GetPromptParams{}
+			json.Unmarshal(params, p)
+			return &mcp.GetPromptResult{
+				Description: p.Name,
+				Messages: []*mcp.PromptMessage{
+					{Role: "user", Content: mcp.TextContent("Summarize " + p.Arguments["topic"])},
+					{Role: "assistant", Content: mcp.TextContent("Sure.")},
+					{Role: "user", Content: &mcp.Content{Type: "image", Data: "aGk=", MimeType: "image/png"}},
+					{Role: "system", Content: mcp.TextContent("unknown roles become user")},
+					{Role: "user"},
+				},
+			}, nil
+		}
+
+		return nil, &mcp.Error{Code: mcp.MethodNotFound, Message: method}
+	})
+	c := NewClient(s)
+	defer c.Close()
+
+	resources, err := c.ListResources(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 3 || resources[2].URI != "file:///c.png" || resources[2].MimeType != "image/png" {
+		t.Errorf("got resources %+v", resources)
+	}
+
+	contents, err := c.ReadResource(ctx, "file:///a.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contents) != 1 || contents[0].Text != "# A" || contents[0].MimeType != "text/markdown" {
+		t.Errorf("got contents %+v", contents)
+	}
+
+	var rpcErr *mcp.Error
+	if _, err := c.ReadResource(ctx, "file:///missing"); !errors.As(err, &rpcErr) || rpcErr.Code != mcp.InvalidParams {
+		t.Errorf("got %v, want an invalid params error", err)
+	}
+
+	prompts, err := c.ListPrompts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 3 || prompts[0].Name != "summarize" || !prompts[0].Arguments[0].Required || prompts[2].Name != "translate" {
+		t.Errorf("got prompts %+v", prompts)
+	}
+
+	prompt, err := c.GetPrompt(ctx, "summarize", map[string]string{"topic": "leave"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prompt.Description != "summarize" || len(prompt.Messages) != 5 {
+		t.Errorf("got prompt %+v", prompt)
+	}
+
+	messages := PromptMessages(prompt)
+	var got []string
+	for _, m := range messages {
+		got = append(got, string(m.Role)+": "+m.Content)
+	}
+	if want := "[user: Summarize leave assistant: Sure. user: unknown roles become user]"; fmt.Sprint(got) != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+
+	// one request per page
+	s.mu.Lock()
+	n := len(s.requests)
+	s.mu.Unlock()
+	if n != 2+2+3+1 {
+		t.Errorf("sent %d requests", n)
+	}
+}
+
+func TestNotificationHandler(t *testing.T) {
+	s := newFakeServer(func(method string, params json.RawMessage) (any, error) {
+		return struct{}{}, nil
+	})
+
+	var (
+		mu       sync.Mutex
+		progress []float64
+		pingErrs []error
+	)
+	done := make(chan struct{})
+
+	var c *Client
+	c = NewClient(s, WithNotificationHandler(func(m *mcp.Message) {
+		p := &mcp.ProgressNotificationParams{}
+		json.Unmarshal(m.Params, p)
+
+		// the handler may call the client, which waits for the reader
+		err := c.Ping(context.Background())
+
+		mu.Lock()
+		defer mu.Unlock()
+		progress = append(progress, p.Progress)
+		pingErrs = append(pingErrs, err)
+		if len(progress) == 3 {
+			close(done)
+		}
+	}))
+
+	for i := 1; i <= 3; i++ {
+		s.push(t, mcp.NotificationProgress, &mcp.ProgressNotificationParams{ProgressToken: json.RawMessage(`"t"`), Progress: float64(i)})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		// closing would wait for the blocked reader
+		t.Fatal("notification handler blocked calling the client")
+	}
+	defer c.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(progress) != "[1 2 3]" {
+		t.Errorf("handled %v, want the notifications in order", progress)
+	}
+	for _, err := range pingErrs {
+		if err != nil {
+			t.Errorf("ping from the handler: %v", err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// SessionHeader is the HTTP header carrying the MCP session identifier
+const SessionHeader = "Mcp-Session-Id"
+
+// HTTPTransport implements the MCP "streamable HTTP" transport. Every client
+// message is POSTed to a single endpoint and the server answers with either a
+// JSON body or a server-sent event stream.
+type HTTPTransport struct {
+	endpoint string
+	client   *http.Client
+	header   http.Header
+
+	mu        sync.Mutex
+	sessionID string
+	bodies    map[io.ReadCloser]struct{}
+
+	inbox     chan *mcp.Message
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// HTTPTransportConfig holds configuration for a HTTPTransport
+type HTTPTransportConfig struct {
+	// The http.Client used for every request. Defaults to http.DefaultClient
+	Client *http.Client
+
+	// Extra headers sent on every request (i.e., authorization)
+	Header http.Header
+}
+
+// HTTPTransportConfigFunc is a function type that modifies HTTPTransportConfig
+type HTTPTransportConfigFunc func(*HTTPTransportConfig)
+
+func WithHTTPClient(c *http.Client) HTTPTransportConfigFunc {
+	return func(conf *HTTPTransportConfig) {
+		conf.Client = c
+	}
+}
+
+func WithHeader(key, value string) HTTPTransportConfigFunc {
+	return func(conf *HTTPTransportConfig) {
+		conf.Header.Add(key, value)
+	}
+}
+
+// NewHTTPTransport returns a new HTTPTransport for the given MCP endpoint URL
+func NewHTTPTransport(endpoint string, opts ...HTTPTransportConfigFunc) *HTTPTransport {
+	conf := &HTTPTransportConfig{
+		Client: http.DefaultClient,
+		Header: http.Header{},
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &HTTPTransport{
+		endpoint: endpoint,
+		client:   conf.Client,
+		header:   conf.Header,
+		bodies:   map[io.ReadCloser]struct{}{},
+		inbox:    make(chan *mcp.Message, 16),
+		done:     make(chan struct{}),
+	}
+}
+
+// Send POSTs m to the endpoint. Messages from the response body are delivered
+// asynchronously on the Receive channel.
+func (t *HTTPTransport) Send(ctx context.Context, m *mcp.Message) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshaling message: %w", err)
+	}
+
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to %s: %w", t.endpoint, err)
+	}
+
+	t.mu.Lock()
+	select {
+	case <-t.done:
+		t.mu.Unlock()
+		resp.Body.Close()
+		return ErrTransportClosed
+	default:
+	}
+	if id := resp.Header.Get(SessionHeader); id != "" {
+		t.sessionID = id
+	}
+	t.bodies[resp.Body] = struct{}{}
+	t.wg.Add(1)
+	t.mu.Unlock()
+
+	if resp.StatusCode == http.StatusAccepted {
+		t.wg.Done()
+		t.closeBody(resp.Body)
+		return nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer t.wg.Done()
+		defer t.closeBody(resp.Body)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, t.endpoint, strings.TrimSpace(string(body)))
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	go func() {
+		defer t.wg.Done()
+		defer t.closeBody(resp.Body)
+
+		if mediaType == "text/event-stream" {
+			t.readEventStream(resp.Body)
+			return
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil || len(bytes.TrimSpace(body)) == 0 {
+			return
+		}
+		t.deliver(body)
+	}()
+
+	return nil
+}
+
+func (t *HTTPTransport) closeBody(body io.ReadCloser) {
+	t.mu.Lock()
+	delete(t.bodies, body)
+	t.mu.Unlock()
+
+	body.Close()
+}
+
+func (t *HTTPTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	for k, v := range t.header {
+		req.Header[k] = v
+	}
+
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(SessionHeader, t.sessionID)
+	}
+	t.mu.Unlock()
+
+	return req, nil
+}
+
+// readEventStream parses a server-sent event stream, delivering the data of
+// every event as a JSON-RPC message
+func (t *HTTPTransport) readEventStream(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" {
+			if data.Len() > 0 {
+				if !t.deliver(data.Bytes()) {
+					return
+				}
+				data.Reset()
+			}
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+		}
+	}
+
+	if data.Len() > 0 {
+		t.deliver(data.Bytes())
+	}
+}
+
+// deliver decodes a payload and pushes its messages to the inbox. It returns
+// false once the transport has been closed.
+func (t *HTTPTransport) deliver(payload []byte) bool {
+	messages, err := mcp.DecodeMessages(payload)
+	if err != nil {
+		return true
+	}
+
+	for _, m := range messages {
+		select {
+		case t.inbox <- m:
+		case <-t.done:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Receive returns the inbound message channel
+func (t *HTTPTransport) Receive() <-chan *mcp.Message {
+	return t.inbox
+}
+
+// Close terminates the session on the server, if one was established, and
+// stops delivering messages
+func (t *HTTPTransport) Close() error {
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		sessionID := t.sessionID
+		t.mu.Unlock()
+
+		if sessionID != "" {
+			req, reqErr := t.newRequest(context.Background(), http.MethodDelete, nil)
+			if reqErr == nil {
+				resp, doErr := t.client.Do(req)
+				if doErr == nil {
+					resp.Body.Close()
+				}
+			}
+		}
+
+		// unblock any in flight event streams
+		t.mu.Lock()
+		close(t.done)
+		for body := range t.bodies {
+			body.Close()
+		}
+		t.mu.Unlock()
+
+		t.wg.Wait()
+		close(t.inbox)
+	})
+
+	return nil
+}
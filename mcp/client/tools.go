@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// ToolAdder is anything tools can be registered with, such as *agent.Agent
+type ToolAdder interface {
+	AddTool(tool *core.Tool) error
+}
+
+// Tools lists the server's tools and converts each one to a core.Tool whose
+// WrappedToolFunction proxies to tools/call. A non-empty prefix is prepended
+// to every tool name to avoid collisions between servers.
+func (c *Client) Tools(ctx context.Context, prefix string) ([]*core.Tool, error) {
+	mcpTools, err := c.ListTools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing mcp tools: %w", err)
+	}
+
+	tools := make([]*core.Tool, 0, len(mcpTools))
+	for _, t := range mcpTools {
+		tools = append(tools, c.toCoreTool(t, prefix))
+	}
+
+	return tools, nil
+}
+
+// RegisterTools adds every tool of the server to the given ToolAdder,
+// i.e., an *agent.Agent
+func (c *Client) RegisterTools(ctx context.Context, a ToolAdder, prefix string) error {
+	tools, err := c.Tools(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tools {
+		if err := a.AddTool(t); err != nil {
+			return fmt.Errorf("error adding mcp tool %s: %w", t.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) toCoreTool(t *mcp.Tool, prefix string) *core.Tool {
+	name := t.Name
+	schema := t.InputSchema
+	if len(schema) == 0 {
+		schema = json.RawMessage(`{"type":"object","properties":{}}`)
+	}
+
+	return &core.Tool{
+		Name:        prefix + name,
+		Description: t.Description,
+		JSONSchema:  schema,
+		WrappedToolFunction: func(ctx context.Context, args []byte) (interface{}, error) {
+			result, err := c.CallTool(ctx, name, args)
+			if err != nil {
+				return nil, err
+			}
+
+			return ToolResultContent(result)
+		},
+	}
+}
+
+// ToolResultContent flattens an MCP tool result into a value suitable for
+// core.ToolResult.Content. Structured content is preferred, then the joined
+// text content. Results with non-text content are returned as is. A result
+// flagged with IsError is returned as an error.
+func ToolResultContent(result *mcp.CallToolResult) (interface{}, error) {
+	text, onlyText := joinText(result.Content)
+
+	if result.IsError {
+		if text == "" {
+			text = "mcp tool reported an error"
+		}
+		return nil, errors.New(text)
+	}
+
+	if result.StructuredContent != nil {
+		return result.StructuredContent, nil
+	}
+
+	if onlyText {
+		return text, nil
+	}
+
+	return result.Content, nil
+}
+
+func joinText(contents []*mcp.Content) (string, bool) {
+	parts := make([]string, 0, len(contents))
+	onlyText := true
+
+	for _, c := range contents {
+		if c.Type != "text" {
+			onlyText = false
+			continue
+		}
+		parts = append(parts, c.Text)
+	}
+
+	return strings.Join(parts, "\n"), onlyText
+}
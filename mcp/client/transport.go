@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// ErrTransportClosed is returned when sending on a transport that has been closed
+var ErrTransportClosed = errors.New("mcp transport closed")
+
+// Transport moves JSON-RPC messages between a Client and an MCP server
+type Transport interface {
+	// Send delivers a single message to the server
+	Send(ctx context.Context, m *mcp.Message) error
+
+	// Receive returns the channel of messages coming from the server. The channel
+	// is closed once the transport shuts down.
+	Receive() <-chan *mcp.Message
+
+	// Close releases resources associated with the transport
+	Close() error
+}
+
+// StreamTransport implements Transport over a pair of byte streams using
+// newline delimited JSON, as specified by the MCP stdio transport.
+type StreamTransport struct {
+	w       io.Writer
+	closers []io.Closer
+
+	writeMu sync.Mutex
+	inbox   chan *mcp.Message
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewStreamTransport returns a new StreamTransport reading server messages from r
+// and writing client messages to w. Either side that is an io.Closer is closed
+// on Close.
+func NewStreamTransport(r io.Reader, w io.Writer) *StreamTransport {
+	t := &StreamTransport{
+		w:     w,
+		inbox: make(chan *mcp.Message, 16),
+		done:  make(chan struct{}),
+	}
+
+	if c, ok := w.(io.Closer); ok {
+		t.closers = append(t.closers, c)
+	}
+	if c, ok := r.(io.Closer); ok {
+		t.closers = append(t.closers, c)
+	}
+
+	go t.read(r)
+
+	return t
+}
+
+func (t *StreamTransport) read(r io.Reader) {
+	defer close(t.inbox)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		messages, err := mcp.DecodeMessages(line)
+		if err != nil {
+			// not a JSON-RPC frame, servers sometimes leak logs on stdout
+			continue
+		}
+
+		for _, m := range messages {
+			select {
+			case t.inbox <- m:
+			case <-t.done:
+				return
+			}
+		}
+	}
+}
+
+// Send writes m as a single line to the underlying writer
+func (t *StreamTransport) Send(ctx context.Context, m *mcp.Message) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("error marshaling message: %w", err)
+	}
+	raw = append(raw, '\n')
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	_, err = t.w.Write(raw)
+	return err
+}
+
+// Receive returns the inbound message channel
+func (t *StreamTransport) Receive() <-chan *mcp.Message {
+	return t.inbox
+}
+
+// Close stops delivering messages and closes the underlying streams
+func (t *StreamTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		for _, c := range t.closers {
+			if closeErr := c.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+
+	return err
+}
+
+// StdioTransport launches an MCP server as a subprocess and talks to it over
+// its stdin and stdout.
+type StdioTransport struct {
+	*StreamTransport
+
+	cmd *exec.Cmd
+}
+
+// NewStdioTransport starts the given command and returns a transport connected
+// to it. env is appended to the current process environment. The server's
+// stderr is forwarded to os.Stderr.
+func NewStdioTransport(command string, args []string, env []string) (*StdioTransport, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error opening stdin of %s: %w", command, err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error opening stdout of %s: %w", command, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %s: %w", command, err)
+	}
+
+	return &StdioTransport{
+		StreamTransport: NewStreamTransport(stdout, stdin),
+		cmd:             cmd,
+	}, nil
+}
+
+// Close closes the server's stdin and waits for it to exit
+func (t *StdioTransport) Close() error {
+	err := t.StreamTransport.Close()
+
+	waitErr := t.cmd.Wait()
+	if err != nil {
+		return err
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		// servers commonly exit non-zero once their stdin is closed
+		return nil
+	}
+
+	return waitErr
+}
@@ -0,0 +1,138 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// JSONRPCVersion is the only JSON-RPC version spoken by MCP
+const JSONRPCVersion = "2.0"
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Message is a single JSON-RPC 2.0 message. Requests, notifications and
+// responses share this one type so that transports can decode any inbound
+// frame before deciding what to do with it.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// IsRequest reports whether the message is a request expecting a response
+func (m *Message) IsRequest() bool {
+	return m.Method != "" && len(m.ID) > 0
+}
+
+// IsNotification reports whether the message is a one-way notification
+func (m *Message) IsNotification() bool {
+	return m.Method != "" && len(m.ID) == 0
+}
+
+// IsResponse reports whether the message is a response to a previous request
+func (m *Message) IsResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// Error is a JSON-RPC 2.0 error object. It implements the error interface so
+// it can be surfaced directly to callers.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// NewRequest builds a request message with an integer ID
+func NewRequest(id int64, method string, params any) (*Message, error) {
+	m, err := NewNotification(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	m.ID = json.RawMessage(strconv.FormatInt(id, 10))
+	return m, nil
+}
+
+// NewNotification builds a notification message
+func NewNotification(method string, params any) (*Message, error) {
+	m := &Message{
+		JSONRPC: JSONRPCVersion,
+		Method:  method,
+	}
+
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling params for %s: %w", method, err)
+		}
+		m.Params = raw
+	}
+
+	return m, nil
+}
+
+// NewResponse builds a successful response to the request with the given ID
+func NewResponse(id json.RawMessage, result any) (*Message, error) {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling result: %w", err)
+	}
+
+	return &Message{
+		JSONRPC: JSONRPCVersion,
+		ID:      id,
+		Result:  raw,
+	}, nil
+}
+
+// NewErrorResponse builds an error response to the request with the given ID
+func NewErrorResponse(id json.RawMessage, code int, message string) *Message {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	return &Message{
+		JSONRPC: JSONRPCVersion,
+		ID:      id,
+		Error: &Error{
+			Code:    code,
+			Message: message,
+		},
+	}
+}
+
+// DecodeMessages decodes a raw payload that may hold either a single message or
+// a JSON-RPC batch array.
+func DecodeMessages(data []byte) ([]*Message, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []*Message
+		if err := json.Unmarshal(trimmed, &batch); err != nil {
+			return nil, err
+		}
+		return batch, nil
+	}
+
+	m := &Message{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+
+	return []*Message{m}, nil
+}
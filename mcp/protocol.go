@@ -0,0 +1,205 @@
+package mcp
+
+import "encoding/json"
+
+// ProtocolVersion is the MCP specification revision implemented by this package
+const ProtocolVersion = "2025-03-26"
+
+// MCP method names
+const (
+	MethodInitialize             = "initialize"
+	MethodPing                   = "ping"
+	MethodToolsList              = "tools/list"
+	MethodToolsCall              = "tools/call"
+	MethodResourcesList          = "resources/list"
+	MethodResourcesRead          = "resources/read"
+	MethodPromptsList            = "prompts/list"
+	MethodPromptsGet             = "prompts/get"
+	NotificationInitialized      = "notifications/initialized"
+	NotificationCancelled        = "notifications/cancelled"
+	NotificationProgress         = "notifications/progress"
+	NotificationToolsListChanged = "notifications/tools/list_changed"
+)
+
+// Implementation describes the name and version of an MCP client or server
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// ClientCapabilities are the optional features a client advertises during
+// initialization
+type ClientCapabilities struct {
+	Experimental map[string]any `json:"experimental,omitempty"`
+	Roots        map[string]any `json:"roots,omitempty"`
+	Sampling     map[string]any `json:"sampling,omitempty"`
+}
+
+// ServerCapabilities are the optional features a server advertises during
+// initialization
+type ServerCapabilities struct {
+	Experimental map[string]any       `json:"experimental,omitempty"`
+	Logging      map[string]any       `json:"logging,omitempty"`
+	Tools        *ToolsCapability     `json:"tools,omitempty"`
+	Resources    *ResourcesCapability `json:"resources,omitempty"`
+	Prompts      *PromptsCapability   `json:"prompts,omitempty"`
+}
+
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type ResourcesCapability struct {
+	Subscribe   bool `json:"subscribe,omitempty"`
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+type PromptsCapability struct {
+	ListChanged bool `json:"listChanged,omitempty"`
+}
+
+// InitializeParams is sent by the client as the first request of a session
+type InitializeParams struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ClientCapabilities `json:"capabilities"`
+	ClientInfo      Implementation     `json:"clientInfo"`
+}
+
+// InitializeResult is the server's answer to an initialize request
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+// RequestMeta is the reserved "_meta" object that may accompany request params
+type RequestMeta struct {
+	// ProgressToken, when set, asks the receiver to emit progress notifications
+	// tagged with this token. It may be a string or a number.
+	ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+}
+
+// PaginatedParams are the params of any list request
+type PaginatedParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+// Tool is the MCP description of a callable tool
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+type ListToolsResult struct {
+	Tools      []*Tool `json:"tools"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+type CallToolParams struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Meta      *RequestMeta    `json:"_meta,omitempty"`
+}
+
+// CallToolResult is the result of a tools/call request. Tool level failures are
+// reported with IsError rather than as a JSON-RPC error so the model can see them.
+type CallToolResult struct {
+	Content           []*Content `json:"content"`
+	StructuredContent any        `json:"structuredContent,omitempty"`
+	IsError           bool       `json:"isError,omitempty"`
+}
+
+// Content is a single piece of tool or prompt content. Type is one of "text",
+// "image", "audio" or "resource".
+type Content struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+}
+
+// TextContent is a shortcut for building "text" typed content
+func TextContent(text string) *Content {
+	return &Content{
+		Type: "text",
+		Text: text,
+	}
+}
+
+// Resource is a piece of context a server exposes by URI
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ListResourcesResult struct {
+	Resources  []*Resource `json:"resources"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+}
+
+type ReadResourceParams struct {
+	URI string `json:"uri"`
+}
+
+type ReadResourceResult struct {
+	Contents []*ResourceContents `json:"contents"`
+}
+
+// ResourceContents holds either the text or the base64 encoded blob of a resource
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Prompt is a prompt template a server exposes by name
+type Prompt struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Arguments   []*PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type ListPromptsResult struct {
+	Prompts    []*Prompt `json:"prompts"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+type GetPromptParams struct {
+	Name      string            `json:"name"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+type GetPromptResult struct {
+	Description string           `json:"description,omitempty"`
+	Messages    []*PromptMessage `json:"messages"`
+}
+
+// PromptMessage is one rendered message of a prompt. Role is "user" or "assistant".
+type PromptMessage struct {
+	Role    string   `json:"role"`
+	Content *Content `json:"content"`
+}
+
+type ProgressNotificationParams struct {
+	ProgressToken json.RawMessage `json:"progressToken"`
+	Progress      float64         `json:"progress"`
+	Total         float64         `json:"total,omitempty"`
+	Message       string          `json:"message,omitempty"`
+}
+
+type CancelledNotificationParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
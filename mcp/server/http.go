@@ -0,0 +1,309 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// SessionHeader is the HTTP header carrying the MCP session identifier
+const SessionHeader = "Mcp-Session-Id"
+
+// maxRequestBytes caps the size of a single POSTed JSON-RPC payload
+const maxRequestBytes = 16 * 1024 * 1024
+
+// HTTPHandler serves a Server over the MCP "streamable HTTP" transport. Each
+// POST carries client messages; requests are answered with a server-sent event
+// stream (so progress notifications can be delivered) when the client accepts
+// one and with a plain JSON body otherwise.
+type HTTPHandler struct {
+	server         *Server
+	allowedOrigins []string
+
+	mu        sync.Mutex
+	sessions  map[string]*httpSession
+	lastSweep time.Time
+}
+
+// httpSession tracks the activity of a session, so that sessions abandoned
+// by their clients can be dropped
+type httpSession struct {
+	*session
+	lastSeen time.Time
+	active   int
+}
+
+// HTTPHandler returns a http.Handler serving s. Browser requests carrying an
+// Origin header are only accepted from localhost, from the host the request
+// was sent to and from allowedOrigins, which keeps pages of other sites from
+// driving the server. An allowed origin of "*" accepts any origin.
+// Sessions left idle for longer than the session TTL of the server are
+// dropped, as requests come in.
+func (s *Server) HTTPHandler(allowedOrigins ...string) *HTTPHandler {
+	return &HTTPHandler{
+		server:         s,
+		allowedOrigins: allowedOrigins,
+		sessions:       map[string]*httpSession{},
+	}
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if origin := r.Header.Get("Origin"); origin != "" && !h.allowOrigin(origin, r.Host) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		h.handlePost(w, r)
+	case http.MethodDelete:
+		h.handleDelete(w, r)
+	default:
+		// server initiated streams over GET are not supported
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// allowOrigin reports whether requests from origin may reach a server
+// addressed as host
+func (h *HTTPHandler) allowOrigin(origin, host string) bool {
+	if slices.Contains(h.allowedOrigins, "*") || slices.Contains(h.allowedOrigins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	switch u.Hostname() {
+	case "localhost", "127.0.0.1", "::1":
+		return true
+	}
+
+	return u.Host == host
+}
+
+func (h *HTTPHandler) handlePost(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	messages, err := mcp.DecodeMessages(body)
+	if err != nil || len(messages) == 0 {
+		writeJSON(w, http.StatusBadRequest, mcp.NewErrorResponse(nil, mcp.ParseError, "invalid JSON-RPC payload"))
+		return
+	}
+
+	isInit := false
+	hasRequests := false
+	for _, m := range messages {
+		if m.Method == mcp.MethodInitialize {
+			isInit = true
+		}
+		if m.IsRequest() {
+			hasRequests = true
+		}
+	}
+
+	var ss *httpSession
+	if isInit {
+		id, err := newSessionID()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ss = &httpSession{session: h.server.newSession()}
+		h.mu.Lock()
+		h.sessions[id] = ss
+		h.acquire(ss)
+		h.mu.Unlock()
+
+		w.Header().Set(SessionHeader, id)
+	} else {
+		id := r.Header.Get(SessionHeader)
+		if id == "" {
+			http.Error(w, "missing "+SessionHeader+" header", http.StatusBadRequest)
+			return
+		}
+
+		h.mu.Lock()
+		ss = h.sessions[id]
+		if ss != nil {
+			h.acquire(ss)
+		}
+		h.mu.Unlock()
+
+		if ss == nil {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+	}
+	defer h.release(ss)
+
+	if !hasRequests {
+		for _, m := range messages {
+			ss.handle(r.Context(), m, nil)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		h.streamResponses(r.Context(), w, ss.session, messages)
+		return
+	}
+
+	responses := handleAll(r.Context(), ss.session, messages, nil)
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if len(responses) == 1 && bytes.TrimSpace(body)[0] != '[' {
+		writeJSON(w, http.StatusOK, responses[0])
+		return
+	}
+	writeJSON(w, http.StatusOK, responses)
+}
+
+// streamResponses answers requests over a server-sent event stream, interleaving
+// notifications emitted by tools with the final responses
+func (h *HTTPHandler) streamResponses(ctx context.Context, w http.ResponseWriter, ss *session, messages []*mcp.Message) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	var writeMu sync.Mutex
+	write := func(m *mcp.Message) error {
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		if _, err := io.WriteString(w, "event: message\ndata: "+string(raw)+"\n\n"); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	for _, resp := range handleAll(ctx, ss, messages, write) {
+		if err := write(resp); err != nil {
+			h.server.logger.Error(err, "failed to write event")
+			return
+		}
+	}
+}
+
+// acquire marks a session as in use, sweeping idle sessions first. It must
+// be called with mu held.
+func (h *HTTPHandler) acquire(ss *httpSession) {
+	now := time.Now()
+	ss.active++
+	ss.lastSeen = now
+
+	ttl := h.server.sessionTTL
+	if ttl <= 0 || now.Sub(h.lastSweep) < ttl/4 {
+		return
+	}
+	h.lastSweep = now
+
+	for id, other := range h.sessions {
+		if other.active == 0 && now.Sub(other.lastSeen) > ttl {
+			delete(h.sessions, id)
+			other.cancelAll()
+			h.server.logger.V(1).Info("dropped idle session", "idle", now.Sub(other.lastSeen))
+		}
+	}
+}
+
+// release marks the end of a request of a session
+func (h *HTTPHandler) release(ss *httpSession) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ss.active--
+	ss.lastSeen = time.Now()
+}
+
+func (h *HTTPHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(SessionHeader)
+
+	h.mu.Lock()
+	ss, ok := h.sessions[id]
+	delete(h.sessions, id)
+	h.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "unknown session", http.StatusNotFound)
+		return
+	}
+
+	ss.cancelAll()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAll handles notifications in order and requests concurrently, returning
+// the responses in request order
+func handleAll(ctx context.Context, ss *session, messages []*mcp.Message, notify func(*mcp.Message) error) []*mcp.Message {
+	responses := make([]*mcp.Message, len(messages))
+
+	var wg sync.WaitGroup
+	for i, m := range messages {
+		if !m.IsRequest() {
+			ss.handle(ctx, m, notify)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, m *mcp.Message) {
+			defer wg.Done()
+			responses[i] = ss.handle(ctx, m, notify)
+		}(i, m)
+	}
+	wg.Wait()
+
+	return slices.DeleteFunc(responses, func(m *mcp.Message) bool {
+		return m == nil
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// Server exposes a set of core.Tool values to MCP clients. The same Server may
+// be served over stdio and HTTP at once: every connection gets its own session.
+type Server struct {
+	info         mcp.Implementation
+	instructions string
+	logger       *logr.Logger
+
+	tools      map[string]*core.Tool
+	names      []string
+	sessionTTL time.Duration
+}
+
+// ServerConfig holds configuration for a Server
+type ServerConfig struct {
+	// ServerInfo is reported to clients during initialization
+	ServerInfo mcp.Implementation
+
+	// Instructions is an optional hint to clients on how to use the server
+	Instructions string
+
+	// Tools served to clients
+	Tools []*core.Tool
+
+	// SessionTTL is how long an HTTP session may stay idle before it is
+	// dropped, for clients that go away without deleting it
+	// default 30 minutes
+	SessionTTL time.Duration
+
+	// The provided logr.Logger
+	Logger *logr.Logger
+}
+
+// ServerConfigFunc is a function type that modifies ServerConfig
+type ServerConfigFunc func(*ServerConfig)
+
+func WithServerInfo(name, version string) ServerConfigFunc {
+	return func(conf *ServerConfig) {
+		conf.ServerInfo = mcp.Implementation{Name: name, Version: version}
+	}
+}
+
+func WithInstructions(instructions string) ServerConfigFunc {
+	return func(conf *ServerConfig) {
+		conf.Instructions = instructions
+	}
+}
+
+func WithTools(tool ...*core.Tool) ServerConfigFunc {
+	return func(conf *ServerConfig) {
+		conf.Tools = append(conf.Tools, tool...)
+	}
+}
+
+// WithToolMap serves every tool of a map keyed by tool name, such as the
+// agent.ToolMap returned by ToolRegistry.Map
+func WithToolMap(tools map[string]*core.Tool) ServerConfigFunc {
+	return func(conf *ServerConfig) {
+		for _, tool := range tools {
+			conf.Tools = append(conf.Tools, tool)
+		}
+	}
+}
+
+func WithSessionTTL(ttl time.Duration) ServerConfigFunc {
+	return func(conf *ServerConfig) {
+		conf.SessionTTL = ttl
+	}
+}
+
+func WithLogger(l *logr.Logger) ServerConfigFunc {
+	return func(conf *ServerConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewServer returns a new Server. Tools without a name or function, and tools
+// sharing a name, are rejected.
+func NewServer(opts ...ServerConfigFunc) (*Server, error) {
+	conf := &ServerConfig{
+		ServerInfo: mcp.Implementation{
+			Name:    "agent-api",
+			Version: "0.0.0",
+		},
+		Tools:      []*core.Tool{},
+		SessionTTL: 30 * time.Minute,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if conf.Logger == nil {
+		l := logr.Discard()
+		conf.Logger = &l
+	}
+
+	s := &Server{
+		info:         conf.ServerInfo,
+		instructions: conf.Instructions,
+		logger:       conf.Logger,
+		tools:        make(map[string]*core.Tool),
+		sessionTTL:   conf.SessionTTL,
+	}
+
+	for _, tool := range conf.Tools {
+		if tool.Name == "" {
+			return nil, fmt.Errorf("tool must have a name")
+		}
+		if tool.WrappedToolFunction == nil {
+			return nil, fmt.Errorf("tool %s must have a function", tool.Name)
+		}
+
+		if _, ok := s.tools[tool.Name]; ok {
+			return nil, fmt.Errorf("duplicate tool %s", tool.Name)
+		}
+
+		s.names = append(s.names, tool.Name)
+		s.tools[tool.Name] = tool
+	}
+
+	// stable ordering for tools/list
+	sort.Strings(s.names)
+
+	return s, nil
+}
+
+// session is the per connection state of the server
+type session struct {
+	server *Server
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+}
+
+func (s *Server) newSession() *session {
+	return &session{
+		server:   s,
+		inflight: map[string]context.CancelFunc{},
+	}
+}
+
+// handle processes one inbound message. Requests return a response, all other
+// messages return nil. notify is used to emit notifications (i.e., progress)
+// while the request is being handled and may be nil.
+func (ss *session) handle(ctx context.Context, m *mcp.Message, notify func(*mcp.Message) error) *mcp.Message {
+	if m.JSONRPC != mcp.JSONRPCVersion {
+		if m.IsRequest() {
+			return mcp.NewErrorResponse(m.ID, mcp.InvalidRequest, "jsonrpc must be \"2.0\"")
+		}
+		return nil
+	}
+
+	if m.IsNotification() {
+		ss.handleNotification(m)
+		return nil
+	}
+
+	if !m.IsRequest() {
+		// responses to server initiated requests, of which there are none
+		return nil
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ss.mu.Lock()
+	ss.inflight[string(m.ID)] = cancel
+	ss.mu.Unlock()
+
+	defer func() {
+		ss.mu.Lock()
+		delete(ss.inflight, string(m.ID))
+		ss.mu.Unlock()
+	}()
+
+	result, err := ss.dispatch(ctx, m, notify)
+
+	// requests cancelled by the client must not be answered
+	if ctx.Err() != nil && parent.Err() == nil {
+		return nil
+	}
+
+	if err != nil {
+		if rpcErr, ok := err.(*mcp.Error); ok {
+			return &mcp.Message{
+				JSONRPC: mcp.JSONRPCVersion,
+				ID:      m.ID,
+				Error:   rpcErr,
+			}
+		}
+
+		return mcp.NewErrorResponse(m.ID, mcp.InternalError, err.Error())
+	}
+
+	resp, err := mcp.NewResponse(m.ID, result)
+	if err != nil {
+		return mcp.NewErrorResponse(m.ID, mcp.InternalError, err.Error())
+	}
+
+	return resp
+}
+
+func (ss *session) handleNotification(m *mcp.Message) {
+	switch m.Method {
+	case mcp.NotificationCancelled:
+		params := &mcp.CancelledNotificationParams{}
+		if err := json.Unmarshal(m.Params, params); err != nil {
+			return
+		}
+
+		ss.mu.Lock()
+		cancel, ok := ss.inflight[string(params.RequestID)]
+		ss.mu.Unlock()
+
+		if ok {
+			ss.server.logger.V(1).Info("cancelling request", "id", string(params.RequestID), "reason", params.Reason)
+			cancel()
+		}
+	}
+}
+
+// cancelAll cancels every in flight request of the session
+func (ss *session) cancelAll() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, cancel := range ss.inflight {
+		cancel()
+	}
+}
+
+func (ss *session) dispatch(ctx context.Context, m *mcp.Message, notify func(*mcp.Message) error) (any, error) {
+	s := ss.server
+
+	switch m.Method {
+	case mcp.MethodInitialize:
+		params := &mcp.InitializeParams{}
+		if err := unmarshalParams(m.Params, params); err != nil {
+			return nil, err
+		}
+
+		return &mcp.InitializeResult{
+			ProtocolVersion: negotiateVersion(params.ProtocolVersion),
+			Capabilities: mcp.ServerCapabilities{
+				Tools: &mcp.ToolsCapability{},
+			},
+			ServerInfo:   s.info,
+			Instructions: s.instructions,
+		}, nil
+
+	case mcp.MethodPing:
+		return struct{}{}, nil
+
+	case mcp.MethodToolsList:
+		return s.listTools(), nil
+
+	case mcp.MethodToolsCall:
+		params := &mcp.CallToolParams{}
+		if err := unmarshalParams(m.Params, params); err != nil {
+			return nil, err
+		}
+
+		if params.Meta != nil && len(params.Meta.ProgressToken) > 0 && notify != nil {
+			ctx = context.WithValue(ctx, progressKey{}, &progressReporter{
+				token:  params.Meta.ProgressToken,
+				notify: notify,
+			})
+		}
+
+		return s.callTool(ctx, params)
+
+	default:
+		return nil, &mcp.Error{
+			Code:    mcp.MethodNotFound,
+			Message: fmt.Sprintf("method %s not found", m.Method),
+		}
+	}
+}
+
+func unmarshalParams(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &mcp.Error{
+			Code:    mcp.InvalidParams,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// negotiateVersion echoes the client's version when it is one we understand and
+// otherwise answers with our own
+func negotiateVersion(requested string) string {
+	switch requested {
+	case "2024-11-05", mcp.ProtocolVersion:
+		return requested
+	default:
+		return mcp.ProtocolVersion
+	}
+}
+
+func (s *Server) listTools() *mcp.ListToolsResult {
+	result := &mcp.ListToolsResult{
+		Tools: make([]*mcp.Tool, 0, len(s.names)),
+	}
+
+	for _, name := range s.names {
+		tool := s.tools[name]
+
+		schema := json.RawMessage(tool.JSONSchema)
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+
+		result.Tools = append(result.Tools, &mcp.Tool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return result
+}
+
+// callTool runs the tool. Tool failures are reported in the result with IsError
+// so that the calling model can see them.
+func (s *Server) callTool(ctx context.Context, params *mcp.CallToolParams) (*mcp.CallToolResult, error) {
+	tool, ok := s.tools[params.Name]
+	if !ok {
+		return nil, &mcp.Error{
+			Code:    mcp.InvalidParams,
+			Message: fmt.Sprintf("tool %s not found", params.Name),
+		}
+	}
+
+	args := []byte(params.Arguments)
+	if len(args) == 0 {
+		args = []byte("{}")
+	}
+
+	s.logger.V(1).Info("calling tool", "tool", tool.Name)
+	result, err := tool.WrappedToolFunction(ctx, args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			Content: []*mcp.Content{mcp.TextContent(err.Error())},
+			IsError: true,
+		}, nil
+	}
+
+	return toCallToolResult(result)
+}
+
+// toCallToolResult renders a tool's return value as MCP content. Strings are
+// sent as text, anything else is sent as its JSON encoding and, when it encodes
+// to an object, as structured content.
+func toCallToolResult(result any) (*mcp.CallToolResult, error) {
+	switch r := result.(type) {
+	case nil:
+		return &mcp.CallToolResult{Content: []*mcp.Content{}}, nil
+	case *mcp.CallToolResult:
+		return r, nil
+	case string:
+		return &mcp.CallToolResult{Content: []*mcp.Content{mcp.TextContent(r)}}, nil
+	case []byte:
+		return &mcp.CallToolResult{Content: []*mcp.Content{mcp.TextContent(string(r))}}, nil
+	}
+
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling tool result: %w", err)
+	}
+
+	callResult := &mcp.CallToolResult{
+		Content: []*mcp.Content{mcp.TextContent(string(raw))},
+	}
+	if len(raw) > 0 && raw[0] == '{' {
+		callResult.StructuredContent = json.RawMessage(raw)
+	}
+
+	return callResult, nil
+}
+
+type progressKey struct{}
+
+type progressReporter struct {
+	token  json.RawMessage
+	notify func(*mcp.Message) error
+}
+
+// ReportProgress sends a progress notification to the client for the tool call
+// that ctx belongs to. It is a no-op if the client did not ask for progress or
+// the transport cannot deliver notifications. Tools call it from their
+// WrappedToolFunction with the context they were given.
+func ReportProgress(ctx context.Context, progress, total float64, message string) error {
+	r, ok := ctx.Value(progressKey{}).(*progressReporter)
+	if !ok {
+		return nil
+	}
+
+	n, err := mcp.NewNotification(mcp.NotificationProgress, &mcp.ProgressNotificationParams{
+		ProgressToken: r.token,
+		Progress:      progress,
+		Total:         total,
+		Message:       message,
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.notify(n)
+}
@@ -0,0 +1,303 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/mcp"
+)
+
+type echoArgs struct {
+	Text string `json:"text"`
+}
+
+func echoTool(t *testing.T, name string) *core.Tool {
+	t.Helper()
+
+	fn, err := core.WrapToolFunction(func(ctx context.Context, args *echoArgs) (string, error) {
+		return args.Text, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &core.Tool{Name: name, Description: "echoes text", WrappedToolFunction: fn}
+}
+
+func TestNewServerDuplicateTool(t *testing.T) {
+	_, err := NewServer(WithTools(echoTool(t, "echo"), echoTool(t, "echo")))
+	if err == nil || !strings.Contains(err.Error(), "duplicate tool echo") {
+		t.Errorf("got %v, want a duplicate tool error", err)
+	}
+}
+
+func post(t *testing.T, url, session, body string) *http.Response {
+	t.Helper()
+
+	return do(t, newPost(t, url, session, body))
+}
+
+func newPost(t *testing.T, url, session, body string) *http.Request {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if session != "" {
+		req.Header.Set(SessionHeader, session)
+	}
+
+	return req
+}
+
+func do(t *testing.T, req *http.Request) *http.Response {
+	t.Helper()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+const initialize = `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`
+
+func TestHTTPSessionTTL(t *testing.T) {
+	s, err := NewServer(WithTools(echoTool(t, "echo")), WithSessionTTL(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+
+	idle := post(t, srv.URL, "", initialize).Header.Get(SessionHeader)
+	if idle == "" {
+		t.Fatal("no session id returned")
+	}
+	if resp := post(t, srv.URL, idle, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("ping: status %d", resp.StatusCode)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	// a request of another client sweeps the idle session
+	active := post(t, srv.URL, "", initialize).Header.Get(SessionHeader)
+	if resp := post(t, srv.URL, idle, `{"jsonrpc":"2.0","id":3,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("idle session: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+	if resp := post(t, srv.URL, active, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); resp.StatusCode != http.StatusOK {
+		t.Errorf("active session: status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestHTTPDeleteSession(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+
+	id := post(t, srv.URL, "", initialize).Header.Get(SessionHeader)
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL, nil)
+	req.Header.Set(SessionHeader, id)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete: status %d", resp.StatusCode)
+	}
+
+	if resp := post(t, srv.URL, id, `{"jsonrpc":"2.0","id":2,"method":"ping"}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("deleted session: status %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	for requested, want := range map[string]string{
+		"2024-11-05": "2024-11-05",
+		"2025-03-26": "2025-03-26",
+		"2025-06-18": mcp.ProtocolVersion,
+		"1999-01-01": mcp.ProtocolVersion,
+		"":           mcp.ProtocolVersion,
+	} {
+		if got := negotiateVersion(requested); got != want {
+			t.Errorf("negotiateVersion(%q) = %q, want %q", requested, got, want)
+		}
+	}
+}
+
+func TestHTTPOrigin(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := httptest.NewServer(s.HTTPHandler())
+	defer local.Close()
+	allowed := httptest.NewServer(s.HTTPHandler("https://app.example"))
+	defer allowed.Close()
+	wide := httptest.NewServer(s.HTTPHandler("*"))
+	defer wide.Close()
+
+	tests := map[string]struct {
+		url    string
+		origin string
+		want   int
+	}{
+		"no origin":               {local.URL, "", http.StatusOK},
+		"localhost":               {local.URL, "http://localhost:5173", http.StatusOK},
+		"loopback":                {local.URL, "http://127.0.0.1:8080", http.StatusOK},
+		"loopback v6":             {local.URL, "http://[::1]:8080", http.StatusOK},
+		"same host":               {local.URL, local.URL, http.StatusOK},
+		"other site":              {local.URL, "https://evil.example", http.StatusForbidden},
+		"localhost lookalike":     {local.URL, "http://localhost.evil.example", http.StatusForbidden},
+		"opaque origin":           {local.URL, "null", http.StatusForbidden},
+		"allowed origin":          {allowed.URL, "https://app.example", http.StatusOK},
+		"other than allowed":      {allowed.URL, "https://evil.example", http.StatusForbidden},
+		"localhost besides those": {allowed.URL, "http://localhost:5173", http.StatusOK},
+		"any origin":              {wide.URL, "https://evil.example", http.StatusOK},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := newPost(t, tt.url, "", initialize)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if resp := do(t, req); resp.StatusCode != tt.want {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPCancelled(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn, err := core.WrapToolFunction(func(ctx context.Context, args *echoArgs) (string, error) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+			return "", ctx.Err()
+		case <-time.After(5 * time.Second):
+			return "not cancelled", nil
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(WithTools(&core.Tool{Name: "wait", WrappedToolFunction: fn}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+	id := post(t, srv.URL, "", initialize).Header.Get(SessionHeader)
+
+	call := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(newPost(t, srv.URL, id, `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"wait","arguments":{}}}`))
+		if err != nil {
+			t.Error(err)
+			close(call)
+			return
+		}
+		resp.Body.Close()
+		call <- resp
+	}()
+	<-started
+
+	if resp := post(t, srv.URL, id, `{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"test"}}`); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("cancel: status %d", resp.StatusCode)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the tool call was not cancelled")
+	}
+
+	// cancelled requests are not answered
+	if resp := <-call; resp != nil && resp.StatusCode != http.StatusAccepted {
+		t.Errorf("cancelled call: status %d, want %d", resp.StatusCode, http.StatusAccepted)
+	}
+}
+
+func TestHTTPProgress(t *testing.T) {
+	fn, err := core.WrapToolFunction(func(ctx context.Context, args *echoArgs) (string, error) {
+		for i := 1; i <= 2; i++ {
+			if err := ReportProgress(ctx, float64(i), 2, "step"); err != nil {
+				return "", err
+			}
+		}
+		return "done", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(WithTools(&core.Tool{Name: "steps", WrappedToolFunction: fn}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(s.HTTPHandler())
+	defer srv.Close()
+	id := post(t, srv.URL, "", initialize).Header.Get(SessionHeader)
+
+	req := newPost(t, srv.URL, id, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"steps","arguments":{},"_meta":{"progressToken":"tok"}}}`)
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	resp := do(t, req)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	var events []*mcp.Message
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		m := &mcp.Message{}
+		if err := json.Unmarshal([]byte(data), m); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, m)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 2 notifications and a response", len(events))
+	}
+
+	for i, n := range events[:2] {
+		params := &mcp.ProgressNotificationParams{}
+		if n.Method != mcp.NotificationProgress || json.Unmarshal(n.Params, params) != nil {
+			t.Fatalf("event %d: got %+v", i, n)
+		}
+		if string(params.ProgressToken) != `"tok"` || params.Progress != float64(i+1) || params.Total != 2 {
+			t.Errorf("event %d: got %+v", i, params)
+		}
+	}
+	if string(events[2].ID) != "2" || events[2].Error != nil {
+		t.Errorf("got response %+v", events[2])
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/joaopandolfi/core/mcp"
+)
+
+// ServeStdio serves the MCP stdio transport on the process' stdin and stdout
+// until stdin is closed or ctx is cancelled
+func (s *Server) ServeStdio(ctx context.Context) error {
+	return s.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// Serve reads newline delimited JSON-RPC messages from r and writes responses
+// and notifications to w. Requests are handled concurrently so that long
+// running tools can be cancelled. It returns once r reaches EOF or ctx is
+// cancelled, after every in flight request has finished.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ss := s.newSession()
+
+	var writeMu sync.Mutex
+	write := func(m *mcp.Message) error {
+		raw, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		raw = append(raw, '\n')
+
+		writeMu.Lock()
+		defer writeMu.Unlock()
+
+		_, err = w.Write(raw)
+		return err
+	}
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer ss.cancelAll()
+
+	for {
+		var line []byte
+		var ok bool
+
+		select {
+		case line, ok = <-lines:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if !ok {
+			select {
+			case err := <-readErr:
+				if err != nil && !errors.Is(err, io.EOF) {
+					return err
+				}
+			default:
+			}
+			return nil
+		}
+
+		if len(line) == 0 {
+			continue
+		}
+
+		messages, err := mcp.DecodeMessages(line)
+		if err != nil {
+			write(mcp.NewErrorResponse(nil, mcp.ParseError, err.Error()))
+			continue
+		}
+
+		for _, m := range messages {
+			if !m.IsRequest() {
+				// notifications, such as cancellation, must be applied in order
+				ss.handle(ctx, m, write)
+				continue
+			}
+
+			wg.Add(1)
+			go func(m *mcp.Message) {
+				defer wg.Done()
+
+				if resp := ss.handle(ctx, m, write); resp != nil {
+					if err := write(resp); err != nil {
+						s.logger.Error(err, "failed to write response", "method", m.Method)
+					}
+				}
+			}(m)
+		}
+	}
+}
@@ -50,6 +50,26 @@ type Metadata struct {
 	RequestID int
 
 	ProviderProperties map[string]string
+
+	// Citations lists the passages retrieved into the context of the
+	// message, as numbered for the model to cite them
+	Citations []*Citation
+}
+
+// Citation identifies a passage retrieved from a vector store
+type Citation struct {
+	// Index is the number the passage is cited with, as [1]
+	Index int
+
+	// Store is the name of the store the passage comes from, when several
+	// are searched
+	Store string
+
+	// ID of the embedding of the passage
+	ID string
+
+	Score    float32
+	Metadata map[string]interface{}
 }
 
 // ToolCall represents a specific tool invocation request
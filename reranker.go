@@ -0,0 +1,12 @@
+package core
+
+import "context"
+
+// Reranker rescores the results of a search for the query that produced
+// them, typically with a model more precise but slower than the one behind
+// the search
+type Reranker interface {
+	// Rerank returns results ordered best first with updated scores, at
+	// most limit of them, or all of them when limit is zero or less
+	Rerank(ctx context.Context, query string, results []*SearchResult, limit int) ([]*SearchResult, error)
+}
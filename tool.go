@@ -57,7 +57,6 @@ func WrapToolFunction(fn interface{}) (func(context.Context, []byte) (interface{
 	}
 
 	return func(ctx context.Context, args []byte) (interface{}, error) {
-		fmt.Printf("In wrapped func\nargs: %s\n", args)
 		// Create a new instance of the target struct
 		target := reflect.New(argType.Elem()).Interface()
 		if err := json.Unmarshal(args, target); err != nil {
@@ -72,7 +71,7 @@ func WrapToolFunction(fn interface{}) (func(context.Context, []byte) (interface{
 
 		// Extract return values
 		var result interface{}
-		if !results[0].IsNil() {
+		if !isNilValue(results[0]) {
 			result = results[0].Interface()
 		}
 
@@ -84,3 +83,26 @@ func WrapToolFunction(fn interface{}) (func(context.Context, []byte) (interface{
 		return result, errResult
 	}, nil
 }
+
+// isNilValue reports whether v holds a nil pointer, interface, map, slice,
+// channel or function. Values of other kinds, such as strings, are never nil.
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
+
+// ToolResultRenderer turns the result of a tool call into the text content of
+// the tool message sent back to the LLM
+type ToolResultRenderer interface {
+	RenderToolResult(ctx context.Context, tc *ToolCall, result interface{}) (string, error)
+}
+
+// ToolSelector picks the subset of an agent's tools offered to the LLM for the
+// next step of a conversation
+type ToolSelector interface {
+	SelectTools(ctx context.Context, messages []*Message, tools []*Tool) ([]*Tool, error)
+}
@@ -0,0 +1,257 @@
+package fs
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filePatch is the set of hunks a unified diff applies to a single file
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []*hunk
+}
+
+// isCreate reports whether the patch creates a new file
+func (fp *filePatch) isCreate() bool {
+	return fp.oldPath == ""
+}
+
+// isDelete reports whether the patch deletes a file
+func (fp *filePatch) isDelete() bool {
+	return fp.newPath == ""
+}
+
+type hunk struct {
+	oldStart int
+	lines    []string
+}
+
+// oldLines returns the lines the hunk expects to find in the original file
+func (h *hunk) oldLines() []string {
+	out := []string{}
+	for _, l := range h.lines {
+		if l[0] == ' ' || l[0] == '-' {
+			out = append(out, l[1:])
+		}
+	}
+	return out
+}
+
+// newLines returns the lines the hunk leaves in place of oldLines
+func (h *hunk) newLines() []string {
+	out := []string{}
+	for _, l := range h.lines {
+		if l[0] == ' ' || l[0] == '+' {
+			out = append(out, l[1:])
+		}
+	}
+	return out
+}
+
+// parsePatch parses a unified diff (as produced by "diff -u" or "git diff")
+// into per file patches
+func parsePatch(patch string) ([]*filePatch, error) {
+	patches := []*filePatch{}
+	var current *filePatch
+	var h *hunk
+	oldLeft, newLeft := 0, 0
+
+	scanner := bufio.NewScanner(strings.NewReader(patch))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		// inside a hunk, consume exactly the announced number of lines
+		if h != nil && (oldLeft > 0 || newLeft > 0) {
+			if line == "" {
+				// some tools strip the trailing space of empty context lines
+				line = " "
+			}
+
+			switch line[0] {
+			case ' ':
+				oldLeft--
+				newLeft--
+			case '-':
+				oldLeft--
+			case '+':
+				newLeft--
+			case '\\':
+				// "\ No newline at end of file"
+				continue
+			default:
+				return nil, fmt.Errorf("malformed hunk line %q", line)
+			}
+
+			if oldLeft < 0 || newLeft < 0 {
+				return nil, fmt.Errorf("hunk longer than its header announced")
+			}
+
+			h.lines = append(h.lines, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			current = &filePatch{oldPath: patchPath(line[4:])}
+			patches = append(patches, current)
+			h = nil
+
+		case strings.HasPrefix(line, "+++ "):
+			if current == nil {
+				return nil, fmt.Errorf("\"+++\" line without preceding \"---\" line")
+			}
+			current.newPath = patchPath(line[4:])
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("hunk without file header")
+			}
+
+			var err error
+			h = &hunk{}
+			h.oldStart, oldLeft, newLeft, err = parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			current.hunks = append(current.hunks, h)
+		}
+	}
+
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, fmt.Errorf("patch ends in the middle of a hunk")
+	}
+
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("no file headers found in patch")
+	}
+
+	for _, fp := range patches {
+		if fp.oldPath == "" && fp.newPath == "" {
+			return nil, fmt.Errorf("patch has neither an old nor a new file path")
+		}
+	}
+
+	return patches, nil
+}
+
+// patchPath extracts the file path of a "---" or "+++" header, stripping git
+// style "a/" and "b/" prefixes. /dev/null yields an empty path.
+func patchPath(header string) string {
+	// drop an optional timestamp separated by a tab
+	if i := strings.IndexByte(header, '\t'); i >= 0 {
+		header = header[:i]
+	}
+	header = strings.TrimSpace(header)
+
+	if header == "/dev/null" {
+		return ""
+	}
+
+	if strings.HasPrefix(header, "a/") || strings.HasPrefix(header, "b/") {
+		return header[2:]
+	}
+
+	return header
+}
+
+// parseHunkHeader parses "@@ -l,s +l,s @@" returning the old start line and the
+// old and new line counts
+func parseHunkHeader(line string) (int, int, int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q", line)
+	}
+
+	oldStart, oldCount, err := parseRange(fields[1][1:])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q: %w", line, err)
+	}
+
+	_, newCount, err := parseRange(fields[2][1:])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header %q: %w", line, err)
+	}
+
+	return oldStart, oldCount, newCount, nil
+}
+
+func parseRange(r string) (int, int, error) {
+	start, count, found := strings.Cut(r, ",")
+
+	s, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if !found {
+		return s, 1, nil
+	}
+
+	c, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return s, c, nil
+}
+
+// maxFuzz is how far from its announced position a hunk may be found
+const maxFuzz = 200
+
+// applyHunks applies hunks to the lines of a file. Each hunk is located at its
+// announced line or, failing that, at the nearest position where its context
+// matches exactly.
+func applyHunks(lines []string, hunks []*hunk) ([]string, error) {
+	out := make([]string, 0, len(lines))
+	cursor := 0
+
+	for i, h := range hunks {
+		old := h.oldLines()
+
+		want := h.oldStart - 1
+		if len(old) == 0 {
+			// pure insertions name the line after which they apply
+			want = h.oldStart
+		}
+
+		pos := findHunk(lines, old, want, cursor)
+		if pos < 0 {
+			return nil, fmt.Errorf("hunk %d (at line %d) does not apply", i+1, h.oldStart)
+		}
+
+		out = append(out, lines[cursor:pos]...)
+		out = append(out, h.newLines()...)
+		cursor = pos + len(old)
+	}
+
+	return append(out, lines[cursor:]...), nil
+}
+
+func findHunk(lines, old []string, want, min int) int {
+	for offset := 0; offset <= maxFuzz; offset++ {
+		for _, pos := range []int{want - offset, want + offset} {
+			if pos < min || pos+len(old) > len(lines) {
+				continue
+			}
+			if matchesAt(lines, old, pos) {
+				return pos
+			}
+		}
+	}
+
+	return -1
+}
+
+func matchesAt(lines, old []string, pos int) bool {
+	for i, l := range old {
+		if lines[pos+i] != l {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,276 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrOutsideRoot is returned for any path that resolves outside the sandbox root
+	ErrOutsideRoot = errors.New("path escapes sandbox root")
+
+	// ErrReadOnly is returned by write operations on a read-only sandbox
+	ErrReadOnly = errors.New("sandbox is read-only")
+
+	// ErrExtensionNotAllowed is returned for files whose extension is not allowlisted
+	ErrExtensionNotAllowed = errors.New("file extension not allowed")
+)
+
+// Sandbox confines file system access to a single root directory. Every path
+// handed to it is interpreted relative to the root and ".." can never climb
+// above it. Files are opened through an os.Root, which resolves each path
+// component relative to its parent and rejects symlinks leading out of the
+// root at the time of the open, so that a symlink swapped in by another
+// process, such as a shell tool sharing the workspace, cannot escape it.
+type Sandbox struct {
+	root string
+	fsys *os.Root
+
+	readOnly          bool
+	maxReadBytes      int64
+	maxWriteBytes     int64
+	maxResults        int
+	allowedExtensions []string
+	prefix            string
+}
+
+// SandboxConfig holds configuration for a Sandbox
+type SandboxConfig struct {
+	// ReadOnly disables every tool that modifies the file system
+	ReadOnly bool
+
+	// MaxReadBytes caps how much of a file is read at once.
+	// default 1MiB
+	MaxReadBytes int64
+
+	// MaxWriteBytes caps the size of a written file.
+	// default 1MiB
+	MaxWriteBytes int64
+
+	// MaxResults caps the number of entries returned by listDir, glob and grep.
+	// default 500
+	MaxResults int
+
+	// AllowedExtensions, when non empty, restricts which files can be read or
+	// written (i.e., ".go", ".md"). Extensions are matched case insensitively.
+	AllowedExtensions []string
+
+	// Prefix is prepended to every tool name
+	Prefix string
+}
+
+// SandboxConfigFunc is a function type that modifies SandboxConfig
+type SandboxConfigFunc func(*SandboxConfig)
+
+func WithReadOnly() SandboxConfigFunc {
+	return func(conf *SandboxConfig) {
+		conf.ReadOnly = true
+	}
+}
+
+func WithMaxReadBytes(n int64) SandboxConfigFunc {
+	return func(conf *SandboxConfig) {
+		conf.MaxReadBytes = n
+	}
+}
+
+func WithMaxWriteBytes(n int64) SandboxConfigFunc {
+	return func(conf *SandboxConfig) {
+		conf.MaxWriteBytes = n
+	}
+}
+
+func WithMaxResults(n int) SandboxConfigFunc {
+	return func(conf *SandboxConfig) {
+		conf.MaxResults = n
+	}
+}
+
+func WithAllowedExtensions(ext ...string) SandboxConfigFunc {
+	return func(conf *SandboxConfig) {
+		conf.AllowedExtensions = append(conf.AllowedExtensions, ext...)
+	}
+}
+
+func WithPrefix(prefix string) SandboxConfigFunc {
+	return func(conf *SandboxConfig) {
+		conf.Prefix = prefix
+	}
+}
+
+// NewSandbox returns a new Sandbox rooted at the given directory
+func NewSandbox(root string, opts ...SandboxConfigFunc) (*Sandbox, error) {
+	conf := &SandboxConfig{
+		MaxReadBytes:  1 << 20,
+		MaxWriteBytes: 1 << 20,
+		MaxResults:    500,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// the root itself may be a symlink, anchor everything on its real location
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving sandbox root: %w", err)
+	}
+
+	fsys, err := os.OpenRoot(real)
+	if err != nil {
+		return nil, fmt.Errorf("error opening sandbox root: %w", err)
+	}
+
+	info, err := fsys.Stat(".")
+	if err != nil {
+		fsys.Close()
+		return nil, err
+	}
+	if !info.IsDir() {
+		fsys.Close()
+		return nil, fmt.Errorf("sandbox root %s is not a directory", root)
+	}
+
+	exts := make([]string, 0, len(conf.AllowedExtensions))
+	for _, ext := range conf.AllowedExtensions {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		exts = append(exts, ext)
+	}
+
+	return &Sandbox{
+		root:              real,
+		fsys:              fsys,
+		readOnly:          conf.ReadOnly,
+		maxReadBytes:      conf.MaxReadBytes,
+		maxWriteBytes:     conf.MaxWriteBytes,
+		maxResults:        conf.MaxResults,
+		allowedExtensions: exts,
+		prefix:            conf.Prefix,
+	}, nil
+}
+
+// Root returns the absolute, symlink free sandbox root
+func (s *Sandbox) Root() string {
+	return s.root
+}
+
+// ReadOnly reports whether the sandbox rejects writes
+func (s *Sandbox) ReadOnly() bool {
+	return s.readOnly
+}
+
+// Close releases the handle on the root directory
+func (s *Sandbox) Close() error {
+	return s.fsys.Close()
+}
+
+// Clean maps a path to its slash separated form relative to the root, "."
+// for the root itself. Absolute inputs are treated as relative to the root.
+// Cleaning is lexical: symlinks are checked when the path is opened.
+func (s *Sandbox) Clean(name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("invalid path %q", name)
+	}
+
+	// cleaning against "/" drops any ".." that would climb above the root
+	rel := path.Clean("/" + filepath.ToSlash(name))
+	if rel == "/" {
+		return ".", nil
+	}
+
+	if !filepath.IsLocal(filepath.FromSlash(rel[1:])) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideRoot, name)
+	}
+
+	return rel[1:], nil
+}
+
+// wrap reports errors of os.Root for paths leading out of the root as
+// ErrOutsideRoot. os.Root refuses such paths without an exported error, so
+// the path of a failed operation is resolved again to tell them apart.
+func (s *Sandbox) wrap(err error) error {
+	var pathErr *iofs.PathError
+	if !errors.As(err, &pathErr) || !s.escapes(pathErr.Path) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", ErrOutsideRoot, pathErr.Path)
+}
+
+// escapes reports whether the cleaned path rel resolves out of the root
+// through a symlink, the last element included even when its target is
+// missing
+func (s *Sandbox) escapes(rel string) bool {
+	p := s.root
+	for _, part := range strings.Split(filepath.FromSlash(rel), string(filepath.Separator)) {
+		p = filepath.Join(p, part)
+
+		target, err := filepath.EvalSymlinks(p)
+		if err != nil {
+			// a dangling symlink escapes when its directory does
+			link, err := os.Readlink(p)
+			if err != nil {
+				return false
+			}
+			if !filepath.IsAbs(link) {
+				link = filepath.Join(filepath.Dir(p), link)
+			}
+			dir, err := filepath.EvalSymlinks(filepath.Dir(link))
+			return err == nil && !s.inside(dir)
+		}
+		if !s.inside(target) {
+			return true
+		}
+		p = target
+	}
+
+	return false
+}
+
+// inside reports whether the absolute path p lies within the root
+func (s *Sandbox) inside(p string) bool {
+	rel, err := filepath.Rel(s.root, p)
+	return err == nil && (rel == "." || filepath.IsLocal(rel))
+}
+
+// checkExtension enforces the extension allowlist on a file path
+func (s *Sandbox) checkExtension(p string) error {
+	if len(s.allowedExtensions) == 0 {
+		return nil
+	}
+
+	ext := strings.ToLower(path.Ext(p))
+	if !slices.Contains(s.allowedExtensions, ext) {
+		return fmt.Errorf("%w: %q", ErrExtensionNotAllowed, path.Base(p))
+	}
+
+	return nil
+}
+
+// cleanFile cleans a path to a file that may be read or written
+func (s *Sandbox) cleanFile(name string) (string, error) {
+	p, err := s.Clean(name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.checkExtension(p); err != nil {
+		return "", err
+	}
+
+	return p, nil
+}
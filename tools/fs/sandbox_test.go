@@ -0,0 +1,258 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newSandbox(t *testing.T, opts ...SandboxConfigFunc) (*Sandbox, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	s, err := NewSandbox(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s, dir
+}
+
+func TestSandboxSymlinkEscape(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(dir, "dangling.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ReadFile(ctx, &ReadFileArgs{Path: "link/secret.txt"}); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("reading through a symlink out of the root: got %v, want ErrOutsideRoot", err)
+	}
+	if _, err := s.WriteFile(ctx, &WriteFileArgs{Path: "link/secret.txt", Content: "x"}); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("writing through a symlink out of the root: got %v, want ErrOutsideRoot", err)
+	}
+	if _, err := s.WriteFile(ctx, &WriteFileArgs{Path: "dangling.txt", Content: "x"}); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("writing through a dangling symlink: got %v, want ErrOutsideRoot", err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("a file was created out of the root")
+	}
+
+	data, err := os.ReadFile(filepath.Join(outside, "secret.txt"))
+	if err != nil || string(data) != "secret" {
+		t.Errorf("file out of the root changed: %q, %v", data, err)
+	}
+}
+
+func TestSandboxSymlinkSwap(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "a.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docs", "a.txt"), []byte("public"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := s.ReadFile(ctx, &ReadFileArgs{Path: "docs/a.txt"})
+	if err != nil || content != "public" {
+		t.Fatalf("got %q, %v", content, err)
+	}
+
+	// a directory replaced by a symlink between two calls
+	if err := os.RemoveAll(filepath.Join(dir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+
+	if content, err := s.ReadFile(ctx, &ReadFileArgs{Path: "docs/a.txt"}); !errors.Is(err, ErrOutsideRoot) {
+		t.Errorf("got %q, %v, want ErrOutsideRoot", content, err)
+	}
+}
+
+func TestSandboxInnerSymlink(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	if err := os.WriteFile(filepath.Join(dir, "target.txt"), []byte("inside"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("target.txt", filepath.Join(dir, "alias.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := s.ReadFile(ctx, &ReadFileArgs{Path: "/../alias.txt"})
+	if err != nil || content != "inside" {
+		t.Errorf("got %q, %v", content, err)
+	}
+}
+
+func TestSandboxReadOnly(t *testing.T) {
+	s, _ := newSandbox(t, WithReadOnly())
+
+	if _, err := s.WriteFile(context.Background(), &WriteFileArgs{Path: "a.txt", Content: "x"}); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("got %v, want ErrReadOnly", err)
+	}
+	for _, tool := range s.Tools() {
+		if tool.Name == "writeFile" || tool.Name == "applyPatch" {
+			t.Errorf("read-only sandbox exposes %s", tool.Name)
+		}
+	}
+}
+
+func TestApplyPatchSameFileTwice(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\nthree\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+-one
++ONE
+ two
+ three
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ ONE
+ two
+-three
++THREE
+`
+	if _, err := s.ApplyPatch(ctx, &ApplyPatchArgs{Patch: patch}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "ONE\ntwo\nTHREE\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestApplyPatchAtomic(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	patch := `--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-one
++two
+--- a/missing.txt
++++ b/missing.txt
+@@ -1 +1 @@
+-x
++y
+`
+	if _, err := s.ApplyPatch(ctx, &ApplyPatchArgs{Patch: patch}); err == nil {
+		t.Fatal("patching a missing file succeeded")
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "a.txt"))
+	if string(data) != "one\n" {
+		t.Errorf("a failed patch changed a.txt to %q", data)
+	}
+}
+
+func TestApplyPatchRenameAndDelete(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	for name, content := range map[string]string{"old.txt": "keep\n", "gone.txt": "bye\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patch := `--- a/old.txt
++++ b/sub/new.txt
+@@ -1 +1,2 @@
+ keep
++added
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	summary, err := s.ApplyPatch(ctx, &ApplyPatchArgs{Patch: patch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(summary, "renamed old.txt to sub/new.txt") || !strings.Contains(summary, "deleted gone.txt") {
+		t.Errorf("summary %q", summary)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "sub", "new.txt"))
+	if err != nil || string(data) != "keep\nadded\n" {
+		t.Errorf("got %q, %v", data, err)
+	}
+	for _, name := range []string{"old.txt", "gone.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s still exists", name)
+		}
+	}
+}
+
+func TestListGlobGrep(t *testing.T) {
+	ctx := context.Background()
+	s, dir := newSandbox(t)
+
+	for name, content := range map[string]string{
+		"README.md":      "hello\n",
+		"src/main.go":    "package main\n// hello\n",
+		"src/lib/lib.go": "package lib\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	listing, err := s.ListDir(ctx, &ListDirArgs{Path: "src"})
+	if err != nil || listing != "lib/\nmain.go" {
+		t.Errorf("listDir: got %q, %v", listing, err)
+	}
+
+	matches, err := s.Glob(ctx, &GlobArgs{Pattern: "**/*.go"})
+	if err != nil || matches != "src/lib/lib.go\nsrc/main.go" {
+		t.Errorf("glob: got %q, %v", matches, err)
+	}
+
+	lines, err := s.Grep(ctx, &GrepArgs{Pattern: "hello", Include: "**/*.go"})
+	if err != nil || lines != "src/main.go:2: // hello" {
+		t.Errorf("grep: got %q, %v", lines, err)
+	}
+}
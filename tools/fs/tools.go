@@ -0,0 +1,571 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Tools returns the file system tools backed by the sandbox. Tools that write
+// (writeFile and applyPatch) are left out of a read-only sandbox.
+func (s *Sandbox) Tools() []*core.Tool {
+	tools := []*core.Tool{
+		s.tool("readFile", "Reads a text file. Use offset and limit (in lines) to page through large files.", readFileSchema, s.ReadFile),
+		s.tool("listDir", "Lists the entries of a directory. Directories end with a slash.", listDirSchema, s.ListDir),
+		s.tool("glob", "Finds files whose path matches a glob pattern. \"**\" matches any number of directories, i.e., \"src/**/*.go\".", globSchema, s.Glob),
+		s.tool("grep", "Searches file contents with a regular expression and returns matching lines as path:line: text.", grepSchema, s.Grep),
+	}
+
+	if !s.readOnly {
+		tools = append(tools,
+			s.tool("writeFile", "Writes a text file, creating parent directories as needed. Overwrites existing files unless append is set.", writeFileSchema, s.WriteFile),
+			s.tool("applyPatch", "Applies a unified diff (as produced by \"diff -u\" or \"git diff\") to one or more files. Either every file is patched or none is.", applyPatchSchema, s.ApplyPatch),
+		)
+	}
+
+	return tools
+}
+
+func (s *Sandbox) tool(name, description, schema string, fn interface{}) *core.Tool {
+	wrapped, err := core.WrapToolFunction(fn)
+	if err != nil {
+		panic(err)
+	}
+
+	return &core.Tool{
+		Name:        s.prefix + name,
+		Description: description,
+		WrappedToolFunction: func(ctx context.Context, args []byte) (interface{}, error) {
+			result, err := wrapped(ctx, args)
+			if err != nil {
+				// never leak host paths to the model
+				return nil, errors.New(strings.ReplaceAll(err.Error(), s.root+string(filepath.Separator), ""))
+			}
+			return result, nil
+		},
+		JSONSchema: []byte(schema),
+	}
+}
+
+const readFileSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Path of the file, relative to the workspace root"},
+    "offset": {"type": "integer", "description": "1-based line to start reading from"},
+    "limit": {"type": "integer", "description": "Maximum number of lines to read"}
+  },
+  "required": ["path"]
+}`
+
+type ReadFileArgs struct {
+	Path   string `json:"path"`
+	Offset int    `json:"offset"`
+	Limit  int    `json:"limit"`
+}
+
+// ReadFile returns the content of a file, optionally restricted to a range of
+// lines. Output is capped at the sandbox's MaxReadBytes.
+func (s *Sandbox) ReadFile(ctx context.Context, args *ReadFileArgs) (string, error) {
+	p, err := s.cleanFile(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := s.fsys.Open(p)
+	if err != nil {
+		return "", s.wrap(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", args.Path)
+	}
+
+	if args.Offset <= 0 && args.Limit <= 0 {
+		data, err := io.ReadAll(io.LimitReader(f, s.maxReadBytes+1))
+		if err != nil {
+			return "", err
+		}
+		if int64(len(data)) > s.maxReadBytes {
+			return string(data[:s.maxReadBytes]) + fmt.Sprintf("\n[truncated: file is %d bytes, use offset and limit to read the rest]", info.Size()), nil
+		}
+		return string(data), nil
+	}
+
+	offset := max(args.Offset, 1)
+	var out strings.Builder
+	reader := bufio.NewReader(f)
+
+	for n := 1; ; n++ {
+		line, err := reader.ReadString('\n')
+		if n >= offset && line != "" {
+			if args.Limit > 0 && n >= offset+args.Limit {
+				break
+			}
+			if int64(out.Len()+len(line)) > s.maxReadBytes {
+				fmt.Fprintf(&out, "\n[truncated at line %d]", n)
+				break
+			}
+			out.WriteString(line)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return out.String(), nil
+}
+
+const writeFileSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Path of the file, relative to the workspace root"},
+    "content": {"type": "string", "description": "Content to write"},
+    "append": {"type": "boolean", "description": "Append to the file instead of overwriting it"}
+  },
+  "required": ["path", "content"]
+}`
+
+type WriteFileArgs struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+	Append  bool   `json:"append"`
+}
+
+// WriteFile writes content to a file, creating parent directories as needed
+func (s *Sandbox) WriteFile(ctx context.Context, args *WriteFileArgs) (string, error) {
+	if s.readOnly {
+		return "", ErrReadOnly
+	}
+
+	p, err := s.cleanFile(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	size := int64(len(args.Content))
+	if args.Append {
+		if info, err := s.fsys.Stat(p); err == nil {
+			size += info.Size()
+		}
+	}
+	if size > s.maxWriteBytes {
+		return "", fmt.Errorf("file would be %d bytes, exceeding the %d byte limit", size, s.maxWriteBytes)
+	}
+
+	if err := s.fsys.MkdirAll(path.Dir(p), 0o755); err != nil {
+		return "", s.wrap(err)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if args.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+
+	f, err := s.fsys.OpenFile(p, flags, 0o644)
+	if err != nil {
+		return "", s.wrap(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(args.Content); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("wrote %d bytes to %s", len(args.Content), p), nil
+}
+
+const listDirSchema = `{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Directory to list, relative to the workspace root. Defaults to the root"},
+    "recursive": {"type": "boolean", "description": "Also list the content of subdirectories"}
+  }
+}`
+
+type ListDirArgs struct {
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive"`
+}
+
+// ListDir lists a directory, one entry per line
+func (s *Sandbox) ListDir(ctx context.Context, args *ListDirArgs) (string, error) {
+	dir, err := s.Clean(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	entries := []string{}
+	truncated := false
+
+	err = iofs.WalkDir(s.fsys.FS(), dir, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return s.wrap(err)
+		}
+		if p == dir {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if len(entries) >= s.maxResults {
+			truncated = true
+			return iofs.SkipAll
+		}
+
+		rel := strings.TrimPrefix(p, dir+"/")
+		if dir == "." {
+			rel = p
+		}
+		if d.IsDir() {
+			entries = append(entries, rel+"/")
+			if !args.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		entries = append(entries, rel)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if truncated {
+		entries = append(entries, fmt.Sprintf("[truncated at %d entries]", s.maxResults))
+	}
+
+	return strings.Join(entries, "\n"), nil
+}
+
+const globSchema = `{
+  "type": "object",
+  "properties": {
+    "pattern": {"type": "string", "description": "Glob pattern relative to the workspace root, i.e., \"**/*.md\""}
+  },
+  "required": ["pattern"]
+}`
+
+type GlobArgs struct {
+	Pattern string `json:"pattern"`
+}
+
+// Glob returns the sandbox relative paths of every file matching the pattern
+func (s *Sandbox) Glob(ctx context.Context, args *GlobArgs) (string, error) {
+	pattern := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+args.Pattern)), "/")
+
+	matches := []string{}
+	truncated := false
+
+	err := iofs.WalkDir(s.fsys.FS(), ".", func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			// unreadable entries are skipped rather than failing the search
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		if !matchGlob(pattern, p) {
+			return nil
+		}
+
+		if len(matches) >= s.maxResults {
+			truncated = true
+			return iofs.SkipAll
+		}
+		matches = append(matches, p)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sort.Strings(matches)
+	if truncated {
+		matches = append(matches, fmt.Sprintf("[truncated at %d matches]", s.maxResults))
+	}
+
+	return strings.Join(matches, "\n"), nil
+}
+
+const grepSchema = `{
+  "type": "object",
+  "properties": {
+    "pattern": {"type": "string", "description": "Regular expression (RE2 syntax) to search for"},
+    "path": {"type": "string", "description": "File or directory to search, relative to the workspace root. Defaults to the root"},
+    "include": {"type": "string", "description": "Only search files whose path matches this glob, i.e., \"**/*.go\""},
+    "ignoreCase": {"type": "boolean", "description": "Match case insensitively"}
+  },
+  "required": ["pattern"]
+}`
+
+type GrepArgs struct {
+	Pattern    string `json:"pattern"`
+	Path       string `json:"path"`
+	Include    string `json:"include"`
+	IgnoreCase bool   `json:"ignoreCase"`
+}
+
+// Grep searches files for lines matching a regular expression. Binary files,
+// files above MaxReadBytes and files outside the extension allowlist are skipped.
+func (s *Sandbox) Grep(ctx context.Context, args *GrepArgs) (string, error) {
+	expr := args.Pattern
+	if args.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	start, err := s.Clean(args.Path)
+	if err != nil {
+		return "", err
+	}
+
+	include := strings.TrimPrefix(filepath.ToSlash(args.Include), "/")
+	matches := []string{}
+	truncated := false
+
+	fsys := s.fsys.FS()
+	err = iofs.WalkDir(fsys, start, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if include != "" && !matchGlob(include, p) {
+			return nil
+		}
+		if s.checkExtension(p) != nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || info.Size() > s.maxReadBytes {
+			return nil
+		}
+
+		data, err := iofs.ReadFile(fsys, p)
+		if err != nil || isBinary(data) {
+			return nil
+		}
+
+		for n, line := range strings.Split(string(data), "\n") {
+			if !re.MatchString(line) {
+				continue
+			}
+
+			if len(matches) >= s.maxResults {
+				truncated = true
+				return iofs.SkipAll
+			}
+			matches = append(matches, fmt.Sprintf("%s:%d: %s", p, n+1, strings.TrimRight(line, "\r")))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(matches) == 0 {
+		return "no matches", nil
+	}
+	if truncated {
+		matches = append(matches, fmt.Sprintf("[truncated at %d matches]", s.maxResults))
+	}
+
+	return strings.Join(matches, "\n"), nil
+}
+
+// isBinary uses the same heuristic as git: a NUL byte in the first 8000 bytes
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+const applyPatchSchema = `{
+  "type": "object",
+  "properties": {
+    "patch": {"type": "string", "description": "Unified diff with ---/+++ file headers and @@ hunks. Paths are relative to the workspace root"}
+  },
+  "required": ["patch"]
+}`
+
+type ApplyPatchArgs struct {
+	Patch string `json:"patch"`
+}
+
+// ApplyPatch applies a unified diff. Every file is patched in memory first so
+// that a hunk failing to apply leaves the file system untouched. Patches to
+// a file already patched by the same diff apply to its patched content.
+func (s *Sandbox) ApplyPatch(ctx context.Context, args *ApplyPatchArgs) (string, error) {
+	if s.readOnly {
+		return "", ErrReadOnly
+	}
+
+	patches, err := parsePatch(args.Patch)
+	if err != nil {
+		return "", fmt.Errorf("invalid patch: %w", err)
+	}
+
+	// pending holds the content of a file once the diff is applied
+	type pending struct {
+		lines   []string
+		existed bool
+		exists  bool
+		changed bool
+	}
+	files := map[string]*pending{}
+	order := []string{}
+
+	load := func(name string) (*pending, error) {
+		if f, ok := files[name]; ok {
+			return f, nil
+		}
+
+		f := &pending{lines: []string{}}
+		data, err := s.fsys.ReadFile(name)
+		switch {
+		case err == nil:
+			f.lines, f.existed, f.exists = splitLines(string(data)), true, true
+		case !errors.Is(err, iofs.ErrNotExist):
+			return nil, s.wrap(err)
+		}
+
+		files[name] = f
+		order = append(order, name)
+		return f, nil
+	}
+
+	summary := []string{}
+	for _, fp := range patches {
+		var (
+			oldPath string
+			lines   = []string{}
+		)
+		if !fp.isCreate() {
+			if oldPath, err = s.cleanFile(fp.oldPath); err != nil {
+				return "", err
+			}
+
+			old, err := load(oldPath)
+			if err != nil {
+				return "", err
+			}
+			if !old.exists {
+				return "", fmt.Errorf("%s: %w", fp.oldPath, iofs.ErrNotExist)
+			}
+			lines = old.lines
+
+			if fp.isDelete() {
+				old.exists, old.changed = false, true
+				summary = append(summary, "deleted "+oldPath)
+				continue
+			}
+		}
+
+		newPath, err := s.cleanFile(fp.newPath)
+		if err != nil {
+			return "", err
+		}
+
+		patched, err := applyHunks(lines, fp.hunks)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", fp.newPath, err)
+		}
+		if size := len(joinLines(patched)); int64(size) > s.maxWriteBytes {
+			return "", fmt.Errorf("%s would be %d bytes, exceeding the %d byte limit", fp.newPath, size, s.maxWriteBytes)
+		}
+
+		target, err := load(newPath)
+		if err != nil {
+			return "", err
+		}
+		target.lines, target.exists, target.changed = patched, true, true
+
+		// renames carry the old file over to the new path
+		if oldPath != "" && oldPath != newPath {
+			old := files[oldPath]
+			old.exists, old.changed = false, true
+			summary = append(summary, fmt.Sprintf("renamed %s to %s", oldPath, newPath))
+			continue
+		}
+
+		summary = append(summary, "patched "+newPath)
+	}
+
+	for _, name := range order {
+		f := files[name]
+		switch {
+		case !f.changed:
+		case f.exists:
+			if err := s.fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+				return "", s.wrap(err)
+			}
+			if err := s.fsys.WriteFile(name, []byte(joinLines(f.lines)), 0o644); err != nil {
+				return "", s.wrap(err)
+			}
+		case f.existed:
+			if err := s.fsys.Remove(name); err != nil {
+				return "", s.wrap(err)
+			}
+		}
+	}
+
+	return strings.Join(summary, "\n"), nil
+}
+
+// joinLines joins lines into file content, terminating the last one
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// splitLines splits file content into lines without their terminators
+func splitLines(content string) []string {
+	if content == "" {
+		return []string{}
+	}
+
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
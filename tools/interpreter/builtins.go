@@ -0,0 +1,245 @@
+package interpreter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/joaopandolfi/core/tools/fs"
+)
+
+// setup installs the globals of a fresh runtime: console, the optional input,
+// the allocation guards and whatever access was granted
+func (i *Interpreter) setup(ctx context.Context, vm *goja.Runtime, out *cappedBuffer, input json.RawMessage) error {
+	if err := i.setupConsole(vm, out); err != nil {
+		return err
+	}
+
+	guard, err := vm.RunString(guardScript)
+	if err != nil {
+		return fmt.Errorf("error installing guards: %w", err)
+	}
+	install, _ := goja.AssertFunction(guard)
+	if _, err := install(goja.Undefined(), vm.ToValue(i.maxMemoryBytes)); err != nil {
+		return fmt.Errorf("error installing guards: %w", err)
+	}
+
+	if len(input) > 0 && string(input) != "null" {
+		parse, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("parse"))
+		value, err := parse(goja.Undefined(), vm.ToValue(string(input)))
+		if err != nil {
+			return fmt.Errorf("error parsing input: %w", err)
+		}
+		if err := vm.Set("input", value); err != nil {
+			return err
+		}
+	}
+
+	if i.sandbox != nil {
+		if err := vm.Set("fs", i.fsModule(ctx, vm)); err != nil {
+			return err
+		}
+	}
+
+	if len(i.allowedHosts) > 0 {
+		if err := vm.Set("http", i.httpModule(ctx, vm)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (i *Interpreter) setupConsole(vm *goja.Runtime, out *cappedBuffer) error {
+	write := func(call goja.FunctionCall) goja.Value {
+		parts := make([]string, 0, len(call.Arguments))
+		for _, arg := range call.Arguments {
+			if s, ok := arg.Export().(string); ok {
+				parts = append(parts, s)
+				continue
+			}
+			parts = append(parts, i.stringify(vm, arg))
+		}
+
+		out.WriteString(strings.Join(parts, " ") + "\n")
+		return goja.Undefined()
+	}
+
+	console := vm.NewObject()
+	for _, name := range []string{"log", "info", "debug", "warn", "error"} {
+		if err := console.Set(name, write); err != nil {
+			return err
+		}
+	}
+
+	if err := vm.Set("print", write); err != nil {
+		return err
+	}
+
+	return vm.Set("console", console)
+}
+
+// guardScript wraps the built-ins able to allocate large amounts of memory in
+// a single native call, which the heap sampling would only notice afterwards.
+// Strings are counted as two bytes per character.
+const guardScript = `(function (limit) {
+  function check(name, bytes) {
+    if (bytes > limit) {
+      throw new RangeError(name + " would exceed the memory limit");
+    }
+  }
+
+  function wrap(proto, name, size) {
+    var original = proto[name];
+    Object.defineProperty(proto, name, {
+      value: function () {
+        check(name, size.apply(this, arguments));
+        return original.apply(this, arguments);
+      },
+      writable: true,
+      configurable: true
+    });
+  }
+
+  wrap(String.prototype, "repeat", function (n) { return String(this).length * Number(n) * 2; });
+  wrap(String.prototype, "padStart", function (n) { return Number(n) * 2; });
+  wrap(String.prototype, "padEnd", function (n) { return Number(n) * 2; });
+  wrap(Array.prototype, "fill", function () { return this.length * 16; });
+  wrap(Array, "from", function (src) { return src && src.length ? src.length * 16 : 0; });
+  wrap(Array.prototype, "join", function (sep) {
+    return this.length * (sep === undefined ? 1 : String(sep).length) * 2;
+  });
+})`
+
+// fsModule exposes the granted sandbox
+func (i *Interpreter) fsModule(ctx context.Context, vm *goja.Runtime) *goja.Object {
+	sb := i.sandbox
+	module := vm.NewObject()
+
+	module.Set("readFile", func(path string) (string, error) {
+		content, err := sb.ReadFile(ctx, &fs.ReadFileArgs{Path: path})
+		return content, i.hidePaths(err)
+	})
+
+	module.Set("listDir", func(path string) ([]string, error) {
+		listing, err := sb.ListDir(ctx, &fs.ListDirArgs{Path: path})
+		if err != nil {
+			return nil, i.hidePaths(err)
+		}
+		if listing == "" {
+			return []string{}, nil
+		}
+		return strings.Split(listing, "\n"), nil
+	})
+
+	if !sb.ReadOnly() {
+		module.Set("writeFile", func(path, content string) error {
+			_, err := sb.WriteFile(ctx, &fs.WriteFileArgs{Path: path, Content: content})
+			return i.hidePaths(err)
+		})
+	}
+
+	return module
+}
+
+// hidePaths strips the host location of the sandbox from error messages
+func (i *Interpreter) hidePaths(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return errors.New(strings.ReplaceAll(err.Error(), i.sandbox.Root()+string(filepath.Separator), ""))
+}
+
+// httpModule exposes requests to the granted hosts
+func (i *Interpreter) httpModule(ctx context.Context, vm *goja.Runtime) *goja.Object {
+	module := vm.NewObject()
+
+	module.Set("request", func(method, rawURL string, opts map[string]interface{}) (map[string]interface{}, error) {
+		return i.request(ctx, method, rawURL, opts)
+	})
+
+	module.Set("get", func(rawURL string) (map[string]interface{}, error) {
+		return i.request(ctx, http.MethodGet, rawURL, nil)
+	})
+
+	return module
+}
+
+func (i *Interpreter) request(ctx context.Context, method, rawURL string, opts map[string]interface{}) (map[string]interface{}, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if !i.hostAllowed(u.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, u.Hostname())
+	}
+
+	var body io.Reader
+	if b, ok := opts["body"]; ok && b != nil {
+		s, ok := b.(string)
+		if !ok {
+			raw, err := json.Marshal(b)
+			if err != nil {
+				return nil, err
+			}
+			s = string(raw)
+		}
+		body = strings.NewReader(s)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(method), u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if headers, ok := opts["headers"].(map[string]interface{}); ok {
+		for k, v := range headers {
+			req.Header.Set(k, fmt.Sprint(v))
+		}
+	}
+
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// a response larger than the memory budget could not be used anyway
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, int64(i.maxMemoryBytes)))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]interface{}{}
+	for k := range resp.Header {
+		headers[strings.ToLower(k)] = resp.Header.Get(k)
+	}
+
+	return map[string]interface{}{
+		"status":  resp.StatusCode,
+		"headers": headers,
+		"body":    string(respBody),
+	}, nil
+}
+
+func (i *Interpreter) hostAllowed(host string) bool {
+	if slices.Contains(i.allowedHosts, "*") {
+		return true
+	}
+
+	return slices.ContainsFunc(i.allowedHosts, func(h string) bool {
+		return strings.EqualFold(h, host)
+	})
+}
@@ -0,0 +1,394 @@
+package interpreter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/tools/fs"
+)
+
+var (
+	// ErrTimeout is reported when a snippet exceeds its execution time budget
+	ErrTimeout = errors.New("execution time limit exceeded")
+
+	// ErrMemoryLimit is reported when a snippet exceeds its memory budget
+	ErrMemoryLimit = errors.New("memory limit exceeded")
+
+	// ErrStepLimit is reported when a snippet exceeds its step budget
+	ErrStepLimit = errors.New("step limit exceeded")
+
+	// ErrHostNotAllowed is returned for HTTP requests to hosts that were not granted
+	ErrHostNotAllowed = errors.New("host not allowed")
+)
+
+// Result is the structured outcome of a snippet, returned as the tool's content
+type Result struct {
+	// Output is everything written with console.log and friends
+	Output string `json:"output"`
+
+	// Value is the JSON encoding of the value of the last expression
+	Value string `json:"value,omitempty"`
+
+	// Error is the uncaught exception or limit violation that stopped the
+	// snippet, if any
+	Error string `json:"error,omitempty"`
+
+	TimedOut  bool   `json:"timedOut,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// Interpreter runs JavaScript snippets in an embedded, pure Go engine. Every
+// run gets a fresh runtime with no access to the file system or network
+// unless granted with WithFS and WithNetwork.
+type Interpreter struct {
+	timeout          time.Duration
+	maxSteps         int
+	maxMemoryBytes   uint64
+	maxOutputBytes   int
+	maxCallStackSize int
+	sandbox          *fs.Sandbox
+	allowedHosts     []string
+	client           *http.Client
+	name             string
+}
+
+// InterpreterConfig holds configuration for an Interpreter
+type InterpreterConfig struct {
+	// Timeout is the execution time budget of a single snippet
+	// default 5s
+	Timeout time.Duration
+
+	// MaxSteps is the step budget of a single snippet, where every function
+	// call and loop iteration is a step. Unlike Timeout, it does not depend
+	// on the load of the host.
+	// default 10 000 000
+	MaxSteps int
+
+	// MaxMemoryBytes caps how much the heap may grow while a snippet runs.
+	// It is a best effort, global guard rather than a meter of the snippet:
+	// the heap of the whole process is sampled, so allocations of other
+	// goroutines, including concurrent snippets, count too. Built-ins that
+	// allocate in bulk (repeat, padStart, fill, ...) are checked before they
+	// run.
+	// default 64MiB
+	MaxMemoryBytes uint64
+
+	// MaxOutputBytes caps the captured console output
+	// default 32KiB
+	MaxOutputBytes int
+
+	// MaxCallStackSize caps the depth of JavaScript calls
+	// default 1024
+	MaxCallStackSize int
+
+	// Sandbox, when set, exposes fs.readFile, fs.writeFile and fs.listDir
+	// confined to the sandbox root
+	Sandbox *fs.Sandbox
+
+	// AllowedHosts, when non empty, exposes http.get and http.request for
+	// URLs on these hosts. "*" allows any host.
+	AllowedHosts []string
+
+	// Client used for granted network access.
+	// default http.DefaultClient
+	Client *http.Client
+
+	// Name of the tool
+	// default "runJavaScript"
+	Name string
+}
+
+// InterpreterConfigFunc is a function type that modifies InterpreterConfig
+type InterpreterConfigFunc func(*InterpreterConfig)
+
+func WithTimeout(d time.Duration) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.Timeout = d
+	}
+}
+
+func WithMaxSteps(n int) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.MaxSteps = n
+	}
+}
+
+func WithMaxMemoryBytes(n uint64) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.MaxMemoryBytes = n
+	}
+}
+
+func WithMaxOutputBytes(n int) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.MaxOutputBytes = n
+	}
+}
+
+func WithMaxCallStackSize(n int) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.MaxCallStackSize = n
+	}
+}
+
+// WithFS grants snippets access to the files of a sandbox. A read-only
+// sandbox only allows reading.
+func WithFS(sandbox *fs.Sandbox) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.Sandbox = sandbox
+	}
+}
+
+// WithNetwork grants snippets HTTP access to the given hosts
+func WithNetwork(host ...string) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.AllowedHosts = append(conf.AllowedHosts, host...)
+	}
+}
+
+func WithHTTPClient(client *http.Client) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.Client = client
+	}
+}
+
+func WithName(name string) InterpreterConfigFunc {
+	return func(conf *InterpreterConfig) {
+		conf.Name = name
+	}
+}
+
+// NewInterpreter returns a new Interpreter
+func NewInterpreter(opts ...InterpreterConfigFunc) *Interpreter {
+	conf := &InterpreterConfig{
+		Timeout:          5 * time.Second,
+		MaxSteps:         10_000_000,
+		MaxMemoryBytes:   64 << 20,
+		MaxOutputBytes:   32 * 1024,
+		MaxCallStackSize: 1024,
+		Client:           http.DefaultClient,
+		Name:             "runJavaScript",
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	i := &Interpreter{
+		timeout:          conf.Timeout,
+		maxSteps:         conf.MaxSteps,
+		maxMemoryBytes:   conf.MaxMemoryBytes,
+		maxOutputBytes:   conf.MaxOutputBytes,
+		maxCallStackSize: conf.MaxCallStackSize,
+		sandbox:          conf.Sandbox,
+		allowedHosts:     conf.AllowedHosts,
+		name:             conf.Name,
+	}
+
+	if len(i.allowedHosts) > 0 {
+		// redirects must not lead outside the allowed hosts
+		client := *conf.Client
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if !i.hostAllowed(req.URL.Hostname()) {
+				return fmt.Errorf("redirect to %s: %w", req.URL.Hostname(), ErrHostNotAllowed)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		}
+		i.client = &client
+	}
+
+	return i
+}
+
+// Tool returns the interpreter as a core.Tool
+func (i *Interpreter) Tool() *core.Tool {
+	wrapped, err := core.WrapToolFunction(i.Run)
+	if err != nil {
+		panic(err)
+	}
+
+	grants := []string{}
+	if i.sandbox != nil {
+		grants = append(grants, "fs.readFile(path), fs.listDir(path)")
+		if !i.sandbox.ReadOnly() {
+			grants = append(grants, "fs.writeFile(path, content)")
+		}
+	}
+	if len(i.allowedHosts) > 0 {
+		grants = append(grants, fmt.Sprintf("http.get(url) and http.request(method, url, {headers, body}) for hosts %s", strings.Join(i.allowedHosts, ", ")))
+	}
+
+	access := "There is no file system or network access."
+	if len(grants) > 0 {
+		access = "Available APIs: " + strings.Join(grants, "; ") + "."
+	}
+
+	return &core.Tool{
+		Name: i.name,
+		Description: fmt.Sprintf("Runs a JavaScript (ES5.1 with most of ES6) snippet and returns its console output and the value of its last expression. "+
+			"Use it for arithmetic and data reshaping instead of computing by hand. The optional input is available as the global \"input\". "+
+			"%s Snippets are stopped after %s.", access, i.timeout),
+		WrappedToolFunction: wrapped,
+		JSONSchema:          []byte(runSchema),
+	}
+}
+
+const runSchema = `{
+  "type": "object",
+  "properties": {
+    "code": {"type": "string", "description": "JavaScript to run. Print with console.log; the value of the last expression is returned as JSON"},
+    "input": {"description": "Optional JSON data exposed to the snippet as the global variable \"input\""}
+  },
+  "required": ["code"]
+}`
+
+// scriptName is the file name snippets are compiled under
+const scriptName = "snippet.js"
+
+type RunArgs struct {
+	Code  string          `json:"code"`
+	Input json.RawMessage `json:"input"`
+}
+
+// Run executes a snippet in a fresh runtime. Exceptions and limit violations
+// are not errors: they are reported in the Result so the model can fix its
+// code.
+func (i *Interpreter) Run(ctx context.Context, args *RunArgs) (*Result, error) {
+	if strings.TrimSpace(args.Code) == "" {
+		return nil, errors.New("code must not be empty")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, i.timeout)
+	defer cancel()
+
+	out := newCappedBuffer(i.maxOutputBytes)
+
+	vm := goja.New()
+	vm.SetMaxCallStackSize(i.maxCallStackSize)
+
+	if err := i.setup(ctx, vm, out, args.Input); err != nil {
+		return nil, err
+	}
+
+	snippet, err := instrument(vm, args.Code, i.maxSteps)
+	if err != nil {
+		return nil, err
+	}
+
+	began := time.Now()
+	stop := i.watch(ctx, vm)
+	value, err := vm.RunScript(scriptName, snippet.code)
+	reason := stop()
+
+	result := &Result{
+		Duration: time.Since(began).Round(time.Millisecond).String(),
+	}
+
+	if err != nil {
+		var interrupted *goja.InterruptedError
+		var overflow *goja.StackOverflowError
+		var exception *goja.Exception
+		if errors.As(err, &interrupted) && reason == nil {
+			// interrupted by the step budget
+			reason, _ = interrupted.Value().(error)
+		}
+
+		switch {
+		case errors.As(err, &interrupted) && reason != nil:
+			if errors.Is(reason, context.Canceled) {
+				return nil, reason
+			}
+			result.Error = reason.Error()
+			result.TimedOut = errors.Is(reason, ErrTimeout)
+		case errors.As(err, &overflow):
+			result.Error = "RangeError: maximum call stack size exceeded"
+		case errors.As(err, &exception):
+			result.Error = snippet.describe(exception)
+		default:
+			result.Error = err.Error()
+		}
+	} else if value != nil && !goja.IsUndefined(value) {
+		result.Value = i.stringify(vm, value)
+	}
+
+	result.Output = out.String()
+	result.Truncated = out.Truncated()
+
+	return result, nil
+}
+
+// describe renders an uncaught exception with the innermost position in the
+// snippet, leaving out frames of native functions
+func (s *instrumented) describe(exception *goja.Exception) string {
+	msg := exception.Value().String()
+
+	for _, frame := range exception.Stack() {
+		if frame.SrcName() == scriptName {
+			pos := frame.Position()
+			line, column := s.position(pos.Line, pos.Column)
+			return fmt.Sprintf("%s (line %d, column %d)", msg, line, column)
+		}
+	}
+
+	return msg
+}
+
+// stringify renders a value as JSON, falling back to its string form for
+// values JSON cannot represent (i.e., functions)
+func (i *Interpreter) stringify(vm *goja.Runtime, value goja.Value) string {
+	stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+
+	encoded, err := stringify(goja.Undefined(), value)
+	if err != nil || goja.IsUndefined(encoded) {
+		return value.String()
+	}
+
+	s := encoded.String()
+	if len(s) > i.maxOutputBytes {
+		return s[:i.maxOutputBytes] + "... [truncated]"
+	}
+
+	return s
+}
+
+// cappedBuffer keeps the first limit bytes written to it
+type cappedBuffer struct {
+	limit int
+	buf   strings.Builder
+	total int
+}
+
+func newCappedBuffer(limit int) *cappedBuffer {
+	return &cappedBuffer{limit: limit}
+}
+
+func (b *cappedBuffer) WriteString(s string) {
+	b.total += len(s)
+	if room := b.limit - b.buf.Len(); room > 0 {
+		b.buf.WriteString(s[:min(room, len(s))])
+	}
+}
+
+// Truncated reports whether any output was dropped
+func (b *cappedBuffer) Truncated() bool {
+	return b.total > b.limit
+}
+
+func (b *cappedBuffer) String() string {
+	if !b.Truncated() {
+		return b.buf.String()
+	}
+
+	return fmt.Sprintf("%s\n... [%d bytes truncated]", b.buf.String(), b.total-b.buf.Len())
+}
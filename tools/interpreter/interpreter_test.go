@@ -0,0 +1,67 @@
+package interpreter
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func run(t *testing.T, i *Interpreter, code string) *Result {
+	t.Helper()
+
+	result, err := i.Run(context.Background(), &RunArgs{Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestStepLimit(t *testing.T) {
+	i := NewInterpreter(WithMaxSteps(1000))
+
+	for name, code := range map[string]string{
+		"while":     `while (true) {}`,
+		"for":       `for (;;) x = 1`,
+		"do while":  `var n = 0; do n++; while (true)`,
+		"recursion": `function f(n) { return n > 0 ? f(n - 1) + f(n - 1) : 0 } f(20)`,
+		"callbacks": `var a = []; for (var k = 0; k < 500; k++) a.push(k); a.forEach(function () {}); a.map(x => x * 2)`,
+		"caught":    `for (;;) { try { while (true) {} } catch (e) {} }`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			result := run(t, i, code)
+			if !strings.Contains(result.Error, ErrStepLimit.Error()) {
+				t.Errorf("got error %q, want a step limit error", result.Error)
+			}
+			if result.TimedOut {
+				t.Error("reported as timed out")
+			}
+		})
+	}
+}
+
+func TestStepsWithinBudget(t *testing.T) {
+	i := NewInterpreter(WithMaxSteps(1000))
+
+	result := run(t, i, "var total = 0;\nfor (var k = 0; k < 100; k++) total += k;\n[1, 2, 3].map(x => x * 2).concat([total])")
+	if result.Error != "" || result.Value != "[2,4,6,4950]" {
+		t.Errorf("got value %q, error %q", result.Value, result.Error)
+	}
+}
+
+func TestExceptionPosition(t *testing.T) {
+	i := NewInterpreter()
+
+	// the counting calls added before the error must not move its column
+	result := run(t, i, "function f() { for (;;) { throw new Error('boom') } }\nf()")
+	if result.Error != "Error: boom (line 1, column 33)" {
+		t.Errorf("got error %q", result.Error)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	result := run(t, NewInterpreter(), "for (;;) {")
+	if !strings.Contains(result.Error, "SyntaxError") {
+		t.Errorf("got error %q, want a syntax error", result.Error)
+	}
+}
@@ -0,0 +1,187 @@
+package interpreter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/ast"
+	"github.com/dop251/goja/file"
+	"github.com/dop251/goja/parser"
+)
+
+// insertion is text added to a snippet at a byte offset of the original code
+type insertion struct {
+	offset int
+	text   string
+}
+
+// instrumented is a snippet counting its steps. Every function call and loop
+// iteration calls the step function first, which interrupts the runtime once
+// the budget is spent: unlike a thrown exception, the interruption cannot be
+// caught by the snippet.
+type instrumented struct {
+	code       string
+	original   string
+	insertions []insertion
+}
+
+// instrument rewrites code so that it counts its steps against max. Code that
+// does not parse is returned as is, for the runtime to report the syntax
+// error.
+func instrument(vm *goja.Runtime, code string, max int) (*instrumented, error) {
+	program, err := parser.ParseFile(nil, scriptName, code, 0)
+	if err != nil {
+		return &instrumented{code: code, original: code}, nil
+	}
+
+	// a random name so that the snippet cannot shadow or reach the function
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	name := "__step_" + hex.EncodeToString(suffix)
+
+	steps := 0
+	step := func(goja.FunctionCall) goja.Value {
+		steps++
+		if steps > max {
+			vm.Interrupt(fmt.Errorf("%w: more than %d steps", ErrStepLimit, max))
+		}
+		return goja.Undefined()
+	}
+	if err := vm.GlobalObject().DefineDataProperty(name, vm.ToValue(step), goja.FLAG_FALSE, goja.FLAG_FALSE, goja.FLAG_FALSE); err != nil {
+		return nil, err
+	}
+
+	call := name + "();"
+	seen := map[insertion]bool{}
+	insertions := []insertion{}
+	insert := func(idx file.Idx, text string) {
+		// offsets of a single file start at 1
+		ins := insertion{offset: int(idx) - 1, text: text}
+		if !seen[ins] {
+			seen[ins] = true
+			insertions = append(insertions, ins)
+		}
+	}
+
+	countBody := func(body ast.Statement) {
+		if block, ok := body.(*ast.BlockStatement); ok {
+			insert(block.LeftBrace+1, call)
+			return
+		}
+		insert(body.Idx0(), "{"+call)
+		insert(body.Idx1(), "}")
+	}
+
+	walk(reflect.ValueOf(program), func(node ast.Node) {
+		switch n := node.(type) {
+		case *ast.FunctionLiteral:
+			if n.Body != nil {
+				insert(n.Body.LeftBrace+1, call)
+			}
+		case *ast.ArrowFunctionLiteral:
+			switch body := n.Body.(type) {
+			case *ast.BlockStatement:
+				insert(body.LeftBrace+1, call)
+			case *ast.ExpressionBody:
+				insert(body.Idx0(), "("+name+"(), ")
+				insert(body.Idx1(), ")")
+			}
+		case *ast.ForStatement:
+			countBody(n.Body)
+		case *ast.ForInStatement:
+			countBody(n.Body)
+		case *ast.ForOfStatement:
+			countBody(n.Body)
+		case *ast.WhileStatement:
+			countBody(n.Body)
+		case *ast.DoWhileStatement:
+			if block, ok := n.Body.(*ast.BlockStatement); ok {
+				insert(block.LeftBrace+1, call)
+			} else {
+				// a body wrapped in braces could no longer be followed by
+				// its semicolon, the test is counted instead
+				insert(n.Test.Idx0(), "("+name+"(), ")
+				insert(n.Test.Idx1(), ")")
+			}
+		}
+	})
+
+	sort.SliceStable(insertions, func(i, j int) bool {
+		return insertions[i].offset < insertions[j].offset
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, ins := range insertions {
+		b.WriteString(code[last:ins.offset])
+		b.WriteString(ins.text)
+		last = ins.offset
+	}
+	b.WriteString(code[last:])
+
+	if _, err := parser.ParseFile(nil, scriptName, b.String(), 0); err != nil {
+		return nil, fmt.Errorf("error counting steps of snippet: %w", err)
+	}
+
+	return &instrumented{code: b.String(), original: code, insertions: insertions}, nil
+}
+
+// walk calls fn on every node of the tree rooted at v
+func walk(v reflect.Value, fn func(ast.Node)) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if node, ok := v.Interface().(ast.Node); ok && v.Kind() == reflect.Pointer {
+			fn(node)
+		}
+		walk(v.Elem(), fn)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				walk(v.Field(i), fn)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), fn)
+		}
+	}
+}
+
+// position maps a position of the instrumented code back to the original
+// snippet. Insertions hold no new lines, so only columns move.
+func (s *instrumented) position(line, column int) (int, int) {
+	shift := 0
+	for _, ins := range s.insertions {
+		insLine, insColumn := lineColumn(s.original, ins.offset)
+		if insLine < line {
+			continue
+		}
+		if insLine > line || column < insColumn+shift {
+			break
+		}
+		if column < insColumn+shift+len(ins.text) {
+			return line, insColumn
+		}
+		shift += len(ins.text)
+	}
+
+	return line, column - shift
+}
+
+// lineColumn returns the 1-based line and column of a byte offset of code
+func lineColumn(code string, offset int) (int, int) {
+	before := code[:offset]
+	line := strings.Count(before, "\n") + 1
+
+	return line, offset - strings.LastIndex(before, "\n")
+}
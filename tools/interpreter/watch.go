@@ -0,0 +1,76 @@
+package interpreter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"time"
+
+	"github.com/dop251/goja"
+)
+
+// processHeapMetric is the number of bytes occupied by heap objects of the
+// whole process, live or not yet swept. Reading it does not stop the world.
+const processHeapMetric = "/memory/classes/heap/objects:bytes"
+
+// sampleInterval is how often the heap is sampled while a snippet runs
+const sampleInterval = 5 * time.Millisecond
+
+// watch interrupts the runtime when ctx is done or the heap grows beyond the
+// memory budget. The returned function stops watching and returns the reason
+// of the interruption, if any.
+//
+// The heap check is a best effort, global guard: Go offers no way to meter
+// the allocations of a single runtime, so growth of the process heap since
+// the snippet started is what is checked, whoever allocated it.
+func (i *Interpreter) watch(ctx context.Context, vm *goja.Runtime) func() error {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	var reason error
+
+	sample := []metrics.Sample{{Name: processHeapMetric}}
+	processHeap := func() uint64 {
+		metrics.Read(sample)
+		if sample[0].Value.Kind() != metrics.KindUint64 {
+			return 0
+		}
+		return sample[0].Value.Uint64()
+	}
+	baseline := processHeap()
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ctx.Done():
+				reason = ctx.Err()
+				if errors.Is(reason, context.DeadlineExceeded) {
+					reason = ErrTimeout
+				}
+				vm.Interrupt(reason)
+				return
+
+			case <-ticker.C:
+				if used := processHeap(); used > baseline && used-baseline > i.maxMemoryBytes {
+					reason = fmt.Errorf("%w: heap grew by %d bytes", ErrMemoryLimit, used-baseline)
+					vm.Interrupt(reason)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(done)
+		<-stopped
+		return reason
+	}
+}
@@ -0,0 +1,330 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is the subset of an OpenAPI 3.x document needed to build tools.
+// Schemas are kept as raw JSON so they can be forwarded to an LLM untouched.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []*Server            `json:"servers"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components"`
+
+	// raw is the generic decoding of the whole document, used to resolve $refs
+	raw any
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL       string                     `json:"url"`
+	Variables map[string]*ServerVariable `json:"variables"`
+}
+
+type ServerVariable struct {
+	Default string `json:"default"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Put        *Operation   `json:"put"`
+	Post       *Operation   `json:"post"`
+	Delete     *Operation   `json:"delete"`
+	Options    *Operation   `json:"options"`
+	Head       *Operation   `json:"head"`
+	Patch      *Operation   `json:"patch"`
+	Trace      *Operation   `json:"trace"`
+}
+
+// methodOperation pairs an operation with its HTTP method
+type methodOperation struct {
+	method string
+	op     *Operation
+}
+
+// operations returns the operations of the path item in a stable order
+func (p *PathItem) operations() []methodOperation {
+	ops := []methodOperation{}
+	for _, mo := range []methodOperation{
+		{"GET", p.Get},
+		{"PUT", p.Put},
+		{"POST", p.Post},
+		{"DELETE", p.Delete},
+		{"OPTIONS", p.Options},
+		{"HEAD", p.Head},
+		{"PATCH", p.Patch},
+		{"TRACE", p.Trace},
+	} {
+		if mo.op != nil {
+			ops = append(ops, mo)
+		}
+	}
+
+	return ops
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Summary     string       `json:"summary"`
+	Description string       `json:"description"`
+	Tags        []string     `json:"tags"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+	Deprecated  bool         `json:"deprecated"`
+}
+
+// Parameter is a path, query, header or cookie parameter
+type Parameter struct {
+	Ref         string          `json:"$ref"`
+	Name        string          `json:"name"`
+	In          string          `json:"in"`
+	Description string          `json:"description"`
+	Required    bool            `json:"required"`
+	Schema      json.RawMessage `json:"schema"`
+}
+
+type RequestBody struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Required    bool                  `json:"required"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema json.RawMessage `json:"schema"`
+}
+
+type Components struct {
+	Schemas       map[string]json.RawMessage `json:"schemas"`
+	Parameters    map[string]*Parameter      `json:"parameters"`
+	RequestBodies map[string]*RequestBody    `json:"requestBodies"`
+}
+
+// Load parses an OpenAPI 3.x document encoded as either JSON or YAML
+func Load(data []byte) (*Document, error) {
+	var raw any
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, fmt.Errorf("error parsing openapi json: %w", err)
+		}
+	} else {
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("error parsing openapi yaml: %w", err)
+		}
+	}
+
+	// round trip through JSON so YAML and JSON documents decode identically
+	normalized, err := json.Marshal(normalize(raw))
+	if err != nil {
+		return nil, fmt.Errorf("error normalizing openapi document: %w", err)
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(normalized, doc); err != nil {
+		return nil, fmt.Errorf("error decoding openapi document: %w", err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported openapi version %q: only 3.x is supported", doc.OpenAPI)
+	}
+
+	if err := json.Unmarshal(normalized, &doc.raw); err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// LoadFile reads and parses the OpenAPI document at path
+func LoadFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(data)
+}
+
+// normalize converts YAML decoded values into their JSON compatible equivalent
+func normalize(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			t[k] = normalize(val)
+		}
+		return t
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case []any:
+		for i, val := range t {
+			t[i] = normalize(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+// resolvePointer resolves a local JSON reference such as
+// "#/components/schemas/Pet" against the raw document
+func (d *Document) resolvePointer(ref string) (any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %q: only local references are supported", ref)
+	}
+
+	var node any = d.raw
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+
+		m, ok := node.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+		if node, ok = m[part]; !ok {
+			return nil, fmt.Errorf("unresolvable $ref %q", ref)
+		}
+	}
+
+	return node, nil
+}
+
+// resolveParameter follows a parameter $ref
+func (d *Document) resolveParameter(p *Parameter) (*Parameter, error) {
+	seen := map[string]bool{}
+	for p.Ref != "" {
+		if seen[p.Ref] {
+			return nil, fmt.Errorf("circular $ref %q", p.Ref)
+		}
+		seen[p.Ref] = true
+
+		node, err := d.resolvePointer(p.Ref)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := &Parameter{}
+		if err := remarshal(node, resolved); err != nil {
+			return nil, err
+		}
+		p = resolved
+	}
+
+	return p, nil
+}
+
+// resolveRequestBody follows a request body $ref
+func (d *Document) resolveRequestBody(b *RequestBody) (*RequestBody, error) {
+	seen := map[string]bool{}
+	for b != nil && b.Ref != "" {
+		if seen[b.Ref] {
+			return nil, fmt.Errorf("circular $ref %q", b.Ref)
+		}
+		seen[b.Ref] = true
+
+		node, err := d.resolvePointer(b.Ref)
+		if err != nil {
+			return nil, err
+		}
+
+		resolved := &RequestBody{}
+		if err := remarshal(node, resolved); err != nil {
+			return nil, err
+		}
+		b = resolved
+	}
+
+	return b, nil
+}
+
+// maxRefDepth bounds the inlining of recursive schemas
+const maxRefDepth = 2
+
+// inlineSchema returns a copy of a raw schema with every local $ref replaced
+// by its target so the result is self contained. Recursive references are cut
+// off after maxRefDepth levels.
+func (d *Document) inlineSchema(raw json.RawMessage) (any, error) {
+	if len(raw) == 0 {
+		return map[string]any{}, nil
+	}
+
+	var schema any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil, err
+	}
+
+	return d.inline(schema, map[string]int{})
+}
+
+func (d *Document) inline(node any, seen map[string]int) (any, error) {
+	switch t := node.(type) {
+	case map[string]any:
+		if ref, ok := t["$ref"].(string); ok {
+			if seen[ref] >= maxRefDepth {
+				return map[string]any{}, nil
+			}
+
+			target, err := d.resolvePointer(ref)
+			if err != nil {
+				return nil, err
+			}
+
+			seen[ref]++
+			defer func() { seen[ref]-- }()
+
+			return d.inline(target, seen)
+		}
+
+		out := make(map[string]any, len(t))
+		for k, v := range t {
+			inlined, err := d.inline(v, seen)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = inlined
+		}
+		return out, nil
+
+	case []any:
+		out := make([]any, len(t))
+		for i, v := range t {
+			inlined, err := d.inline(v, seen)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = inlined
+		}
+		return out, nil
+
+	default:
+		return node, nil
+	}
+}
+
+func remarshal(in any, out any) error {
+	raw, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,311 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Response is the value returned by generated tools
+type Response struct {
+	StatusCode int `json:"statusCode"`
+	Body       any `json:"body"`
+}
+
+// errUnsupported marks operations that cannot be turned into a tool. They are
+// skipped rather than failing the whole document.
+var errUnsupported = errors.New("unsupported operation")
+
+// param is a parameter of an operation along with the name of the tool
+// argument it is read from
+type param struct {
+	*Parameter
+	arg string
+}
+
+// operation is a single resolved API operation backing a generated tool
+type operation struct {
+	doc     *Document
+	conf    *ToolsConfig
+	baseURL string
+
+	name        string
+	description string
+	method      string
+	path        string
+
+	params []*param
+
+	body            *MediaType
+	bodyContentType string
+	bodyRequired    bool
+	bodyDescription string
+	flattenBody     bool
+}
+
+func newOperation(doc *Document, conf *ToolsConfig, baseURL, method, path string, item *PathItem, op *Operation) (*operation, error) {
+	o := &operation{
+		doc:         doc,
+		conf:        conf,
+		baseURL:     baseURL,
+		name:        toolName(conf.Prefix, method, path, op),
+		description: describe(method, path, op),
+		method:      method,
+		path:        path,
+	}
+
+	// operation level parameters override path level ones with the same name
+	// and location
+	byKey := map[string]*Parameter{}
+	order := []string{}
+	for _, p := range append(append([]*Parameter{}, item.Parameters...), op.Parameters...) {
+		resolved, err := doc.resolveParameter(p)
+		if err != nil {
+			return nil, err
+		}
+
+		// cookies are left to the http.Client's jar
+		if resolved.In == "cookie" {
+			continue
+		}
+
+		key := resolved.In + ":" + resolved.Name
+		if _, ok := byKey[key]; !ok {
+			order = append(order, key)
+		}
+		byKey[key] = resolved
+	}
+
+	// parameters sharing a name in different locations are told apart by
+	// prefixing their location, i.e., query_id and header_id
+	locations := map[string]int{}
+	for _, key := range order {
+		locations[byKey[key].Name]++
+	}
+	args := map[string]bool{}
+	for _, key := range order {
+		p := &param{Parameter: byKey[key], arg: byKey[key].Name}
+		if locations[p.Name] > 1 {
+			p.arg = p.In + "_" + p.Name
+		}
+		if args[p.arg] {
+			return nil, fmt.Errorf("%w: parameter %s is ambiguous", errUnsupported, p.arg)
+		}
+		args[p.arg] = true
+		o.params = append(o.params, p)
+	}
+
+	body, err := doc.resolveRequestBody(op.RequestBody)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		contentType, media := jsonMediaType(body)
+		if media == nil {
+			return nil, fmt.Errorf("%w: request body has no JSON media type", errUnsupported)
+		}
+
+		o.body = media
+		o.bodyContentType = contentType
+		o.bodyRequired = body.Required
+		o.bodyDescription = body.Description
+	}
+
+	return o, nil
+}
+
+func (o *operation) tool() (*core.Tool, error) {
+	schema, err := o.buildSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	return &core.Tool{
+		Name:                o.name,
+		Description:         o.description,
+		JSONSchema:          schema,
+		WrappedToolFunction: o.call,
+	}, nil
+}
+
+// call performs the HTTP request described by the LLM provided arguments
+func (o *operation) call(ctx context.Context, rawArgs []byte) (interface{}, error) {
+	args := map[string]json.RawMessage{}
+	if len(bytes.TrimSpace(rawArgs)) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, fmt.Errorf("error unmarshaling args: %w", err)
+		}
+	}
+
+	path := o.path
+	query := url.Values{}
+	header := http.Header{}
+
+	for _, p := range o.params {
+		raw, ok := args[p.arg]
+		delete(args, p.arg)
+		if !ok || string(raw) == "null" {
+			if p.Required || p.In == "path" {
+				return nil, fmt.Errorf("missing required %s parameter %s", p.In, p.Name)
+			}
+			continue
+		}
+
+		values, err := paramValues(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s parameter %s: %w", p.In, p.Name, err)
+		}
+
+		switch p.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(strings.Join(values, ",")))
+		case "query":
+			for _, v := range values {
+				query.Add(p.Name, v)
+			}
+		case "header":
+			header.Set(p.Name, strings.Join(values, ","))
+		}
+	}
+
+	var body io.Reader
+	if o.body != nil {
+		var payload []byte
+		if o.flattenBody {
+			if len(args) > 0 || o.bodyRequired {
+				var err error
+				if payload, err = json.Marshal(args); err != nil {
+					return nil, err
+				}
+			}
+		} else if raw, ok := args["body"]; ok {
+			payload = raw
+		} else if o.bodyRequired {
+			return nil, fmt.Errorf("missing required request body")
+		}
+
+		if payload != nil {
+			body = bytes.NewReader(payload)
+			header.Set("Content-Type", o.bodyContentType)
+		}
+	}
+
+	u := o.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, o.method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	for k, v := range o.conf.Header {
+		req.Header[k] = v
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json, */*;q=0.8")
+
+	if o.conf.Auth != nil {
+		if err := o.conf.Auth(req); err != nil {
+			return nil, fmt.Errorf("error authenticating request: %w", err)
+		}
+	}
+
+	resp, err := o.conf.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling %s %s: %w", o.method, o.path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, o.conf.MaxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("%s %s returned %d: %s", o.method, o.path, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	return &Response{
+		StatusCode: resp.StatusCode,
+		Body:       decodeBody(resp.Header.Get("Content-Type"), respBody),
+	}, nil
+}
+
+// paramValues converts a JSON argument to the string values of a parameter.
+// Arrays produce one value per element.
+func paramValues(raw json.RawMessage) ([]string, error) {
+	var v any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if arr, ok := v.([]any); ok {
+		values := make([]string, 0, len(arr))
+		for _, e := range arr {
+			s, err := scalarString(e)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	}
+
+	s, err := scalarString(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{s}, nil
+}
+
+func scalarString(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case json.Number:
+		return t.String(), nil
+	case bool:
+		return fmt.Sprint(t), nil
+	case nil:
+		return "", nil
+	default:
+		raw, err := json.Marshal(t)
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	}
+}
+
+// decodeBody decodes JSON responses and returns everything else as text
+func decodeBody(contentType string, body []byte) any {
+	if len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		var v any
+		if err := json.Unmarshal(body, &v); err == nil {
+			return v
+		}
+	}
+
+	return string(body)
+}
@@ -0,0 +1,389 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+// AuthFunc decorates an outgoing request with credentials
+type AuthFunc func(req *http.Request) error
+
+// BearerToken returns an AuthFunc setting a bearer authorization header
+func BearerToken(token string) AuthFunc {
+	return func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+}
+
+// APIKeyHeader returns an AuthFunc setting an API key header
+func APIKeyHeader(name, value string) AuthFunc {
+	return func(req *http.Request) error {
+		req.Header.Set(name, value)
+		return nil
+	}
+}
+
+// BasicAuth returns an AuthFunc setting HTTP basic authentication
+func BasicAuth(username, password string) AuthFunc {
+	return func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	}
+}
+
+// ToolsConfig holds configuration for generating tools from a Document
+type ToolsConfig struct {
+	// BaseURL overrides the first server declared in the document. It is
+	// required when the document declares no server or a relative one.
+	BaseURL string
+
+	// The http.Client used to perform calls. Defaults to http.DefaultClient
+	Client *http.Client
+
+	// Auth is called on every outgoing request
+	Auth AuthFunc
+
+	// Extra headers sent on every request
+	Header http.Header
+
+	// Filter, when set, selects which operations become tools
+	Filter func(method, path string, op *Operation) bool
+
+	// Prefix is prepended to every tool name
+	Prefix string
+
+	// IncludeDeprecated also generates tools for deprecated operations
+	IncludeDeprecated bool
+
+	// MaxResponseBytes caps how much of a response body is read.
+	// default 1MiB
+	MaxResponseBytes int64
+
+	// The provided logr.Logger, told about skipped operations
+	// default discard
+	Logger *logr.Logger
+}
+
+// ToolsConfigFunc is a function type that modifies ToolsConfig
+type ToolsConfigFunc func(*ToolsConfig)
+
+func WithBaseURL(url string) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.BaseURL = url
+	}
+}
+
+func WithHTTPClient(c *http.Client) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.Client = c
+	}
+}
+
+func WithAuth(auth AuthFunc) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.Auth = auth
+	}
+}
+
+func WithHeader(key, value string) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.Header.Add(key, value)
+	}
+}
+
+func WithFilter(filter func(method, path string, op *Operation) bool) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.Filter = filter
+	}
+}
+
+func WithPrefix(prefix string) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.Prefix = prefix
+	}
+}
+
+func WithDeprecated() ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.IncludeDeprecated = true
+	}
+}
+
+func WithMaxResponseBytes(n int64) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.MaxResponseBytes = n
+	}
+}
+
+func WithLogger(l *logr.Logger) ToolsConfigFunc {
+	return func(conf *ToolsConfig) {
+		conf.Logger = l
+	}
+}
+
+// Tools generates one core.Tool per operation of the document. Tools are
+// returned sorted by name. Operations that cannot be described to an LLM,
+// such as those taking a non JSON request body, are skipped and logged.
+//
+// Tool arguments are named after the parameters of the operation. Parameters
+// sharing a name in different locations are prefixed with their location,
+// i.e., query_id and header_id.
+func Tools(doc *Document, opts ...ToolsConfigFunc) ([]*core.Tool, error) {
+	discard := logr.Discard()
+	conf := &ToolsConfig{
+		Client:           http.DefaultClient,
+		Header:           http.Header{},
+		MaxResponseBytes: 1 << 20,
+		Logger:           &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	baseURL, err := resolveBaseURL(doc, conf.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := []*core.Tool{}
+	seen := map[string]bool{}
+
+	for path, item := range doc.Paths {
+		if item == nil {
+			continue
+		}
+
+		for _, mo := range item.operations() {
+			if mo.op.Deprecated && !conf.IncludeDeprecated {
+				continue
+			}
+			if conf.Filter != nil && !conf.Filter(mo.method, path, mo.op) {
+				continue
+			}
+
+			tool, err := buildTool(doc, conf, baseURL, mo.method, path, item, mo.op)
+			if errors.Is(err, errUnsupported) {
+				conf.Logger.Info("skipping operation", "method", mo.method, "path", path, "reason", err.Error())
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("error building tool for %s %s: %w", mo.method, path, err)
+			}
+
+			if seen[tool.Name] {
+				return nil, fmt.Errorf("duplicate tool name %s for %s %s", tool.Name, mo.method, path)
+			}
+			seen[tool.Name] = true
+			tools = append(tools, tool)
+		}
+	}
+
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
+
+	return tools, nil
+}
+
+func buildTool(doc *Document, conf *ToolsConfig, baseURL, method, path string, item *PathItem, op *Operation) (*core.Tool, error) {
+	o, err := newOperation(doc, conf, baseURL, method, path, item, op)
+	if err != nil {
+		return nil, err
+	}
+
+	return o.tool()
+}
+
+func resolveBaseURL(doc *Document, override string) (string, error) {
+	if override != "" {
+		if len(doc.Servers) > 0 && strings.HasPrefix(doc.Servers[0].URL, "/") {
+			return strings.TrimSuffix(override, "/") + strings.TrimSuffix(doc.Servers[0].URL, "/"), nil
+		}
+		return strings.TrimSuffix(override, "/"), nil
+	}
+
+	if len(doc.Servers) == 0 {
+		return "", fmt.Errorf("openapi document declares no servers: a base URL is required")
+	}
+
+	server := doc.Servers[0]
+	url := server.URL
+	for name, v := range server.Variables {
+		url = strings.ReplaceAll(url, "{"+name+"}", v.Default)
+	}
+
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return "", fmt.Errorf("openapi server URL %q is not absolute: a base URL is required", url)
+	}
+
+	return strings.TrimSuffix(url, "/"), nil
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// toolName derives a provider safe tool name from the operation ID, falling
+// back to the method and path
+func toolName(prefix, method, path string, op *Operation) string {
+	name := op.OperationID
+	if name == "" {
+		name = strings.ToLower(method) + "_" + path
+	}
+
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "_"), "_")
+	name = prefix + name
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// describe builds the tool description from the operation summary and description
+func describe(method, path string, op *Operation) string {
+	parts := []string{}
+	if op.Summary != "" {
+		parts = append(parts, op.Summary)
+	}
+	if op.Description != "" && op.Description != op.Summary {
+		parts = append(parts, op.Description)
+	}
+	if len(parts) == 0 {
+		parts = append(parts, method+" "+path)
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// jsonMediaType picks the JSON media type of a request body, if any
+func jsonMediaType(body *RequestBody) (string, *MediaType) {
+	keys := make([]string, 0, len(body.Content))
+	for k := range body.Content {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if k == "application/json" {
+			return k, body.Content[k]
+		}
+	}
+	for _, k := range keys {
+		if strings.HasSuffix(k, "+json") || strings.HasSuffix(k, "/json") {
+			return k, body.Content[k]
+		}
+	}
+
+	return "", nil
+}
+
+// buildSchema merges the operation's parameters and request body into a
+// single object schema. A JSON object body is flattened into the top level
+// properties unless one of its properties clashes with a parameter, in which
+// case it is nested under "body".
+func (o *operation) buildSchema() ([]byte, error) {
+	properties := map[string]any{}
+	required := []string{}
+
+	for _, p := range o.params {
+		prop, err := o.doc.inlineSchema(p.Schema)
+		if err != nil {
+			return nil, err
+		}
+
+		if m, ok := prop.(map[string]any); ok && p.Description != "" {
+			m["description"] = p.Description
+		}
+
+		properties[p.arg] = prop
+		if p.Required || p.In == "path" {
+			required = append(required, p.arg)
+		}
+	}
+
+	if o.body != nil {
+		bodySchema, err := o.doc.inlineSchema(o.body.Schema)
+		if err != nil {
+			return nil, err
+		}
+
+		bodyProps, bodyRequired, isObject := objectProperties(bodySchema)
+		if isObject && !clashes(properties, bodyProps) {
+			o.flattenBody = true
+			for k, v := range bodyProps {
+				properties[k] = v
+			}
+			if o.bodyRequired {
+				required = append(required, bodyRequired...)
+			}
+		} else {
+			if _, ok := properties["body"]; ok {
+				return nil, fmt.Errorf("%w: parameter body clashes with the request body", errUnsupported)
+			}
+			if m, ok := bodySchema.(map[string]any); ok && o.bodyDescription != "" {
+				m["description"] = o.bodyDescription
+			}
+			properties["body"] = bodySchema
+			if o.bodyRequired {
+				required = append(required, "body")
+			}
+		}
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+
+	return json.Marshal(schema)
+}
+
+func objectProperties(schema any) (map[string]any, []string, bool) {
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return nil, nil, false
+	}
+
+	props, ok := m["properties"].(map[string]any)
+	if !ok {
+		return nil, nil, false
+	}
+	if t, ok := m["type"]; ok && t != "object" {
+		return nil, nil, false
+	}
+
+	required := []string{}
+	if r, ok := m["required"].([]any); ok {
+		for _, name := range r {
+			if s, ok := name.(string); ok {
+				required = append(required, s)
+			}
+		}
+	}
+
+	return props, required, true
+}
+
+func clashes(a, b map[string]any) bool {
+	for k := range b {
+		if _, ok := a[k]; ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package openapi
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+const petstore = `
+openapi: 3.0.3
+info:
+  title: Pets
+  version: "1"
+servers:
+  - url: /v1
+paths:
+  /pets/{id}:
+    parameters:
+      - $ref: "#/components/parameters/id"
+    get:
+      operationId: getPet
+      parameters:
+        - name: id
+          in: header
+          schema: {type: string}
+        - name: fields
+          in: query
+          schema: {type: array, items: {type: string}}
+    put:
+      operationId: updatePet
+      requestBody:
+        $ref: "#/components/requestBodies/pet"
+  /pets/{id}/photo:
+    put:
+      operationId: uploadPhoto
+      parameters:
+        - $ref: "#/components/parameters/id"
+      requestBody:
+        content:
+          image/png:
+            schema: {type: string, format: binary}
+components:
+  parameters:
+    id:
+      name: id
+      in: path
+      required: true
+      schema: {type: string}
+    loop:
+      $ref: "#/components/parameters/loop"
+  requestBodies:
+    pet:
+      required: true
+      content:
+        application/json:
+          schema:
+            type: object
+            required: [name]
+            properties:
+              name: {type: string}
+`
+
+type request struct {
+	method, path, query, header, body string
+}
+
+func newAPI(t *testing.T) (*httptest.Server, *[]request) {
+	t.Helper()
+
+	requests := &[]request{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*requests = append(*requests, request{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("id"), string(body)})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, requests
+}
+
+func loadTools(t *testing.T, baseURL string) map[string]*core.Tool {
+	t.Helper()
+
+	doc, err := Load([]byte(petstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tools, err := Tools(doc, WithBaseURL(baseURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byName := map[string]*core.Tool{}
+	for _, tool := range tools {
+		byName[tool.Name] = tool
+	}
+
+	return byName
+}
+
+func TestToolsSkipsUnsupportedOperations(t *testing.T) {
+	tools := loadTools(t, "http://example.com")
+
+	if len(tools) != 2 || tools["getPet"] == nil || tools["updatePet"] == nil {
+		names := []string{}
+		for name := range tools {
+			names = append(names, name)
+		}
+		t.Errorf("got tools %v, want getPet and updatePet", names)
+	}
+}
+
+func TestResolveParameterCycle(t *testing.T) {
+	doc, err := Load([]byte(petstore))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = doc.resolveParameter(&Parameter{Ref: "#/components/parameters/loop"})
+	if err == nil || !strings.Contains(err.Error(), "circular $ref") {
+		t.Errorf("got %v, want a circular $ref error", err)
+	}
+}
+
+func TestToolParameterLocations(t *testing.T) {
+	srv, requests := newAPI(t)
+	tool := loadTools(t, srv.URL)["getPet"]
+
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+		Required   []string       `json:"required"`
+	}
+	if err := json.Unmarshal(tool.JSONSchema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"path_id", "header_id", "fields"} {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("schema has no property %s: %s", name, tool.JSONSchema)
+		}
+	}
+	if len(schema.Required) != 1 || schema.Required[0] != "path_id" {
+		t.Errorf("required %v", schema.Required)
+	}
+
+	result, err := tool.WrappedToolFunction(context.Background(), []byte(`{"path_id":"a b","header_id":"h","fields":["name","age"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := result.(*Response); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d", resp.StatusCode)
+	}
+
+	want := request{method: "GET", path: "/v1/pets/a b", query: "fields=name&fields=age", header: "h"}
+	if len(*requests) != 1 || (*requests)[0] != want {
+		t.Errorf("got requests %+v, want %+v", *requests, want)
+	}
+}
+
+func TestToolRequestBody(t *testing.T) {
+	srv, requests := newAPI(t)
+	tool := loadTools(t, srv.URL)["updatePet"]
+
+	result, err := tool.WrappedToolFunction(context.Background(), []byte(`{"id":"1","name":"rex"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, ok := result.(*Response).Body.(map[string]any)
+	if !ok || body["ok"] != true {
+		t.Errorf("got body %v", result.(*Response).Body)
+	}
+
+	want := request{method: "PUT", path: "/v1/pets/1", body: `{"name":"rex"}`}
+	if len(*requests) != 1 || (*requests)[0] != want {
+		t.Errorf("got requests %+v, want %+v", *requests, want)
+	}
+}
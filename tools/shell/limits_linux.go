@@ -0,0 +1,99 @@
+//go:build linux
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// rlimitNproc is RLIMIT_NPROC, which the syscall package does not export
+const rlimitNproc = 6
+
+// start starts the command with its resource limits in place before it runs a
+// single instruction of the target program. The child is started under
+// ptrace so it stops right after execve, the limits are applied with
+// prlimit(2) and the child is released. Where ptrace is unavailable (i.e., a
+// restrictive seccomp profile) limits are applied right after the start
+// instead, leaving a short window in which the process runs unrestricted.
+func start(cmd *exec.Cmd, l *Limits) error {
+	if l == nil || *l == (Limits{}) {
+		return cmd.Start()
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	// ptrace requests must come from the thread that started the tracee
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	err := cmd.Start()
+	if errors.Is(err, syscall.EPERM) {
+		cmd.SysProcAttr.Ptrace = false
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		return killOnError(cmd, setLimits(cmd.Process.Pid, l))
+	}
+	if err != nil {
+		return err
+	}
+
+	pid := cmd.Process.Pid
+
+	var status syscall.WaitStatus
+	if _, err := syscall.Wait4(pid, &status, 0, nil); err != nil {
+		return killOnError(cmd, fmt.Errorf("error waiting for process to stop: %w", err))
+	}
+	if !status.Stopped() {
+		return killOnError(cmd, fmt.Errorf("process did not stop after exec"))
+	}
+
+	if err := setLimits(pid, l); err != nil {
+		return killOnError(cmd, err)
+	}
+
+	return killOnError(cmd, syscall.PtraceDetach(pid))
+}
+
+func killOnError(cmd *exec.Cmd, err error) error {
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	return err
+}
+
+func setLimits(pid int, l *Limits) error {
+	for _, limit := range []struct {
+		resource int
+		value    uint64
+	}{
+		{syscall.RLIMIT_CPU, l.CPUSeconds},
+		{syscall.RLIMIT_AS, l.MemoryBytes},
+		{syscall.RLIMIT_FSIZE, l.FileSizeBytes},
+		{syscall.RLIMIT_NOFILE, l.OpenFiles},
+		{rlimitNproc, l.Processes},
+	} {
+		if limit.value == 0 {
+			continue
+		}
+
+		rlim := syscall.Rlimit{Cur: limit.value, Max: limit.value}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64,
+			uintptr(pid), uintptr(limit.resource), uintptr(unsafe.Pointer(&rlim)), 0, 0, 0)
+		if errno != 0 {
+			return fmt.Errorf("error applying resource limits: %w", errno)
+		}
+	}
+
+	return nil
+}
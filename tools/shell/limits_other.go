@@ -0,0 +1,10 @@
+//go:build !linux
+
+package shell
+
+import "os/exec"
+
+// start starts the command. Resource limits are only enforced on Linux.
+func start(cmd *exec.Cmd, l *Limits) error {
+	return cmd.Start()
+}
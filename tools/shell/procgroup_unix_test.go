@@ -0,0 +1,64 @@
+//go:build unix
+
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunTimeoutKillsProcessGroup(t *testing.T) {
+	e := newExecutor(t, WithAllow("sh"), WithTimeout(200*time.Millisecond))
+	pidFile := filepath.Join(e.workDir, "child.pid")
+
+	began := time.Now()
+	result, err := e.Run(context.Background(), &RunArgs{
+		Command: "sh",
+		Args:    []string{"-c", "sleep 30 & echo $! > child.pid; wait"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TimedOut {
+		t.Errorf("got %+v, want a timeout", result)
+	}
+	if elapsed := time.Since(began); elapsed > 5*time.Second {
+		t.Errorf("took %s", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for alive(pid) {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("child %d outlived the timeout", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// alive reports whether the process runs. Killed processes are zombies until
+// their new parent reaps them, which /proc tells apart where it exists.
+func alive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	return err != nil || !strings.Contains(string(stat), ") Z ")
+}
@@ -0,0 +1,437 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joaopandolfi/core"
+)
+
+// ErrCommandNotAllowed is returned for commands rejected by the Policy
+var ErrCommandNotAllowed = errors.New("command not allowed")
+
+// Policy decides which programs may be executed. Bare program names are
+// looked up in PATH; programs given as a path (i.e., "./build.sh") must be
+// listed verbatim so that a model cannot shadow an allowed name with a file of
+// its own. Deny always wins over Allow and also matches base names. An empty
+// Allow list rejects everything, "*" allows any program that is not denied.
+type Policy struct {
+	Allow []string
+	Deny  []string
+}
+
+// Permits reports whether the policy allows running the named program
+func (p *Policy) Permits(program string) bool {
+	if slices.Contains(p.Deny, program) || slices.Contains(p.Deny, filepath.Base(program)) {
+		return false
+	}
+
+	if slices.Contains(p.Allow, program) {
+		return true
+	}
+
+	return !strings.Contains(program, "/") && slices.Contains(p.Allow, "*")
+}
+
+// Limits are resource limits applied to every executed process. Zero values
+// leave the corresponding limit unset. They are only enforced on Linux.
+type Limits struct {
+	// CPUSeconds caps the CPU time of the process (RLIMIT_CPU)
+	CPUSeconds uint64
+
+	// MemoryBytes caps the virtual address space of the process (RLIMIT_AS)
+	MemoryBytes uint64
+
+	// FileSizeBytes caps the size of any file the process writes (RLIMIT_FSIZE)
+	FileSizeBytes uint64
+
+	// OpenFiles caps the number of open file descriptors (RLIMIT_NOFILE)
+	OpenFiles uint64
+
+	// Processes caps the number of processes of the executing user (RLIMIT_NPROC)
+	Processes uint64
+}
+
+// Result is the structured outcome of a command, returned as the tool's content
+type Result struct {
+	ExitCode  int    `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	TimedOut  bool   `json:"timedOut,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	Duration  string `json:"duration"`
+}
+
+// Executor runs commands in a fixed working directory under a Policy
+type Executor struct {
+	workDir          string
+	policy           *Policy
+	env              []string
+	timeout          time.Duration
+	maxOutputBytes   int
+	limits           *Limits
+	killProcessGroup bool
+	name             string
+}
+
+// ExecutorConfig holds configuration for an Executor
+type ExecutorConfig struct {
+	// Policy deciding which programs may run. Defaults to rejecting everything
+	Policy *Policy
+
+	// Allow and Deny extend the Policy without modifying it
+	Allow []string
+	Deny  []string
+
+	// Env is the complete environment of executed commands, as KEY=VALUE
+	// pairs. The parent environment is never inherited; by default only PATH
+	// is set, and HOME points to the working directory.
+	Env []string
+
+	// Timeout is the wall clock limit of a single command.
+	// default 30s
+	Timeout time.Duration
+
+	// MaxOutputBytes caps each of stdout and stderr. Longer output keeps its
+	// head and tail and drops the middle.
+	// default 32KiB
+	MaxOutputBytes int
+
+	// Limits are the resource limits applied to executed processes
+	Limits *Limits
+
+	// KillProcessGroup runs each command in its own process group and kills the
+	// whole group on timeout, so that children cannot outlive it.
+	// default true
+	KillProcessGroup bool
+
+	// Name of the tool
+	// default "runCommand"
+	Name string
+}
+
+// ExecutorConfigFunc is a function type that modifies ExecutorConfig
+type ExecutorConfigFunc func(*ExecutorConfig)
+
+func WithPolicy(p *Policy) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Policy = p
+	}
+}
+
+func WithAllow(program ...string) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Allow = append(conf.Allow, program...)
+	}
+}
+
+func WithDeny(program ...string) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Deny = append(conf.Deny, program...)
+	}
+}
+
+// WithEnv adds KEY=VALUE pairs to the environment of executed commands
+func WithEnv(kv ...string) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Env = append(conf.Env, kv...)
+	}
+}
+
+// WithPassEnv passes the named variables through from the current process
+func WithPassEnv(name ...string) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		for _, n := range name {
+			if v, ok := os.LookupEnv(n); ok {
+				conf.Env = append(conf.Env, n+"="+v)
+			}
+		}
+	}
+}
+
+func WithTimeout(d time.Duration) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Timeout = d
+	}
+}
+
+func WithMaxOutputBytes(n int) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.MaxOutputBytes = n
+	}
+}
+
+func WithLimits(l *Limits) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Limits = l
+	}
+}
+
+func WithKillProcessGroup(kill bool) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.KillProcessGroup = kill
+	}
+}
+
+func WithName(name string) ExecutorConfigFunc {
+	return func(conf *ExecutorConfig) {
+		conf.Name = name
+	}
+}
+
+// NewExecutor returns a new Executor running commands in workDir
+func NewExecutor(workDir string, opts ...ExecutorConfigFunc) (*Executor, error) {
+	abs, err := filepath.Abs(workDir)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("working directory %s is not a directory", workDir)
+	}
+
+	conf := &ExecutorConfig{
+		Policy: &Policy{},
+		Env: []string{
+			"PATH=/usr/local/bin:/usr/bin:/bin",
+			"HOME=" + abs,
+			"LANG=C.UTF-8",
+		},
+		Timeout:        30 * time.Second,
+		MaxOutputBytes: 32 * 1024,
+		Limits: &Limits{
+			CPUSeconds:    30,
+			FileSizeBytes: 64 << 20,
+			OpenFiles:     256,
+		},
+		KillProcessGroup: true,
+		Name:             "runCommand",
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	policy := &Policy{Allow: conf.Allow, Deny: conf.Deny}
+	if conf.Policy != nil {
+		policy.Allow = slices.Concat(conf.Policy.Allow, conf.Allow)
+		policy.Deny = slices.Concat(conf.Policy.Deny, conf.Deny)
+	}
+
+	return &Executor{
+		workDir:          abs,
+		policy:           policy,
+		env:              dedupeEnv(conf.Env),
+		timeout:          conf.Timeout,
+		maxOutputBytes:   conf.MaxOutputBytes,
+		limits:           conf.Limits,
+		killProcessGroup: conf.KillProcessGroup,
+		name:             conf.Name,
+	}, nil
+}
+
+// dedupeEnv keeps the last value of every variable
+func dedupeEnv(env []string) []string {
+	index := map[string]int{}
+	out := []string{}
+
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[k]; ok {
+			out[i] = kv
+			continue
+		}
+		index[k] = len(out)
+		out = append(out, kv)
+	}
+
+	return out
+}
+
+// Tool returns the executor as a core.Tool
+func (e *Executor) Tool() *core.Tool {
+	wrapped, err := core.WrapToolFunction(e.Run)
+	if err != nil {
+		panic(err)
+	}
+
+	allowed := "no programs"
+	if slices.Contains(e.policy.Allow, "*") {
+		allowed = "any program"
+	} else if len(e.policy.Allow) > 0 {
+		allowed = strings.Join(e.policy.Allow, ", ")
+	}
+
+	return &core.Tool{
+		Name: e.name,
+		Description: fmt.Sprintf("Runs a program (without a shell) in the workspace and returns its exit code, stdout and stderr. "+
+			"Allowed programs: %s. Commands time out after %s.", allowed, e.timeout),
+		WrappedToolFunction: wrapped,
+		JSONSchema:          []byte(runSchema),
+	}
+}
+
+const runSchema = `{
+  "type": "object",
+  "properties": {
+    "command": {"type": "string", "description": "Program to run, i.e., \"ls\""},
+    "args": {"type": "array", "items": {"type": "string"}, "description": "Arguments passed to the program. No shell expansion is performed"},
+    "stdin": {"type": "string", "description": "Optional data written to the program's standard input"}
+  },
+  "required": ["command"]
+}`
+
+type RunArgs struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	Stdin   string   `json:"stdin"`
+}
+
+// Run executes a single command. A non-zero exit code is not an error: it is
+// reported in the Result so the model can react to it.
+func (e *Executor) Run(ctx context.Context, args *RunArgs) (*Result, error) {
+	if args.Command == "" {
+		return nil, errors.New("command must not be empty")
+	}
+
+	if !e.policy.Permits(args.Command) {
+		return nil, fmt.Errorf("%w: %s", ErrCommandNotAllowed, args.Command)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	path, err := e.lookPath(args.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, path, args.Args...)
+	cmd.Dir = e.workDir
+	cmd.Env = e.env
+	cmd.Stdin = strings.NewReader(args.Stdin)
+
+	stdout := newHeadTailBuffer(e.maxOutputBytes)
+	stderr := newHeadTailBuffer(e.maxOutputBytes)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// don't wait forever on pipes inherited by orphaned grandchildren
+	cmd.WaitDelay = time.Second
+
+	if e.killProcessGroup {
+		setProcessGroup(cmd)
+	}
+
+	began := time.Now()
+	if err := start(cmd, e.limits); err != nil {
+		return nil, fmt.Errorf("error starting %s: %w", args.Command, err)
+	}
+
+	waitErr := cmd.Wait()
+
+	result := &Result{
+		ExitCode:  cmd.ProcessState.ExitCode(),
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		TimedOut:  errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Truncated: stdout.Truncated() || stderr.Truncated(),
+		Duration:  time.Since(began).Round(time.Millisecond).String(),
+	}
+
+	var exitErr *exec.ExitError
+	if waitErr != nil && !errors.As(waitErr, &exitErr) && !errors.Is(waitErr, exec.ErrWaitDelay) {
+		return nil, fmt.Errorf("error running %s: %w", args.Command, waitErr)
+	}
+
+	return result, nil
+}
+
+// lookPath finds the program using the scrubbed PATH rather than the PATH of
+// the current process
+func (e *Executor) lookPath(program string) (string, error) {
+	if strings.Contains(program, "/") {
+		if filepath.IsAbs(program) {
+			return program, nil
+		}
+		return filepath.Join(e.workDir, program), nil
+	}
+
+	pathEnv := ""
+	for _, kv := range e.env {
+		if v, ok := strings.CutPrefix(kv, "PATH="); ok {
+			pathEnv = v
+		}
+	}
+
+	for _, dir := range filepath.SplitList(pathEnv) {
+		candidate := filepath.Join(dir, program)
+		info, err := os.Stat(candidate)
+		if err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return candidate, nil
+		}
+	}
+
+	return "", fmt.Errorf("%s: %w", program, exec.ErrNotFound)
+}
+
+// headTailBuffer is an io.Writer keeping only the first and last bytes written
+// to it once its capacity is exceeded
+type headTailBuffer struct {
+	limit int
+	head  bytes.Buffer
+	tail  []byte
+	total int
+}
+
+func newHeadTailBuffer(limit int) *headTailBuffer {
+	return &headTailBuffer{limit: limit}
+}
+
+func (b *headTailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	b.total += n
+
+	headLimit := b.limit / 2
+	if room := headLimit - b.head.Len(); room > 0 {
+		if room > len(p) {
+			room = len(p)
+		}
+		b.head.Write(p[:room])
+		p = p[room:]
+	}
+
+	tailLimit := b.limit - headLimit
+	b.tail = append(b.tail, p...)
+	if len(b.tail) > tailLimit {
+		b.tail = append(b.tail[:0], b.tail[len(b.tail)-tailLimit:]...)
+	}
+
+	return n, nil
+}
+
+// Truncated reports whether any output was dropped
+func (b *headTailBuffer) Truncated() bool {
+	return b.total > b.limit
+}
+
+func (b *headTailBuffer) String() string {
+	if !b.Truncated() {
+		return b.head.String() + string(b.tail)
+	}
+
+	dropped := b.total - b.head.Len() - len(b.tail)
+	return fmt.Sprintf("%s\n... [%d bytes truncated] ...\n%s", b.head.String(), dropped, b.tail)
+}
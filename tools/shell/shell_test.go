@@ -0,0 +1,148 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newExecutor(t *testing.T, opts ...ExecutorConfigFunc) *Executor {
+	t.Helper()
+
+	e, err := NewExecutor(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return e
+}
+
+func TestPolicyPermits(t *testing.T) {
+	tests := map[string]struct {
+		policy  Policy
+		program string
+		want    bool
+	}{
+		"empty allow list":        {Policy{}, "ls", false},
+		"allowed name":            {Policy{Allow: []string{"ls"}}, "ls", true},
+		"other name":              {Policy{Allow: []string{"ls"}}, "cat", false},
+		"wildcard":                {Policy{Allow: []string{"*"}}, "cat", true},
+		"wildcard rejects paths":  {Policy{Allow: []string{"*"}}, "./cat", false},
+		"wildcard rejects abs":    {Policy{Allow: []string{"*"}}, "/bin/cat", false},
+		"allowed path":            {Policy{Allow: []string{"./build.sh"}}, "./build.sh", true},
+		"path of an allowed name": {Policy{Allow: []string{"ls"}}, "./ls", false},
+		"deny wins":               {Policy{Allow: []string{"rm"}, Deny: []string{"rm"}}, "rm", false},
+		"deny over wildcard":      {Policy{Allow: []string{"*"}, Deny: []string{"rm"}}, "rm", false},
+		"deny by base name":       {Policy{Allow: []string{"/bin/rm"}, Deny: []string{"rm"}}, "/bin/rm", false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.policy.Permits(tt.program); got != tt.want {
+				t.Errorf("Permits(%q) = %v, want %v", tt.program, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowDenyCopyPolicy(t *testing.T) {
+	p := &Policy{Allow: []string{"ls"}}
+	e := newExecutor(t, WithPolicy(p), WithAllow("cat"), WithDeny("rm"))
+
+	if len(p.Allow) != 1 || len(p.Deny) != 0 {
+		t.Errorf("caller's policy changed to %+v", p)
+	}
+	if !e.policy.Permits("ls") || !e.policy.Permits("cat") || e.policy.Permits("rm") {
+		t.Errorf("got policy %+v", e.policy)
+	}
+
+	e = newExecutor(t, WithPolicy(nil), WithAllow("cat"))
+	if !e.policy.Permits("cat") || e.policy.Permits("ls") {
+		t.Errorf("got policy %+v", e.policy)
+	}
+}
+
+func TestHeadTailBuffer(t *testing.T) {
+	tests := map[string]struct {
+		limit  int
+		writes []string
+		want   string
+	}{
+		"fits":        {10, []string{"hello"}, "hello"},
+		"exact":       {4, []string{"ab", "cd"}, "abcd"},
+		"truncated":   {4, []string{"abcdefgh"}, "ab\n... [4 bytes truncated] ...\ngh"},
+		"many writes": {4, []string{"a", "b", "c", "d", "e", "f"}, "ab\n... [2 bytes truncated] ...\nef"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := newHeadTailBuffer(tt.limit)
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write returned %d, %v", n, err)
+				}
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if b.Truncated() != (tt.want != strings.Join(tt.writes, "")) {
+				t.Errorf("Truncated() = %v", b.Truncated())
+			}
+		})
+	}
+}
+
+func TestRunNotAllowed(t *testing.T) {
+	e := newExecutor(t, WithAllow("echo"))
+
+	if _, err := e.Run(context.Background(), &RunArgs{Command: "cat"}); !errors.Is(err, ErrCommandNotAllowed) {
+		t.Errorf("got %v, want ErrCommandNotAllowed", err)
+	}
+}
+
+func TestRunEnv(t *testing.T) {
+	t.Setenv("SHELL_TEST_SECRET", "secret")
+	t.Setenv("SHELL_TEST_PASSED", "passed")
+	e := newExecutor(t, WithAllow("env"), WithEnv("EXTRA=1", "LANG=C"), WithPassEnv("SHELL_TEST_PASSED"))
+
+	result, err := e.Run(context.Background(), &RunArgs{Command: "env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := strings.Split(strings.TrimSpace(result.Stdout), "\n")
+	for _, kv := range []string{"EXTRA=1", "LANG=C", "SHELL_TEST_PASSED=passed", "HOME=" + e.workDir} {
+		if !slices.Contains(env, kv) {
+			t.Errorf("%s missing from %v", kv, env)
+		}
+	}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "SHELL_TEST_SECRET=") || kv == "LANG=C.UTF-8" {
+			t.Errorf("unexpected %s in %v", kv, env)
+		}
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	e := newExecutor(t, WithAllow("sh"), WithLimits(&Limits{OpenFiles: 64, FileSizeBytes: 1 << 20}))
+
+	result, err := e.Run(context.Background(), &RunArgs{Command: "sh", Args: []string{"-c", "ulimit -n"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := strings.TrimSpace(result.Stdout)
+	if runtime.GOOS != "linux" {
+		// limits are skipped, the command still runs
+		if result.ExitCode != 0 {
+			t.Errorf("got %+v", result)
+		}
+		return
+	}
+	if got != "64" {
+		t.Errorf("open files limit %q, want 64", got)
+	}
+}
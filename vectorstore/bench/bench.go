@@ -0,0 +1,163 @@
+// Package bench measures the recall and latency of an approximate
+// core.VectorStorer against an exact reference, usually the brute force
+// memory store:
+//
+//	data := bench.RandomVectors(100_000, 384, 1)
+//	queries := bench.RandomVectors(200, 384, 2)
+//
+//	exact := memory.NewMemoryVectorStore(nil)
+//	exact.AddEmbeddings(data...)
+//	index := hnsw.NewHNSWVectorStore(nil)
+//	index.AddEmbeddings(ctx, data...)
+//
+//	report, err := bench.Compare(ctx, exact, index, queries, 10)
+//	fmt.Println(report)
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Latency summarizes the duration of a set of searches
+type Latency struct {
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P95  time.Duration `json:"p95_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	QPS  float64       `json:"qps"`
+}
+
+func (l Latency) String() string {
+	return fmt.Sprintf("mean %s, p50 %s, p95 %s, p99 %s, %.0f qps", l.Mean, l.P50, l.P95, l.P99, l.QPS)
+}
+
+// Report is the outcome of Compare
+type Report struct {
+	// K is the number of results requested per query
+	K int
+
+	// Recall is the mean fraction of the reference top-k found by the
+	// candidate store
+	Recall float64
+
+	Reference Latency
+	Candidate Latency
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("recall@%d %.4f\nreference: %s\ncandidate: %s", r.K, r.Recall, r.Reference, r.Candidate)
+}
+
+// Compare runs every query against both stores, which must hold the same
+// embeddings, and reports the recall@k of candidate along with the latency
+// of both
+func Compare(ctx context.Context, reference, candidate core.VectorStorer, queries []*core.Embedding, k int) (*Report, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no queries")
+	}
+
+	refLatencies := make([]time.Duration, 0, len(queries))
+	candLatencies := make([]time.Duration, 0, len(queries))
+	recall := 0.0
+
+	for _, q := range queries {
+		params := &core.SearchParams{QueryVec: q.Vector, Limit: k}
+
+		began := time.Now()
+		want, err := reference.Search(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("error searching reference store: %w", err)
+		}
+		refLatencies = append(refLatencies, time.Since(began))
+
+		began = time.Now()
+		got, err := candidate.Search(ctx, params)
+		if err != nil {
+			return nil, fmt.Errorf("error searching candidate store: %w", err)
+		}
+		candLatencies = append(candLatencies, time.Since(began))
+
+		recall += Recall(want, got)
+	}
+
+	return &Report{
+		K:         k,
+		Recall:    recall / float64(len(queries)),
+		Reference: Summarize(refLatencies),
+		Candidate: Summarize(candLatencies),
+	}, nil
+}
+
+// Recall returns the fraction of want found in got, matched by embedding ID
+func Recall(want, got []*core.SearchResult) float64 {
+	if len(want) == 0 {
+		return 1
+	}
+
+	ids := make(map[string]bool, len(got))
+	for _, r := range got {
+		ids[r.Embedding.ID] = true
+	}
+
+	found := 0
+	for _, r := range want {
+		if ids[r.Embedding.ID] {
+			found++
+		}
+	}
+
+	return float64(found) / float64(len(want))
+}
+
+// Summarize returns the mean and percentiles of latencies, which must not be
+// empty, and the throughput of running them one after the other
+func Summarize(latencies []time.Duration) Latency {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+
+	percentile := func(p float64) time.Duration {
+		return sorted[min(int(p*float64(len(sorted))), len(sorted)-1)]
+	}
+
+	l := Latency{
+		Mean: total / time.Duration(len(sorted)),
+		P50:  percentile(0.50),
+		P95:  percentile(0.95),
+		P99:  percentile(0.99),
+	}
+	if total > 0 {
+		l.QPS = float64(len(sorted)) / total.Seconds()
+	}
+
+	return l
+}
+
+// RandomVectors returns n embeddings of uniformly distributed vectors with
+// IDs "0" to "n-1"
+func RandomVectors(n, dim int, seed int64) []*core.Embedding {
+	r := rand.New(rand.NewSource(seed))
+
+	out := make([]*core.Embedding, n)
+	for i := range out {
+		v := make(core.Vec32, dim)
+		for j := range v {
+			v[j] = r.Float32()*2 - 1
+		}
+		out[i] = &core.Embedding{ID: fmt.Sprint(i), Vector: v}
+	}
+
+	return out
+}
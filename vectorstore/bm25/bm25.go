@@ -0,0 +1,371 @@
+// Package bm25 provides a lexical index ranking embeddings by the Okapi BM25
+// score of their content against a text query. It catches what vector search
+// tends to miss, such as exact identifiers, and is usually combined with a
+// vector store through the hybrid package.
+package bm25
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// ErrNoQuery is returned for searches without a text query
+var ErrNoQuery = errors.New("lexical search needs a text query")
+
+// Index implements core.MutableVectorStorer with an in-memory inverted index
+// over Embedding.Content. Vectors are ignored: Search matches
+// SearchParams.Query and scores are BM25 scores, which are not bounded.
+type Index struct {
+	tokenizer Tokenizer
+	k1        float64
+	b         float64
+
+	mu       sync.RWMutex
+	docs     []*doc
+	ids      map[string]int
+	postings map[string][]posting
+	// df counts the live documents holding each term
+	df       map[string]int
+	totalLen int
+	live     int
+}
+
+type doc struct {
+	emb     *core.Embedding
+	length  int
+	terms   map[string]int
+	deleted bool
+}
+
+type posting struct {
+	doc int
+	tf  int
+}
+
+// IndexConfig holds configuration for an Index
+type IndexConfig struct {
+	// Tokenizer splitting contents and queries into terms
+	// default NewTextTokenizer()
+	Tokenizer Tokenizer
+
+	// K1 controls how quickly repeated terms stop adding to the score
+	// default 1.2
+	K1 float64
+
+	// B controls how much long documents are penalized, from 0 to 1
+	// default 0.75
+	B float64
+}
+
+// IndexConfigFunc is a function type that modifies IndexConfig
+type IndexConfigFunc func(*IndexConfig)
+
+func WithTokenizer(t Tokenizer) IndexConfigFunc {
+	return func(conf *IndexConfig) {
+		conf.Tokenizer = t
+	}
+}
+
+func WithK1(k1 float64) IndexConfigFunc {
+	return func(conf *IndexConfig) {
+		conf.K1 = k1
+	}
+}
+
+func WithB(b float64) IndexConfigFunc {
+	return func(conf *IndexConfig) {
+		conf.B = b
+	}
+}
+
+// NewIndex returns a new, empty Index
+func NewIndex(opts ...IndexConfigFunc) *Index {
+	conf := &IndexConfig{
+		Tokenizer: NewTextTokenizer(),
+		K1:        1.2,
+		B:         0.75,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Index{
+		tokenizer: conf.Tokenizer,
+		k1:        conf.K1,
+		b:         conf.B,
+		ids:       map[string]int{},
+		postings:  map[string][]posting{},
+		df:        map[string]int{},
+	}
+}
+
+// Add indexes contents under random IDs
+func (x *Index) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings := make([]*core.Embedding, len(contents))
+	for i, content := range contents {
+		embeddings[i] = &core.Embedding{ID: vectorstore.NewID(), Content: content}
+	}
+
+	if err := x.Upsert(ctx, embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// Upsert indexes the content of embeddings, replacing any indexed embedding
+// with the same ID. Embeddings without an ID get a random one.
+func (x *Index) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	// tokenizing is the expensive part and needs no lock
+	docs := make([]*doc, len(embeddings))
+	for i, e := range embeddings {
+		if e.ID == "" {
+			e.ID = vectorstore.NewID()
+		}
+
+		terms := x.tokenizer.Tokenize(e.Content)
+		d := &doc{emb: e, length: len(terms), terms: make(map[string]int, len(terms))}
+		for _, t := range terms {
+			d.terms[t]++
+		}
+		docs[i] = d
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, d := range docs {
+		if i, ok := x.ids[d.emb.ID]; ok {
+			x.remove(i)
+		}
+
+		index := len(x.docs)
+		x.docs = append(x.docs, d)
+		x.ids[d.emb.ID] = index
+		x.totalLen += d.length
+		x.live++
+
+		for t, tf := range d.terms {
+			x.postings[t] = append(x.postings[t], posting{doc: index, tf: tf})
+			x.df[t]++
+		}
+	}
+
+	return nil
+}
+
+// remove tombstones document i. Postings are cleaned up once tombstones make
+// up half of the index. It must be called with mu held.
+func (x *Index) remove(i int) {
+	d := x.docs[i]
+	if d.deleted {
+		return
+	}
+
+	d.deleted = true
+	delete(x.ids, d.emb.ID)
+	x.totalLen -= d.length
+	x.live--
+
+	for t := range d.terms {
+		if x.df[t]--; x.df[t] == 0 {
+			delete(x.df, t)
+		}
+	}
+
+	if len(x.docs) >= 64 && x.live < len(x.docs)/2 {
+		x.compact()
+	}
+}
+
+// compact drops tombstoned documents and renumbers the others
+func (x *Index) compact() {
+	docs := make([]*doc, 0, x.live)
+	for _, d := range x.docs {
+		if !d.deleted {
+			docs = append(docs, d)
+		}
+	}
+
+	x.docs = docs
+	x.ids = make(map[string]int, len(docs))
+	x.postings = map[string][]posting{}
+	for i, d := range docs {
+		x.ids[d.emb.ID] = i
+		for t, tf := range d.terms {
+			x.postings[t] = append(x.postings[t], posting{doc: i, tf: tf})
+		}
+	}
+}
+
+// Search returns the Limit embeddings whose content scores highest against
+// params.Query, best first, leaving out those scoring below Threshold and
+// those not matching Filter
+func (x *Index) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if params.Query == "" {
+		return nil, ErrNoQuery
+	}
+	if err := vectorstore.ValidateFilter(params); err != nil {
+		return nil, err
+	}
+
+	terms := x.tokenizer.Tokenize(params.Query)
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if x.live == 0 {
+		return []*core.SearchResult{}, nil
+	}
+
+	n := float64(x.live)
+	avgLen := float64(x.totalLen) / n
+
+	scores := map[int]float64{}
+	seen := map[string]bool{}
+	for _, t := range terms {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+
+		df := float64(x.df[t])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for _, p := range x.postings[t] {
+			d := x.docs[p.doc]
+			if d.deleted {
+				continue
+			}
+
+			tf := float64(p.tf)
+			norm := x.k1 * (1 - x.b + x.b*float64(d.length)/avgLen)
+			scores[p.doc] += idf * tf * (x.k1 + 1) / (tf + norm)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	top := vectorstore.NewTopK(vectorstore.Limit(params))
+	for i, score := range scores {
+		d := x.docs[i]
+		if !vectorstore.Passes(params, float32(score)) || !params.Filter.Match(d.emb.Metadata) {
+			continue
+		}
+		top.Push(float32(score), d.emb)
+	}
+
+	return top.Results(params), nil
+}
+
+// Delete removes the embeddings with the given IDs. Unknown IDs are ignored.
+func (x *Index) Delete(ctx context.Context, ids ...string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, id := range ids {
+		if i, ok := x.ids[id]; ok {
+			x.remove(i)
+		}
+	}
+
+	return nil
+}
+
+// DeleteWhere removes the embeddings matching filter
+func (x *Index) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	var matched []string
+	for _, d := range x.docs {
+		if !d.deleted && filter.Match(d.emb.Metadata) {
+			matched = append(matched, d.emb.ID)
+		}
+	}
+
+	// removing may compact, so documents are looked up by ID
+	for _, id := range matched {
+		x.remove(x.ids[id])
+	}
+
+	return len(matched), nil
+}
+
+// Get returns the indexed embeddings with the given IDs
+func (x *Index) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	out := make([]*core.Embedding, 0, len(ids))
+	for _, id := range ids {
+		if i, ok := x.ids[id]; ok {
+			out = append(out, x.docs[i].emb)
+		}
+	}
+
+	return out, nil
+}
+
+// Count returns the number of indexed embeddings matching filter
+func (x *Index) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	if filter != nil {
+		if err := filter.Validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if filter == nil {
+		return x.live, nil
+	}
+
+	n := 0
+	for _, d := range x.docs {
+		if !d.deleted && filter.Match(d.emb.Metadata) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Len returns the number of indexed embeddings
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	return x.live
+}
+
+// Close drops the whole index
+func (x *Index) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.docs = nil
+	x.ids = map[string]int{}
+	x.postings = map[string][]posting{}
+	x.df = map[string]int{}
+	x.totalLen = 0
+	x.live = 0
+
+	return nil
+}
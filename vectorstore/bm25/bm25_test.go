@@ -0,0 +1,147 @@
+package bm25
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+func search(t *testing.T, x *Index, params *core.SearchParams) []string {
+	t.Helper()
+
+	results, err := x.Search(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]string, len(results))
+	for i, r := range results {
+		ids[i] = r.Embedding.ID
+	}
+
+	return ids
+}
+
+func TestIndexRanking(t *testing.T) {
+	ctx := context.Background()
+	x := NewIndex()
+	err := x.Upsert(ctx,
+		&core.Embedding{ID: "incident", Content: "Payment service failed with error E-1042 after the deploy", Metadata: map[string]interface{}{"team": "payments"}},
+		&core.Embedding{ID: "codes", Content: "List of error codes: E-1041, E-1043 and E-2000"},
+		&core.Embedding{ID: "short", Content: "Payment service"},
+		&core.Embedding{ID: "long", Content: "The payment service handles cards, transfers, refunds, disputes, invoices, receipts and much more besides"},
+		&core.Embedding{ID: "other", Content: "Onboarding checklist for new employees"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		params *core.SearchParams
+		want   string
+	}{
+		"exact identifier":  {&core.SearchParams{Query: "E-1042"}, "[incident codes]"},
+		"identifier parts":  {&core.SearchParams{Query: "error 1043"}, "[codes incident]"},
+		"shorter first":     {&core.SearchParams{Query: "payment service"}, "[short incident long]"},
+		"stemmed":           {&core.SearchParams{Query: "failing payments"}, "[incident short long]"},
+		"limit":             {&core.SearchParams{Query: "payment service", Limit: 1}, "[short]"},
+		"filter":            {&core.SearchParams{Query: "payment service", Filter: core.Eq("team", "payments")}, "[incident]"},
+		"no matching terms": {&core.SearchParams{Query: "kubernetes"}, "[]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fmt.Sprint(search(t, x, tt.params)); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := x.Search(ctx, &core.SearchParams{}); !errors.Is(err, ErrNoQuery) {
+		t.Errorf("got %v, want ErrNoQuery", err)
+	}
+}
+
+func TestIndexUpsertReplaces(t *testing.T) {
+	ctx := context.Background()
+	x := NewIndex()
+
+	if err := x.Upsert(ctx, &core.Embedding{ID: "a", Content: "old words"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Upsert(ctx, &core.Embedding{ID: "a", Content: "new words"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := search(t, x, &core.SearchParams{Query: "old"}); len(got) != 0 {
+		t.Errorf("replaced content still matches: %v", got)
+	}
+	if got := search(t, x, &core.SearchParams{Query: "new"}); fmt.Sprint(got) != "[a]" {
+		t.Errorf("got %v", got)
+	}
+	if x.Len() != 1 || x.df["word"] != 1 {
+		t.Errorf("%d documents, df %d", x.Len(), x.df["word"])
+	}
+}
+
+func TestIndexCompaction(t *testing.T) {
+	ctx := context.Background()
+	x := NewIndex()
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("doc-%03d", i)
+		ids = append(ids, id)
+		content := fmt.Sprintf("common item-%d", i)
+		if i%2 == 0 {
+			content += " even"
+		}
+		if err := x.Upsert(ctx, &core.Embedding{ID: id, Content: content, Metadata: map[string]interface{}{"n": i}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := x.Delete(ctx, ids[:40]...); err != nil {
+		t.Fatal(err)
+	}
+	n, err := x.DeleteWhere(ctx, core.Range("n", 40, 59))
+	if err != nil || n != 20 {
+		t.Fatalf("deleted %d, %v", n, err)
+	}
+
+	// the index was compacted at the 51st deletion, leaving 49 documents
+	// of which 9 were deleted since
+	if len(x.docs) != 49 || x.Len() != 40 {
+		t.Fatalf("%d documents held, %d live, want 49 and 40", len(x.docs), x.Len())
+	}
+	for term, postings := range x.postings {
+		for _, p := range postings {
+			if p.doc >= len(x.docs) {
+				t.Errorf("posting of %q points past the documents", term)
+			}
+		}
+	}
+
+	if got := search(t, x, &core.SearchParams{Query: "item-70"}); len(got) == 0 || got[0] != "doc-070" {
+		t.Errorf("got %v, want doc-070 first", got)
+	}
+	for _, id := range search(t, x, &core.SearchParams{Query: "item-10 item-55", Limit: 100}) {
+		if id == "doc-010" || id == "doc-055" {
+			t.Errorf("deleted document %s found", id)
+		}
+	}
+	if got := search(t, x, &core.SearchParams{Query: "even", Limit: 100}); len(got) != 20 {
+		t.Errorf("got %d even documents, want 20", len(got))
+	}
+
+	got, err := x.Get(ctx, "doc-000", "doc-099", "doc-060")
+	if err != nil || len(got) != 2 || got[0].ID != "doc-099" || got[1].ID != "doc-060" {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if count, err := x.Count(ctx, core.Range("n", 90, nil)); err != nil || count != 10 {
+		t.Errorf("counted %d, %v", count, err)
+	}
+}
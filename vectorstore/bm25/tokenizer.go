@@ -0,0 +1,249 @@
+package bm25
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Tokenizer splits text into the terms an Index matches on. Queries and
+// documents go through the same tokenizer.
+type Tokenizer interface {
+	Tokenize(text string) []string
+}
+
+// TokenizerFunc adapts a function to the Tokenizer interface
+type TokenizerFunc func(text string) []string
+
+func (f TokenizerFunc) Tokenize(text string) []string {
+	return f(text)
+}
+
+// Stemmer reduces a word to its stem, so that inflected forms match
+type Stemmer interface {
+	Stem(word string) string
+}
+
+// StemmerFunc adapts a function to the Stemmer interface
+type StemmerFunc func(word string) string
+
+func (f StemmerFunc) Stem(word string) string {
+	return f(word)
+}
+
+// EnglishStopWords is a short list of English words carrying no meaning for
+// retrieval, for use with WithStopWords
+var EnglishStopWords = []string{
+	"a", "an", "and", "are", "as", "at", "be", "by", "for", "from", "has",
+	"in", "is", "it", "its", "of", "on", "or", "that", "the", "to", "was",
+	"were", "will", "with",
+}
+
+// TextTokenizer is the default Tokenizer. It lower cases text and splits it
+// into runs of letters and digits. Runs joined by one of - _ . / : # form a
+// compound, such as an error code, a SKU or a version, which is emitted
+// whole besides its parts so that exact identifiers score highest. Words
+// holding digits are neither stemmed nor dropped as stop words.
+type TextTokenizer struct {
+	stemmer   Stemmer
+	stopWords map[string]bool
+	minLength int
+}
+
+// TextTokenizerConfig holds configuration for a TextTokenizer
+type TextTokenizerConfig struct {
+	// Stemmer applied to words, nil disables stemming
+	// default EnglishStemmer
+	Stemmer Stemmer
+
+	// StopWords are dropped
+	// default none
+	StopWords []string
+
+	// MinLength is the length in runes under which words are dropped
+	// default 1
+	MinLength int
+}
+
+// TextTokenizerConfigFunc is a function type that modifies TextTokenizerConfig
+type TextTokenizerConfigFunc func(*TextTokenizerConfig)
+
+func WithStemmer(s Stemmer) TextTokenizerConfigFunc {
+	return func(conf *TextTokenizerConfig) {
+		conf.Stemmer = s
+	}
+}
+
+func WithStopWords(words ...string) TextTokenizerConfigFunc {
+	return func(conf *TextTokenizerConfig) {
+		conf.StopWords = words
+	}
+}
+
+func WithMinLength(n int) TextTokenizerConfigFunc {
+	return func(conf *TextTokenizerConfig) {
+		conf.MinLength = n
+	}
+}
+
+// NewTextTokenizer returns a new TextTokenizer
+func NewTextTokenizer(opts ...TextTokenizerConfigFunc) *TextTokenizer {
+	conf := &TextTokenizerConfig{
+		Stemmer:   StemmerFunc(EnglishStemmer),
+		MinLength: 1,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	stopWords := make(map[string]bool, len(conf.StopWords))
+	for _, w := range conf.StopWords {
+		stopWords[strings.ToLower(w)] = true
+	}
+
+	return &TextTokenizer{
+		stemmer:   conf.Stemmer,
+		stopWords: stopWords,
+		minLength: conf.MinLength,
+	}
+}
+
+// Tokenize returns the terms of text, in order
+func (t *TextTokenizer) Tokenize(text string) []string {
+	var (
+		terms []string
+		parts []string
+		word  strings.Builder
+		start = -1
+		end   = -1
+	)
+
+	lower := strings.ToLower(text)
+
+	flushWord := func() {
+		if word.Len() > 0 {
+			parts = append(parts, word.String())
+			word.Reset()
+		}
+	}
+
+	flushCompound := func() {
+		flushWord()
+		for _, p := range parts {
+			if term, ok := t.term(p); ok {
+				terms = append(terms, term)
+			}
+		}
+		if len(parts) > 1 {
+			terms = append(terms, lower[start:end])
+		}
+		parts = parts[:0]
+		start = -1
+	}
+
+	runes := []rune(lower)
+	offset := 0
+	for i, r := range runes {
+		size := len(string(r))
+
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if start < 0 {
+				start = offset
+			}
+			word.WriteRune(r)
+			end = offset + size
+		case isConnector(r) && word.Len() > 0 && i+1 < len(runes) && (unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])):
+			flushWord()
+		default:
+			if start >= 0 {
+				flushCompound()
+			}
+		}
+
+		offset += size
+	}
+	if start >= 0 {
+		flushCompound()
+	}
+
+	return terms
+}
+
+// term turns a word into a term, reporting false for dropped words
+func (t *TextTokenizer) term(word string) (string, bool) {
+	if hasDigit(word) {
+		return word, true
+	}
+
+	if len([]rune(word)) < t.minLength || t.stopWords[word] {
+		return "", false
+	}
+
+	if t.stemmer != nil {
+		word = t.stemmer.Stem(word)
+	}
+
+	return word, true
+}
+
+func isConnector(r rune) bool {
+	return strings.ContainsRune("-_./:#", r)
+}
+
+func hasDigit(s string) bool {
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnglishStemmer is a light English stemmer stripping common inflections:
+// plurals, -ing, -ed and -ly. It is deliberately conservative, trading some
+// recall for never conflating unrelated words the way aggressive stemmers
+// occasionally do.
+func EnglishStemmer(word string) string {
+	n := len(word)
+	switch {
+	case n > 4 && strings.HasSuffix(word, "ies"):
+		return word[:n-3] + "y"
+	case n > 4 && strings.HasSuffix(word, "sses"):
+		return word[:n-2]
+	case n > 3 && strings.HasSuffix(word, "s") &&
+		!strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:n-1]
+	case n > 5 && strings.HasSuffix(word, "ing") && hasVowel(word[:n-3]):
+		return undouble(word[:n-3])
+	case n > 4 && strings.HasSuffix(word, "ed") && hasVowel(word[:n-2]):
+		return undouble(word[:n-2])
+	case n > 5 && strings.HasSuffix(word, "ly"):
+		return word[:n-2]
+	}
+
+	return word
+}
+
+// hasVowel reports whether a stem left by a stripped suffix holds a vowel,
+// which tells "string" and "shred" apart from "singing" and "opened"
+func hasVowel(stem string) bool {
+	return strings.ContainsAny(stem, "aeiouy")
+}
+
+// undouble drops the doubled final consonant left by a stripped suffix, as
+// in "running" or "stopped"
+func undouble(stem string) string {
+	n := len(stem)
+	if n < 3 || stem[n-1] != stem[n-2] {
+		return stem
+	}
+
+	switch stem[n-1] {
+	case 'l', 's', 'z', 'a', 'e', 'i', 'o', 'u':
+		return stem
+	}
+
+	return stem[:n-1]
+}
@@ -0,0 +1,66 @@
+package bm25
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTextTokenizer(t *testing.T) {
+	tests := map[string]struct {
+		opts []TextTokenizerConfigFunc
+		text string
+		want string
+	}{
+		"error code":       {nil, "Error E-1042 occurred", "error e 1042 e-1042 occur"},
+		"sku":              {nil, "SKU_123 in stock", "sku 123 sku_123 in stock"},
+		"version":          {nil, "v1.2.3 notes.", "v1 2 3 v1.2.3 note"},
+		"path":             {nil, "path/to/file.go: line 12", "path to file go path/to/file.go line 12"},
+		"hash":             {nil, "user#42 #tag", "user 42 user#42 tag"},
+		"hyphenated word":  {nil, "re-run it - now", "re run re-run it now"},
+		"unicode":          {nil, "Ação rápida", "ação rápida"},
+		"empty":            {nil, " -- ", ""},
+		"stop words":       {[]TextTokenizerConfigFunc{WithStopWords(EnglishStopWords...)}, "The cause of the E-1 error", "cause e 1 e-1 error"},
+		"min length":       {[]TextTokenizerConfigFunc{WithMinLength(3)}, "go to a v2 db-7", "v2 7 db-7"},
+		"no stemming":      {[]TextTokenizerConfigFunc{WithStemmer(nil)}, "running tests", "running tests"},
+		"digits unstemmed": {nil, "2000s files", "2000s file"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := strings.Join(NewTextTokenizer(tt.opts...).Tokenize(tt.text), " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnglishStemmer(t *testing.T) {
+	for word, want := range map[string]string{
+		"studies":  "study",
+		"classes":  "class",
+		"files":    "file",
+		"bus":      "bus",
+		"status":   "status",
+		"analysis": "analysis",
+		"glass":    "glass",
+		"cats":     "cat",
+		"its":      "its",
+		"running":  "run",
+		"falling":  "fall",
+		"buzzing":  "buzz",
+		"sing":     "sing",
+		"string":   "string",
+		"spring":   "spring",
+		"shred":    "shred",
+		"opened":   "open",
+		"stopped":  "stop",
+		"called":   "call",
+		"red":      "red",
+		"quickly":  "quick",
+		"fly":      "fly",
+	} {
+		if got := EnglishStemmer(word); got != want {
+			t.Errorf("EnglishStemmer(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,545 @@
+// Package chroma implements core.VectorStorer over a collection of a Chroma
+// server, through its v2 HTTP API:
+//
+//	store := chroma.NewChromaVectorStore("http://localhost:8000", "handbook", embedder,
+//		chroma.WithTenant("acme", "production"),
+//	)
+//
+// Embeddings map one to one to Chroma records: their ID, vector, content as
+// the document and metadata. Chroma only stores strings, numbers and
+// booleans as metadata, and its filters are narrower than core filters:
+// ranges only bound numbers, Exists is not supported, and negations never
+// match records lacking the field. Filters Chroma cannot express fail with
+// vectorstore.ErrUnsupportedFilter.
+//
+// The chromatest package serves a stand-in of the API for tests.
+package chroma
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// ChromaVectorStore implements core.MutableVectorStorer over a Chroma
+// collection, created when first used if missing
+type ChromaVectorStore struct {
+	baseURL    string
+	collection string
+	embedder   core.Embedder
+	metric     vectorstore.Metric
+	tenant     string
+	database   string
+	token      string
+	client     *http.Client
+
+	mu sync.Mutex
+	// id is the ID of the collection, once resolved
+	id string
+}
+
+// ChromaVectorStoreConfig holds configuration for a ChromaVectorStore
+type ChromaVectorStoreConfig struct {
+	// Metric of a collection created by the store, its "hnsw:space".
+	// Existing collections keep their own, which must match for scores to
+	// make sense.
+	// default vectorstore.Cosine
+	Metric vectorstore.Metric
+
+	// Tenant and Database hold the collection
+	// default "default_tenant" and "default_database"
+	Tenant   string
+	Database string
+
+	// Token is sent in the x-chroma-token header
+	// default none
+	Token string
+
+	// HTTPClient sends the requests
+	// default a client with a 30 seconds timeout
+	HTTPClient *http.Client
+}
+
+// ChromaVectorStoreConfigFunc is a function type that modifies ChromaVectorStoreConfig
+type ChromaVectorStoreConfigFunc func(*ChromaVectorStoreConfig)
+
+func WithMetric(m vectorstore.Metric) ChromaVectorStoreConfigFunc {
+	return func(conf *ChromaVectorStoreConfig) {
+		conf.Metric = m
+	}
+}
+
+func WithTenant(tenant, database string) ChromaVectorStoreConfigFunc {
+	return func(conf *ChromaVectorStoreConfig) {
+		conf.Tenant = tenant
+		conf.Database = database
+	}
+}
+
+func WithToken(token string) ChromaVectorStoreConfigFunc {
+	return func(conf *ChromaVectorStoreConfig) {
+		conf.Token = token
+	}
+}
+
+func WithHTTPClient(c *http.Client) ChromaVectorStoreConfigFunc {
+	return func(conf *ChromaVectorStoreConfig) {
+		conf.HTTPClient = c
+	}
+}
+
+// NewChromaVectorStore returns a new ChromaVectorStore over the named
+// collection of the server at baseURL, embedding contents with the given
+// embedder. No request is sent until the store is used.
+func NewChromaVectorStore(baseURL, collection string, embedder core.Embedder, opts ...ChromaVectorStoreConfigFunc) *ChromaVectorStore {
+	conf := &ChromaVectorStoreConfig{
+		Metric:     vectorstore.Cosine,
+		Tenant:     "default_tenant",
+		Database:   "default_database",
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &ChromaVectorStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		collection: collection,
+		embedder:   embedder,
+		metric:     conf.Metric,
+		tenant:     conf.Tenant,
+		database:   conf.Database,
+		token:      conf.Token,
+		client:     conf.HTTPClient,
+	}
+}
+
+// errNotFound is returned by do for 404 responses
+var errNotFound = errors.New("not found")
+
+// do sends a request and decodes the response into out, if not nil
+func (s *ChromaVectorStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding chroma request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("x-chroma-token", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling chroma: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading chroma response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("chroma %s %s: %w", method, path, errNotFound)
+	}
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &failure) == nil && (failure.Error != "" || failure.Message != "") {
+			msg = strings.Trim(failure.Error+": "+failure.Message, ": ")
+		}
+		return fmt.Errorf("chroma %s %s: %s: %s", method, path, resp.Status, msg)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error decoding chroma response: %w", err)
+	}
+
+	return nil
+}
+
+// collectionsPath is the path of the collections of the tenant and database
+func (s *ChromaVectorStore) collectionsPath() string {
+	return "/api/v2/tenants/" + url.PathEscape(s.tenant) + "/databases/" + url.PathEscape(s.database) + "/collections"
+}
+
+// path returns the path of an endpoint of the collection, resolving its ID
+// and creating it on first use
+func (s *ChromaVectorStore) path(ctx context.Context, suffix string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.id == "" {
+		var created struct {
+			ID string `json:"id"`
+		}
+		err := s.do(ctx, http.MethodPost, s.collectionsPath(), map[string]interface{}{
+			"name":          s.collection,
+			"metadata":      map[string]interface{}{"hnsw:space": space(s.metric)},
+			"get_or_create": true,
+		}, &created)
+		if err != nil {
+			return "", fmt.Errorf("error preparing collection %s: %w", s.collection, err)
+		}
+		s.id = created.ID
+	}
+
+	return s.collectionsPath() + "/" + url.PathEscape(s.id) + suffix, nil
+}
+
+func space(m vectorstore.Metric) string {
+	switch m {
+	case vectorstore.DotProduct:
+		return "ip"
+	case vectorstore.L2:
+		return "l2"
+	default:
+		return "cosine"
+	}
+}
+
+// score turns a Chroma distance into the score of the metric
+func (s *ChromaVectorStore) score(distance float32) float32 {
+	switch s.metric {
+	case vectorstore.L2:
+		// Chroma returns squared distances
+		return 1 / (1 + float32(math.Sqrt(float64(max(distance, 0)))))
+	default:
+		// 1 - cosine similarity or 1 - inner product
+		return 1 - distance
+	}
+}
+
+// Add embeds and stores contents
+func (s *ChromaVectorStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := vectorstore.Embed(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Upsert(ctx, embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// Upsert stores embeddings, embedding the content of those without a vector
+func (s *ChromaVectorStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	if err := vectorstore.EmbedMissing(ctx, s.embedder, embeddings); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(embeddings))
+	vectors := make([]core.Vec32, len(embeddings))
+	documents := make([]string, len(embeddings))
+	metadatas := make([]map[string]interface{}, len(embeddings))
+	for i, e := range embeddings {
+		if len(e.Vector) != len(embeddings[0].Vector) {
+			return fmt.Errorf("%w: embedding %q has %d dimensions, expected %d", vectorstore.ErrDimensionMismatch, e.ID, len(e.Vector), len(embeddings[0].Vector))
+		}
+
+		ids[i], vectors[i], documents[i] = e.ID, e.Vector, e.Content
+		// Chroma rejects empty metadata
+		if len(e.Metadata) > 0 {
+			metadatas[i] = e.Metadata
+		}
+	}
+
+	path, err := s.path(ctx, "/upsert")
+	if err != nil {
+		return err
+	}
+
+	return s.do(ctx, http.MethodPost, path, map[string]interface{}{
+		"ids":        ids,
+		"embeddings": vectors,
+		"documents":  documents,
+		"metadatas":  metadatas,
+	}, nil)
+}
+
+// Search returns the Limit records scoring highest against the query, best
+// first. Chroma distances are turned into the scores of the metric.
+func (s *ChromaVectorStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if err := vectorstore.ValidateFilter(params); err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"n_results": vectorstore.Limit(params),
+		"include":   []string{"documents", "metadatas", "embeddings", "distances"},
+	}
+	if params.Filter != nil {
+		where, err := whereOf(params.Filter)
+		if err != nil {
+			return nil, err
+		}
+		body["where"] = where
+	}
+
+	query, err := vectorstore.QueryVector(ctx, s.embedder, params)
+	if err != nil {
+		return nil, err
+	}
+	body["query_embeddings"] = []core.Vec32{query}
+
+	path, err := s.path(ctx, "/query")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		IDs        [][]string                 `json:"ids"`
+		Documents  [][]*string                `json:"documents"`
+		Metadatas  [][]map[string]interface{} `json:"metadatas"`
+		Embeddings [][]core.Vec32             `json:"embeddings"`
+		Distances  [][]float32                `json:"distances"`
+	}
+	if err := s.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return nil, err
+	}
+
+	results := []*core.SearchResult{}
+	if len(resp.IDs) == 0 {
+		return results, nil
+	}
+
+	for i, id := range resp.IDs[0] {
+		var score float32
+		if len(resp.Distances) > 0 && i < len(resp.Distances[0]) {
+			score = s.score(resp.Distances[0][i])
+		}
+		if !vectorstore.Passes(params, score) {
+			continue
+		}
+
+		e := &core.Embedding{ID: id}
+		if len(resp.Documents) > 0 && i < len(resp.Documents[0]) && resp.Documents[0][i] != nil {
+			e.Content = *resp.Documents[0][i]
+		}
+		if len(resp.Metadatas) > 0 && i < len(resp.Metadatas[0]) {
+			e.Metadata = resp.Metadatas[0][i]
+		}
+		if len(resp.Embeddings) > 0 && i < len(resp.Embeddings[0]) {
+			e.Vector = resp.Embeddings[0][i]
+		}
+		results = append(results, &core.SearchResult{Score: score, Embedding: e, SearchMeta: params})
+	}
+
+	return results, nil
+}
+
+// getResponse is the response of the get endpoint
+type getResponse struct {
+	IDs        []string                 `json:"ids"`
+	Documents  []*string                `json:"documents"`
+	Metadatas  []map[string]interface{} `json:"metadatas"`
+	Embeddings []core.Vec32             `json:"embeddings"`
+}
+
+func (s *ChromaVectorStore) get(ctx context.Context, body map[string]interface{}) (*getResponse, error) {
+	path, err := s.path(ctx, "/get")
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &getResponse{}
+	if err := s.do(ctx, http.MethodPost, path, body, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Delete removes the embeddings with the given IDs. Unknown IDs are ignored.
+func (s *ChromaVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	path, err := s.path(ctx, "/delete")
+	if err != nil {
+		return err
+	}
+
+	return s.do(ctx, http.MethodPost, path, map[string]interface{}{"ids": ids}, nil)
+}
+
+// DeleteWhere removes the embeddings matching filter. The IDs of the matching
+// records are fetched, then deleted.
+func (s *ChromaVectorStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	where, err := whereOf(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	found, err := s.get(ctx, map[string]interface{}{"where": where, "include": []string{}})
+	if err != nil {
+		return 0, err
+	}
+	if err := s.Delete(ctx, found.IDs...); err != nil {
+		return 0, err
+	}
+
+	return len(found.IDs), nil
+}
+
+// Get returns the stored embeddings with the given IDs
+func (s *ChromaVectorStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	if len(ids) == 0 {
+		return []*core.Embedding{}, nil
+	}
+
+	found, err := s.get(ctx, map[string]interface{}{
+		"ids":     ids,
+		"include": []string{"documents", "metadatas", "embeddings"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*core.Embedding, len(found.IDs))
+	for i, id := range found.IDs {
+		e := &core.Embedding{ID: id}
+		if i < len(found.Documents) && found.Documents[i] != nil {
+			e.Content = *found.Documents[i]
+		}
+		if i < len(found.Metadatas) {
+			e.Metadata = found.Metadatas[i]
+		}
+		if i < len(found.Embeddings) {
+			e.Vector = found.Embeddings[i]
+		}
+		byID[id] = e
+	}
+
+	out := make([]*core.Embedding, 0, len(found.IDs))
+	for _, id := range ids {
+		if e, ok := byID[id]; ok {
+			out = append(out, e)
+		}
+	}
+
+	return out, nil
+}
+
+// Count returns the number of stored embeddings matching filter. Filtered
+// counts fetch the IDs of the matching records.
+func (s *ChromaVectorStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	if filter == nil {
+		path, err := s.path(ctx, "/count")
+		if err != nil {
+			return 0, err
+		}
+
+		var n int
+		if err := s.do(ctx, http.MethodGet, path, nil, &n); err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	where, err := whereOf(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	found, err := s.get(ctx, map[string]interface{}{"where": where, "include": []string{}})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(found.IDs), nil
+}
+
+// Close releases idle connections. The collection is left as is.
+func (s *ChromaVectorStore) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// Drop deletes the collection along with its records
+func (s *ChromaVectorStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	s.id = ""
+	s.mu.Unlock()
+
+	err := s.do(ctx, http.MethodDelete, s.collectionsPath()+"/"+url.PathEscape(s.collection), nil, nil)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// NewCollections returns a core.CollectionManager keeping each collection in
+// the Chroma collection of the same name
+func NewCollections(baseURL string, embedder core.Embedder, opts ...ChromaVectorStoreConfigFunc) *vectorstore.Collections {
+	admin := NewChromaVectorStore(baseURL, "", embedder, opts...)
+
+	return vectorstore.NewCollections(
+		func(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+			return NewChromaVectorStore(baseURL, name, embedder, opts...), nil
+		},
+		vectorstore.WithList(func(ctx context.Context) ([]string, error) {
+			var collections []struct {
+				Name string `json:"name"`
+			}
+			if err := admin.do(ctx, http.MethodGet, admin.collectionsPath(), nil, &collections); err != nil {
+				return nil, err
+			}
+
+			names := make([]string, len(collections))
+			for i, c := range collections {
+				names[i] = c.Name
+			}
+			return names, nil
+		}),
+		vectorstore.WithDrop(func(ctx context.Context, name string) error {
+			return NewChromaVectorStore(baseURL, name, embedder, opts...).Drop(ctx)
+		}),
+	)
+}
+
+// errUnsupported wraps vectorstore.ErrUnsupportedFilter with the reason
+func errUnsupported(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", vectorstore.ErrUnsupportedFilter, fmt.Sprintf(format, args...))
+}
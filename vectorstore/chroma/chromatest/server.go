@@ -0,0 +1,652 @@
+// Package chromatest serves an in-memory stand-in of the Chroma v2 HTTP API,
+// for testing code using the chroma package without a Chroma server:
+//
+//	srv := chromatest.NewServer()
+//	defer srv.Close()
+//	store := chroma.NewChromaVectorStore(srv.URL, "docs", embedder)
+//
+// It implements the endpoints the chroma package calls, with exact search
+// and the where operators Chroma supports, and validates requests as Chroma
+// does where it matters to clients: collection names, metadata values,
+// where clauses with a single operator, and vectors matching the dimension
+// of their collection.
+package chromatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// NewServer starts a server with no collections, to be closed by the caller
+func NewServer() *httptest.Server {
+	return httptest.NewServer(NewHandler())
+}
+
+// NewHandler returns the handler of the API, with no collections
+func NewHandler() http.Handler {
+	s := &server{collections: map[string]*collection{}}
+
+	const base = "/api/v2/tenants/{tenant}/databases/{database}/collections"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+base, s.listCollections)
+	mux.HandleFunc("POST "+base, s.createCollection)
+	mux.HandleFunc("DELETE "+base+"/{name}", s.deleteCollection)
+	mux.HandleFunc("POST "+base+"/{id}/upsert", s.upsert)
+	mux.HandleFunc("POST "+base+"/{id}/query", s.query)
+	mux.HandleFunc("POST "+base+"/{id}/get", s.get)
+	mux.HandleFunc("POST "+base+"/{id}/delete", s.delete)
+	mux.HandleFunc("GET "+base+"/{id}/count", s.count)
+
+	return mux
+}
+
+type server struct {
+	mu sync.Mutex
+	// collections holds collections by tenant, database and name
+	collections map[string]*collection
+	next        int
+}
+
+type collection struct {
+	id       string
+	name     string
+	space    string
+	metadata map[string]interface{}
+	dim      int
+	// ids keeps the insertion order, in which records are returned
+	ids     []string
+	records map[string]*record
+}
+
+type record struct {
+	embedding []float32
+	document  *string
+	metadata  map[string]interface{}
+}
+
+func respond(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func fail(w http.ResponseWriter, status int, kind, format string, args ...interface{}) {
+	respond(w, status, map[string]string{"error": kind, "message": fmt.Sprintf(format, args...)})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "invalid JSON body: %v", err)
+		return false
+	}
+
+	return true
+}
+
+func key(r *http.Request, name string) string {
+	return r.PathValue("tenant") + "/" + r.PathValue("database") + "/" + name
+}
+
+// lookup returns the collection of the request by ID, responding 404 when
+// missing. It must be called with mu held.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) *collection {
+	id := r.PathValue("id")
+	prefix := key(r, "")
+	for k, c := range s.collections {
+		if c.id == id && k == prefix+c.name {
+			return c
+		}
+	}
+
+	fail(w, http.StatusNotFound, "NotFoundError", "Collection %s does not exist.", id)
+	return nil
+}
+
+func (c *collection) describe() map[string]interface{} {
+	return map[string]interface{}{"id": c.id, "name": c.name, "metadata": c.metadata, "dimension": c.dim}
+}
+
+func (s *server) listCollections(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix := key(r, "")
+	list := []map[string]interface{}{}
+	for k, c := range s.collections {
+		if k == prefix+c.name {
+			list = append(list, c.describe())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i]["name"].(string) < list[j]["name"].(string) })
+
+	respond(w, http.StatusOK, list)
+}
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{1,61}[a-zA-Z0-9]$`)
+
+func (s *server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string                 `json:"name"`
+		Metadata    map[string]interface{} `json:"metadata"`
+		GetOrCreate bool                   `json:"get_or_create"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if !validName.MatchString(req.Name) {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "Validation error: name: Expected a name containing 3-63 characters from [a-zA-Z0-9._-], starting and ending with a character in [a-zA-Z0-9]. Got: %s", req.Name)
+		return
+	}
+
+	space := "l2"
+	if v, ok := req.Metadata["hnsw:space"]; ok {
+		space, _ = v.(string)
+	}
+	switch space {
+	case "cosine", "ip", "l2":
+	default:
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "unknown hnsw:space %v", req.Metadata["hnsw:space"])
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key(r, req.Name)
+	if c, ok := s.collections[k]; ok {
+		if !req.GetOrCreate {
+			fail(w, http.StatusConflict, "UniqueConstraintError", "Collection %s already exists", req.Name)
+			return
+		}
+		respond(w, http.StatusOK, c.describe())
+		return
+	}
+
+	s.next++
+	c := &collection{
+		id:       fmt.Sprintf("00000000-0000-4000-8000-%012d", s.next),
+		name:     req.Name,
+		space:    space,
+		metadata: req.Metadata,
+		records:  map[string]*record{},
+	}
+	s.collections[k] = c
+	respond(w, http.StatusOK, c.describe())
+}
+
+func (s *server) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key(r, r.PathValue("name"))
+	if _, ok := s.collections[k]; !ok {
+		fail(w, http.StatusNotFound, "NotFoundError", "Collection %s does not exist.", r.PathValue("name"))
+		return
+	}
+
+	delete(s.collections, k)
+	respond(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *server) upsert(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs        []string                 `json:"ids"`
+		Embeddings [][]float32              `json:"embeddings"`
+		Documents  []*string                `json:"documents"`
+		Metadatas  []map[string]interface{} `json:"metadatas"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	n := len(req.IDs)
+	if len(req.Embeddings) != n || req.Documents != nil && len(req.Documents) != n || req.Metadatas != nil && len(req.Metadatas) != n {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "Inconsistent number of records: ids, embeddings, documents and metadatas must have the same length")
+		return
+	}
+
+	seen := map[string]bool{}
+	for i, id := range req.IDs {
+		if id == "" || seen[id] {
+			fail(w, http.StatusBadRequest, "DuplicateIDError", "Expected IDs to be unique and non-empty, found %q", id)
+			return
+		}
+		seen[id] = true
+
+		if len(req.Embeddings[i]) == 0 || len(req.Embeddings[i]) != len(req.Embeddings[0]) {
+			fail(w, http.StatusBadRequest, "InvalidArgumentError", "Expected embeddings of the same non-zero dimension")
+			return
+		}
+		if req.Metadatas != nil && req.Metadatas[i] != nil {
+			if err := validMetadata(req.Metadatas[i]); err != nil {
+				fail(w, http.StatusBadRequest, "InvalidArgumentError", "%v", err)
+				return
+			}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+	if n == 0 {
+		respond(w, http.StatusOK, map[string]interface{}{})
+		return
+	}
+	if c.dim != 0 && c.dim != len(req.Embeddings[0]) {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "Collection expecting embedding with dimension of %d, got %d", c.dim, len(req.Embeddings[0]))
+		return
+	}
+	c.dim = len(req.Embeddings[0])
+
+	for i, id := range req.IDs {
+		rec := &record{embedding: req.Embeddings[i]}
+		if req.Documents != nil {
+			rec.document = req.Documents[i]
+		}
+		if req.Metadatas != nil {
+			rec.metadata = req.Metadatas[i]
+		}
+
+		if _, ok := c.records[id]; !ok {
+			c.ids = append(c.ids, id)
+		}
+		c.records[id] = rec
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{})
+}
+
+// validMetadata accepts non-empty metadata of strings, numbers and booleans
+func validMetadata(m map[string]interface{}) error {
+	if len(m) == 0 {
+		return fmt.Errorf("Expected metadata to be a non-empty dict, got %v", m)
+	}
+	for k, v := range m {
+		switch v.(type) {
+		case string, float64, bool:
+		default:
+			return fmt.Errorf("Expected metadata value for %s to be a str, int, float or bool, got %v", k, v)
+		}
+	}
+
+	return nil
+}
+
+// request holds the fields common to query, get and delete requests
+type request struct {
+	IDs     []string               `json:"ids"`
+	Where   map[string]interface{} `json:"where"`
+	Include *[]string              `json:"include"`
+}
+
+// matching returns the IDs of the records selected by a request, in
+// insertion order
+func (c *collection) matching(req *request) ([]string, error) {
+	var wanted map[string]bool
+	if req.IDs != nil {
+		wanted = make(map[string]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			wanted[id] = true
+		}
+	}
+
+	ids := []string{}
+	for _, id := range c.ids {
+		if wanted != nil && !wanted[id] {
+			continue
+		}
+		if req.Where != nil {
+			ok, err := matchWhere(req.Where, c.records[id].metadata)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func includes(req *request, field string, defaults ...string) bool {
+	list := defaults
+	if req.Include != nil {
+		list = *req.Include
+	}
+	for _, f := range list {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *server) get(w http.ResponseWriter, r *http.Request) {
+	req := &request{}
+	if !decode(w, r, req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+	ids, err := c.matching(req)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "%v", err)
+		return
+	}
+
+	resp := map[string]interface{}{"ids": ids, "documents": nil, "metadatas": nil, "embeddings": nil}
+	columns(resp, c, ids, req, "documents", "metadatas")
+	respond(w, http.StatusOK, resp)
+}
+
+// columns sets the included fields of the records in resp
+func columns(resp map[string]interface{}, c *collection, ids []string, req *request, defaults ...string) {
+	documents := make([]*string, len(ids))
+	metadatas := make([]map[string]interface{}, len(ids))
+	embeddings := make([][]float32, len(ids))
+	for i, id := range ids {
+		rec := c.records[id]
+		documents[i], metadatas[i], embeddings[i] = rec.document, rec.metadata, rec.embedding
+	}
+
+	if includes(req, "documents", defaults...) {
+		resp["documents"] = documents
+	}
+	if includes(req, "metadatas", defaults...) {
+		resp["metadatas"] = metadatas
+	}
+	if includes(req, "embeddings", defaults...) {
+		resp["embeddings"] = embeddings
+	}
+}
+
+func (s *server) query(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		request
+		QueryEmbeddings [][]float32 `json:"query_embeddings"`
+		NResults        *int        `json:"n_results"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	limit := 10
+	if req.NResults != nil {
+		limit = *req.NResults
+	}
+	if limit <= 0 {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "Expected n_results to be a positive integer, got %d", limit)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+	ids, err := c.matching(&req.request)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "%v", err)
+		return
+	}
+
+	resp := map[string][]interface{}{}
+	for _, fields := range []string{"ids", "documents", "metadatas", "embeddings", "distances"} {
+		resp[fields] = []interface{}{}
+	}
+
+	for _, q := range req.QueryEmbeddings {
+		if c.dim != 0 && len(q) != c.dim {
+			fail(w, http.StatusBadRequest, "InvalidArgumentError", "Collection expecting embedding with dimension of %d, got %d", c.dim, len(q))
+			return
+		}
+
+		distances := make(map[string]float32, len(ids))
+		for _, id := range ids {
+			distances[id] = distance(c.space, q, c.records[id].embedding)
+		}
+		ranked := append([]string(nil), ids...)
+		sort.SliceStable(ranked, func(i, j int) bool { return distances[ranked[i]] < distances[ranked[j]] })
+		ranked = ranked[:min(limit, len(ranked))]
+
+		row := map[string]interface{}{"documents": nil, "metadatas": nil, "embeddings": nil}
+		columns(row, c, ranked, &req.request, "documents", "metadatas", "distances")
+
+		resp["ids"] = append(resp["ids"], ranked)
+		for _, field := range []string{"documents", "metadatas", "embeddings"} {
+			resp[field] = append(resp[field], row[field])
+		}
+		if includes(&req.request, "distances", "documents", "metadatas", "distances") {
+			d := make([]float32, len(ranked))
+			for i, id := range ranked {
+				d[i] = distances[id]
+			}
+			resp["distances"] = append(resp["distances"], d)
+		} else {
+			resp["distances"] = append(resp["distances"], nil)
+		}
+	}
+
+	respond(w, http.StatusOK, resp)
+}
+
+func (s *server) delete(w http.ResponseWriter, r *http.Request) {
+	req := &request{}
+	if !decode(w, r, req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+	ids, err := c.matching(req)
+	if err != nil {
+		fail(w, http.StatusBadRequest, "InvalidArgumentError", "%v", err)
+		return
+	}
+
+	for _, id := range ids {
+		delete(c.records, id)
+	}
+	kept := c.ids[:0]
+	for _, id := range c.ids {
+		if _, ok := c.records[id]; ok {
+			kept = append(kept, id)
+		}
+	}
+	c.ids = kept
+
+	respond(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *server) count(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	respond(w, http.StatusOK, len(c.ids))
+}
+
+// distance is the distance of Chroma spaces: 1 - cosine similarity, 1 -
+// inner product, or squared euclidean distance
+func distance(space string, a, b []float32) float32 {
+	var dot, na, nb, l2 float64
+	for i := range a {
+		x, y := float64(a[i]), float64(b[i])
+		dot += x * y
+		na += x * x
+		nb += y * y
+		l2 += (x - y) * (x - y)
+	}
+
+	switch space {
+	case "cosine":
+		if na == 0 || nb == 0 {
+			return 1
+		}
+		return float32(1 - dot/math.Sqrt(na*nb))
+	case "ip":
+		return float32(1 - dot)
+	default:
+		return float32(l2)
+	}
+}
+
+// matchWhere evaluates a where clause against metadata. Every clause must hold
+// a single operator or field, and conditions on a field the metadata lacks
+// never hold, negations included.
+func matchWhere(where map[string]interface{}, metadata map[string]interface{}) (bool, error) {
+	if len(where) != 1 {
+		return false, fmt.Errorf("Expected where to have exactly one operator, got %v", where)
+	}
+
+	for k, v := range where {
+		switch k {
+		case "$and", "$or":
+			clauses, ok := v.([]interface{})
+			if !ok || len(clauses) < 2 {
+				return false, fmt.Errorf("Expected where value for %s to be a list with at least two where expressions, got %v", k, v)
+			}
+
+			some, all := false, true
+			for _, clause := range clauses {
+				sub, ok := clause.(map[string]interface{})
+				if !ok {
+					return false, fmt.Errorf("Expected where expression to be a dict, got %v", clause)
+				}
+				matched, err := matchWhere(sub, metadata)
+				if err != nil {
+					return false, err
+				}
+				some = some || matched
+				all = all && matched
+			}
+			if k == "$and" {
+				return all, nil
+			}
+			return some, nil
+		default:
+			return matchField(k, v, metadata)
+		}
+	}
+
+	return false, nil
+}
+
+// matchField evaluates the condition of a field, a value or an operator
+func matchField(field string, cond interface{}, metadata map[string]interface{}) (bool, error) {
+	op, want := "$eq", cond
+	if m, ok := cond.(map[string]interface{}); ok {
+		if len(m) != 1 {
+			return false, fmt.Errorf("Expected operator expression to have exactly one operator, got %v", m)
+		}
+		for k, v := range m {
+			op, want = k, v
+		}
+	}
+
+	switch op {
+	case "$eq", "$ne":
+		if !scalar(want) {
+			return false, fmt.Errorf("Expected where operand value to be a str, int, float or bool, got %v", want)
+		}
+	case "$gt", "$gte", "$lt", "$lte":
+		if _, ok := want.(float64); !ok {
+			return false, fmt.Errorf("Expected operand value to be an int or a float for operator %s, got %v", op, want)
+		}
+	case "$in", "$nin":
+		list, ok := want.([]interface{})
+		if !ok || len(list) == 0 {
+			return false, fmt.Errorf("Expected where value for %s to be a non-empty list, got %v", op, want)
+		}
+		for _, v := range list {
+			if !scalar(v) {
+				return false, fmt.Errorf("Expected where operand value to be a str, int, float or bool, got %v", v)
+			}
+		}
+	default:
+		return false, fmt.Errorf("Expected where operator to be one of $gt, $gte, $lt, $lte, $ne, $eq, $in, $nin, got %s", op)
+	}
+
+	got, ok := metadata[field]
+	if !ok {
+		return false, nil
+	}
+
+	switch op {
+	case "$eq":
+		return equal(got, want), nil
+	case "$ne":
+		return !equal(got, want), nil
+	case "$in", "$nin":
+		found := false
+		for _, v := range want.([]interface{}) {
+			found = found || equal(got, v)
+		}
+		return found == (op == "$in"), nil
+	}
+
+	n, ok := got.(float64)
+	if !ok {
+		return false, nil
+	}
+	bound := want.(float64)
+	switch op {
+	case "$gt":
+		return n > bound, nil
+	case "$gte":
+		return n >= bound, nil
+	case "$lt":
+		return n < bound, nil
+	default:
+		return n <= bound, nil
+	}
+}
+
+func scalar(v interface{}) bool {
+	switch v.(type) {
+	case string, float64, bool:
+		return true
+	}
+	return false
+}
+
+// equal compares metadata values, numbers by value
+func equal(a, b interface{}) bool {
+	x, ok := a.(float64)
+	y, ok2 := b.(float64)
+	if ok && ok2 {
+		return x == y
+	}
+
+	return a == b
+}
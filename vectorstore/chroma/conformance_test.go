@@ -0,0 +1,31 @@
+package chroma
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/chroma/chromatest"
+	"github.com/joaopandolfi/core/vectorstore/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	srv := chromatest.NewServer()
+	defer srv.Close()
+
+	// the stand-in is shared, every store gets a collection of its own
+	collections := 0
+
+	for _, m := range []vectorstore.Metric{vectorstore.Cosine, vectorstore.DotProduct, vectorstore.L2} {
+		t.Run(m.String(), func(t *testing.T) {
+			factory := func(ctx context.Context, embedder core.Embedder) (core.MutableVectorStorer, error) {
+				collections++
+				return NewChromaVectorStore(srv.URL, fmt.Sprintf("conformance-%d", collections), embedder, WithMetric(m)), nil
+			}
+
+			conformance.Test(t, factory)
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package chroma
+
+import (
+	"github.com/joaopandolfi/core"
+)
+
+// whereOf translates a valid core.Filter into a Chroma where clause. Not is
+// pushed down to the conditions, as Chroma has no negation of clauses: $ne,
+// $nin and the complement of ranges, which like every Chroma operator never
+// match records lacking the field.
+func whereOf(f *core.Filter) (map[string]interface{}, error) {
+	return where(f, false)
+}
+
+func where(f *core.Filter, negate bool) (map[string]interface{}, error) {
+	switch f.Op {
+	case core.FilterAnd, core.FilterOr:
+		// De Morgan: a negated And is an Or of negations, and vice versa
+		op := "$and"
+		if (f.Op == core.FilterOr) != negate {
+			op = "$or"
+		}
+		return combine(op, f.Filters, negate)
+	case core.FilterNot:
+		// Not holds none of its filters, an And of their negations
+		op := "$and"
+		if negate {
+			op = "$or"
+		}
+		return combine(op, f.Filters, !negate)
+	case core.FilterEq:
+		if !scalar(f.Value) {
+			return nil, errUnsupported("chroma only matches strings, numbers and booleans, got %T in %s", f.Value, f.Field)
+		}
+		if negate {
+			return field(f.Field, "$ne", f.Value), nil
+		}
+		return field(f.Field, "$eq", f.Value), nil
+	case core.FilterIn:
+		for _, v := range f.Values {
+			if !scalar(v) {
+				return nil, errUnsupported("chroma only matches strings, numbers and booleans, got %T in %s", v, f.Field)
+			}
+		}
+		if negate {
+			return field(f.Field, "$nin", f.Values), nil
+		}
+		return field(f.Field, "$in", f.Values), nil
+	case core.FilterRange:
+		return rangeOf(f, negate)
+	case core.FilterExists:
+		return nil, errUnsupported("chroma cannot filter on the presence of %s", f.Field)
+	default:
+		return nil, errUnsupported("unknown filter operation %q", f.Op)
+	}
+}
+
+// combine joins the clauses of filters with op, unwrapping a single clause
+// which Chroma rejects
+func combine(op string, filters []*core.Filter, negate bool) (map[string]interface{}, error) {
+	clauses := make([]interface{}, 0, len(filters))
+	for _, sub := range filters {
+		clause, err := where(sub, negate)
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+	}
+
+	if len(clauses) == 1 {
+		return clauses[0].(map[string]interface{}), nil
+	}
+
+	return map[string]interface{}{op: clauses}, nil
+}
+
+// rangeOf translates a range, whose bounds must be numbers. A negated range
+// holds when any of its bounds does not.
+func rangeOf(f *core.Filter, negate bool) (map[string]interface{}, error) {
+	type bound struct {
+		value     interface{}
+		op, negOp string
+	}
+	bounds := []bound{
+		{f.Gt, "$gt", "$lte"},
+		{f.Gte, "$gte", "$lt"},
+		{f.Lt, "$lt", "$gte"},
+		{f.Lte, "$lte", "$gt"},
+	}
+
+	clauses := []interface{}{}
+	for _, b := range bounds {
+		if b.value == nil {
+			continue
+		}
+		if !number(b.value) {
+			return nil, errUnsupported("chroma ranges only bound numbers, got %T in %s", b.value, f.Field)
+		}
+
+		op := b.op
+		if negate {
+			op = b.negOp
+		}
+		clauses = append(clauses, field(f.Field, op, b.value))
+	}
+
+	if len(clauses) == 1 {
+		return clauses[0].(map[string]interface{}), nil
+	}
+	if negate {
+		return map[string]interface{}{"$or": clauses}, nil
+	}
+
+	return map[string]interface{}{"$and": clauses}, nil
+}
+
+func field(name, op string, value interface{}) map[string]interface{} {
+	return map[string]interface{}{name: map[string]interface{}{op: value}}
+}
+
+func number(v interface{}) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+func scalar(v interface{}) bool {
+	switch v.(type) {
+	case string, bool:
+		return true
+	}
+	return number(v)
+}
@@ -0,0 +1,302 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+)
+
+var (
+	// ErrInvalidCollection is returned for collection names that are empty,
+	// too long or hold characters other than letters, digits, '.', '-' and
+	// '_'
+	ErrInvalidCollection = errors.New("invalid collection name")
+
+	// ErrCollectionDropped is returned by the stores of collections dropped
+	// or closed since they were returned
+	ErrCollectionDropped = errors.New("collection dropped")
+)
+
+var collectionName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// ValidateCollection checks a collection name. Valid names are safe to use as
+// file names.
+func ValidateCollection(name string) error {
+	if !collectionName.MatchString(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidCollection, name)
+	}
+
+	return nil
+}
+
+// Collections implements core.CollectionManager over stores opened on demand,
+// one per collection. The sub packages provide constructors for their own
+// stores.
+//
+// Collection returns a handle on the store shared by every caller, which
+// stays owned by the Collections: closing the handle does nothing. Dropping
+// or closing the collections waits for the calls in flight on their handles,
+// later calls failing with ErrCollectionDropped.
+type Collections struct {
+	open func(ctx context.Context, name string) (core.MutableVectorStorer, error)
+	list func(ctx context.Context) ([]string, error)
+	drop func(ctx context.Context, name string) error
+
+	mu     sync.Mutex
+	stores map[string]*collection
+}
+
+// CollectionsConfig holds configuration for Collections
+type CollectionsConfig struct {
+	// List returns the collections persisted by a previous process, which
+	// are opened when first used
+	// default none
+	List func(ctx context.Context) ([]string, error)
+
+	// Drop deletes what a collection persisted, once its store is closed
+	// default none
+	Drop func(ctx context.Context, name string) error
+}
+
+// CollectionsConfigFunc is a function type that modifies CollectionsConfig
+type CollectionsConfigFunc func(*CollectionsConfig)
+
+func WithList(list func(ctx context.Context) ([]string, error)) CollectionsConfigFunc {
+	return func(conf *CollectionsConfig) {
+		conf.List = list
+	}
+}
+
+func WithDrop(drop func(ctx context.Context, name string) error) CollectionsConfigFunc {
+	return func(conf *CollectionsConfig) {
+		conf.Drop = drop
+	}
+}
+
+// NewCollections returns a new Collections creating the store of a
+// collection with open
+func NewCollections(open func(ctx context.Context, name string) (core.MutableVectorStorer, error), opts ...CollectionsConfigFunc) *Collections {
+	conf := &CollectionsConfig{}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Collections{
+		open:   open,
+		list:   conf.List,
+		drop:   conf.Drop,
+		stores: map[string]*collection{},
+	}
+}
+
+// Collection returns the named collection, creating it if needed
+func (c *Collections) Collection(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+	if err := ValidateCollection(name); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.stores[name]; ok {
+		return s, nil
+	}
+
+	store, err := c.open(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening collection %q: %w", name, err)
+	}
+
+	s := &collection{name: name, store: store}
+	c.stores[name] = s
+	return s, nil
+}
+
+// Collections returns the names of the open and persisted collections, sorted
+func (c *Collections) Collections(ctx context.Context) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := map[string]bool{}
+	for name := range c.stores {
+		names[name] = true
+	}
+
+	if c.list != nil {
+		listed, err := c.list(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing collections: %w", err)
+		}
+		for _, name := range listed {
+			names[name] = true
+		}
+	}
+
+	out := make([]string, 0, len(names))
+	for name := range names {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
+
+// DropCollection closes a collection and deletes it. Dropping an unknown
+// collection is not an error. The handles returned for the collection fail
+// with ErrCollectionDropped from then on, even once a collection of the same
+// name is created again.
+func (c *Collections) DropCollection(ctx context.Context, name string) error {
+	if err := ValidateCollection(name); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s, ok := c.stores[name]; ok {
+		delete(c.stores, name)
+		if err := s.close(); err != nil {
+			return fmt.Errorf("error closing collection %q: %w", name, err)
+		}
+	}
+
+	if c.drop != nil {
+		if err := c.drop(ctx, name); err != nil {
+			return fmt.Errorf("error dropping collection %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Close closes every open collection
+func (c *Collections) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for name, s := range c.stores {
+		if err := s.close(); err != nil {
+			errs = append(errs, fmt.Errorf("error closing collection %q: %w", name, err))
+		}
+	}
+	c.stores = map[string]*collection{}
+
+	return errors.Join(errs...)
+}
+
+// collection is the handle on the store of a collection. Calls hold a read
+// lock, so that closing the store waits for those in flight.
+type collection struct {
+	name string
+
+	mu     sync.RWMutex
+	store  core.MutableVectorStorer
+	closed bool
+}
+
+// close closes the store, failing the calls made from then on
+func (c *collection) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	return c.store.Close()
+}
+
+func (c *collection) errDropped() error {
+	return fmt.Errorf("%w: %q", ErrCollectionDropped, c.name)
+}
+
+func (c *collection) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, c.errDropped()
+	}
+
+	return c.store.Add(ctx, contents)
+}
+
+func (c *collection) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, c.errDropped()
+	}
+
+	return c.store.Search(ctx, params)
+}
+
+func (c *collection) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return c.errDropped()
+	}
+
+	return c.store.Upsert(ctx, embeddings...)
+}
+
+func (c *collection) Delete(ctx context.Context, ids ...string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return c.errDropped()
+	}
+
+	return c.store.Delete(ctx, ids...)
+}
+
+func (c *collection) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return 0, c.errDropped()
+	}
+
+	return c.store.DeleteWhere(ctx, filter)
+}
+
+func (c *collection) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return nil, c.errDropped()
+	}
+
+	return c.store.Get(ctx, ids...)
+}
+
+func (c *collection) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return 0, c.errDropped()
+	}
+
+	return c.store.Count(ctx, filter)
+}
+
+// Close does nothing: the store is closed by DropCollection or by the Close
+// of the Collections
+func (c *collection) Close() error {
+	return nil
+}
@@ -0,0 +1,385 @@
+package vectorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joaopandolfi/core"
+)
+
+// fakeStore counts embeddings, fails once closed and, when block is set,
+// blocks searches on it after a send on started
+type fakeStore struct {
+	name     string
+	closeErr error
+	started  chan struct{}
+	block    chan struct{}
+
+	mu     sync.Mutex
+	count  int
+	closed bool
+}
+
+func (s *fakeStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	return nil, s.Upsert(ctx)
+}
+
+func (s *fakeStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if s.block != nil {
+		s.started <- struct{}{}
+		<-s.block
+	}
+	if s.isClosed() {
+		return nil, errors.New("search on a closed store")
+	}
+
+	return nil, nil
+}
+
+func (s *fakeStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("upsert on a closed store")
+	}
+	s.count += len(embeddings)
+
+	return nil
+}
+
+func (s *fakeStore) Delete(ctx context.Context, ids ...string) error {
+	return nil
+}
+
+func (s *fakeStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count, nil
+}
+
+func (s *fakeStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	return s.closeErr
+}
+
+func (s *fakeStore) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closed
+}
+
+// fakeBackend opens fakeStores and records what was opened and dropped
+type fakeBackend struct {
+	persisted []string
+	listErr   error
+	dropErr   error
+
+	opened  []*fakeStore
+	dropped []string
+}
+
+func (b *fakeBackend) open(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+	if name == "broken" {
+		return nil, errors.New("cannot open")
+	}
+
+	s := &fakeStore{name: name}
+	b.opened = append(b.opened, s)
+	return s, nil
+}
+
+func (b *fakeBackend) collections(opts ...CollectionsConfigFunc) *Collections {
+	opts = append([]CollectionsConfigFunc{
+		WithList(func(ctx context.Context) ([]string, error) { return b.persisted, b.listErr }),
+		WithDrop(func(ctx context.Context, name string) error {
+			b.dropped = append(b.dropped, name)
+			return b.dropErr
+		}),
+	}, opts...)
+
+	return NewCollections(b.open, opts...)
+}
+
+func TestValidateCollection(t *testing.T) {
+	tests := map[string]bool{
+		"docs":                   true,
+		"tenant-42.v2":           true,
+		"_private":               true,
+		"A":                      true,
+		strings.Repeat("a", 128): true,
+		"":                       false,
+		strings.Repeat("a", 129): false,
+		".hidden":                false,
+		"-flag":                  false,
+		"../escape":              false,
+		"a/b":                    false,
+		"with space":             false,
+		"naïve":                  false,
+	}
+
+	for name, valid := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateCollection(name)
+			if valid && err != nil {
+				t.Errorf("got %v", err)
+			}
+			if !valid && !errors.Is(err, ErrInvalidCollection) {
+				t.Errorf("got %v, want ErrInvalidCollection", err)
+			}
+		})
+	}
+}
+
+func TestCollection(t *testing.T) {
+	ctx := context.Background()
+	b := &fakeBackend{}
+	c := b.collections()
+	defer c.Close()
+
+	first, err := c.Collection(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Upsert(ctx, &core.Embedding{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the store is shared and outlives the Close of a handle
+	if err := first.Close(); err != nil {
+		t.Fatal(err)
+	}
+	second, err := c.Collection(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := second.Count(ctx, nil); n != 1 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if len(b.opened) != 1 || b.opened[0].isClosed() {
+		t.Errorf("opened %d stores", len(b.opened))
+	}
+
+	if _, err := c.Collection(ctx, "../docs"); !errors.Is(err, ErrInvalidCollection) {
+		t.Errorf("got %v, want ErrInvalidCollection", err)
+	}
+	if _, err := c.Collection(ctx, "broken"); err == nil || !strings.Contains(err.Error(), `error opening collection "broken"`) {
+		t.Errorf("got %v", err)
+	}
+	if len(b.opened) != 1 {
+		t.Errorf("opened %d stores", len(b.opened))
+	}
+}
+
+func TestCollections(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		persisted []string
+		open      []string
+		want      string
+	}{
+		"none":             {nil, nil, "[]"},
+		"open only":        {nil, []string{"b", "a"}, "[a b]"},
+		"persisted only":   {[]string{"z", "m"}, nil, "[m z]"},
+		"open and listed":  {[]string{"c", "a"}, []string{"b", "a"}, "[a b c]"},
+		"listed twice too": {[]string{"a", "a"}, []string{"a"}, "[a]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := (&fakeBackend{persisted: tt.persisted}).collections()
+			defer c.Close()
+
+			for _, name := range tt.open {
+				if _, err := c.Collection(ctx, name); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			names, err := c.Collections(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprint(names); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	failing := (&fakeBackend{listErr: errors.New("down")}).collections()
+	if _, err := failing.Collections(ctx); err == nil || !strings.Contains(err.Error(), "error listing collections") {
+		t.Errorf("got %v", err)
+	}
+
+	// without a list, the open collections are listed
+	c := NewCollections((&fakeBackend{}).open)
+	if _, err := c.Collection(ctx, "docs"); err != nil {
+		t.Fatal(err)
+	}
+	if names, err := c.Collections(ctx); fmt.Sprint(names) != "[docs]" || err != nil {
+		t.Errorf("got %v, %v", names, err)
+	}
+}
+
+func TestDropCollection(t *testing.T) {
+	ctx := context.Background()
+	b := &fakeBackend{}
+	c := b.collections()
+	defer c.Close()
+
+	handle, err := c.Collection(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.DropCollection(ctx, "docs"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !b.opened[0].isClosed() || fmt.Sprint(b.dropped) != "[docs]" {
+		t.Errorf("store closed %v, dropped %v", b.opened[0].isClosed(), b.dropped)
+	}
+	if _, err := handle.Search(ctx, &core.SearchParams{Query: "x"}); !errors.Is(err, ErrCollectionDropped) {
+		t.Errorf("got %v, want ErrCollectionDropped", err)
+	}
+	if err := handle.Upsert(ctx, &core.Embedding{ID: "1"}); !errors.Is(err, ErrCollectionDropped) {
+		t.Errorf("got %v, want ErrCollectionDropped", err)
+	}
+
+	// a collection created again under the name is a new store, which the
+	// handles of the dropped one do not reach
+	again, err := c.Collection(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := again.Upsert(ctx, &core.Embedding{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.opened) != 2 {
+		t.Errorf("opened %d stores", len(b.opened))
+	}
+	if _, err := handle.Count(ctx, nil); !errors.Is(err, ErrCollectionDropped) {
+		t.Errorf("got %v, want ErrCollectionDropped", err)
+	}
+
+	// unknown collections are dropped from the backend all the same
+	if err := c.DropCollection(ctx, "persisted"); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(b.dropped) != "[docs persisted]" {
+		t.Errorf("dropped %v", b.dropped)
+	}
+
+	if err := c.DropCollection(ctx, "a/b"); !errors.Is(err, ErrInvalidCollection) {
+		t.Errorf("got %v, want ErrInvalidCollection", err)
+	}
+
+	b.dropErr = errors.New("read-only")
+	if err := c.DropCollection(ctx, "docs"); err == nil || !strings.Contains(err.Error(), `error dropping collection "docs"`) {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestDropCollectionWaitsForCalls(t *testing.T) {
+	ctx := context.Background()
+	b := &fakeBackend{}
+	c := b.collections()
+
+	handle, err := c.Collection(ctx, "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := b.opened[0]
+	store.started, store.block = make(chan struct{}), make(chan struct{})
+
+	searched := make(chan error)
+	go func() {
+		_, err := handle.Search(ctx, &core.SearchParams{Query: "x"})
+		searched <- err
+	}()
+
+	<-store.started
+
+	dropped := make(chan error)
+	go func() {
+		dropped <- c.DropCollection(ctx, "docs")
+	}()
+
+	select {
+	case err := <-dropped:
+		t.Fatalf("dropped with a search in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if store.isClosed() {
+		t.Fatal("store closed with a search in flight")
+	}
+
+	close(store.block)
+	if err := <-searched; err != nil {
+		t.Errorf("search failed: %v", err)
+	}
+	if err := <-dropped; err != nil {
+		t.Fatal(err)
+	}
+	if !store.isClosed() {
+		t.Error("store not closed")
+	}
+}
+
+func TestCollectionsClose(t *testing.T) {
+	ctx := context.Background()
+	b := &fakeBackend{}
+	c := b.collections()
+
+	var handles []core.MutableVectorStorer
+	for _, name := range []string{"a", "b", "c"} {
+		h, err := c.Collection(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handles = append(handles, h)
+	}
+	b.opened[1].closeErr = errors.New("flush failed")
+
+	err := c.Close()
+	if err == nil || !strings.Contains(err.Error(), `error closing collection "b": flush failed`) {
+		t.Errorf("got %v", err)
+	}
+	for i, s := range b.opened {
+		if !s.isClosed() {
+			t.Errorf("store %s not closed", s.name)
+		}
+		if _, err := handles[i].Get(ctx, "1"); !errors.Is(err, ErrCollectionDropped) {
+			t.Errorf("got %v, want ErrCollectionDropped", err)
+		}
+	}
+
+	// the collections can be opened again, nothing was dropped
+	if _, err := c.Collection(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.opened) != 4 || len(b.dropped) != 0 {
+		t.Errorf("opened %d, dropped %v", len(b.opened), b.dropped)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,568 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// Cases returns the cases of the suite
+func Cases() []*Case {
+	return []*Case{
+		{Name: "add", Run: testAdd},
+		{Name: "upsert_get", Run: testUpsertGet},
+		{Name: "upsert_replace", Run: testUpsertReplace},
+		{Name: "search_order", Run: testSearchOrder},
+		{Name: "search_threshold", Run: testSearchThreshold},
+		{Name: "search_empty", Run: testSearchEmpty},
+		{Name: "filters", Run: testFilters},
+		{Name: "delete", Run: testDelete},
+		{Name: "delete_where", Run: testDeleteWhere},
+		{Name: "invalid_filter", Run: testInvalidFilter},
+		{Name: "dimension_mismatch", Run: testDimensionMismatch},
+	}
+}
+
+// vec returns the unit vector at angle theta in the plane of the first two
+// dimensions. Angles from a query order results the same way under every
+// metric.
+func vec(theta float64) core.Vec32 {
+	return core.Vec32{float32(math.Cos(theta)), float32(math.Sin(theta)), 0, 0}
+}
+
+func ids(results []*core.SearchResult) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Embedding.ID
+	}
+
+	return out
+}
+
+func sameSet(got, want []string) bool {
+	a := append([]string(nil), got...)
+	b := append([]string(nil), want...)
+	sort.Strings(a)
+	sort.Strings(b)
+
+	return reflect.DeepEqual(a, b) || len(a) == 0 && len(b) == 0
+}
+
+// normalize returns metadata as decoded from JSON, so that numbers compare
+// alike whatever their type, and empty metadata as nil
+func normalize(metadata map[string]interface{}) (map[string]interface{}, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func cosine(a, b core.Vec32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+
+	return dot / math.Sqrt(na*nb)
+}
+
+// same checks that a stored embedding matches the one upserted. Vectors may
+// have been normalized, so only their direction is compared.
+func same(got, want *core.Embedding) error {
+	if got.ID != want.ID {
+		return fmt.Errorf("got ID %q, want %q", got.ID, want.ID)
+	}
+	if got.Content != want.Content {
+		return fmt.Errorf("%s: got content %q, want %q", want.ID, got.Content, want.Content)
+	}
+	if c := cosine(got.Vector, want.Vector); c < 0.999 {
+		return fmt.Errorf("%s: stored vector differs from the upserted one, cosine %.4f", want.ID, c)
+	}
+
+	gotMeta, err := normalize(got.Metadata)
+	if err != nil {
+		return err
+	}
+	wantMeta, err := normalize(want.Metadata)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(gotMeta, wantMeta) {
+		return fmt.Errorf("%s: got metadata %v, want %v", want.ID, gotMeta, wantMeta)
+	}
+
+	return nil
+}
+
+func testAdd(ctx context.Context, store core.MutableVectorStorer) error {
+	contents := []string{
+		"the cat sat on the mat",
+		"a dog barked at the mailman",
+		"stock markets fell sharply",
+	}
+
+	added, err := store.Add(ctx, contents)
+	if err != nil {
+		return err
+	}
+	if len(added) != len(contents) {
+		return fmt.Errorf("added %d embeddings, want %d", len(added), len(contents))
+	}
+
+	seen := map[string]bool{}
+	for i, e := range added {
+		if e.ID == "" || seen[e.ID] {
+			return fmt.Errorf("embedding %d has an empty or duplicate ID %q", i, e.ID)
+		}
+		seen[e.ID] = true
+		if e.Content != contents[i] || len(e.Vector) != Dimensions {
+			return fmt.Errorf("embedding %d has content %q and %d dimensions", i, e.Content, len(e.Vector))
+		}
+	}
+
+	n, err := store.Count(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if n != len(contents) {
+		return fmt.Errorf("counted %d embeddings, want %d", n, len(contents))
+	}
+
+	results, err := store.Search(ctx, &core.SearchParams{Query: "a cat on a mat", Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0].Embedding.Content != contents[0] {
+		return fmt.Errorf("searching for the cat returned %v", ids(results))
+	}
+
+	return nil
+}
+
+func testUpsertGet(ctx context.Context, store core.MutableVectorStorer) error {
+	embeddings := []*core.Embedding{
+		{ID: "a", Vector: vec(0.1), Content: "alpha", Metadata: map[string]interface{}{"lang": "en", "year": 2021, "draft": false, "rating": 4.5}},
+		{ID: "b", Vector: vec(0.5), Content: "beta", Metadata: map[string]interface{}{"lang": "pt"}},
+		{ID: "c", Vector: vec(1.0), Content: "gamma"},
+	}
+	if err := store.Upsert(ctx, embeddings...); err != nil {
+		return err
+	}
+
+	got, err := store.Get(ctx, "c", "unknown", "a", "b")
+	if err != nil {
+		return err
+	}
+	want := []*core.Embedding{embeddings[2], embeddings[0], embeddings[1]}
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d embeddings, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if err := same(got[i], want[i]); err != nil {
+			return err
+		}
+	}
+
+	none, err := store.Get(ctx, "unknown")
+	if err != nil {
+		return err
+	}
+	if len(none) != 0 {
+		return fmt.Errorf("got %d embeddings for an unknown ID", len(none))
+	}
+
+	return nil
+}
+
+func testUpsertReplace(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := store.Upsert(ctx,
+		&core.Embedding{ID: "a", Vector: vec(1.5), Content: "old", Metadata: map[string]interface{}{"version": 1}},
+		&core.Embedding{ID: "b", Vector: vec(0.5), Content: "other"},
+	); err != nil {
+		return err
+	}
+
+	replacement := &core.Embedding{ID: "a", Vector: vec(0), Content: "new", Metadata: map[string]interface{}{"version": 2}}
+	if err := store.Upsert(ctx, replacement); err != nil {
+		return err
+	}
+
+	n, err := store.Count(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if n != 2 {
+		return fmt.Errorf("counted %d embeddings after replacing one, want 2", n)
+	}
+
+	got, err := store.Get(ctx, "a")
+	if err != nil {
+		return err
+	}
+	if len(got) != 1 {
+		return fmt.Errorf("got %d embeddings, want 1", len(got))
+	}
+	if err := same(got[0], replacement); err != nil {
+		return err
+	}
+
+	results, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0].Embedding.ID != "a" || results[0].Embedding.Content != "new" {
+		return fmt.Errorf("search returned %v, want the replaced embedding", ids(results))
+	}
+
+	return nil
+}
+
+// upsertOrdered stores embeddings a to d at increasing angles from vec(0)
+func upsertOrdered(ctx context.Context, store core.MutableVectorStorer) error {
+	return store.Upsert(ctx,
+		&core.Embedding{ID: "c", Vector: vec(1.0), Content: "c"},
+		&core.Embedding{ID: "a", Vector: vec(0.1), Content: "a"},
+		&core.Embedding{ID: "d", Vector: vec(1.5), Content: "d"},
+		&core.Embedding{ID: "b", Vector: vec(0.5), Content: "b"},
+	)
+}
+
+func testSearchOrder(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := upsertOrdered(ctx, store); err != nil {
+		return err
+	}
+
+	results, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 10})
+	if err != nil {
+		return err
+	}
+	if got := strings.Join(ids(results), ","); got != "a,b,c,d" {
+		return fmt.Errorf("search returned %s, want a,b,c,d", got)
+	}
+	for i, r := range results {
+		if i > 0 && r.Score > results[i-1].Score {
+			return fmt.Errorf("scores are not decreasing: %v then %v", results[i-1].Score, r.Score)
+		}
+		if r.Embedding.Content != r.Embedding.ID {
+			return fmt.Errorf("result %s has content %q", r.Embedding.ID, r.Embedding.Content)
+		}
+	}
+
+	limited, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 2})
+	if err != nil {
+		return err
+	}
+	if got := strings.Join(ids(limited), ","); got != "a,b" {
+		return fmt.Errorf("search limited to 2 returned %s, want a,b", got)
+	}
+
+	return nil
+}
+
+func testSearchThreshold(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := upsertOrdered(ctx, store); err != nil {
+		return err
+	}
+
+	all, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 10})
+	if err != nil {
+		return err
+	}
+	if len(all) != 4 {
+		return fmt.Errorf("search returned %d results, want 4", len(all))
+	}
+
+	// between the scores of b and c, whatever the metric
+	threshold := (all[1].Score + all[2].Score) / 2
+	results, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 10, Threshold: threshold})
+	if err != nil {
+		return err
+	}
+	if got := strings.Join(ids(results), ","); got != "a,b" {
+		return fmt.Errorf("search with threshold %v returned %s, want a,b", threshold, got)
+	}
+
+	return nil
+}
+
+func testSearchEmpty(ctx context.Context, store core.MutableVectorStorer) error {
+	results, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 5})
+	if err != nil {
+		return err
+	}
+	if len(results) != 0 {
+		return fmt.Errorf("search of an empty store returned %v", ids(results))
+	}
+
+	n, err := store.Count(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return fmt.Errorf("counted %d embeddings in an empty store", n)
+	}
+
+	got, err := store.Get(ctx, "a")
+	if err != nil {
+		return err
+	}
+	if len(got) != 0 {
+		return fmt.Errorf("got %d embeddings from an empty store", len(got))
+	}
+
+	return nil
+}
+
+// fixture is the metadata filters are checked against. Every document has
+// every field but "team", so that negations agree across stores whatever
+// they make of missing fields.
+var fixture = []*core.Embedding{
+	{ID: "a", Vector: vec(0.1), Content: "a", Metadata: map[string]interface{}{"lang": "en", "year": 2019, "draft": false, "rating": 4.5, "team": "search"}},
+	{ID: "b", Vector: vec(0.3), Content: "b", Metadata: map[string]interface{}{"lang": "en", "year": 2021, "draft": true, "rating": 3}},
+	{ID: "c", Vector: vec(0.5), Content: "c", Metadata: map[string]interface{}{"lang": "pt", "year": 2022, "draft": false, "rating": 4.5, "team": "ops"}},
+	{ID: "d", Vector: vec(0.7), Content: "d", Metadata: map[string]interface{}{"lang": "de", "year": 2020, "draft": false, "rating": 2}},
+	{ID: "e", Vector: vec(0.9), Content: "e", Metadata: map[string]interface{}{"lang": "pt", "year": 2018, "draft": true, "rating": 5}},
+}
+
+func fixtureCopy() []*core.Embedding {
+	out := make([]*core.Embedding, len(fixture))
+	for i, e := range fixture {
+		c := *e
+		c.Vector = append(core.Vec32(nil), e.Vector...)
+		c.Metadata = make(map[string]interface{}, len(e.Metadata))
+		for k, v := range e.Metadata {
+			c.Metadata[k] = v
+		}
+		out[i] = &c
+	}
+
+	return out
+}
+
+// matching returns the IDs of the fixture documents matching filter
+func matching(filter *core.Filter) []string {
+	var out []string
+	for _, e := range fixture {
+		if filter.Match(e.Metadata) {
+			out = append(out, e.ID)
+		}
+	}
+
+	return out
+}
+
+func filters() map[string]*core.Filter {
+	return map[string]*core.Filter{
+		"eq string":     core.Eq("lang", "en"),
+		"eq integer":    core.Eq("year", 2021),
+		"eq fraction":   core.Eq("rating", 4.5),
+		"eq boolean":    core.Eq("draft", true),
+		"in":            core.In("lang", "pt", "de"),
+		"range closed":  core.Range("year", 2019, 2021),
+		"range gt":      {Op: core.FilterRange, Field: "year", Gt: 2020},
+		"range lt":      {Op: core.FilterRange, Field: "rating", Lt: 4},
+		"not":           core.Not(core.Eq("lang", "en")),
+		"and":           core.And(core.Eq("lang", "pt"), core.Range("year", 2020, nil)),
+		"or":            core.Or(core.Eq("lang", "de"), core.Eq("draft", true)),
+		"not or":        core.Not(core.Or(core.Eq("lang", "en"), core.Eq("lang", "de"))),
+		"not range":     core.Not(core.Range("year", 2019, 2021)),
+		"exists":        core.Exists("team"),
+		"unknown field": core.Eq("missing", "x"),
+	}
+}
+
+func testFilters(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := store.Upsert(ctx, fixtureCopy()...); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(filters()))
+	for name := range filters() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		errs        []error
+		unsupported []string
+	)
+	for _, name := range names {
+		filter := filters()[name]
+		want := matching(filter)
+
+		results, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: len(fixture), Filter: filter})
+		if errors.Is(err, vectorstore.ErrUnsupportedFilter) {
+			unsupported = append(unsupported, name)
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if !sameSet(ids(results), want) {
+			errs = append(errs, fmt.Errorf("%s: search returned %v, want %v", name, ids(results), want))
+		}
+
+		n, err := store.Count(ctx, filter)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: count: %w", name, err))
+			continue
+		}
+		if n != len(want) {
+			errs = append(errs, fmt.Errorf("%s: counted %d, want %d", name, n, len(want)))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if len(unsupported) == len(names) {
+		return fmt.Errorf("%w: no filter is supported", ErrSkipped)
+	}
+
+	return nil
+}
+
+func testDelete(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := upsertOrdered(ctx, store); err != nil {
+		return err
+	}
+
+	if err := store.Delete(ctx, "a", "unknown"); err != nil {
+		return err
+	}
+	if err := store.Delete(ctx); err != nil {
+		return err
+	}
+
+	n, err := store.Count(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if n != 3 {
+		return fmt.Errorf("counted %d embeddings after deleting one of 4", n)
+	}
+
+	got, err := store.Get(ctx, "a")
+	if err != nil {
+		return err
+	}
+	if len(got) != 0 {
+		return errors.New("deleted embedding is still returned by Get")
+	}
+
+	results, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Limit: 10})
+	if err != nil {
+		return err
+	}
+	if got := strings.Join(ids(results), ","); got != "b,c,d" {
+		return fmt.Errorf("search after delete returned %s, want b,c,d", got)
+	}
+
+	return nil
+}
+
+func testDeleteWhere(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := store.Upsert(ctx, fixtureCopy()...); err != nil {
+		return err
+	}
+
+	filter := core.Eq("lang", "pt")
+	want := matching(filter)
+
+	n, err := store.DeleteWhere(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if n != len(want) {
+		return fmt.Errorf("deleted %d embeddings, want %d", n, len(want))
+	}
+
+	left, err := store.Count(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if left != len(fixture)-len(want) {
+		return fmt.Errorf("counted %d embeddings after deleting %d of %d", left, n, len(fixture))
+	}
+
+	n, err = store.DeleteWhere(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if n != 0 {
+		return fmt.Errorf("deleted %d embeddings matching nothing", n)
+	}
+
+	return nil
+}
+
+func testInvalidFilter(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := upsertOrdered(ctx, store); err != nil {
+		return err
+	}
+
+	invalid := &core.Filter{Op: "near", Field: "lang"}
+	if _, err := store.Search(ctx, &core.SearchParams{QueryVec: vec(0), Filter: invalid}); !errors.Is(err, core.ErrInvalidFilter) {
+		return fmt.Errorf("search with an invalid filter returned %v, want core.ErrInvalidFilter", err)
+	}
+	if _, err := store.Count(ctx, invalid); !errors.Is(err, core.ErrInvalidFilter) {
+		return fmt.Errorf("count with an invalid filter returned %v, want core.ErrInvalidFilter", err)
+	}
+	if _, err := store.DeleteWhere(ctx, invalid); !errors.Is(err, core.ErrInvalidFilter) {
+		return fmt.Errorf("delete with an invalid filter returned %v, want core.ErrInvalidFilter", err)
+	}
+
+	return nil
+}
+
+func testDimensionMismatch(ctx context.Context, store core.MutableVectorStorer) error {
+	if err := upsertOrdered(ctx, store); err != nil {
+		return err
+	}
+
+	if err := store.Upsert(ctx, &core.Embedding{ID: "wide", Vector: core.Vec32{1, 0, 0, 0, 0}}); err == nil {
+		return errors.New("upserting a vector of another dimension succeeded")
+	}
+	if _, err := store.Search(ctx, &core.SearchParams{QueryVec: core.Vec32{1, 0, 0}}); err == nil {
+		return errors.New("searching with a vector of another dimension succeeded")
+	}
+
+	n, err := store.Count(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if n != 4 {
+		return fmt.Errorf("counted %d embeddings after a rejected upsert, want 4", n)
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+// Package conformance checks that implementations of core.MutableVectorStorer
+// behave alike: the in-repo stores as well as the adapters to external
+// databases, which it runs against their local stand-ins.
+//
+//	suite := conformance.NewSuite(func(ctx context.Context, embedder core.Embedder) (core.MutableVectorStorer, error) {
+//		return memory.NewMemoryVectorStore(embedder), nil
+//	})
+//	if err := conformance.Failures(suite.Run(ctx)); err != nil {
+//		...
+//	}
+//
+// Tests of a store run the cases as subtests with Test.
+//
+// Every case runs against a new, empty store. Filters are checked against
+// core.Filter.Match over the same metadata, so that stores agree with the
+// reference semantics; filters a store reports as unsupported with
+// vectorstore.ErrUnsupportedFilter are skipped rather than failed.
+package conformance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/embedder"
+)
+
+// ErrSkipped is returned by cases that do not apply to a store
+var ErrSkipped = errors.New("case skipped")
+
+// Dimensions of the vectors of the embedder passed to factories
+const Dimensions = 64
+
+// Factory returns a new, empty store using embedder to embed contents.
+// Stores of external databases must use a collection or table of their own
+// per call.
+type Factory func(ctx context.Context, embedder core.Embedder) (core.MutableVectorStorer, error)
+
+// Case is a check of the behavior of a store
+type Case struct {
+	Name string
+	Run  func(ctx context.Context, store core.MutableVectorStorer) error
+}
+
+// Result is the outcome of a case
+type Result struct {
+	Case     string
+	Err      error
+	Skipped  bool
+	Duration time.Duration
+}
+
+// Suite runs the cases against stores returned by a factory
+type Suite struct {
+	factory  Factory
+	embedder core.Embedder
+	cases    []*Case
+	skip     map[string]bool
+	logger   *logr.Logger
+}
+
+// SuiteConfig holds configuration for a Suite
+type SuiteConfig struct {
+	// Cases to run
+	// default Cases()
+	Cases []*Case
+
+	// Skip names cases not to run, for behaviors a store documents as
+	// different
+	// default none
+	Skip []string
+
+	// Logger reports the outcome of every case
+	// default discard
+	Logger *logr.Logger
+}
+
+// SuiteConfigFunc is a function type that modifies SuiteConfig
+type SuiteConfigFunc func(*SuiteConfig)
+
+func WithCases(cases ...*Case) SuiteConfigFunc {
+	return func(conf *SuiteConfig) {
+		conf.Cases = cases
+	}
+}
+
+func WithSkip(names ...string) SuiteConfigFunc {
+	return func(conf *SuiteConfig) {
+		conf.Skip = append(conf.Skip, names...)
+	}
+}
+
+func WithLogger(logger *logr.Logger) SuiteConfigFunc {
+	return func(conf *SuiteConfig) {
+		conf.Logger = logger
+	}
+}
+
+// NewSuite returns a new Suite over the stores of factory
+func NewSuite(factory Factory, opts ...SuiteConfigFunc) *Suite {
+	discard := logr.Discard()
+	conf := &SuiteConfig{
+		Cases:  Cases(),
+		Logger: &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	skip := make(map[string]bool, len(conf.Skip))
+	for _, name := range conf.Skip {
+		skip[name] = true
+	}
+
+	return &Suite{
+		factory:  factory,
+		embedder: embedder.NewHashingEmbedder(embedder.WithDimensions(Dimensions)),
+		cases:    conf.Cases,
+		skip:     skip,
+		logger:   conf.Logger,
+	}
+}
+
+// Run runs every case against a new store, closed once the case is done
+func (s *Suite) Run(ctx context.Context) []*Result {
+	results := make([]*Result, 0, len(s.cases))
+	for _, c := range s.cases {
+		result := &Result{Case: c.Name}
+		results = append(results, result)
+
+		if s.skip[c.Name] {
+			result.Skipped = true
+			continue
+		}
+
+		start := time.Now()
+		result.Err = s.run(ctx, c)
+		result.Duration = time.Since(start)
+		if errors.Is(result.Err, ErrSkipped) {
+			result.Skipped = true
+		}
+
+		switch {
+		case result.Skipped:
+			s.logger.Info("case skipped", "case", c.Name, "reason", result.Err)
+		case result.Err != nil:
+			s.logger.Info("case failed", "case", c.Name, "error", result.Err.Error())
+		default:
+			s.logger.V(1).Info("case passed", "case", c.Name, "duration", result.Duration)
+		}
+	}
+
+	return results
+}
+
+func (s *Suite) run(ctx context.Context, c *Case) error {
+	store, err := s.factory(ctx, s.embedder)
+	if err != nil {
+		return fmt.Errorf("error creating store: %w", err)
+	}
+	defer store.Close()
+
+	return c.Run(ctx, store)
+}
+
+// Failures joins the errors of the failed cases, nil when none failed
+func Failures(results []*Result) error {
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil && !r.Skipped {
+			errs = append(errs, fmt.Errorf("%s: %w", r.Case, r.Err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,26 @@
+package conformance
+
+import (
+	"context"
+	"testing"
+)
+
+// Test runs every case as a subtest of t, for stores to call from their own
+// tests. Cases excluded by opts or not applying to the store are skipped.
+func Test(t *testing.T, factory Factory, opts ...SuiteConfigFunc) {
+	t.Helper()
+
+	for _, c := range Cases() {
+		t.Run(c.Name, func(t *testing.T) {
+			result := NewSuite(factory, append(opts, WithCases(c))...).Run(context.Background())[0]
+			switch {
+			case result.Skipped && result.Err == nil:
+				t.Skip("case skipped")
+			case result.Skipped:
+				t.Skip(result.Err)
+			case result.Err != nil:
+				t.Fatal(result.Err)
+			}
+		})
+	}
+}
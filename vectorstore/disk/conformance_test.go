@@ -0,0 +1,17 @@
+package disk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	factory := func(ctx context.Context, embedder core.Embedder) (core.MutableVectorStorer, error) {
+		return NewDiskVectorStore(t.TempDir(), embedder, WithSyncWrites(false))
+	}
+
+	conformance.Test(t, factory)
+}
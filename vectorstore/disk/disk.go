@@ -0,0 +1,702 @@
+// Package disk provides a core.VectorStorer persisting embeddings, their
+// contents and the HNSW graph indexing them to a directory, so that a
+// process restart neither re-embeds the corpus nor rebuilds the index.
+//
+// Changes are appended to a write-ahead log as they are made and folded into
+// a snapshot of the whole index by Snapshot, by Close, or once the log grows
+// past a configured number of records. At startup the snapshot is memory
+// mapped and its vectors are used in place; see format.go for the layout of
+// both files.
+//
+// A directory must be opened by a single DiskVectorStore at a time.
+package disk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/hnsw"
+	"github.com/joaopandolfi/core/vectorstore/quant"
+)
+
+// ErrClosed is returned for operations on a closed store
+var ErrClosed = errors.New("vector store is closed")
+
+// DiskVectorStore implements core.VectorStorer with an HNSW index persisted
+// to a directory.
+//
+// Changes are logged and applied to the index one at a time, in the same
+// order; searches run concurrently with them.
+//
+// Vectors of embeddings loaded from a snapshot are backed by the mapped file,
+// read only; Search and Get return copies of them, which callers may modify
+// and keep after Close. Under the cosine metric embeddings are stored with
+// unit length vectors, which leaves their scores unchanged.
+type DiskVectorStore struct {
+	dir           string
+	embedder      core.Embedder
+	metric        vectorstore.Metric
+	snapshotEvery int
+	logger        *logr.Logger
+
+	// mu is held shared by every operation and exclusively while the index
+	// is written to a snapshot or closed, so that no logged change is
+	// missing from the snapshot that truncates the log
+	mu       sync.RWMutex
+	index    *hnsw.HNSWVectorStore
+	mappings []*mapping
+	closed   bool
+
+	// walMu orders changes: a change is appended to the log and applied to
+	// the index under it, so that the index sees changes in the order a
+	// replay of the log does
+	walMu sync.Mutex
+	wal   *wal
+	dim   int
+
+	// quantizer is the configured quantizer, or the one restored from the
+	// snapshot
+	quantizer quant.Quantizer
+}
+
+// DiskVectorStoreConfig holds configuration for a DiskVectorStore
+type DiskVectorStoreConfig struct {
+	// Metric used to compare vectors. A store reopened from a snapshot keeps
+	// the metric it was created with.
+	// default vectorstore.Cosine
+	Metric vectorstore.Metric
+
+	// M, EfConstruction and EfSearch configure the HNSW index, see the hnsw
+	// package. A store reopened from a snapshot keeps its M.
+	// default 16, 200 and 64
+	M              int
+	EfConstruction int
+	EfSearch       int
+
+	// SyncWrites syncs the log to disk after every change. Without it a
+	// crash of the machine, but not of the process, may lose the latest
+	// changes.
+	// default true
+	SyncWrites bool
+
+	// SnapshotEvery is the number of log records after which a change
+	// triggers a snapshot. Zero leaves snapshots to Snapshot and Close.
+	// default 50000
+	SnapshotEvery int
+
+	// VerifyChecksum checks the checksum of the snapshot when opening the
+	// store, which reads the whole file
+	// default false
+	VerifyChecksum bool
+
+	// Quantizer compresses the vectors the index is traversed with, so that
+	// only codes need to fit in memory: the float vectors of a reopened
+	// store stay in the memory mapped snapshot, read to rescore the
+	// candidates of a search. An untrained quantizer is trained on the
+	// stored vectors when the store is opened. The trained quantizer is
+	// saved in the snapshot, and a reopened store uses a copy of the saved
+	// one rather than the configured one.
+	// default nil, vectors are traversed as float32
+	Quantizer quant.Quantizer
+
+	// Rescore, with a Quantizer, sets the number of candidates rescored to
+	// max(EfSearch, Limit × Rescore)
+	// default 1
+	Rescore int
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// DiskVectorStoreConfigFunc is a function type that modifies DiskVectorStoreConfig
+type DiskVectorStoreConfigFunc func(*DiskVectorStoreConfig)
+
+func WithMetric(m vectorstore.Metric) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.Metric = m
+	}
+}
+
+func WithM(m int) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.M = m
+	}
+}
+
+func WithEfConstruction(ef int) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.EfConstruction = ef
+	}
+}
+
+func WithEfSearch(ef int) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.EfSearch = ef
+	}
+}
+
+func WithSyncWrites(sync bool) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.SyncWrites = sync
+	}
+}
+
+func WithSnapshotEvery(records int) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.SnapshotEvery = records
+	}
+}
+
+func WithVerifyChecksum(verify bool) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.VerifyChecksum = verify
+	}
+}
+
+func WithQuantizer(q quant.Quantizer) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.Quantizer = q
+	}
+}
+
+func WithRescore(factor int) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.Rescore = factor
+	}
+}
+
+func WithLogger(l *logr.Logger) DiskVectorStoreConfigFunc {
+	return func(conf *DiskVectorStoreConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewDiskVectorStore opens the store kept in dir, creating it if needed, and
+// embeds contents with the given embedder
+func NewDiskVectorStore(dir string, embedder core.Embedder, opts ...DiskVectorStoreConfigFunc) (*DiskVectorStore, error) {
+	discard := logr.Discard()
+	conf := &DiskVectorStoreConfig{
+		Metric:         vectorstore.Cosine,
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+		SyncWrites:     true,
+		SnapshotEvery:  50000,
+		Rescore:        1,
+		Logger:         &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+
+	s := &DiskVectorStore{
+		dir:           dir,
+		embedder:      embedder,
+		snapshotEvery: conf.SnapshotEvery,
+		logger:        conf.Logger,
+	}
+
+	var (
+		g          *hnsw.Graph
+		generation uint64
+	)
+	s.metric = conf.Metric
+	s.quantizer = conf.Quantizer
+
+	m, err := mapFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("error opening snapshot: %w", err)
+	default:
+		s.mappings = append(s.mappings, m)
+
+		var h *header
+		g, h, err = decodeSnapshot(m.data, conf.VerifyChecksum)
+		if err != nil {
+			s.unmap()
+			return nil, fmt.Errorf("error loading snapshot: %w", err)
+		}
+
+		if h.metric != conf.Metric {
+			s.logger.Info("Store keeps the metric of its snapshot", "metric", h.metric, "configured", conf.Metric)
+		}
+
+		// a quantizer of its own, leaving the configured one untouched
+		if conf.Quantizer != nil && len(h.quantizer) > 0 {
+			s.quantizer, err = quant.Unmarshal(h.quantizer)
+			if err != nil {
+				s.unmap()
+				return nil, fmt.Errorf("error loading snapshot quantizer: %w", err)
+			}
+		}
+
+		s.metric = h.metric
+		s.dim = h.dim
+		generation = h.generation
+	}
+
+	w, entries, err := openWAL(filepath.Join(dir, walFile), generation, conf.SyncWrites)
+	if err != nil {
+		s.unmap()
+		return nil, err
+	}
+	s.wal = w
+
+	// an untrained quantizer is trained on the vectors of the snapshot and
+	// of the log
+	if q := s.quantizer; q != nil && !q.Trained() {
+		var sample []core.Vec32
+		if g != nil {
+			for _, n := range g.Nodes {
+				if !n.Deleted {
+					sample = append(sample, n.Embedding.Vector)
+				}
+			}
+		}
+		for _, e := range entries {
+			if e.op == opAdd {
+				sample = append(sample, e.embedding.Vector)
+			}
+		}
+		if len(sample) > 0 {
+			if err := q.Train(quant.Sample(sample, 50000, 1)); err != nil {
+				w.close()
+				s.unmap()
+				return nil, fmt.Errorf("error training quantizer: %w", err)
+			}
+		}
+	}
+
+	indexOpts := []hnsw.HNSWVectorStoreConfigFunc{
+		hnsw.WithEfConstruction(conf.EfConstruction),
+		hnsw.WithEfSearch(conf.EfSearch),
+	}
+	if s.quantizer != nil {
+		// the vectors of the embeddings are always kept, for the snapshot
+		indexOpts = append(indexOpts, hnsw.WithQuantizer(s.quantizer), hnsw.WithRescore(max(conf.Rescore, 1)))
+	}
+
+	if g == nil {
+		s.index = hnsw.NewHNSWVectorStore(embedder, append(indexOpts, hnsw.WithMetric(conf.Metric), hnsw.WithM(conf.M))...)
+	} else if s.index, err = hnsw.Import(embedder, g, indexOpts...); err != nil {
+		w.close()
+		s.unmap()
+		return nil, fmt.Errorf("error loading snapshot: %w", err)
+	}
+
+	if err := s.replay(entries); err != nil {
+		w.close()
+		s.unmap()
+		return nil, fmt.Errorf("error replaying log: %w", err)
+	}
+
+	// records of the current version cannot be appended to an older log
+	if w.version < walVersion {
+		if err := s.snapshot(); err != nil {
+			w.close()
+			s.unmap()
+			return nil, fmt.Errorf("error upgrading store: %w", err)
+		}
+	}
+
+	s.logger.Info("Opened vector store", "dir", dir, "embeddings", s.index.Len(), "replayed", len(entries))
+
+	return s, nil
+}
+
+func (s *DiskVectorStore) replay(entries []*walEntry) error {
+	ctx := context.Background()
+	for _, e := range entries {
+		switch e.op {
+		case opAdd:
+			if s.dim == 0 {
+				s.dim = len(e.embedding.Vector)
+			}
+			if err := s.index.AddEmbeddings(ctx, e.embedding); err != nil {
+				return err
+			}
+		case opDelete:
+			if err := s.index.Delete(ctx, e.ids...); err != nil {
+				return err
+			}
+		case opDeleteWhere:
+			if _, err := s.index.DeleteWhere(ctx, e.filter); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Add embeds and stores contents
+func (s *DiskVectorStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := vectorstore.Embed(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.AddEmbeddings(ctx, embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// AddEmbeddings stores embeddings computed elsewhere. Embeddings without an ID
+// get a random one, and an embedding whose ID is already stored replaces the
+// previous one. Once logged, the embeddings are inserted even if ctx is
+// cancelled.
+func (s *DiskVectorStore) AddEmbeddings(ctx context.Context, embeddings ...*core.Embedding) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	stored := make([]*core.Embedding, len(embeddings))
+	for i, e := range embeddings {
+		if len(e.Vector) == 0 {
+			return errors.New("embedding has no vector")
+		}
+		if e.ID == "" {
+			e.ID = vectorstore.NewID()
+		}
+
+		stored[i] = e
+		if s.metric == vectorstore.Cosine {
+			c := *e
+			c.Vector = vectorstore.Normalize(e.Vector)
+			stored[i] = &c
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	full, err := s.add(ctx, stored)
+	if err != nil {
+		return err
+	}
+
+	if full {
+		go s.snapshotIfFull()
+	}
+
+	return nil
+}
+
+// add logs and inserts embeddings, reporting whether the log is due for a
+// snapshot. It must be called with mu held.
+func (s *DiskVectorStore) add(ctx context.Context, stored []*core.Embedding) (bool, error) {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	dim := s.dim
+	for _, e := range stored {
+		if dim == 0 {
+			dim = len(e.Vector)
+		}
+		if len(e.Vector) != dim {
+			return false, fmt.Errorf("%w: got %d, want %d", vectorstore.ErrDimensionMismatch, len(e.Vector), dim)
+		}
+	}
+
+	if err := s.wal.appendAdd(stored); err != nil {
+		return false, err
+	}
+	s.dim = dim
+
+	if err := s.index.AddEmbeddings(context.WithoutCancel(ctx), stored...); err != nil {
+		return false, err
+	}
+
+	return s.snapshotEvery > 0 && s.wal.records >= s.snapshotEvery, nil
+}
+
+// Search returns the approximate Limit nearest embeddings to the query, best
+// first, leaving out those scoring below Threshold and those not matching
+// Filter
+func (s *DiskVectorStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	results, err := s.index.Search(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		r.Embedding = detach(r.Embedding)
+	}
+
+	return results, nil
+}
+
+// detach copies an embedding of the index with its vector, so that it no
+// longer refers to a mapped snapshot
+func detach(e *core.Embedding) *core.Embedding {
+	c := *e
+	c.Vector = slices.Clone(e.Vector)
+
+	return &c
+}
+
+// Delete removes the embeddings with the given IDs. Unknown IDs are ignored.
+func (s *DiskVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+
+	if err := s.wal.appendDelete(ids); err != nil {
+		return err
+	}
+
+	return s.index.Delete(context.WithoutCancel(ctx), ids...)
+}
+
+// Upsert stores embeddings, embedding the content of those without a vector
+func (s *DiskVectorStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	if err := vectorstore.EmbedMissing(ctx, s.embedder, embeddings); err != nil {
+		return err
+	}
+
+	return s.AddEmbeddings(ctx, embeddings...)
+}
+
+// DeleteWhere removes the embeddings matching filter. Changes wait for it to
+// complete, so that replaying the log deletes the same embeddings.
+func (s *DiskVectorStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+
+	if err := s.wal.appendDeleteWhere(filter); err != nil {
+		return 0, err
+	}
+
+	return s.index.DeleteWhere(context.WithoutCancel(ctx), filter)
+}
+
+// Get returns the stored embeddings with the given IDs
+func (s *DiskVectorStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+
+	embeddings, err := s.index.Get(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range embeddings {
+		embeddings[i] = detach(e)
+	}
+
+	return embeddings, nil
+}
+
+// Count returns the number of stored embeddings matching filter
+func (s *DiskVectorStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+
+	return s.index.Count(ctx, filter)
+}
+
+// Len returns the number of stored embeddings
+func (s *DiskVectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return 0
+	}
+
+	return s.index.Len()
+}
+
+// Snapshot writes the whole index to the snapshot file and empties the log.
+// Changes wait for it to complete.
+func (s *DiskVectorStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	return s.snapshot()
+}
+
+func (s *DiskVectorStore) snapshotIfFull() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// another change may have triggered the snapshot already
+	if s.closed || s.wal.records < s.snapshotEvery {
+		return
+	}
+
+	if err := s.snapshot(); err != nil {
+		s.logger.Error(err, "Error writing snapshot", "dir", s.dir)
+	}
+}
+
+// snapshot must be called with mu held exclusively
+func (s *DiskVectorStore) snapshot() error {
+	generation := s.wal.generation + 1
+	var quantizer []byte
+	if s.quantizer != nil && s.quantizer.Trained() {
+		var err error
+		if quantizer, err = s.quantizer.MarshalBinary(); err != nil {
+			return fmt.Errorf("error encoding quantizer: %w", err)
+		}
+	}
+
+	if err := writeSnapshot(filepath.Join(s.dir, snapshotFile), s.index.Export(), quantizer, s.dim, generation); err != nil {
+		return err
+	}
+	syncDir(s.dir)
+
+	// from here the log is stale, whether or not resetting it succeeds
+	if err := s.wal.reset(generation); err != nil {
+		return fmt.Errorf("error resetting log: %w", err)
+	}
+
+	s.logger.V(1).Info("Wrote snapshot", "dir", s.dir, "generation", generation)
+
+	return nil
+}
+
+// Close writes a snapshot if the log holds changes and releases the files
+// of the store
+func (s *DiskVectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	if s.wal.records > 0 {
+		errs = append(errs, s.snapshot())
+	}
+
+	errs = append(errs, s.wal.close(), s.index.Close())
+	s.unmap()
+
+	return errors.Join(errs...)
+}
+
+func (s *DiskVectorStore) unmap() {
+	for _, m := range s.mappings {
+		if err := m.close(); err != nil {
+			s.logger.Error(err, "Error unmapping snapshot", "dir", s.dir)
+		}
+	}
+	s.mappings = nil
+}
+
+// syncDir makes a rename in dir durable. It is best effort: not every
+// platform can sync a directory.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	d.Sync()
+	d.Close()
+}
+
+// NewCollections returns a core.CollectionManager keeping each collection in
+// its own store, in a sub directory of dir named after the collection and
+// configured with opts. A Quantizer in opts is shared by the stores, which
+// cannot train it: it must be trained beforehand, on vectors representative
+// of every collection, and opening a collection fails otherwise.
+func NewCollections(dir string, embedder core.Embedder, opts ...DiskVectorStoreConfigFunc) *vectorstore.Collections {
+	conf := &DiskVectorStoreConfig{}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	open := func(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+		if conf.Quantizer != nil && !conf.Quantizer.Trained() {
+			return nil, fmt.Errorf("%w: collections share their quantizer, which must be trained beforehand", quant.ErrNotTrained)
+		}
+
+		return NewDiskVectorStore(filepath.Join(dir, name), embedder, opts...)
+	}
+
+	list := func(ctx context.Context) ([]string, error) {
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var names []string
+		for _, e := range entries {
+			if e.IsDir() && vectorstore.ValidateCollection(e.Name()) == nil {
+				names = append(names, e.Name())
+			}
+		}
+
+		return names, nil
+	}
+
+	drop := func(ctx context.Context, name string) error {
+		return os.RemoveAll(filepath.Join(dir, name))
+	}
+
+	return vectorstore.NewCollections(open, vectorstore.WithList(list), vectorstore.WithDrop(drop))
+}
@@ -0,0 +1,225 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/bench"
+	"github.com/joaopandolfi/core/vectorstore/quant"
+)
+
+// copyDir copies the files of a store, as a crash would leave them
+func copyDir(t *testing.T, src string) string {
+	t.Helper()
+
+	dst := t.TempDir()
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(src, e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dst, e.Name()), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dst
+}
+
+func TestConcurrentChangesReplayInOrder(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewDiskVectorStore(dir, nil, WithSyncWrites(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ids := []string{"a", "b"}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				id := ids[(w+i)%len(ids)]
+				if (w+i)%3 == 0 {
+					if err := s.Delete(ctx, id); err != nil {
+						t.Error(err)
+					}
+					continue
+				}
+
+				e := &core.Embedding{ID: id, Vector: core.Vec32{1, float32(w), float32(i), 1}, Content: fmt.Sprint(w, i)}
+				if err := s.Upsert(ctx, e); err != nil {
+					t.Error(err)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	want, err := s.Get(ctx, ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the log alone must rebuild the same embeddings
+	replayed, err := NewDiskVectorStore(copyDir(t, dir), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayed.Close()
+
+	got, err := replayed.Get(ctx, ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("replayed %d embeddings, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID || got[i].Content != want[i].Content {
+			t.Errorf("replayed %s %q, want %s %q", got[i].ID, got[i].Content, want[i].ID, want[i].Content)
+		}
+	}
+}
+
+func TestQuantizerSavedInSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	data := bench.RandomVectors(300, 16, 1)
+
+	s, err := NewDiskVectorStore(dir, nil, WithSyncWrites(false), WithQuantizer(quant.NewScalarQuantizer()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddEmbeddings(ctx, data...); !errors.Is(err, quant.ErrNotTrained) {
+		t.Fatalf("adding to a store with an untrained quantizer: got %v", err)
+	}
+
+	trained := quant.NewScalarQuantizer()
+	vectors := make([]core.Vec32, len(data))
+	for i, e := range data {
+		vectors[i] = e.Vector
+	}
+	if err := trained.Train(vectors); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := trained.MarshalBinary()
+
+	s.Close()
+	s, err = NewDiskVectorStore(dir, nil, WithSyncWrites(false), WithQuantizer(trained))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddEmbeddings(ctx, data...); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a reopened store restores the saved quantizer, the configured one is
+	// left untrained
+	configured := quant.NewScalarQuantizer()
+	s, err = NewDiskVectorStore(dir, nil, WithQuantizer(configured))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if configured.Trained() {
+		t.Error("the configured quantizer was trained")
+	}
+	got, err := s.quantizer.MarshalBinary()
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("restored quantizer differs from the saved one: %v", err)
+	}
+
+	results, err := s.Search(ctx, &core.SearchParams{QueryVec: data[7].Vector, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Embedding.ID != data[7].ID {
+		t.Errorf("search of a stored vector did not find it first")
+	}
+}
+
+func TestCollectionsNeedTrainedQuantizer(t *testing.T) {
+	ctx := context.Background()
+
+	c := NewCollections(t.TempDir(), nil, WithQuantizer(quant.NewScalarQuantizer()))
+	defer c.Close()
+
+	if _, err := c.Collection(ctx, "docs"); !errors.Is(err, quant.ErrNotTrained) {
+		t.Errorf("got %v, want ErrNotTrained", err)
+	}
+}
+
+func TestReturnedVectorsOutliveSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewDiskVectorStore(dir, nil, WithMetric(vectorstore.L2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(ctx, &core.Embedding{ID: "a", Vector: core.Vec32{1, 2, 3}}, &core.Embedding{ID: "b", Vector: core.Vec32{4, 5, 6}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// vectors of the reopened store are read from the mapped snapshot
+	s, err = NewDiskVectorStore(dir, nil, WithMetric(vectorstore.L2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := s.Search(ctx, &core.SearchParams{QueryVec: core.Vec32{1, 2, 3}, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get(ctx, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || len(got) != 1 {
+		t.Fatalf("got %d results and %d embeddings", len(results), len(got))
+	}
+
+	// writing to returned vectors changes neither the store nor the file
+	results[0].Embedding.Vector[0] = 100
+	got[0].Vector[0] = 100
+
+	again, err := s.Get(ctx, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Vector[0] != 1 || again[1].Vector[0] != 4 {
+		t.Errorf("stored vectors changed to %v and %v", again[0].Vector, again[1].Vector)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(results[0].Embedding.Vector, results[1].Embedding.Vector, got[0].Vector) != "[100 2 3] [4 5 6] [100 5 6]" {
+		t.Errorf("got %v, %v and %v after Close", results[0].Embedding.Vector, results[1].Embedding.Vector, got[0].Vector)
+	}
+}
@@ -0,0 +1,524 @@
+package disk
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"unsafe"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/hnsw"
+)
+
+// A store directory holds two files, a snapshot of the whole index and a
+// write-ahead log of the changes made since. Integers are little endian.
+//
+// The snapshot, snapshot.vec, is rewritten in full by Snapshot:
+//
+//	header, 64 bytes
+//	   0  magic       [4]byte  "CVEC"
+//	   4  version     uint32   3
+//	   8  metric      uint32   vectorstore.Metric
+//	  12  dim         uint32
+//	  16  count       uint64   number of nodes, deleted ones included
+//	  24  generation  uint64   generation of the log following the snapshot
+//	  32  entry       int64    entry point of the graph, -1 when empty
+//	  40  maxLevel    uint32   top layer of the graph
+//	  44  m           uint32   HNSW M parameter
+//	  48  recordsOff  uint64   offset of the records section
+//	  56  graphOff    uint64   offset of the graph section
+//	vectors, at offset 64: count × dim float32, node by node
+//	records, one per node:
+//	  flags       uint8    bit 0 set for deleted nodes
+//	  idLen       uvarint
+//	  id          [idLen]byte
+//	  contentLen  uvarint
+//	  content     [contentLen]byte
+//	  metaLen     uvarint  0 without metadata, absent in version 1
+//	  metadata    [metaLen]byte, JSON object
+//	graph, one entry per node:
+//	  levels      uvarint  number of layers the node is on
+//	  per layer:
+//	    n         uvarint
+//	    friends   n × uint32, node indexes
+//	quantizer, absent before version 3:
+//	  quantLen    uvarint  0 without a trained quantizer
+//	  quantizer   [quantLen]byte, quant.Quantizer.MarshalBinary
+//	trailer:
+//	  checksum    uint32   CRC-32C of everything before it
+//
+// The vectors section sits right after the 64 byte header so that, once the
+// file is memory mapped, vectors are used in place without being decoded.
+//
+// The log, wal.log, starts with a 16 byte header:
+//
+//	0  magic       [4]byte  "CWAL"
+//	4  version     uint32   2
+//	8  generation  uint64
+//
+// followed by records:
+//
+//	length    uint32   length of the payload
+//	checksum  uint32   CRC-32C of the payload
+//	payload:
+//	  op      uint8    1 add, 2 delete, 3 delete where
+//	  add:    idLen uvarint, id, contentLen uvarint, content,
+//	          metaLen uvarint, metadata (version 2 only),
+//	          dim uvarint, dim × float32
+//	  delete: n uvarint, then n × (idLen uvarint, id)
+//	  delete where: filterLen uvarint, filter, JSON core.Filter
+//
+// A log applies on top of the snapshot with the same generation. A log with
+// an older generation was already folded into the snapshot and is dropped.
+//
+// Files of older versions are read, and rewritten in the current versions by
+// the next snapshot.
+// Metadata goes through JSON, so numbers come back as float64 and times as
+// RFC 3339 strings, both of which filters compare as before.
+const (
+	snapshotFile = "snapshot.vec"
+	walFile      = "wal.log"
+
+	snapshotMagic   = "CVEC"
+	walMagic        = "CWAL"
+	snapshotVersion = 3
+	walVersion      = 2
+	headerSize      = 64
+	walHeaderSize   = 16
+	walRecordHeader = 8
+
+	flagDeleted = 1 << 0
+
+	opAdd         = 1
+	opDelete      = 2
+	opDeleteWhere = 3
+)
+
+// ErrCorrupt is returned for snapshots that fail validation
+var ErrCorrupt = errors.New("corrupt snapshot")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// littleEndian reports whether the host stores floats the way the format
+// does, in which case mapped vectors need no decoding
+var littleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+type header struct {
+	version    uint32
+	metric     vectorstore.Metric
+	dim        int
+	count      int
+	generation uint64
+	entry      int64
+	maxLevel   int
+	m          int
+	recordsOff uint64
+	graphOff   uint64
+
+	// quantizer holds the quantizer section, which follows the graph
+	quantizer []byte
+}
+
+func (h *header) encode() []byte {
+	b := make([]byte, headerSize)
+	copy(b, snapshotMagic)
+	binary.LittleEndian.PutUint32(b[4:], snapshotVersion)
+	binary.LittleEndian.PutUint32(b[8:], uint32(h.metric))
+	binary.LittleEndian.PutUint32(b[12:], uint32(h.dim))
+	binary.LittleEndian.PutUint64(b[16:], uint64(h.count))
+	binary.LittleEndian.PutUint64(b[24:], h.generation)
+	binary.LittleEndian.PutUint64(b[32:], uint64(h.entry))
+	binary.LittleEndian.PutUint32(b[40:], uint32(h.maxLevel))
+	binary.LittleEndian.PutUint32(b[44:], uint32(h.m))
+	binary.LittleEndian.PutUint64(b[48:], h.recordsOff)
+	binary.LittleEndian.PutUint64(b[56:], h.graphOff)
+
+	return b
+}
+
+func decodeHeader(b []byte) (*header, error) {
+	if len(b) < headerSize+4 {
+		return nil, fmt.Errorf("%w: file is too short", ErrCorrupt)
+	}
+	if string(b[:4]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrCorrupt)
+	}
+	version := binary.LittleEndian.Uint32(b[4:])
+	if version < 1 || version > snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", version)
+	}
+
+	h := &header{
+		version:    version,
+		metric:     vectorstore.Metric(binary.LittleEndian.Uint32(b[8:])),
+		dim:        int(binary.LittleEndian.Uint32(b[12:])),
+		count:      int(binary.LittleEndian.Uint64(b[16:])),
+		generation: binary.LittleEndian.Uint64(b[24:]),
+		entry:      int64(binary.LittleEndian.Uint64(b[32:])),
+		maxLevel:   int(binary.LittleEndian.Uint32(b[40:])),
+		m:          int(binary.LittleEndian.Uint32(b[44:])),
+		recordsOff: binary.LittleEndian.Uint64(b[48:]),
+		graphOff:   binary.LittleEndian.Uint64(b[56:]),
+	}
+
+	body := uint64(len(b) - 4)
+	vectorsEnd := uint64(headerSize) + uint64(h.count)*uint64(h.dim)*4
+	if h.count < 0 || vectorsEnd != h.recordsOff || h.recordsOff > h.graphOff || h.graphOff > body {
+		return nil, fmt.Errorf("%w: inconsistent section offsets", ErrCorrupt)
+	}
+
+	return h, nil
+}
+
+// writeSnapshot writes g and the data of its quantizer, if any, to path
+// through a temporary file renamed into place, so that a crash leaves either
+// the old or the new snapshot
+func writeSnapshot(path string, g *hnsw.Graph, quantizer []byte, dim int, generation uint64) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	if err := encodeSnapshot(f, g, quantizer, dim, generation); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("error syncing snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error replacing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func encodeSnapshot(w io.Writer, g *hnsw.Graph, quantizer []byte, dim int, generation uint64) error {
+	crc := crc32.New(castagnoli)
+	bw := bufio.NewWriterSize(io.MultiWriter(w, crc), 1<<20)
+
+	recordsOff := uint64(headerSize) + uint64(len(g.Nodes))*uint64(dim)*4
+	metadata := make([][]byte, len(g.Nodes))
+	recordsLen := uint64(0)
+	for i, n := range g.Nodes {
+		meta, err := encodeMetadata(n.Embedding.Metadata)
+		if err != nil {
+			return fmt.Errorf("error encoding metadata of %q: %w", n.Embedding.ID, err)
+		}
+
+		metadata[i] = meta
+		recordsLen += 1 + stringLen(n.Embedding.ID) + stringLen(n.Embedding.Content) + bytesLen(meta)
+	}
+
+	h := &header{
+		metric:     g.Metric,
+		dim:        dim,
+		count:      len(g.Nodes),
+		generation: generation,
+		entry:      g.Entry,
+		maxLevel:   g.MaxLevel,
+		m:          g.M,
+		recordsOff: recordsOff,
+		graphOff:   recordsOff + recordsLen,
+	}
+	bw.Write(h.encode())
+
+	buf := make([]byte, 0, dim*4)
+	for _, n := range g.Nodes {
+		buf = appendVector(buf[:0], n.Embedding.Vector)
+		bw.Write(buf)
+	}
+
+	for i, n := range g.Nodes {
+		flags := byte(0)
+		if n.Deleted {
+			flags |= flagDeleted
+		}
+
+		buf = append(buf[:0], flags)
+		buf = appendString(buf, n.Embedding.ID)
+		buf = appendString(buf, n.Embedding.Content)
+		buf = appendBytes(buf, metadata[i])
+		bw.Write(buf)
+	}
+
+	for _, n := range g.Nodes {
+		buf = binary.AppendUvarint(buf[:0], uint64(len(n.Friends)))
+		for _, friends := range n.Friends {
+			buf = binary.AppendUvarint(buf, uint64(len(friends)))
+			for _, f := range friends {
+				buf = binary.LittleEndian.AppendUint32(buf, f)
+			}
+		}
+		bw.Write(buf)
+	}
+
+	bw.Write(appendBytes(buf[:0], quantizer))
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32()))
+	return err
+}
+
+// decodeSnapshot parses a snapshot held in data. Vectors alias data when the
+// host byte order allows it; IDs and contents are copied.
+func decodeSnapshot(data []byte, verify bool) (*hnsw.Graph, *header, error) {
+	h, err := decodeHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := data[:len(data)-4]
+	if verify {
+		if crc32.Checksum(body, castagnoli) != binary.LittleEndian.Uint32(data[len(body):]) {
+			return nil, nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+		}
+	}
+
+	g := &hnsw.Graph{
+		Metric:   h.metric,
+		M:        h.m,
+		Entry:    h.entry,
+		MaxLevel: h.maxLevel,
+		Nodes:    make([]*hnsw.GraphNode, h.count),
+	}
+
+	vectors := data[headerSize:h.recordsOff]
+	for i := range g.Nodes {
+		g.Nodes[i] = &hnsw.GraphNode{
+			Embedding: &core.Embedding{Vector: vectorAt(vectors, i, h.dim)},
+		}
+	}
+
+	r := &reader{b: body[h.recordsOff:h.graphOff]}
+	for _, n := range g.Nodes {
+		n.Deleted = r.byte()&flagDeleted != 0
+		n.Embedding.ID = r.string()
+		n.Embedding.Content = r.string()
+		if h.version >= 2 {
+			n.Embedding.Metadata = r.metadata()
+		}
+	}
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("%w: records: %w", ErrCorrupt, r.err)
+	}
+
+	r = &reader{b: body[h.graphOff:]}
+	for _, n := range g.Nodes {
+		levels := r.uvarint()
+		if levels > 64 {
+			return nil, nil, fmt.Errorf("%w: node on %d layers", ErrCorrupt, levels)
+		}
+
+		n.Friends = make([][]uint32, levels)
+		for l := range n.Friends {
+			count := r.uvarint()
+			if count > uint64(len(r.b))/4 {
+				r.err = io.ErrUnexpectedEOF
+				break
+			}
+
+			friends := make([]uint32, count)
+			for j := range friends {
+				friends[j] = r.uint32()
+			}
+			n.Friends[l] = friends
+		}
+	}
+	if r.err != nil {
+		return nil, nil, fmt.Errorf("%w: graph: %w", ErrCorrupt, r.err)
+	}
+
+	if h.version >= 3 {
+		h.quantizer = r.bytes()
+		if r.err != nil {
+			return nil, nil, fmt.Errorf("%w: quantizer: %w", ErrCorrupt, r.err)
+		}
+	}
+
+	return g, h, nil
+}
+
+// vectorAt returns vector i of a vectors section, in place when possible
+func vectorAt(vectors []byte, i, dim int) core.Vec32 {
+	b := vectors[i*dim*4 : (i+1)*dim*4]
+	if dim == 0 {
+		return nil
+	}
+
+	if littleEndian && uintptr(unsafe.Pointer(&b[0]))%4 == 0 {
+		v := unsafe.Slice((*float32)(unsafe.Pointer(&b[0])), dim)
+		// capping the capacity keeps appends from writing into the mapping
+		return v[:dim:dim]
+	}
+
+	v := make(core.Vec32, dim)
+	for j := range v {
+		v[j] = math.Float32frombits(binary.LittleEndian.Uint32(b[j*4:]))
+	}
+
+	return v
+}
+
+func appendVector(b []byte, v core.Vec32) []byte {
+	for _, f := range v {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(f))
+	}
+
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func appendBytes(b, p []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(p)))
+	return append(b, p...)
+}
+
+func stringLen(s string) uint64 {
+	return uint64(len(binary.AppendUvarint(nil, uint64(len(s))))) + uint64(len(s))
+}
+
+func bytesLen(p []byte) uint64 {
+	return uint64(len(binary.AppendUvarint(nil, uint64(len(p))))) + uint64(len(p))
+}
+
+// encodeMetadata returns the JSON of metadata, nothing when it is empty
+func encodeMetadata(metadata map[string]interface{}) ([]byte, error) {
+	if len(metadata) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(metadata)
+}
+
+// reader decodes the fields of a section, recording the first error
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) fail() {
+	if r.err == nil {
+		r.err = io.ErrUnexpectedEOF
+	}
+	r.b = nil
+}
+
+func (r *reader) byte() byte {
+	if len(r.b) < 1 {
+		r.fail()
+		return 0
+	}
+
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *reader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.fail()
+		return 0
+	}
+
+	v := binary.LittleEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *reader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail()
+		return ""
+	}
+
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+func (r *reader) bytes() []byte {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail()
+		return nil
+	}
+
+	p := make([]byte, n)
+	copy(p, r.b)
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *reader) metadata() map[string]interface{} {
+	n := r.uvarint()
+	if n > uint64(len(r.b)) {
+		r.fail()
+		return nil
+	}
+
+	p := r.b[:n]
+	r.b = r.b[n:]
+	if n == 0 {
+		return nil
+	}
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal(p, &metadata); err != nil && r.err == nil {
+		r.err = err
+	}
+
+	return metadata
+}
+
+func (r *reader) vector() core.Vec32 {
+	dim := r.uvarint()
+	if dim > uint64(len(r.b))/4 {
+		r.fail()
+		return nil
+	}
+
+	v := make(core.Vec32, dim)
+	for i := range v {
+		v[i] = math.Float32frombits(r.uint32())
+	}
+
+	return v
+}
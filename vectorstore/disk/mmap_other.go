@@ -0,0 +1,25 @@
+//go:build !unix
+
+package disk
+
+import "os"
+
+// mapping holds the content of a file. Without mmap support the file is
+// read into memory.
+type mapping struct {
+	data []byte
+}
+
+func mapFile(path string) (*mapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mapping{data: data}, nil
+}
+
+func (m *mapping) close() error {
+	m.data = nil
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package disk
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mapping is a read only view of a file
+type mapping struct {
+	data []byte
+}
+
+// mapFile maps the whole of path into memory. Pages are read from disk on
+// first access, so loading a large snapshot costs little until it is used.
+func mapFile(path string) (*mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() == 0 {
+		return &mapping{}, nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("error mapping %s: %w", path, err)
+	}
+
+	return &mapping{data: data}, nil
+}
+
+func (m *mapping) close() error {
+	if m.data == nil {
+		return nil
+	}
+
+	data := m.data
+	m.data = nil
+	return syscall.Munmap(data)
+}
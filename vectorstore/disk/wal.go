@@ -0,0 +1,239 @@
+package disk
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/joaopandolfi/core"
+)
+
+// walEntry is a decoded log record
+type walEntry struct {
+	op        byte
+	embedding *core.Embedding
+	ids       []string
+	filter    *core.Filter
+}
+
+// wal is the append side of the log
+type wal struct {
+	f *os.File
+	// version is the format version of the log, older ones are only read
+	version    uint32
+	generation uint64
+	records    int
+	sync       bool
+}
+
+// openWAL opens the log of dir and returns the entries to apply on top of a
+// snapshot of the given generation. A log from an older generation is reset,
+// and a record torn by a crash ends the log: it is cut off along with
+// anything after it.
+func openWAL(path string, generation uint64, sync bool) (*wal, []*walEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, nil, fmt.Errorf("error reading log: %w", err)
+	}
+
+	entries, version, end, err := decodeWAL(data, generation)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening log: %w", err)
+	}
+
+	w := &wal{f: f, version: version, generation: generation, records: len(entries), sync: sync}
+	if end == 0 {
+		err = w.reset(generation)
+	} else if end < len(data) {
+		err = f.Truncate(int64(end))
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekEnd)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("error preparing log: %w", err)
+	}
+
+	return w, entries, nil
+}
+
+// decodeWAL returns the entries of a log, its version and the length of its
+// valid part, 0 when the log does not apply to the generation
+func decodeWAL(data []byte, generation uint64) ([]*walEntry, uint32, int, error) {
+	if len(data) < walHeaderSize || string(data[:4]) != walMagic {
+		return nil, 0, 0, nil
+	}
+	version := binary.LittleEndian.Uint32(data[4:])
+	if version < 1 || version > walVersion {
+		return nil, 0, 0, fmt.Errorf("unsupported log version %d", version)
+	}
+
+	gen := binary.LittleEndian.Uint64(data[8:])
+	if gen < generation {
+		return nil, 0, 0, nil
+	}
+	if gen > generation {
+		return nil, 0, 0, fmt.Errorf("log generation %d is ahead of snapshot generation %d", gen, generation)
+	}
+
+	var entries []*walEntry
+	off := walHeaderSize
+	for off+walRecordHeader <= len(data) {
+		length := int(binary.LittleEndian.Uint32(data[off:]))
+		sum := binary.LittleEndian.Uint32(data[off+4:])
+
+		start := off + walRecordHeader
+		if length > len(data)-start {
+			break
+		}
+
+		payload := data[start : start+length]
+		if crc32.Checksum(payload, castagnoli) != sum {
+			break
+		}
+
+		e, err := decodeEntry(payload, version)
+		if err != nil {
+			break
+		}
+
+		entries = append(entries, e)
+		off = start + length
+	}
+
+	return entries, version, off, nil
+}
+
+func decodeEntry(payload []byte, version uint32) (*walEntry, error) {
+	r := &reader{b: payload}
+	e := &walEntry{op: r.byte()}
+
+	switch e.op {
+	case opAdd:
+		e.embedding = &core.Embedding{ID: r.string(), Content: r.string()}
+		if version >= 2 {
+			e.embedding.Metadata = r.metadata()
+		}
+		e.embedding.Vector = r.vector()
+	case opDelete:
+		n := r.uvarint()
+		for i := uint64(0); i < n && r.err == nil; i++ {
+			e.ids = append(e.ids, r.string())
+		}
+	case opDeleteWhere:
+		e.filter = &core.Filter{}
+		if err := json.Unmarshal([]byte(r.string()), e.filter); err != nil && r.err == nil {
+			r.err = err
+		}
+	default:
+		return nil, fmt.Errorf("unknown log operation %d", e.op)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return e, nil
+}
+
+// appendAdd logs the addition of embeddings with a single write
+func (w *wal) appendAdd(embeddings []*core.Embedding) error {
+	var buf, payload []byte
+	for _, e := range embeddings {
+		meta, err := encodeMetadata(e.Metadata)
+		if err != nil {
+			return fmt.Errorf("error encoding metadata of %q: %w", e.ID, err)
+		}
+
+		payload = append(payload[:0], opAdd)
+		payload = appendString(payload, e.ID)
+		payload = appendString(payload, e.Content)
+		payload = appendBytes(payload, meta)
+		payload = binary.AppendUvarint(payload, uint64(len(e.Vector)))
+		payload = appendVector(payload, e.Vector)
+
+		buf = appendRecord(buf, payload)
+	}
+
+	return w.write(buf, len(embeddings))
+}
+
+// appendDelete logs the deletion of ids
+func (w *wal) appendDelete(ids []string) error {
+	payload := []byte{opDelete}
+	payload = binary.AppendUvarint(payload, uint64(len(ids)))
+	for _, id := range ids {
+		payload = appendString(payload, id)
+	}
+
+	return w.write(appendRecord(nil, payload), 1)
+}
+
+// appendDeleteWhere logs the deletion of the embeddings matching filter
+func (w *wal) appendDeleteWhere(filter *core.Filter) error {
+	b, err := json.Marshal(filter)
+	if err != nil {
+		return fmt.Errorf("error encoding filter: %w", err)
+	}
+
+	payload := appendBytes([]byte{opDeleteWhere}, b)
+	return w.write(appendRecord(nil, payload), 1)
+}
+
+func (w *wal) write(buf []byte, records int) error {
+	if _, err := w.f.Write(buf); err != nil {
+		return fmt.Errorf("error writing log: %w", err)
+	}
+
+	if w.sync {
+		if err := w.f.Sync(); err != nil {
+			return fmt.Errorf("error syncing log: %w", err)
+		}
+	}
+
+	w.records += records
+	return nil
+}
+
+// reset empties the log and starts the given generation
+func (w *wal) reset(generation uint64) error {
+	if err := w.f.Truncate(0); err != nil {
+		return err
+	}
+
+	h := make([]byte, walHeaderSize)
+	copy(h, walMagic)
+	binary.LittleEndian.PutUint32(h[4:], walVersion)
+	binary.LittleEndian.PutUint64(h[8:], generation)
+	if _, err := w.f.WriteAt(h, 0); err != nil {
+		return err
+	}
+	if _, err := w.f.Seek(walHeaderSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	w.version = walVersion
+	w.generation = generation
+	w.records = 0
+	return w.f.Sync()
+}
+
+func (w *wal) close() error {
+	return w.f.Close()
+}
+
+func appendRecord(b, payload []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+	b = binary.LittleEndian.AppendUint32(b, crc32.Checksum(payload, castagnoli))
+	return append(b, payload...)
+}
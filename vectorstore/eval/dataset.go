@@ -0,0 +1,162 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Dataset is a set of queries labelled with their relevant results
+type Dataset struct {
+	Name    string   `json:"name"`
+	Queries []*Query `json:"queries"`
+}
+
+// Query is a search labelled with the results it should find
+type Query struct {
+	ID   string `json:"id"`
+	Text string `json:"query"`
+
+	// Relevant grades the keys of the relevant results, as computed by the
+	// KeyFunc of the evaluator: 1 for relevant, more for more relevant
+	Relevant Judgments `json:"relevant"`
+}
+
+// Judgments maps the keys of relevant results to their grade. In JSON it is
+// either an object of grades or a list of keys, all graded 1.
+type Judgments map[string]float64
+
+func (j *Judgments) UnmarshalJSON(data []byte) error {
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err == nil {
+		*j = make(Judgments, len(keys))
+		for _, k := range keys {
+			(*j)[k] = 1
+		}
+		return nil
+	}
+
+	var grades map[string]float64
+	if err := json.Unmarshal(data, &grades); err != nil {
+		return fmt.Errorf("relevant results must be a list of keys or an object of grades: %w", err)
+	}
+	*j = grades
+
+	return nil
+}
+
+// LoadDataset reads a dataset from a file, see ReadDataset. The dataset is
+// named after the file unless it names itself.
+func LoadDataset(path string) (*Dataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dataset: %w", err)
+	}
+	defer f.Close()
+
+	d, err := ReadDataset(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading dataset %s: %w", path, err)
+	}
+	if d.Name == "" {
+		d.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return d, nil
+}
+
+// ReadDataset reads a dataset in JSON, either a Dataset object, an array of
+// queries or one query per line:
+//
+//	{"id": "q1", "query": "how long is parental leave?", "relevant": ["handbook.pdf"]}
+//	{"id": "q2", "query": "expense deadline", "relevant": {"handbook.pdf": 2, "faq.md": 1}}
+//
+// Queries without an ID are numbered.
+func ReadDataset(r io.Reader) (*Dataset, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dataset{}
+	switch trimmed := bytes.TrimSpace(data); {
+	case len(trimmed) == 0:
+		return nil, errors.New("empty dataset")
+	case trimmed[0] == '[':
+		if err := json.Unmarshal(trimmed, &d.Queries); err != nil {
+			return nil, err
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		for dec.More() {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, err
+			}
+
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &fields); err != nil {
+				return nil, err
+			}
+			if _, ok := fields["queries"]; ok {
+				if err := json.Unmarshal(raw, d); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			q := &Query{}
+			if err := json.Unmarshal(raw, q); err != nil {
+				return nil, err
+			}
+			d.Queries = append(d.Queries, q)
+		}
+	}
+
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *Dataset) validate() error {
+	if len(d.Queries) == 0 {
+		return errors.New("no queries")
+	}
+
+	seen := make(map[string]bool, len(d.Queries))
+	for i, q := range d.Queries {
+		if q == nil {
+			return fmt.Errorf("query %d is null", i+1)
+		}
+		if q.ID == "" {
+			q.ID = fmt.Sprintf("q%d", i+1)
+		}
+		if seen[q.ID] {
+			return fmt.Errorf("duplicate query ID %q", q.ID)
+		}
+		seen[q.ID] = true
+
+		if strings.TrimSpace(q.Text) == "" {
+			return fmt.Errorf("query %s has no text", q.ID)
+		}
+
+		relevant := 0
+		for _, grade := range q.Relevant {
+			if grade > 0 {
+				relevant++
+			}
+		}
+		if relevant == 0 {
+			return fmt.Errorf("query %s has no relevant results", q.ID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,367 @@
+// Package eval measures the retrieval quality of a vector store and embedder
+// over a labelled query set, to tell whether a change of chunker, embedder
+// or index made retrieval better or worse:
+//
+//	dataset, err := eval.LoadDataset("queries.jsonl")
+//	ev := eval.NewEvaluator(eval.WithKey(eval.ByMetadata(ingest.MetaSource)))
+//
+//	before, err := ev.Evaluate(ctx, "minilm", storeA, embedderA, dataset)
+//	after, err := ev.Evaluate(ctx, "bge-small", storeB, embedderB, dataset)
+//	fmt.Println(eval.NewReport(before, after).Markdown())
+//
+// Results are matched to the labels of the queries by key, the embedding ID
+// by default. Labelling documents rather than chunks, through a metadata
+// field set at ingestion, keeps a dataset valid across chunkers: the chunks
+// of a document then count once, at the rank of the best of them.
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore/bench"
+)
+
+// KeyFunc returns the key a result is judged by, "" for results that cannot
+// be relevant
+type KeyFunc func(e *core.Embedding) string
+
+// ByID keys results by embedding ID
+func ByID(e *core.Embedding) string {
+	return e.ID
+}
+
+// ByMetadata keys results by a metadata field, such as the source document
+func ByMetadata(field string) KeyFunc {
+	return func(e *core.Embedding) string {
+		v, ok := e.Metadata[field]
+		if !ok || v == nil {
+			return ""
+		}
+
+		return fmt.Sprint(v)
+	}
+}
+
+// Evaluator runs labelled queries against vector stores
+type Evaluator struct {
+	ks     []int
+	key    KeyFunc
+	limit  int
+	warmup int
+	logger *logr.Logger
+}
+
+// EvaluatorConfig holds configuration for an Evaluator
+type EvaluatorConfig struct {
+	// Ks are the cutoffs metrics are computed at
+	// default 1, 3, 5 and 10
+	Ks []int
+
+	// Key judges results against the labels of the queries
+	// default ByID
+	Key KeyFunc
+
+	// Limit is the number of results searched per query. Keys shared by
+	// several results, such as documents made of several chunks, may call
+	// for more than the largest cutoff.
+	// default the largest of Ks
+	Limit int
+
+	// Warmup queries are run once before measuring, so that latencies do not
+	// include cold caches
+	// default 5
+	Warmup int
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// EvaluatorConfigFunc is a function type that modifies EvaluatorConfig
+type EvaluatorConfigFunc func(*EvaluatorConfig)
+
+func WithKs(ks ...int) EvaluatorConfigFunc {
+	return func(conf *EvaluatorConfig) {
+		conf.Ks = ks
+	}
+}
+
+func WithKey(key KeyFunc) EvaluatorConfigFunc {
+	return func(conf *EvaluatorConfig) {
+		conf.Key = key
+	}
+}
+
+func WithLimit(n int) EvaluatorConfigFunc {
+	return func(conf *EvaluatorConfig) {
+		conf.Limit = n
+	}
+}
+
+func WithWarmup(n int) EvaluatorConfigFunc {
+	return func(conf *EvaluatorConfig) {
+		conf.Warmup = n
+	}
+}
+
+func WithLogger(l *logr.Logger) EvaluatorConfigFunc {
+	return func(conf *EvaluatorConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewEvaluator returns a new Evaluator
+func NewEvaluator(opts ...EvaluatorConfigFunc) *Evaluator {
+	discard := logr.Discard()
+	conf := &EvaluatorConfig{
+		Ks:     []int{1, 3, 5, 10},
+		Key:    ByID,
+		Warmup: 5,
+		Logger: &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	ks := []int{}
+	for _, k := range conf.Ks {
+		if k > 0 && !slices.Contains(ks, k) {
+			ks = append(ks, k)
+		}
+	}
+	if len(ks) == 0 {
+		ks = []int{10}
+	}
+	slices.Sort(ks)
+
+	return &Evaluator{
+		ks:     ks,
+		key:    conf.Key,
+		limit:  max(conf.Limit, ks[len(ks)-1]),
+		warmup: max(conf.Warmup, 0),
+		logger: conf.Logger,
+	}
+}
+
+// Metrics are means over the queries of a run, keyed by cutoff
+type Metrics struct {
+	// Recall is the fraction of the relevant results found
+	Recall map[int]float64 `json:"recall"`
+
+	// Precision is the fraction of the results that are relevant
+	Precision map[int]float64 `json:"precision"`
+
+	// NDCG is the normalized discounted cumulative gain, which rewards
+	// ranking the most relevant results first
+	NDCG map[int]float64 `json:"ndcg"`
+
+	// MRR is the mean reciprocal rank of the first relevant result, 0 when
+	// none is found within the limit
+	MRR float64 `json:"mrr"`
+}
+
+func newMetrics() Metrics {
+	return Metrics{
+		Recall:    map[int]float64{},
+		Precision: map[int]float64{},
+		NDCG:      map[int]float64{},
+	}
+}
+
+// QueryResult holds the metrics of a single query
+type QueryResult struct {
+	ID    string `json:"id"`
+	Query string `json:"query"`
+
+	Metrics
+
+	// Retrieved lists the keys of the results, best first, a key once
+	Retrieved []string `json:"retrieved"`
+}
+
+// Run is the outcome of evaluating a store over a dataset
+type Run struct {
+	// Name tells the configuration evaluated apart
+	Name    string `json:"name"`
+	Dataset string `json:"dataset"`
+	Queries int    `json:"queries"`
+
+	// Ks are the cutoffs of the metrics
+	Ks    []int `json:"ks"`
+	Limit int   `json:"limit"`
+
+	Metrics
+
+	// Search is the latency of the store
+	Search bench.Latency `json:"search"`
+
+	// Embed is the latency of the embedder, when queries were embedded
+	// apart from the store
+	Embed *bench.Latency `json:"embed,omitempty"`
+
+	PerQuery []*QueryResult `json:"per_query"`
+}
+
+// Evaluate runs every query of dataset against store and returns the mean
+// metrics and latencies. Queries are embedded by embedder and searched by
+// vector, which times embedding and search apart, or searched by text when
+// embedder is nil, the store embedding them itself.
+func (e *Evaluator) Evaluate(ctx context.Context, name string, store core.VectorStorer, embedder core.Embedder, dataset *Dataset) (*Run, error) {
+	if err := dataset.validate(); err != nil {
+		return nil, fmt.Errorf("invalid dataset: %w", err)
+	}
+
+	for _, q := range dataset.Queries[:min(e.warmup, len(dataset.Queries))] {
+		if _, _, err := e.search(ctx, store, embedder, q); err != nil {
+			return nil, err
+		}
+	}
+
+	run := &Run{
+		Name:    name,
+		Dataset: dataset.Name,
+		Queries: len(dataset.Queries),
+		Ks:      e.ks,
+		Limit:   e.limit,
+		Metrics: newMetrics(),
+	}
+
+	searchLatencies := make([]time.Duration, 0, len(dataset.Queries))
+	embedLatencies := make([]time.Duration, 0, len(dataset.Queries))
+	for _, q := range dataset.Queries {
+		results, timing, err := e.search(ctx, store, embedder, q)
+		if err != nil {
+			return nil, err
+		}
+		searchLatencies = append(searchLatencies, timing.search)
+		if embedder != nil {
+			embedLatencies = append(embedLatencies, timing.embed)
+		}
+
+		qr := e.score(q, results)
+		run.PerQuery = append(run.PerQuery, qr)
+		for _, k := range e.ks {
+			run.Recall[k] += qr.Recall[k]
+			run.Precision[k] += qr.Precision[k]
+			run.NDCG[k] += qr.NDCG[k]
+		}
+		run.MRR += qr.MRR
+	}
+
+	n := float64(len(dataset.Queries))
+	for _, k := range e.ks {
+		run.Recall[k] /= n
+		run.Precision[k] /= n
+		run.NDCG[k] /= n
+	}
+	run.MRR /= n
+
+	run.Search = bench.Summarize(searchLatencies)
+	if embedder != nil {
+		embed := bench.Summarize(embedLatencies)
+		run.Embed = &embed
+	}
+
+	e.logger.V(1).Info("Evaluated retrieval", "run", name, "queries", run.Queries, "mrr", run.MRR)
+	return run, nil
+}
+
+type timing struct {
+	embed  time.Duration
+	search time.Duration
+}
+
+func (e *Evaluator) search(ctx context.Context, store core.VectorStorer, embedder core.Embedder, q *Query) ([]*core.SearchResult, timing, error) {
+	var t timing
+	params := &core.SearchParams{Query: q.Text, Limit: e.limit}
+
+	if embedder != nil {
+		began := time.Now()
+		emb, err := embedder.GenerateEmbedding(ctx, q.Text)
+		if err != nil {
+			return nil, t, fmt.Errorf("error embedding query %s: %w", q.ID, err)
+		}
+		t.embed = time.Since(began)
+		params = &core.SearchParams{QueryVec: emb.Vector, Limit: e.limit}
+	}
+
+	began := time.Now()
+	results, err := store.Search(ctx, params)
+	if err != nil {
+		return nil, t, fmt.Errorf("error searching query %s: %w", q.ID, err)
+	}
+	t.search = time.Since(began)
+
+	return results, t, nil
+}
+
+// score computes the metrics of a query from its results, keeping the first
+// result of each key
+func (e *Evaluator) score(q *Query, results []*core.SearchResult) *QueryResult {
+	qr := &QueryResult{ID: q.ID, Query: q.Text, Metrics: newMetrics()}
+
+	// grades of the retrieved results, in rank order
+	var grades []float64
+	seen := map[string]bool{}
+	for _, r := range results {
+		key := e.key(r.Embedding)
+		if key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		qr.Retrieved = append(qr.Retrieved, key)
+		grades = append(grades, max(q.Relevant[key], 0))
+	}
+
+	var ideal []float64
+	for _, grade := range q.Relevant {
+		if grade > 0 {
+			ideal = append(ideal, grade)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(ideal)))
+
+	for i, grade := range grades {
+		if grade > 0 {
+			qr.MRR = 1 / float64(i+1)
+			break
+		}
+	}
+
+	for _, k := range e.ks {
+		found := 0
+		for _, grade := range grades[:min(k, len(grades))] {
+			if grade > 0 {
+				found++
+			}
+		}
+
+		qr.Recall[k] = float64(found) / float64(len(ideal))
+		qr.Precision[k] = float64(found) / float64(k)
+		qr.NDCG[k] = dcg(grades, k) / dcg(ideal, k)
+	}
+
+	return qr
+}
+
+// dcg is the discounted cumulative gain of the first k grades, with the
+// exponential gain favouring highly relevant results
+func dcg(grades []float64, k int) float64 {
+	sum := 0.0
+	for i, grade := range grades[:min(k, len(grades))] {
+		sum += (math.Pow(2, grade) - 1) / math.Log2(float64(i+2))
+	}
+
+	return sum
+}
@@ -0,0 +1,273 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+// result returns a search result of ID id from the document source, without
+// source metadata when source is empty
+func result(id, source string) *core.SearchResult {
+	e := &core.Embedding{ID: id, Content: "content of " + id}
+	if source != "" {
+		e.Metadata = map[string]interface{}{"source": source}
+	}
+
+	return &core.SearchResult{Embedding: e, Score: 1}
+}
+
+// byID returns results of the given IDs
+func byID(ids ...string) []*core.SearchResult {
+	out := make([]*core.SearchResult, len(ids))
+	for i, id := range ids {
+		out[i] = result(id, "")
+	}
+
+	return out
+}
+
+func checkMetric(t *testing.T, name string, got, want map[int]float64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Errorf("%s: got %v, want %v", name, got, want)
+		return
+	}
+	for k, w := range want {
+		if math.Abs(got[k]-w) > 1e-9 {
+			t.Errorf("%s@%d: got %v, want %v", name, k, got[k], w)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := map[string]struct {
+		opts      []EvaluatorConfigFunc
+		relevant  Judgments
+		results   []*core.SearchResult
+		retrieved string
+		recall    map[int]float64
+		precision map[int]float64
+		ndcg      map[int]float64
+		mrr       float64
+	}{
+		// DCG@3 is 1 + 1/log2(4), the ideal 1 + 1/log2(3) + 1/log2(4)
+		"binary": {
+			[]EvaluatorConfigFunc{WithKs(1, 3, 5)},
+			Judgments{"a": 1, "b": 1, "c": 1},
+			byID("a", "x", "b", "y", "z"),
+			"[a x b y z]",
+			map[int]float64{1: 1.0 / 3, 3: 2.0 / 3, 5: 2.0 / 3},
+			map[int]float64{1: 1, 3: 2.0 / 3, 5: 2.0 / 5},
+			map[int]float64{1: 1, 3: 0.7039180890341347, 5: 0.7039180890341347},
+			1,
+		},
+		// gains are 2^grade - 1: 1 for b and 7 for a, ranked in the wrong
+		// order
+		"graded": {
+			[]EvaluatorConfigFunc{WithKs(1, 2)},
+			Judgments{"a": 3, "b": 1},
+			byID("b", "a"),
+			"[b a]",
+			map[int]float64{1: 0.5, 2: 1},
+			map[int]float64{1: 1, 2: 1},
+			map[int]float64{1: 1.0 / 7, 2: 0.7098097413968655},
+			1,
+		},
+		// the chunks of a document count once, at the rank of the first
+		"duplicate keys": {
+			[]EvaluatorConfigFunc{WithKs(1, 3), WithKey(ByMetadata("source"))},
+			Judgments{"a.md": 1, "b.md": 1},
+			[]*core.SearchResult{result("1", "a.md"), result("2", "a.md"), result("3", "x.md"), result("4", "a.md"), result("5", "b.md")},
+			"[a.md x.md b.md]",
+			map[int]float64{1: 0.5, 3: 1},
+			map[int]float64{1: 1, 3: 2.0 / 3},
+			map[int]float64{1: 1, 3: 0.9197207891481876},
+			1,
+		},
+		// results without a key are never relevant nor merged
+		"missing keys": {
+			[]EvaluatorConfigFunc{WithKs(3), WithKey(ByMetadata("source"))},
+			Judgments{"a.md": 1},
+			[]*core.SearchResult{result("1", ""), result("2", ""), result("3", "a.md")},
+			"[  a.md]",
+			map[int]float64{3: 1},
+			map[int]float64{3: 1.0 / 3},
+			map[int]float64{3: 0.5},
+			1.0 / 3,
+		},
+		// precision still divides by k
+		"k beyond the results": {
+			[]EvaluatorConfigFunc{WithKs(5, 10)},
+			Judgments{"a": 1, "b": 1},
+			byID("x", "a"),
+			"[x a]",
+			map[int]float64{5: 0.5, 10: 0.5},
+			map[int]float64{5: 1.0 / 5, 10: 1.0 / 10},
+			map[int]float64{5: 0.38685280723454163, 10: 0.38685280723454163},
+			0.5,
+		},
+		"nothing relevant": {
+			[]EvaluatorConfigFunc{WithKs(1, 3)},
+			Judgments{"a": 1},
+			byID("x", "y"),
+			"[x y]",
+			map[int]float64{1: 0, 3: 0},
+			map[int]float64{1: 0, 3: 0},
+			map[int]float64{1: 0, 3: 0},
+			0,
+		},
+		"no results": {
+			[]EvaluatorConfigFunc{WithKs(1)},
+			Judgments{"a": 1},
+			nil,
+			"[]",
+			map[int]float64{1: 0},
+			map[int]float64{1: 0},
+			map[int]float64{1: 0},
+			0,
+		},
+		// grades of zero or less are not relevant
+		"ungraded": {
+			[]EvaluatorConfigFunc{WithKs(2)},
+			Judgments{"a": 1, "b": 0, "c": -1},
+			byID("b", "c"),
+			"[b c]",
+			map[int]float64{2: 0},
+			map[int]float64{2: 0},
+			map[int]float64{2: 0},
+			0,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := NewEvaluator(tt.opts...)
+			qr := e.score(&Query{ID: "q1", Text: "query", Relevant: tt.relevant}, tt.results)
+
+			if got := fmt.Sprint(qr.Retrieved); got != tt.retrieved {
+				t.Errorf("retrieved %s, want %s", got, tt.retrieved)
+			}
+			checkMetric(t, "recall", qr.Recall, tt.recall)
+			checkMetric(t, "precision", qr.Precision, tt.precision)
+			checkMetric(t, "ndcg", qr.NDCG, tt.ndcg)
+			if math.Abs(qr.MRR-tt.mrr) > 1e-9 {
+				t.Errorf("mrr: got %v, want %v", qr.MRR, tt.mrr)
+			}
+		})
+	}
+}
+
+func TestNewEvaluatorKs(t *testing.T) {
+	tests := map[string]struct {
+		opts  []EvaluatorConfigFunc
+		ks    string
+		limit int
+	}{
+		"default":          {nil, "[1 3 5 10]", 10},
+		"sorted and dedup": {[]EvaluatorConfigFunc{WithKs(5, 1, 5, 0, -2)}, "[1 5]", 5},
+		"none valid":       {[]EvaluatorConfigFunc{WithKs(0)}, "[10]", 10},
+		"larger limit":     {[]EvaluatorConfigFunc{WithKs(3), WithLimit(20)}, "[3]", 20},
+		"smaller limit":    {[]EvaluatorConfigFunc{WithKs(3), WithLimit(1)}, "[3]", 3},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			e := NewEvaluator(tt.opts...)
+			if got := fmt.Sprint(e.ks); got != tt.ks || e.limit != tt.limit {
+				t.Errorf("got ks %s and limit %d, want %s and %d", got, e.limit, tt.ks, tt.limit)
+			}
+		})
+	}
+}
+
+// fakeStore returns fixed results per query text, and records searches
+type fakeStore struct {
+	results  map[string][]*core.SearchResult
+	searches []*core.SearchParams
+}
+
+func (s *fakeStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	s.searches = append(s.searches, params)
+
+	text := params.Query
+	if params.QueryVec != nil {
+		// vectors of the fake embedder hold the length of the query
+		for t := range s.results {
+			if float32(len(t)) == params.QueryVec[0] {
+				text = t
+			}
+		}
+	}
+	results := s.results[text]
+
+	return results[:min(params.Limit, len(results))], nil
+}
+
+func (s *fakeStore) Close() error {
+	return nil
+}
+
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) GenerateEmbedding(ctx context.Context, content string) (*core.Embedding, error) {
+	return &core.Embedding{Vector: core.Vec32{float32(len(content))}, Content: content}, nil
+}
+
+var testDataset = &Dataset{
+	Name: "handbook",
+	Queries: []*Query{
+		{ID: "leave", Text: "parental leave", Relevant: Judgments{"a": 1, "b": 1}},
+		{ID: "expenses", Text: "expense deadline", Relevant: Judgments{"c": 2, "d": 1}},
+	},
+}
+
+func TestEvaluate(t *testing.T) {
+	store := &fakeStore{results: map[string][]*core.SearchResult{
+		"parental leave":   byID("a", "x", "b"),
+		"expense deadline": byID("y", "d", "c"),
+	}}
+	e := NewEvaluator(WithKs(1, 3), WithWarmup(1))
+
+	for name, embedder := range map[string]core.Embedder{"by text": nil, "by vector": fakeEmbedder{}} {
+		t.Run(name, func(t *testing.T) {
+			store.searches = nil
+
+			run, err := e.Evaluate(context.Background(), name, store, embedder, testDataset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// one warmup search, then one per query
+			if len(store.searches) != 3 || store.searches[0].Limit != 3 {
+				t.Errorf("got searches %+v", store.searches)
+			}
+			if (store.searches[0].QueryVec != nil) != (embedder != nil) || (run.Embed != nil) != (embedder != nil) {
+				t.Errorf("searched %+v, embed latency %v", store.searches[0], run.Embed)
+			}
+
+			// means of the metrics of both queries
+			checkMetric(t, "recall", run.Recall, map[int]float64{1: 0.25, 3: 1})
+			checkMetric(t, "precision", run.Precision, map[int]float64{1: 0.5, 3: 2.0 / 3})
+			if math.Abs(run.MRR-0.75) > 1e-9 {
+				t.Errorf("mrr: got %v, want 0.75", run.MRR)
+			}
+			if run.Queries != 2 || run.Dataset != "handbook" || len(run.PerQuery) != 2 || run.PerQuery[1].ID != "expenses" {
+				t.Errorf("got run %+v", run)
+			}
+		})
+	}
+
+	if _, err := e.Evaluate(context.Background(), "empty", store, nil, &Dataset{}); err == nil || !strings.Contains(err.Error(), "invalid dataset") {
+		t.Errorf("got %v for an empty dataset", err)
+	}
+}
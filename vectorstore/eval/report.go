@@ -0,0 +1,244 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report compares runs over the same dataset against the first of them, the
+// baseline
+type Report struct {
+	Runs []*Run `json:"runs"`
+
+	// Comparisons holds a comparison against the baseline per other run
+	Comparisons []*Comparison `json:"comparisons,omitempty"`
+}
+
+// Comparison is the difference between a run and the baseline
+type Comparison struct {
+	Run      string `json:"run"`
+	Baseline string `json:"baseline"`
+
+	// Delta holds the metrics of the run minus those of the baseline, for
+	// the cutoffs of both
+	Delta Metrics `json:"delta"`
+
+	// Regressions and Improvements list the queries whose nDCG at the
+	// largest common cutoff changed, the largest changes first
+	Regressions  []*Change `json:"regressions,omitempty"`
+	Improvements []*Change `json:"improvements,omitempty"`
+}
+
+// Change is the nDCG of a query in the baseline and in a run
+type Change struct {
+	ID       string  `json:"id"`
+	Query    string  `json:"query"`
+	Baseline float64 `json:"baseline"`
+	Run      float64 `json:"run"`
+}
+
+// maxChanges caps the queries listed as regressions or improvements in
+// Markdown
+const maxChanges = 10
+
+// NewReport compares runs against the first of them
+func NewReport(runs ...*Run) *Report {
+	report := &Report{Runs: runs}
+	if len(runs) < 2 {
+		return report
+	}
+
+	baseline := runs[0]
+	for _, run := range runs[1:] {
+		report.Comparisons = append(report.Comparisons, compare(baseline, run))
+	}
+
+	return report
+}
+
+func compare(baseline, run *Run) *Comparison {
+	c := &Comparison{Run: run.Name, Baseline: baseline.Name, Delta: newMetrics()}
+
+	ks := commonKs(baseline, run)
+	for _, k := range ks {
+		c.Delta.Recall[k] = run.Recall[k] - baseline.Recall[k]
+		c.Delta.Precision[k] = run.Precision[k] - baseline.Precision[k]
+		c.Delta.NDCG[k] = run.NDCG[k] - baseline.NDCG[k]
+	}
+	c.Delta.MRR = run.MRR - baseline.MRR
+
+	if len(ks) == 0 {
+		return c
+	}
+	k := ks[len(ks)-1]
+
+	before := make(map[string]*QueryResult, len(baseline.PerQuery))
+	for _, qr := range baseline.PerQuery {
+		before[qr.ID] = qr
+	}
+	for _, qr := range run.PerQuery {
+		b, ok := before[qr.ID]
+		if !ok {
+			continue
+		}
+
+		change := &Change{ID: qr.ID, Query: qr.Query, Baseline: b.NDCG[k], Run: qr.NDCG[k]}
+		switch {
+		case change.Run < change.Baseline:
+			c.Regressions = append(c.Regressions, change)
+		case change.Run > change.Baseline:
+			c.Improvements = append(c.Improvements, change)
+		}
+	}
+
+	for _, changes := range [][]*Change{c.Regressions, c.Improvements} {
+		sort.SliceStable(changes, func(i, j int) bool {
+			return abs(changes[i].Run-changes[i].Baseline) > abs(changes[j].Run-changes[j].Baseline)
+		})
+	}
+
+	return c
+}
+
+// commonKs returns the cutoffs of both runs, in increasing order
+func commonKs(a, b *Run) []int {
+	var ks []int
+	for _, k := range a.Ks {
+		for _, other := range b.Ks {
+			if k == other {
+				ks = append(ks, k)
+			}
+		}
+	}
+
+	return ks
+}
+
+func abs(x float64) float64 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// JSON returns the report as indented JSON
+func (r *Report) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// Markdown returns the report as a table of the metrics of every run, with
+// their difference to the baseline, followed by the queries that changed
+// the most
+func (r *Report) Markdown() string {
+	if len(r.Runs) == 0 {
+		return "No runs to report.\n"
+	}
+
+	var b strings.Builder
+	baseline := r.Runs[0]
+	title := "Retrieval evaluation"
+	if baseline.Dataset != "" {
+		title += ": " + baseline.Dataset
+	}
+	fmt.Fprintf(&b, "## %s (%d queries)\n\n", title, baseline.Queries)
+
+	ks := baseline.Ks
+	for _, run := range r.Runs[1:] {
+		ks = commonKs(&Run{Ks: ks}, run)
+	}
+
+	header := []string{"run"}
+	for _, k := range ks {
+		header = append(header, fmt.Sprintf("recall@%d", k))
+	}
+	for _, k := range ks {
+		header = append(header, fmt.Sprintf("ndcg@%d", k))
+	}
+	header = append(header, "mrr", "search p50", "search p95", "embed p50")
+	writeRow(&b, header)
+	writeRow(&b, make([]string, len(header)))
+
+	for i, run := range r.Runs {
+		row := []string{run.Name}
+		metric := func(value, base float64) string {
+			if i == 0 {
+				return fmt.Sprintf("%.3f", value)
+			}
+			return fmt.Sprintf("%.3f (%+.3f)", value, value-base)
+		}
+
+		for _, k := range ks {
+			row = append(row, metric(run.Recall[k], baseline.Recall[k]))
+		}
+		for _, k := range ks {
+			row = append(row, metric(run.NDCG[k], baseline.NDCG[k]))
+		}
+		row = append(row, metric(run.MRR, baseline.MRR), duration(run.Search.P50), duration(run.Search.P95))
+		if run.Embed != nil {
+			row = append(row, duration(run.Embed.P50))
+		} else {
+			row = append(row, "-")
+		}
+		writeRow(&b, row)
+	}
+
+	for _, c := range r.Comparisons {
+		if len(ks) == 0 || len(c.Regressions) == 0 && len(c.Improvements) == 0 {
+			continue
+		}
+
+		k := ks[len(ks)-1]
+		fmt.Fprintf(&b, "\n### %s against %s\n\n", c.Run, c.Baseline)
+		fmt.Fprintf(&b, "%d queries regressed and %d improved in ndcg@%d.\n", len(c.Regressions), len(c.Improvements), k)
+		writeChanges(&b, "Regressions", c.Regressions)
+		writeChanges(&b, "Improvements", c.Improvements)
+	}
+
+	return b.String()
+}
+
+func writeChanges(b *strings.Builder, title string, changes []*Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	fmt.Fprintf(b, "\n%s:\n\n", title)
+	writeRow(b, []string{"query", "baseline", "run"})
+	writeRow(b, make([]string, 3))
+	for _, c := range changes[:min(len(changes), maxChanges)] {
+		writeRow(b, []string{fmt.Sprintf("%s: %s", c.ID, c.Query), fmt.Sprintf("%.3f", c.Baseline), fmt.Sprintf("%.3f", c.Run)})
+	}
+	if len(changes) > maxChanges {
+		fmt.Fprintf(b, "\n%d more in the JSON report.\n", len(changes)-maxChanges)
+	}
+}
+
+// writeRow writes a Markdown table row, a separator row when every cell is
+// empty
+func writeRow(b *strings.Builder, cells []string) {
+	separator := true
+	for _, c := range cells {
+		separator = separator && c == ""
+	}
+
+	b.WriteString("|")
+	for _, c := range cells {
+		if separator {
+			c = "---"
+		}
+		fmt.Fprintf(b, " %s |", strings.ReplaceAll(strings.Join(strings.Fields(c), " "), "|", `\|`))
+	}
+	b.WriteString("\n")
+}
+
+func duration(d time.Duration) string {
+	switch {
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	default:
+		return fmt.Sprintf("%.0fµs", float64(d)/float64(time.Microsecond))
+	}
+}
@@ -0,0 +1,91 @@
+package eval
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore/bench"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden compares got to the content of testdata/name, rewriting it with
+// -update
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs, got:\n%s", name, got)
+	}
+}
+
+func testReport(t *testing.T) *Report {
+	t.Helper()
+
+	stores := map[string]*fakeStore{
+		"baseline": {results: map[string][]*core.SearchResult{
+			"parental leave":   byID("a", "x", "b"),
+			"expense deadline": byID("y", "d", "c"),
+		}},
+		// better on expenses, worse on leave
+		"candidate": {results: map[string][]*core.SearchResult{
+			"parental leave":   byID("x", "y", "a"),
+			"expense deadline": byID("c", "d"),
+		}},
+	}
+
+	var runs []*Run
+	for i, name := range []string{"baseline", "candidate"} {
+		var embedder core.Embedder
+		if name == "candidate" {
+			embedder = fakeEmbedder{}
+		}
+
+		run, err := NewEvaluator(WithKs(1, 3), WithWarmup(0)).Evaluate(context.Background(), name, stores[name], embedder, testDataset)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// latencies are measured, fix them
+		run.Search = bench.Latency{Mean: time.Duration(i+1) * time.Millisecond, P50: 900 * time.Microsecond, P95: time.Duration(i+2) * time.Millisecond, P99: 4 * time.Millisecond, QPS: 1000}
+		if run.Embed != nil {
+			*run.Embed = bench.Latency{Mean: 250 * time.Microsecond, P50: 240 * time.Microsecond, P95: 300 * time.Microsecond, P99: 310 * time.Microsecond, QPS: 4000}
+		}
+		runs = append(runs, run)
+	}
+
+	return NewReport(runs...)
+}
+
+func TestReportJSON(t *testing.T) {
+	data, err := testReport(t).JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden(t, "report.json", append(data, '\n'))
+}
+
+func TestReportMarkdown(t *testing.T) {
+	golden(t, "report.md", []byte(testReport(t).Markdown()))
+
+	if got := NewReport().Markdown(); got != "No runs to report.\n" {
+		t.Errorf("got %q without runs", got)
+	}
+}
@@ -0,0 +1,143 @@
+package hnsw
+
+import (
+	"sort"
+)
+
+// compactMinNodes is the size under which tombstones are never reclaimed
+const compactMinNodes = 64
+
+// maybeCompact reclaims the tombstones once they make up half of the graph.
+// It must be called without holding mu or graphMu.
+func (s *HNSWVectorStore) maybeCompact() {
+	s.mu.Lock()
+	due := len(*s.nodes.Load()) >= compactMinNodes && s.deleted > len(*s.nodes.Load())/2
+	s.mu.Unlock()
+
+	if due {
+		s.compact()
+	}
+}
+
+// compact drops the tombstoned nodes and renumbers the others. A live node
+// that linked to a tombstone is relinked to the best of its remaining
+// neighbours and of the neighbours of the tombstone, as when the tombstone
+// had never been inserted, so that the graph stays navigable.
+func (s *HNSWVectorStore) compact() {
+	s.graphMu.Lock()
+	defer s.graphMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := *s.nodes.Load()
+	if s.deleted == 0 {
+		return
+	}
+
+	// relink with the indexes of the current graph
+	friends := make([][][]uint32, len(nodes))
+	for i, n := range nodes {
+		if n.deleted.Load() {
+			continue
+		}
+
+		friends[i] = make([][]uint32, len(n.friends))
+		for l, fs := range n.friends {
+			friends[i][l] = s.relink(n, fs, l)
+		}
+	}
+
+	// renumber
+	remap := make([]int64, len(nodes))
+	live := make([]*node, 0, len(nodes)-s.deleted)
+	for i, n := range nodes {
+		remap[i] = -1
+		if !n.deleted.Load() {
+			remap[i] = int64(len(live))
+			live = append(live, n)
+		}
+	}
+
+	s.ids = make(map[string]uint32, len(live))
+	s.entry = -1
+	s.maxLevel = 0
+	for _, n := range live {
+		old := n.index
+		n.index = uint32(remap[old])
+		for l, fs := range friends[old] {
+			renumbered := make([]uint32, 0, len(fs))
+			for _, f := range fs {
+				renumbered = append(renumbered, uint32(remap[f]))
+			}
+			n.friends[l] = renumbered
+		}
+		s.ids[n.emb.ID] = n.index
+
+		// the highest node is the entry point
+		if s.entry < 0 || n.level > s.maxLevel {
+			s.entry = int64(n.index)
+			s.maxLevel = n.level
+		}
+	}
+
+	s.nodes.Store(&live)
+	s.deleted = 0
+}
+
+// relink returns the neighbours of n on a layer without tombstones. When
+// some are dropped, the live neighbours of the tombstones are candidates to
+// replace them.
+func (s *HNSWVectorStore) relink(n *node, friends []uint32, level int) []uint32 {
+	seen := map[uint32]bool{n.index: true}
+	candidates := []uint32{}
+	dropped := false
+
+	for _, f := range friends {
+		fn := s.node(f)
+		if !fn.deleted.Load() {
+			if !seen[f] {
+				seen[f] = true
+				candidates = append(candidates, f)
+			}
+			continue
+		}
+
+		dropped = true
+		if level >= len(fn.friends) {
+			continue
+		}
+		for _, ff := range fn.friends[level] {
+			if !seen[ff] && !s.node(ff).deleted.Load() {
+				seen[ff] = true
+				candidates = append(candidates, ff)
+			}
+		}
+	}
+
+	if !dropped {
+		return friends
+	}
+
+	maxConn := s.m
+	if level == 0 {
+		maxConn = s.mMax0
+	}
+
+	vec := s.vector(n)
+	scored := make([]candidate, len(candidates))
+	for i, c := range candidates {
+		scored[i] = candidate{index: c, dist: s.dist(vec, s.vector(s.node(c)))}
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		return scored[i].dist < scored[j].dist
+	})
+
+	selected := s.selectNeighbors(scored, maxConn)
+	out := make([]uint32, len(selected))
+	for i, c := range selected {
+		out[i] = c.index
+	}
+
+	return out
+}
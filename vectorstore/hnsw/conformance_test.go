@@ -0,0 +1,17 @@
+package hnsw
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	factory := func(ctx context.Context, embedder core.Embedder) (core.MutableVectorStorer, error) {
+		return NewHNSWVectorStore(embedder), nil
+	}
+
+	conformance.Test(t, factory)
+}
@@ -0,0 +1,163 @@
+package hnsw
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/quant"
+)
+
+// Graph is the complete structure of an index, as exported for persistence.
+// Node i of the graph is referenced by index i in neighbour lists.
+type Graph struct {
+	Metric   vectorstore.Metric
+	M        int
+	Entry    int64
+	MaxLevel int
+	Nodes    []*GraphNode
+}
+
+// GraphNode is a node of an exported Graph
+type GraphNode struct {
+	Embedding *core.Embedding
+	Deleted   bool
+
+	// Friends holds the neighbour indexes of the node on each of its layers
+	Friends [][]uint32
+}
+
+// Export returns the structure of the index. Inserts running concurrently
+// may or may not be part of it.
+func (s *HNSWVectorStore) Export() *Graph {
+	s.graphMu.RLock()
+	defer s.graphMu.RUnlock()
+
+	s.mu.Lock()
+	nodes := *s.nodes.Load()
+	g := &Graph{
+		Metric:   s.metric,
+		M:        s.m,
+		Entry:    s.entry,
+		MaxLevel: s.maxLevel,
+		Nodes:    make([]*GraphNode, len(nodes)),
+	}
+	s.mu.Unlock()
+
+	for i, n := range nodes {
+		n.mu.Lock()
+		friends := make([][]uint32, len(n.friends))
+		for l, f := range n.friends {
+			friends[l] = append([]uint32(nil), f...)
+		}
+		n.mu.Unlock()
+
+		g.Nodes[i] = &GraphNode{Embedding: s.embedding(n), Deleted: n.deleted.Load(), Friends: friends}
+	}
+
+	return g
+}
+
+// Import returns an index with the structure of g, without recomputing any
+// distance. The metric and M of the graph override the options. Under the
+// cosine metric, vectors that are already unit length are used as is rather
+// than copied, so vectors backed by a memory mapped file stay on disk.
+//
+// An untrained quantizer is trained on a sample of the vectors of the graph.
+func Import(embedder core.Embedder, g *Graph, opts ...HNSWVectorStoreConfigFunc) (*HNSWVectorStore, error) {
+	opts = append(opts, WithMetric(g.Metric), WithM(g.M))
+	s := NewHNSWVectorStore(embedder, opts...)
+
+	nodes := make([]*node, len(g.Nodes))
+	for i, gn := range g.Nodes {
+		if gn.Embedding == nil || len(gn.Embedding.Vector) == 0 {
+			return nil, fmt.Errorf("node %d has no vector", i)
+		}
+		if s.dim == 0 {
+			s.dim = len(gn.Embedding.Vector)
+		}
+		if len(gn.Embedding.Vector) != s.dim {
+			return nil, fmt.Errorf("%w: node %d has %d dimensions, want %d", vectorstore.ErrDimensionMismatch, i, len(gn.Embedding.Vector), s.dim)
+		}
+		if len(gn.Friends) == 0 {
+			return nil, fmt.Errorf("node %d has no layer", i)
+		}
+
+		for _, friends := range gn.Friends {
+			for _, f := range friends {
+				if int(f) >= len(g.Nodes) {
+					return nil, fmt.Errorf("node %d links to unknown node %d", i, f)
+				}
+			}
+		}
+
+		n := &node{
+			index:   uint32(i),
+			emb:     gn.Embedding,
+			vec:     s.prepare(gn.Embedding.Vector),
+			level:   len(gn.Friends) - 1,
+			friends: gn.Friends,
+		}
+		if gn.Deleted {
+			n.deleted.Store(true)
+			s.deleted++
+		} else {
+			s.ids[gn.Embedding.ID] = uint32(i)
+		}
+
+		nodes[i] = n
+	}
+
+	if s.quantizer != nil && len(nodes) > 0 {
+		if !s.quantizer.Trained() {
+			sample := make([]core.Vec32, len(nodes))
+			for i, n := range nodes {
+				sample[i] = n.vec
+			}
+			if err := s.quantizer.Train(quant.Sample(sample, trainingSample, 1)); err != nil {
+				return nil, fmt.Errorf("error training quantizer: %w", err)
+			}
+		}
+		if s.quantizer.Dimensions() != s.dim {
+			return nil, fmt.Errorf("%w: quantizer has %d dimensions, graph has %d", vectorstore.ErrDimensionMismatch, s.quantizer.Dimensions(), s.dim)
+		}
+
+		for _, n := range nodes {
+			s.compress(n)
+		}
+	}
+
+	if g.Entry >= int64(len(nodes)) || (g.Entry < 0 && len(nodes) > 0) {
+		return nil, fmt.Errorf("invalid entry point %d", g.Entry)
+	}
+
+	s.nodes.Store(&nodes)
+	s.entry = g.Entry
+	s.maxLevel = g.MaxLevel
+
+	// keep drawing levels from a different sequence than the original build
+	s.rand = rand.New(rand.NewSource(int64(len(nodes)) + 1))
+
+	s.maybeCompact()
+
+	return s, nil
+}
+
+// trainingSample is the number of vectors Import trains a quantizer on
+const trainingSample = 50000
+
+// prepare returns the vector actually stored for v: a unit length version
+// under the cosine metric, v itself otherwise
+func (s *HNSWVectorStore) prepare(v core.Vec32) core.Vec32 {
+	if s.metric != vectorstore.Cosine {
+		return v
+	}
+
+	if norm := vectorstore.Dot(v, v); math.Abs(float64(norm)-1) < 1e-4 {
+		return v
+	}
+
+	return vectorstore.Normalize(v)
+}
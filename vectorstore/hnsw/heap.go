@@ -0,0 +1,104 @@
+package hnsw
+
+// candidate is a node along with its distance to the query
+type candidate struct {
+	index uint32
+	dist  float32
+}
+
+// distHeap is a binary heap of candidates. With max set the farthest
+// candidate is on top, otherwise the closest one.
+type distHeap struct {
+	items []candidate
+	max   bool
+}
+
+func (h *distHeap) less(i, j int) bool {
+	if h.max {
+		return h.items[i].dist > h.items[j].dist
+	}
+	return h.items[i].dist < h.items[j].dist
+}
+
+func (h *distHeap) len() int {
+	return len(h.items)
+}
+
+func (h *distHeap) top() candidate {
+	return h.items[0]
+}
+
+func (h *distHeap) push(c candidate) {
+	h.items = append(h.items, c)
+
+	i := len(h.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			break
+		}
+		h.items[i], h.items[parent] = h.items[parent], h.items[i]
+		i = parent
+	}
+}
+
+func (h *distHeap) pop() candidate {
+	top := h.items[0]
+	last := len(h.items) - 1
+	h.items[0] = h.items[last]
+	h.items = h.items[:last]
+
+	i := 0
+	for {
+		smallest := i
+		l, r := 2*i+1, 2*i+2
+		if l < len(h.items) && h.less(l, smallest) {
+			smallest = l
+		}
+		if r < len(h.items) && h.less(r, smallest) {
+			smallest = r
+		}
+		if smallest == i {
+			break
+		}
+		h.items[i], h.items[smallest] = h.items[smallest], h.items[i]
+		i = smallest
+	}
+
+	return top
+}
+
+// visitedSet marks visited nodes during a search. Marks are tagged with a
+// generation so that a set is reset in constant time and can be pooled.
+type visitedSet struct {
+	marks []uint32
+	gen   uint32
+}
+
+func (v *visitedSet) reset(n int) {
+	if len(v.marks) < n {
+		v.marks = make([]uint32, n+n/4)
+		v.gen = 0
+	}
+
+	v.gen++
+	if v.gen == 0 {
+		clear(v.marks)
+		v.gen = 1
+	}
+}
+
+// visit marks i and reports whether it was not visited before. Nodes added
+// since the last reset grow the set.
+func (v *visitedSet) visit(i uint32) bool {
+	if int(i) >= len(v.marks) {
+		v.marks = append(v.marks, make([]uint32, int(i)-len(v.marks)+1+len(v.marks)/4)...)
+	}
+
+	if v.marks[i] == v.gen {
+		return false
+	}
+
+	v.marks[i] = v.gen
+	return true
+}
@@ -0,0 +1,816 @@
+package hnsw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/quant"
+)
+
+// HNSWVectorStore implements core.VectorStorer with a Hierarchical Navigable
+// Small World graph (Malkov & Yashunin, 2016), an approximate nearest
+// neighbour index answering searches in roughly logarithmic time.
+//
+// Inserts and searches may run concurrently. Deleted embeddings are
+// tombstoned: they keep routing searches through the graph but are never
+// returned. Once tombstones make up half of the graph they are dropped and
+// their neighbours relinked, blocking inserts and searches meanwhile.
+//
+// With a quantizer, nodes keep compact codes instead of float vectors and
+// the graph is traversed with the estimated scores of the codes, see the
+// quant package.
+type HNSWVectorStore struct {
+	embedder       core.Embedder
+	metric         vectorstore.Metric
+	quantizer      quant.Quantizer
+	rescore        int
+	m              int
+	mMax0          int
+	efConstruction int
+	efSearch       atomic.Int64
+	levelMult      float64
+
+	// graphMu is held for reading by inserts, searches and exports, and for
+	// writing while tombstones are reclaimed, which renumbers the nodes
+	graphMu sync.RWMutex
+
+	// mu guards node registration, the ID index and the entry point. The
+	// node slice is published atomically so that searches and the linking
+	// phase of inserts never wait on it; neighbour lists are guarded by the
+	// lock of their node.
+	mu       sync.Mutex
+	nodes    atomic.Pointer[[]*node]
+	ids      map[string]uint32
+	entry    int64
+	maxLevel int
+	dim      int
+	deleted  int
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+
+	visited sync.Pool
+}
+
+type node struct {
+	index   uint32
+	emb     *core.Embedding
+	vec     core.Vec32
+	code    []byte
+	level   int
+	deleted atomic.Bool
+
+	mu      sync.Mutex
+	friends [][]uint32
+}
+
+// HNSWVectorStoreConfig holds configuration for a HNSWVectorStore
+type HNSWVectorStoreConfig struct {
+	// Metric used to compare vectors
+	// default vectorstore.Cosine
+	Metric vectorstore.Metric
+
+	// M is the number of neighbours of a node on upper layers, layer 0 keeps
+	// twice as many. Higher values improve recall at the cost of memory and
+	// insert time.
+	// default 16
+	M int
+
+	// EfConstruction is the size of the candidate list while inserting.
+	// Higher values build a better graph, slower.
+	// default 200
+	EfConstruction int
+
+	// EfSearch is the size of the candidate list while searching, raised to
+	// the search limit when lower. Higher values improve recall, slower.
+	// default 64
+	EfSearch int
+
+	// Seed of the level generator, for reproducible graphs
+	// default 1
+	Seed int64
+
+	// Quantizer compresses the vectors of the nodes, and must be trained
+	// before embeddings are added, unless the store is imported. Unless
+	// Rescore is set the float vectors are dropped: embeddings returned by
+	// Search, Get and Export then carry vectors decoded from their codes,
+	// and scores are estimates.
+	// default nil, vectors are kept as float32
+	Quantizer quant.Quantizer
+
+	// Rescore, with a Quantizer, keeps the embeddings as given and rescores
+	// the max(EfSearch, Limit × Rescore) candidates of a search with their
+	// vectors. The disk store keeps those vectors in its memory mapped
+	// snapshot rather than in memory.
+	// default 0
+	Rescore int
+}
+
+// HNSWVectorStoreConfigFunc is a function type that modifies HNSWVectorStoreConfig
+type HNSWVectorStoreConfigFunc func(*HNSWVectorStoreConfig)
+
+func WithMetric(m vectorstore.Metric) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.Metric = m
+	}
+}
+
+func WithM(m int) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.M = m
+	}
+}
+
+func WithEfConstruction(ef int) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.EfConstruction = ef
+	}
+}
+
+func WithEfSearch(ef int) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.EfSearch = ef
+	}
+}
+
+func WithSeed(seed int64) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.Seed = seed
+	}
+}
+
+func WithQuantizer(q quant.Quantizer) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.Quantizer = q
+	}
+}
+
+func WithRescore(factor int) HNSWVectorStoreConfigFunc {
+	return func(conf *HNSWVectorStoreConfig) {
+		conf.Rescore = factor
+	}
+}
+
+// NewHNSWVectorStore returns a new, empty HNSWVectorStore embedding contents
+// with the given embedder
+func NewHNSWVectorStore(embedder core.Embedder, opts ...HNSWVectorStoreConfigFunc) *HNSWVectorStore {
+	conf := &HNSWVectorStoreConfig{
+		Metric:         vectorstore.Cosine,
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+		Seed:           1,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	conf.M = max(conf.M, 2)
+
+	s := &HNSWVectorStore{
+		embedder:       embedder,
+		metric:         conf.Metric,
+		quantizer:      conf.Quantizer,
+		rescore:        max(conf.Rescore, 0),
+		m:              conf.M,
+		mMax0:          2 * conf.M,
+		efConstruction: max(conf.EfConstruction, conf.M),
+		levelMult:      1 / math.Log(float64(conf.M)),
+		ids:            map[string]uint32{},
+		entry:          -1,
+		rand:           rand.New(rand.NewSource(conf.Seed)),
+	}
+	s.efSearch.Store(int64(conf.EfSearch))
+	s.nodes.Store(&[]*node{})
+	s.visited.New = func() any { return &visitedSet{} }
+
+	return s
+}
+
+// SetEfSearch changes the size of the search candidate list
+func (s *HNSWVectorStore) SetEfSearch(ef int) {
+	s.efSearch.Store(int64(ef))
+}
+
+// Add embeds and stores contents
+func (s *HNSWVectorStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := vectorstore.Embed(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.AddEmbeddings(ctx, embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// AddEmbeddings inserts embeddings computed elsewhere. An embedding whose ID
+// is already stored replaces the previous one.
+func (s *HNSWVectorStore) AddEmbeddings(ctx context.Context, embeddings ...*core.Embedding) error {
+	defer s.maybeCompact()
+
+	for _, e := range embeddings {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		s.graphMu.RLock()
+		err := s.insert(e)
+		s.graphMu.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *HNSWVectorStore) insert(e *core.Embedding) error {
+	if len(e.Vector) == 0 {
+		return errors.New("embedding has no vector")
+	}
+	if e.ID == "" {
+		e.ID = vectorstore.NewID()
+	}
+
+	vec := s.prepare(e.Vector)
+
+	level := s.randomLevel()
+	n := &node{emb: e, vec: vec, level: level, friends: make([][]uint32, level+1)}
+	if s.quantizer != nil {
+		if !s.quantizer.Trained() {
+			return quant.ErrNotTrained
+		}
+		if len(vec) != s.quantizer.Dimensions() {
+			return fmt.Errorf("%w: got %d, want %d", vectorstore.ErrDimensionMismatch, len(vec), s.quantizer.Dimensions())
+		}
+		s.compress(n)
+	}
+	q := s.newTarget(vec)
+
+	// register the node
+	s.mu.Lock()
+	if s.dim == 0 {
+		s.dim = len(vec)
+	}
+	if len(vec) != s.dim {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: got %d, want %d", vectorstore.ErrDimensionMismatch, len(vec), s.dim)
+	}
+
+	nodes := *s.nodes.Load()
+	if old, ok := s.ids[e.ID]; ok && !nodes[old].deleted.Swap(true) {
+		s.deleted++
+	}
+
+	// readers holding the previous slice never index past its length, so
+	// appending in place is safe
+	n.index = uint32(len(nodes))
+	nodes = append(nodes, n)
+	s.nodes.Store(&nodes)
+	s.ids[e.ID] = n.index
+
+	entry, maxLevel := s.entry, s.maxLevel
+	if entry < 0 {
+		s.entry = int64(n.index)
+		s.maxLevel = level
+		s.mu.Unlock()
+		return nil
+	}
+	s.mu.Unlock()
+
+	// link it into the graph
+	cur := candidate{index: uint32(entry), dist: s.distTo(q, s.node(uint32(entry)))}
+	for l := maxLevel; l > level; l-- {
+		cur = s.greedy(q, cur, l)
+	}
+
+	for l := min(level, maxLevel); l >= 0; l-- {
+		candidates := s.searchLayer(q, cur, s.efConstruction, l, nil)
+		neighbors := s.selectNeighbors(candidates, s.m)
+
+		friends := make([]uint32, len(neighbors))
+		for i, nb := range neighbors {
+			friends[i] = nb.index
+		}
+		n.mu.Lock()
+		n.friends[l] = friends
+		n.mu.Unlock()
+
+		maxConn := s.m
+		if l == 0 {
+			maxConn = s.mMax0
+		}
+		for _, nb := range neighbors {
+			s.link(nb.index, n.index, nb.dist, l, maxConn)
+		}
+
+		cur = candidates[0]
+	}
+
+	// a node reaching above the graph becomes its entry point
+	if level > maxLevel {
+		s.mu.Lock()
+		if level > s.maxLevel {
+			s.maxLevel = level
+			s.entry = int64(n.index)
+		}
+		s.mu.Unlock()
+	}
+
+	return nil
+}
+
+// randomLevel draws the top layer of a new node from an exponentially
+// decaying distribution
+func (s *HNSWVectorStore) randomLevel() int {
+	s.randMu.Lock()
+	r := s.rand.Float64()
+	s.randMu.Unlock()
+
+	return int(-math.Log(1-r) * s.levelMult)
+}
+
+// dist is the metric turned into a distance: lower is closer
+func (s *HNSWVectorStore) dist(a, b core.Vec32) float32 {
+	switch s.metric {
+	case vectorstore.DotProduct:
+		return -vectorstore.Dot(a, b)
+	case vectorstore.L2:
+		return vectorstore.SquaredL2(a, b)
+	default:
+		// vectors are normalized
+		return 1 - vectorstore.Dot(a, b)
+	}
+}
+
+// score turns a distance back into the metric's score
+func (s *HNSWVectorStore) score(dist float32) float32 {
+	switch s.metric {
+	case vectorstore.DotProduct:
+		return -dist
+	case vectorstore.L2:
+		return 1 / (1 + float32(math.Sqrt(float64(dist))))
+	default:
+		return 1 - dist
+	}
+}
+
+// distOf turns a score of the metric into a distance, the reverse of score
+func (s *HNSWVectorStore) distOf(score float32) float32 {
+	switch s.metric {
+	case vectorstore.DotProduct:
+		return -score
+	case vectorstore.L2:
+		d := 1/score - 1
+		return d * d
+	default:
+		return 1 - score
+	}
+}
+
+// target is a vector searched for in the graph, along with the scorer of
+// codes of a quantized store
+type target struct {
+	vec   core.Vec32
+	score quant.Scorer
+}
+
+func (s *HNSWVectorStore) newTarget(vec core.Vec32) *target {
+	t := &target{vec: vec}
+	if s.quantizer != nil {
+		t.score = s.quantizer.Scorer(vec, s.metric)
+	}
+
+	return t
+}
+
+// distTo returns the distance from a target to a node, estimated from the
+// code of the node in a quantized store
+func (s *HNSWVectorStore) distTo(t *target, n *node) float32 {
+	if t.score != nil {
+		return s.distOf(t.score(n.code))
+	}
+
+	return s.dist(t.vec, n.vec)
+}
+
+// vector returns the vector of a node, decoded from its code in a quantized
+// store
+func (s *HNSWVectorStore) vector(n *node) core.Vec32 {
+	if n.vec != nil {
+		return n.vec
+	}
+
+	return s.quantizer.Decode(n.code)
+}
+
+// compress replaces the float vector of a node with its code. Without
+// rescoring the embedding is replaced with a copy without vector too, which
+// lets the caller's vector be collected.
+func (s *HNSWVectorStore) compress(n *node) {
+	n.code = s.quantizer.Encode(nil, n.vec)
+	n.vec = nil
+
+	if s.rescore == 0 {
+		stripped := *n.emb
+		stripped.Vector = nil
+		n.emb = &stripped
+	}
+}
+
+// embedding returns the embedding of a node, with the vector decoded from
+// its code when the store dropped the float one
+func (s *HNSWVectorStore) embedding(n *node) *core.Embedding {
+	if s.quantizer == nil || s.rescore > 0 {
+		return n.emb
+	}
+
+	e := *n.emb
+	e.Vector = s.quantizer.Decode(n.code)
+	return &e
+}
+
+// node returns a node by index. The slice is loaded on every call since
+// nodes linked after a search started are reachable from it.
+func (s *HNSWVectorStore) node(index uint32) *node {
+	return (*s.nodes.Load())[index]
+}
+
+// friendsOf appends the neighbours of a node on a layer to buf
+func (s *HNSWVectorStore) friendsOf(buf []uint32, index uint32, level int) []uint32 {
+	n := s.node(index)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if level >= len(n.friends) {
+		return buf[:0]
+	}
+
+	return append(buf[:0], n.friends[level]...)
+}
+
+// greedy walks a layer towards the query until no neighbour is closer
+func (s *HNSWVectorStore) greedy(q *target, cur candidate, level int) candidate {
+	var friends []uint32
+	for changed := true; changed; {
+		changed = false
+		friends = s.friendsOf(friends, cur.index, level)
+		for _, f := range friends {
+			if d := s.distTo(q, s.node(f)); d < cur.dist {
+				cur = candidate{index: f, dist: d}
+				changed = true
+			}
+		}
+	}
+
+	return cur
+}
+
+// searchLayer returns the ef nodes of a layer closest to the query, closest
+// first. With accept set, only accepted nodes are returned while the others
+// still route the search: the traversal widens until it finds ef accepted
+// nodes or runs out of reachable ones, so that a selective filter degrades
+// into an exhaustive scan instead of missing results.
+func (s *HNSWVectorStore) searchLayer(q *target, entry candidate, ef int, level int, accept func(*node) bool) []candidate {
+	visited := s.visited.Get().(*visitedSet)
+	defer s.visited.Put(visited)
+	visited.reset(len(*s.nodes.Load()))
+	visited.visit(entry.index)
+
+	candidates := &distHeap{items: []candidate{entry}}
+	results := &distHeap{max: true}
+	if accept == nil || accept(s.node(entry.index)) {
+		results.push(entry)
+	}
+	var friends []uint32
+
+	for candidates.len() > 0 {
+		c := candidates.pop()
+		if results.len() >= ef && c.dist > results.top().dist {
+			break
+		}
+
+		friends = s.friendsOf(friends, c.index, level)
+		for _, f := range friends {
+			if !visited.visit(f) {
+				continue
+			}
+
+			n := s.node(f)
+			d := s.distTo(q, n)
+			if results.len() < ef || d < results.top().dist {
+				candidates.push(candidate{index: f, dist: d})
+				if accept != nil && !accept(n) {
+					continue
+				}
+
+				results.push(candidate{index: f, dist: d})
+				if results.len() > ef {
+					results.pop()
+				}
+			}
+		}
+	}
+
+	out := results.items
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].dist < out[j].dist
+	})
+
+	return out
+}
+
+// selectNeighbors picks up to m neighbours out of candidates sorted closest
+// first, with the heuristic of the paper: a candidate is skipped when it is
+// closer to an already selected neighbour than to the base node, which keeps
+// links spread in all directions. Skipped candidates fill remaining slots.
+func (s *HNSWVectorStore) selectNeighbors(candidates []candidate, m int) []candidate {
+	if len(candidates) <= m {
+		return candidates
+	}
+
+	selected := make([]candidate, 0, m)
+	// vectors of the selected candidates, decoded once in a quantized store
+	selectedVecs := make([]core.Vec32, 0, m)
+	skipped := []candidate{}
+
+	for _, c := range candidates {
+		if len(selected) >= m {
+			break
+		}
+
+		vec := s.vector(s.node(c.index))
+		good := true
+		for _, sel := range selectedVecs {
+			if s.dist(vec, sel) < c.dist {
+				good = false
+				break
+			}
+		}
+
+		if good {
+			selected = append(selected, c)
+			selectedVecs = append(selectedVecs, vec)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	for _, c := range skipped {
+		if len(selected) >= m {
+			break
+		}
+		selected = append(selected, c)
+	}
+
+	return selected
+}
+
+// link adds a backlink from target to a new node, shrinking the neighbour
+// list of target when it overflows
+func (s *HNSWVectorStore) link(target, index uint32, dist float32, level, maxConn int) {
+	t := s.node(target)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.friends[level]) < maxConn {
+		t.friends[level] = append(t.friends[level], index)
+		return
+	}
+
+	candidates := make([]candidate, 0, len(t.friends[level])+1)
+	candidates = append(candidates, candidate{index: index, dist: dist})
+	vec := s.vector(t)
+	for _, f := range t.friends[level] {
+		candidates = append(candidates, candidate{index: f, dist: s.dist(vec, s.vector(s.node(f)))})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].dist < candidates[j].dist
+	})
+
+	selected := s.selectNeighbors(candidates, maxConn)
+	friends := make([]uint32, len(selected))
+	for i, c := range selected {
+		friends[i] = c.index
+	}
+	t.friends[level] = friends
+}
+
+// Search returns the approximate Limit nearest embeddings to the query, best
+// first, leaving out those scoring below Threshold and those not matching
+// Filter. Filtering happens during the traversal of the graph, so restrictive
+// filters still fill the results.
+func (s *HNSWVectorStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if err := vectorstore.ValidateFilter(params); err != nil {
+		return nil, err
+	}
+
+	query, err := vectorstore.QueryVector(ctx, s.embedder, params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.graphMu.RLock()
+	defer s.graphMu.RUnlock()
+
+	s.mu.Lock()
+	entry, maxLevel, dim := s.entry, s.maxLevel, s.dim
+	s.mu.Unlock()
+
+	if entry < 0 {
+		return []*core.SearchResult{}, nil
+	}
+
+	if len(query) != dim {
+		return nil, fmt.Errorf("%w: query has %d dimensions, store has %d", vectorstore.ErrDimensionMismatch, len(query), dim)
+	}
+
+	if s.metric == vectorstore.Cosine {
+		query = vectorstore.Normalize(query)
+	}
+
+	limit := vectorstore.Limit(params)
+	ef := max(int(s.efSearch.Load()), limit)
+	rescore := s.quantizer != nil && s.rescore > 0
+	if rescore {
+		ef = max(ef, limit*s.rescore)
+	}
+
+	q := s.newTarget(query)
+	cur := candidate{index: uint32(entry), dist: s.distTo(q, s.node(uint32(entry)))}
+	for l := maxLevel; l > 0; l-- {
+		cur = s.greedy(q, cur, l)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// tombstones and filtered out nodes route the search but are not
+	// returned
+	accept := func(n *node) bool {
+		return !n.deleted.Load() && params.Filter.Match(n.emb.Metadata)
+	}
+
+	top := vectorstore.NewTopK(limit)
+	for _, c := range s.searchLayer(q, cur, ef, 0, accept) {
+		n := s.node(c.index)
+		score := s.score(c.dist)
+		if rescore {
+			// the embedding holds the vector as given, unit length or not
+			score = s.metric.Score(query, n.emb.Vector)
+		}
+		if vectorstore.Passes(params, score) && top.Accepts(score) {
+			top.Push(score, s.embedding(n))
+		}
+	}
+
+	return top.Results(params), nil
+}
+
+// Delete tombstones the embeddings with the given IDs. Unknown IDs are
+// ignored.
+func (s *HNSWVectorStore) Delete(ctx context.Context, ids ...string) error {
+	defer s.maybeCompact()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		index, ok := s.ids[id]
+		if !ok {
+			continue
+		}
+
+		delete(s.ids, id)
+		if !s.node(index).deleted.Swap(true) {
+			s.deleted++
+		}
+	}
+
+	return nil
+}
+
+// Upsert inserts embeddings, embedding the content of those without a vector
+func (s *HNSWVectorStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	if err := vectorstore.EmbedMissing(ctx, s.embedder, embeddings); err != nil {
+		return err
+	}
+
+	return s.AddEmbeddings(ctx, embeddings...)
+}
+
+// DeleteWhere tombstones the embeddings matching filter
+func (s *HNSWVectorStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	defer s.maybeCompact()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for id, index := range s.ids {
+		n := s.node(index)
+		if !filter.Match(n.emb.Metadata) {
+			continue
+		}
+
+		delete(s.ids, id)
+		if !n.deleted.Swap(true) {
+			s.deleted++
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// Get returns the live embeddings with the given IDs
+func (s *HNSWVectorStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]*core.Embedding, 0, len(ids))
+	for _, id := range ids {
+		if index, ok := s.ids[id]; ok {
+			out = append(out, s.embedding(s.node(index)))
+		}
+	}
+
+	return out, nil
+}
+
+// Count returns the number of live embeddings matching filter
+func (s *HNSWVectorStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	if filter != nil {
+		if err := filter.Validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if filter == nil {
+		return len(s.ids), nil
+	}
+
+	n := 0
+	for _, index := range s.ids {
+		if filter.Match(s.node(index).emb.Metadata) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Len returns the number of live embeddings
+func (s *HNSWVectorStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(*s.nodes.Load()) - s.deleted
+}
+
+// Close drops the whole graph
+func (s *HNSWVectorStore) Close() error {
+	s.graphMu.Lock()
+	defer s.graphMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nodes.Store(&[]*node{})
+	s.ids = map[string]uint32{}
+	s.entry = -1
+	s.maxLevel = 0
+	s.dim = 0
+	s.deleted = 0
+
+	return nil
+}
+
+// NewCollections returns a core.CollectionManager keeping each collection in
+// its own store, configured with opts. Collections live as long as the
+// process.
+func NewCollections(embedder core.Embedder, opts ...HNSWVectorStoreConfigFunc) *vectorstore.Collections {
+	return vectorstore.NewCollections(func(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+		return NewHNSWVectorStore(embedder, opts...), nil
+	})
+}
@@ -0,0 +1,185 @@
+package hnsw
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore/bench"
+	"github.com/joaopandolfi/core/vectorstore/memory"
+)
+
+// recall returns the recall@k of store against the brute force memory store
+// holding data
+func recall(t testing.TB, store core.VectorStorer, data, queries []*core.Embedding, k int) float64 {
+	t.Helper()
+
+	exact := memory.NewMemoryVectorStore(nil)
+	if err := exact.AddEmbeddings(data...); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := bench.Compare(context.Background(), exact, store, queries, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report.Recall
+}
+
+func newStore(t testing.TB, data []*core.Embedding, opts ...HNSWVectorStoreConfigFunc) *HNSWVectorStore {
+	t.Helper()
+
+	s := NewHNSWVectorStore(nil, opts...)
+	if err := s.AddEmbeddings(context.Background(), data...); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestRecall(t *testing.T) {
+	data := bench.RandomVectors(5000, 32, 1)
+	queries := bench.RandomVectors(100, 32, 2)
+
+	if r := recall(t, newStore(t, data), data, queries, 10); r < 0.95 {
+		t.Errorf("recall@10 %.3f, want at least 0.95", r)
+	}
+}
+
+func TestCompaction(t *testing.T) {
+	ctx := context.Background()
+	data := bench.RandomVectors(2000, 32, 1)
+	queries := bench.RandomVectors(100, 32, 2)
+	s := newStore(t, data)
+
+	// delete three quarters of the embeddings, in several calls
+	ids := []string{}
+	for i := range data {
+		if i%4 != 0 {
+			ids = append(ids, data[i].ID)
+		}
+	}
+	for len(ids) > 0 {
+		n := min(100, len(ids))
+		if err := s.Delete(ctx, ids[:n]...); err != nil {
+			t.Fatal(err)
+		}
+		ids = ids[n:]
+	}
+
+	live := []*core.Embedding{}
+	for i := 0; i < len(data); i += 4 {
+		live = append(live, data[i])
+	}
+
+	if got := s.Len(); got != len(live) {
+		t.Errorf("Len %d, want %d", got, len(live))
+	}
+	if nodes := len(s.Export().Nodes); nodes > len(live)*2 {
+		t.Errorf("%d nodes for %d live embeddings: tombstones were not reclaimed", nodes, len(live))
+	}
+
+	got, err := s.Get(ctx, live[0].ID, data[1].ID)
+	if err != nil || len(got) != 1 || got[0].ID != live[0].ID {
+		t.Errorf("Get after compaction: %v, %v", got, err)
+	}
+
+	if r := recall(t, s, live, queries, 10); r < 0.95 {
+		t.Errorf("recall@10 after compaction %.3f, want at least 0.95", r)
+	}
+
+	// every replaced embedding leaves a tombstone
+	if err := s.Upsert(ctx, live...); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Upsert(ctx, live...); err != nil {
+		t.Fatal(err)
+	}
+	if nodes := len(s.Export().Nodes); nodes > len(live)*2 {
+		t.Errorf("%d nodes for %d live embeddings after upserts", nodes, len(live))
+	}
+	if r := recall(t, s, live, queries, 10); r < 0.95 {
+		t.Errorf("recall@10 after upserts %.3f, want at least 0.95", r)
+	}
+}
+
+func TestCompactionConcurrentSearches(t *testing.T) {
+	ctx := context.Background()
+	data := bench.RandomVectors(1000, 16, 1)
+	s := newStore(t, data[:500])
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for _, e := range data[:450] {
+			if err := s.Delete(ctx, e.ID); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := s.AddEmbeddings(ctx, data[500:]...); err != nil {
+			t.Error(err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for _, q := range data[:200] {
+			results, err := s.Search(ctx, &core.SearchParams{QueryVec: q.Vector, Limit: 5})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, r := range results {
+				if r.Embedding == nil {
+					t.Error("result without embedding")
+				}
+			}
+		}
+	}()
+	wg.Wait()
+
+	if got, want := s.Len(), 550; got != want {
+		t.Errorf("Len %d, want %d", got, want)
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	for _, dim := range []int{128, 384} {
+		b.Run(fmt.Sprintf("dim=%d", dim), func(b *testing.B) {
+			data := bench.RandomVectors(b.N, dim, 1)
+			s := NewHNSWVectorStore(nil)
+
+			b.ResetTimer()
+			if err := s.AddEmbeddings(context.Background(), data...); err != nil {
+				b.Fatal(err)
+			}
+		})
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	ctx := context.Background()
+	data := bench.RandomVectors(20000, 128, 1)
+	queries := bench.RandomVectors(200, 128, 2)
+	s := newStore(b, data)
+
+	for _, ef := range []int{16, 64, 256} {
+		s.SetEfSearch(ef)
+		r := recall(b, s, data, queries, 10)
+
+		b.Run(fmt.Sprintf("ef=%d", ef), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.Search(ctx, &core.SearchParams{QueryVec: queries[i%len(queries)].Vector, Limit: 10}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(r, "recall@10")
+		})
+	}
+}
@@ -0,0 +1,351 @@
+// Package hybrid combines a lexical index and a vector store into a single
+// retriever, so that searches match both meaning and exact terms:
+//
+//	lexical := bm25.NewIndex()
+//	vectors := hnsw.NewHNSWVectorStore(embedder)
+//	retriever := hybrid.NewRetriever(lexical, vectors)
+//
+//	retriever.Add(ctx, contents)
+//	results, err := retriever.Search(ctx, &core.SearchParams{Query: "error E1042"})
+package hybrid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// Fusion is the way a Retriever merges the rankings of its stores
+type Fusion int
+
+const (
+	// RRF is reciprocal rank fusion: each result scores the sum over the
+	// rankings it appears in of 1/(k+rank). It needs no calibration between
+	// the score scales of the stores.
+	RRF Fusion = iota
+	// Weighted blends the scores of each store, min-max normalized over its
+	// results, with the vector weight
+	Weighted
+)
+
+func (f Fusion) String() string {
+	switch f {
+	case RRF:
+		return "rrf"
+	case Weighted:
+		return "weighted"
+	default:
+		return fmt.Sprintf("Fusion(%d)", int(f))
+	}
+}
+
+// Retriever implements core.MutableVectorStorer over a lexical store, such as
+// a bm25.Index, and a vector store holding the same embeddings. Writes go to
+// both stores; searches query both concurrently and fuse their rankings.
+//
+// The lexical store is only queried for searches with a text query. Search
+// thresholds apply to the fused score, not to the scores of the stores.
+// Under RRF, fused scores are at most 1/(RRFK+1), about 0.016 by default,
+// so thresholds meant for cosine similarities drop every result; use
+// Weighted fusion, whose scores range from 0 to 1, to search with one.
+type Retriever struct {
+	lexical    core.MutableVectorStorer
+	vector     core.VectorStorer
+	fusion     Fusion
+	rrfK       float64
+	weight     float32
+	candidates int
+}
+
+// RetrieverConfig holds configuration for a Retriever
+type RetrieverConfig struct {
+	// Fusion merging the rankings
+	// default RRF
+	Fusion Fusion
+
+	// RRFK is the k constant of reciprocal rank fusion. Higher values flatten
+	// the advantage of top ranks.
+	// default 60
+	RRFK float64
+
+	// VectorWeight is the weight of vector scores under Weighted fusion,
+	// lexical scores getting the rest. It is also the weight of the vector
+	// ranking under RRF.
+	// default 0.5
+	VectorWeight float32
+
+	// Candidates is the number of results fetched from each store before
+	// fusion, raised to the search limit if needed
+	// default 50
+	Candidates int
+}
+
+// RetrieverConfigFunc is a function type that modifies RetrieverConfig
+type RetrieverConfigFunc func(*RetrieverConfig)
+
+func WithFusion(f Fusion) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Fusion = f
+	}
+}
+
+func WithRRFK(k float64) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.RRFK = k
+	}
+}
+
+func WithVectorWeight(w float32) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.VectorWeight = w
+	}
+}
+
+func WithCandidates(n int) RetrieverConfigFunc {
+	return func(conf *RetrieverConfig) {
+		conf.Candidates = n
+	}
+}
+
+// NewRetriever returns a new Retriever over the given stores
+func NewRetriever(lexical core.MutableVectorStorer, vector core.VectorStorer, opts ...RetrieverConfigFunc) *Retriever {
+	conf := &RetrieverConfig{
+		Fusion:       RRF,
+		RRFK:         60,
+		VectorWeight: 0.5,
+		Candidates:   50,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &Retriever{
+		lexical:    lexical,
+		vector:     vector,
+		fusion:     conf.Fusion,
+		rrfK:       conf.RRFK,
+		weight:     min(max(conf.VectorWeight, 0), 1),
+		candidates: conf.Candidates,
+	}
+}
+
+// Add embeds and stores contents in the vector store, then indexes them
+// under the same IDs in the lexical store
+func (r *Retriever) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := r.vector.Add(ctx, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.lexical.Upsert(ctx, embeddings...); err != nil {
+		return nil, fmt.Errorf("error indexing contents: %w", err)
+	}
+
+	return embeddings, nil
+}
+
+// mutable returns the vector store as a core.MutableVectorStorer
+func (r *Retriever) mutable() (core.MutableVectorStorer, error) {
+	m, ok := r.vector.(core.MutableVectorStorer)
+	if !ok {
+		return nil, fmt.Errorf("vector store %T does not support updates", r.vector)
+	}
+
+	return m, nil
+}
+
+// Upsert stores embeddings in both stores
+func (r *Retriever) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	vector, err := r.mutable()
+	if err != nil {
+		return err
+	}
+
+	if err := vector.Upsert(ctx, embeddings...); err != nil {
+		return err
+	}
+
+	if err := r.lexical.Upsert(ctx, embeddings...); err != nil {
+		return fmt.Errorf("error indexing contents: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the embeddings with the given IDs from both stores
+func (r *Retriever) Delete(ctx context.Context, ids ...string) error {
+	vector, err := r.mutable()
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(vector.Delete(ctx, ids...), r.lexical.Delete(ctx, ids...))
+}
+
+// DeleteWhere removes the embeddings matching filter from both stores and
+// returns how many the vector store removed
+func (r *Retriever) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	vector, err := r.mutable()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := vector.DeleteWhere(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := r.lexical.DeleteWhere(ctx, filter); err != nil {
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Get returns the embeddings with the given IDs from the vector store
+func (r *Retriever) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	vector, err := r.mutable()
+	if err != nil {
+		return nil, err
+	}
+
+	return vector.Get(ctx, ids...)
+}
+
+// Count returns the number of embeddings of the vector store matching filter
+func (r *Retriever) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	vector, err := r.mutable()
+	if err != nil {
+		return 0, err
+	}
+
+	return vector.Count(ctx, filter)
+}
+
+// Search returns the Limit best embeddings according to both stores, best
+// first. Results carry the fused score, which Threshold applies to.
+func (r *Retriever) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	limit := vectorstore.Limit(params)
+	sub := *params
+	sub.Limit = max(r.candidates, limit)
+	sub.Threshold = 0
+
+	var (
+		wg                 sync.WaitGroup
+		lexical, vector    []*core.SearchResult
+		lexicalErr, vecErr error
+	)
+
+	if params.Query != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lexical, lexicalErr = r.lexical.Search(ctx, &sub)
+		}()
+	}
+	vector, vecErr = r.vector.Search(ctx, &sub)
+	wg.Wait()
+
+	if vecErr != nil {
+		return nil, fmt.Errorf("error searching vector store: %w", vecErr)
+	}
+	if lexicalErr != nil {
+		return nil, fmt.Errorf("error searching lexical store: %w", lexicalErr)
+	}
+
+	var fused map[string]*core.SearchResult
+	switch r.fusion {
+	case Weighted:
+		fused = r.blend(vector, lexical)
+	default:
+		fused = r.rrf(vector, lexical)
+	}
+
+	out := make([]*core.SearchResult, 0, len(fused))
+	for _, res := range fused {
+		if vectorstore.Passes(params, res.Score) {
+			res.SearchMeta = params
+			out = append(out, res)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Embedding.ID < out[j].Embedding.ID
+	})
+
+	if len(out) > limit {
+		out = out[:limit]
+	}
+
+	return out, nil
+}
+
+// rrf fuses rankings by reciprocal rank
+func (r *Retriever) rrf(vector, lexical []*core.SearchResult) map[string]*core.SearchResult {
+	fused := map[string]*core.SearchResult{}
+	add := func(results []*core.SearchResult, weight float32) {
+		for rank, res := range results {
+			score := weight / float32(r.rrfK+float64(rank+1))
+			merge(fused, res, score)
+		}
+	}
+
+	add(vector, r.weight)
+	add(lexical, 1-r.weight)
+
+	return fused
+}
+
+// blend fuses rankings by weighted, min-max normalized scores
+func (r *Retriever) blend(vector, lexical []*core.SearchResult) map[string]*core.SearchResult {
+	fused := map[string]*core.SearchResult{}
+	add := func(results []*core.SearchResult, weight float32) {
+		if len(results) == 0 {
+			return
+		}
+
+		lo, hi := results[0].Score, results[0].Score
+		for _, res := range results {
+			lo = min(lo, res.Score)
+			hi = max(hi, res.Score)
+		}
+
+		for _, res := range results {
+			norm := float32(1)
+			if hi > lo {
+				norm = (res.Score - lo) / (hi - lo)
+			}
+			merge(fused, res, weight*norm)
+		}
+	}
+
+	add(vector, r.weight)
+	add(lexical, 1-r.weight)
+
+	return fused
+}
+
+// merge adds score to the fused result of res. The embedding of the vector
+// store, added first, is kept since it holds the vector.
+func merge(fused map[string]*core.SearchResult, res *core.SearchResult, score float32) {
+	if f, ok := fused[res.Embedding.ID]; ok {
+		f.Score += score
+		return
+	}
+
+	fused[res.Embedding.ID] = &core.SearchResult{Score: score, Embedding: res.Embedding}
+}
+
+// Close closes both stores
+func (r *Retriever) Close() error {
+	return errors.Join(r.vector.Close(), r.lexical.Close())
+}
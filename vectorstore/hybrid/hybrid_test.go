@@ -0,0 +1,107 @@
+package hybrid
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+// rankedStore returns fixed results, ignoring the query
+type rankedStore struct {
+	core.MutableVectorStorer
+	results []*core.SearchResult
+	queried bool
+}
+
+func (s *rankedStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	s.queried = true
+	return s.results[:min(params.Limit, len(s.results))], nil
+}
+
+// ranking returns a store ranking ids with the given scores
+func ranking(ids []string, scores []float32) *rankedStore {
+	s := &rankedStore{}
+	for i, id := range ids {
+		s.results = append(s.results, &core.SearchResult{Embedding: &core.Embedding{ID: id}, Score: scores[i]})
+	}
+
+	return s
+}
+
+func ids(results []*core.SearchResult) string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.Embedding.ID
+	}
+
+	return fmt.Sprint(out)
+}
+
+func TestFusion(t *testing.T) {
+	vector := func() *rankedStore {
+		return ranking([]string{"a", "b", "c"}, []float32{0.9, 0.8, 0.1})
+	}
+	lexical := func() *rankedStore {
+		return ranking([]string{"c", "a"}, []float32{10, 2})
+	}
+
+	tests := map[string]struct {
+		opts   []RetrieverConfigFunc
+		params *core.SearchParams
+		want   string
+	}{
+		// a: 1/61 + 1/62, c: 1/63 + 1/61, b: 1/62, halved
+		"rrf": {nil, &core.SearchParams{Query: "q"}, "[a c b]"},
+		// lexical ranks count for nothing
+		"rrf vector only": {[]RetrieverConfigFunc{WithVectorWeight(1)}, &core.SearchParams{Query: "q"}, "[a b c]"},
+		// vector ranks count for nothing, b is ranked by no one
+		"rrf lexical only":  {[]RetrieverConfigFunc{WithVectorWeight(0)}, &core.SearchParams{Query: "q"}, "[c a b]"},
+		"rrf without query": {nil, &core.SearchParams{QueryVec: core.Vec32{1}}, "[a b c]"},
+		"rrf limit":         {nil, &core.SearchParams{Query: "q", Limit: 2}, "[a c]"},
+		// a: 0.5, b: 0.4375, c: 0.5, ties broken by ID
+		"weighted": {[]RetrieverConfigFunc{WithFusion(Weighted)}, &core.SearchParams{Query: "q"}, "[a c b]"},
+		// a: 0.3, b: 0.2625, c: 0.7
+		"weighted toward lexical": {[]RetrieverConfigFunc{WithFusion(Weighted), WithVectorWeight(0.3)}, &core.SearchParams{Query: "q"}, "[c a b]"},
+		"weighted threshold":      {[]RetrieverConfigFunc{WithFusion(Weighted)}, &core.SearchParams{Query: "q", Threshold: 0.45}, "[a c]"},
+		// fused RRF scores never reach a similarity threshold
+		"rrf threshold": {nil, &core.SearchParams{Query: "q", Threshold: 0.1}, "[]"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			lex := lexical()
+			r := NewRetriever(lex, vector(), tt.opts...)
+
+			results, err := r.Search(context.Background(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(results); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+			if lex.queried != (tt.params.Query != "") {
+				t.Errorf("lexical store queried %v", lex.queried)
+			}
+		})
+	}
+}
+
+func TestRRFScores(t *testing.T) {
+	r := NewRetriever(ranking([]string{"a", "b"}, []float32{5, 1}), ranking([]string{"a", "b"}, []float32{0.9, 0.2}))
+
+	results, err := r.Search(context.Background(), &core.SearchParams{Query: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// first in both rankings, the highest score RRF gives
+	if want := float32(1.0 / 61); math.Abs(float64(results[0].Score-want)) > 1e-6 {
+		t.Errorf("got %v, want %v", results[0].Score, want)
+	}
+	if want := float32(1.0 / 62); math.Abs(float64(results[1].Score-want)) > 1e-6 {
+		t.Errorf("got %v, want %v", results[1].Score, want)
+	}
+}
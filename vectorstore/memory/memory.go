@@ -0,0 +1,451 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/quant"
+)
+
+// MemoryVectorStore implements core.VectorStorer with an exact, brute force
+// search over embeddings kept in memory. Every search scores every stored
+// vector, which is fast enough for corpora of up to a few hundred thousand
+// vectors and makes it the reference the approximate stores are measured
+// against.
+//
+// With a quantizer, the store scans compact codes instead of float vectors,
+// see the quant package.
+type MemoryVectorStore struct {
+	embedder  core.Embedder
+	metric    vectorstore.Metric
+	quantizer quant.Quantizer
+	rescore   int
+
+	mu         sync.RWMutex
+	embeddings []*core.Embedding
+	// vectors are the vectors actually scored: normalized copies for the
+	// cosine metric, the embeddings' own vectors otherwise. With a
+	// quantizer they are only kept for rescoring.
+	vectors []core.Vec32
+	// codes holds the codes of the quantized vectors one after the other,
+	// codeSize bytes apiece
+	codes    []byte
+	codeSize int
+	ids      map[string]int
+	dim      int
+}
+
+// MemoryVectorStoreConfig holds configuration for a MemoryVectorStore
+type MemoryVectorStoreConfig struct {
+	// Metric used to compare vectors
+	// default vectorstore.Cosine
+	Metric vectorstore.Metric
+
+	// Quantizer compresses the vectors searched, and must be trained before
+	// embeddings are added. Unless Rescore is set the float vectors are
+	// dropped: embeddings returned by Search and Get then carry vectors
+	// decoded from their codes, and scores are estimates.
+	// default nil, vectors are kept as float32
+	Quantizer quant.Quantizer
+
+	// Rescore, with a Quantizer, keeps the float vectors and rescores the
+	// Limit × Rescore best candidates of the quantized scan with them. This
+	// speeds up searches with compact codes, mostly binary ones, without
+	// saving memory.
+	// default 0
+	Rescore int
+}
+
+// MemoryVectorStoreConfigFunc is a function type that modifies MemoryVectorStoreConfig
+type MemoryVectorStoreConfigFunc func(*MemoryVectorStoreConfig)
+
+func WithMetric(m vectorstore.Metric) MemoryVectorStoreConfigFunc {
+	return func(conf *MemoryVectorStoreConfig) {
+		conf.Metric = m
+	}
+}
+
+func WithQuantizer(q quant.Quantizer) MemoryVectorStoreConfigFunc {
+	return func(conf *MemoryVectorStoreConfig) {
+		conf.Quantizer = q
+	}
+}
+
+func WithRescore(factor int) MemoryVectorStoreConfigFunc {
+	return func(conf *MemoryVectorStoreConfig) {
+		conf.Rescore = factor
+	}
+}
+
+// NewMemoryVectorStore returns a new MemoryVectorStore embedding contents with
+// the given embedder
+func NewMemoryVectorStore(embedder core.Embedder, opts ...MemoryVectorStoreConfigFunc) *MemoryVectorStore {
+	conf := &MemoryVectorStoreConfig{
+		Metric: vectorstore.Cosine,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &MemoryVectorStore{
+		embedder:  embedder,
+		metric:    conf.Metric,
+		quantizer: conf.Quantizer,
+		rescore:   max(conf.Rescore, 0),
+		ids:       map[string]int{},
+	}
+}
+
+// Add embeds and stores contents
+func (s *MemoryVectorStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := vectorstore.Embed(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.AddEmbeddings(embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// AddEmbeddings stores embeddings computed elsewhere. Embeddings without an ID
+// get a random one, and an embedding whose ID is already stored replaces the
+// previous one.
+func (s *MemoryVectorStore) AddEmbeddings(embeddings ...*core.Embedding) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dim := s.dim
+	if s.quantizer != nil {
+		if !s.quantizer.Trained() {
+			return quant.ErrNotTrained
+		}
+		dim = s.quantizer.Dimensions()
+		s.codeSize = s.quantizer.CodeSize()
+	}
+
+	for _, e := range embeddings {
+		if len(e.Vector) == 0 {
+			return errors.New("embedding has no vector")
+		}
+		if dim == 0 {
+			dim = len(e.Vector)
+		}
+		if len(e.Vector) != dim {
+			return fmt.Errorf("%w: got %d, want %d", vectorstore.ErrDimensionMismatch, len(e.Vector), dim)
+		}
+	}
+
+	s.dim = dim
+	for _, e := range embeddings {
+		if e.ID == "" {
+			e.ID = vectorstore.NewID()
+		}
+
+		v := e.Vector
+		if s.metric == vectorstore.Cosine {
+			v = vectorstore.Normalize(v)
+		}
+
+		if s.quantizer != nil {
+			if i, ok := s.ids[e.ID]; ok {
+				// a slice of capacity codeSize is overwritten in place
+				s.quantizer.Encode(s.codes[i*s.codeSize:i*s.codeSize:(i+1)*s.codeSize], v)
+			} else {
+				s.codes = s.quantizer.Encode(s.codes, v)
+			}
+
+			if s.rescore == 0 {
+				v = nil
+				stripped := *e
+				stripped.Vector = nil
+				e = &stripped
+			}
+		}
+
+		if i, ok := s.ids[e.ID]; ok {
+			s.embeddings[i] = e
+			s.vectors[i] = v
+			continue
+		}
+
+		s.ids[e.ID] = len(s.embeddings)
+		s.embeddings = append(s.embeddings, e)
+		s.vectors = append(s.vectors, v)
+	}
+
+	return nil
+}
+
+// code returns the code of embedding i
+func (s *MemoryVectorStore) code(i int) []byte {
+	return s.codes[i*s.codeSize : (i+1)*s.codeSize]
+}
+
+// decoded returns embedding i, with the vector decoded from its code when
+// the store dropped the float one
+func (s *MemoryVectorStore) decoded(i int) *core.Embedding {
+	e := s.embeddings[i]
+	if s.quantizer == nil || s.rescore > 0 {
+		return e
+	}
+
+	c := *e
+	c.Vector = s.quantizer.Decode(s.code(i))
+	return &c
+}
+
+// Upsert stores embeddings, embedding the content of those without a vector
+func (s *MemoryVectorStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	if err := vectorstore.EmbedMissing(ctx, s.embedder, embeddings); err != nil {
+		return err
+	}
+
+	return s.AddEmbeddings(embeddings...)
+}
+
+// Delete removes the embeddings with the given IDs. Unknown IDs are ignored.
+func (s *MemoryVectorStore) Delete(ctx context.Context, ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range ids {
+		if i, ok := s.ids[id]; ok {
+			s.remove(i)
+		}
+	}
+
+	return nil
+}
+
+// DeleteWhere removes the embeddings matching filter
+func (s *MemoryVectorStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// walking backwards, the embedding moved into a removed slot was already
+	// checked
+	removed := 0
+	for i := len(s.embeddings) - 1; i >= 0; i-- {
+		if filter.Match(s.embeddings[i].Metadata) {
+			s.remove(i)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// remove drops embedding i by moving the last one into its slot. It must be
+// called with mu held.
+func (s *MemoryVectorStore) remove(i int) {
+	last := len(s.embeddings) - 1
+	delete(s.ids, s.embeddings[i].ID)
+
+	if i != last {
+		s.embeddings[i] = s.embeddings[last]
+		s.vectors[i] = s.vectors[last]
+		s.ids[s.embeddings[i].ID] = i
+		if s.codes != nil {
+			copy(s.code(i), s.code(last))
+		}
+	}
+
+	s.embeddings[last] = nil
+	s.vectors[last] = nil
+	s.embeddings = s.embeddings[:last]
+	s.vectors = s.vectors[:last]
+	if s.codes != nil {
+		s.codes = s.codes[:last*s.codeSize]
+	}
+}
+
+// Get returns the stored embeddings with the given IDs
+func (s *MemoryVectorStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]*core.Embedding, 0, len(ids))
+	for _, id := range ids {
+		if i, ok := s.ids[id]; ok {
+			out = append(out, s.decoded(i))
+		}
+	}
+
+	return out, nil
+}
+
+// Count returns the number of stored embeddings matching filter
+func (s *MemoryVectorStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	if filter != nil {
+		if err := filter.Validate(); err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if filter == nil {
+		return len(s.embeddings), nil
+	}
+
+	n := 0
+	for _, e := range s.embeddings {
+		if filter.Match(e.Metadata) {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Search returns the Limit stored embeddings scoring highest against the
+// query, best first, leaving out those scoring below Threshold and those not
+// matching Filter
+func (s *MemoryVectorStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if err := vectorstore.ValidateFilter(params); err != nil {
+		return nil, err
+	}
+
+	query, err := vectorstore.QueryVector(ctx, s.embedder, params)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.embeddings) == 0 {
+		return []*core.SearchResult{}, nil
+	}
+
+	if len(query) != s.dim {
+		return nil, fmt.Errorf("%w: query has %d dimensions, store has %d", vectorstore.ErrDimensionMismatch, len(query), s.dim)
+	}
+
+	// with normalized vectors on both sides, cosine is a plain dot product
+	metric := s.metric
+	if metric == vectorstore.Cosine {
+		query = vectorstore.Normalize(query)
+		metric = vectorstore.DotProduct
+	}
+
+	if s.quantizer != nil {
+		return s.searchCodes(ctx, params, query, metric)
+	}
+
+	top := vectorstore.NewTopK(vectorstore.Limit(params))
+	for i, v := range s.vectors {
+		// checking once per block keeps cancellation cheap
+		if i%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		// filtering first spares the scoring of excluded vectors
+		if !params.Filter.Match(s.embeddings[i].Metadata) {
+			continue
+		}
+
+		score := metric.Score(query, v)
+		if vectorstore.Passes(params, score) {
+			top.Push(score, s.embeddings[i])
+		}
+	}
+
+	return top.Results(params), nil
+}
+
+// searchCodes scans the codes of the quantized vectors. It must be called
+// with mu held.
+func (s *MemoryVectorStore) searchCodes(ctx context.Context, params *core.SearchParams, query core.Vec32, metric vectorstore.Metric) ([]*core.SearchResult, error) {
+	limit := vectorstore.Limit(params)
+	score := s.quantizer.Scorer(query, metric)
+
+	candidates := limit
+	if s.rescore > 0 {
+		candidates = limit * s.rescore
+	}
+
+	top := vectorstore.NewTopK(candidates)
+	for i, e := range s.embeddings {
+		if i%4096 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		if !params.Filter.Match(e.Metadata) {
+			continue
+		}
+
+		// estimated scores only decide on the threshold without rescoring
+		sc := score(s.code(i))
+		if s.rescore == 0 && !vectorstore.Passes(params, sc) {
+			continue
+		}
+		top.Push(sc, e)
+	}
+
+	results := top.Results(params)
+	if s.rescore == 0 {
+		for _, r := range results {
+			r.Embedding = s.decoded(s.ids[r.Embedding.ID])
+		}
+		return results, nil
+	}
+
+	rescored := vectorstore.NewTopK(limit)
+	for _, r := range results {
+		sc := metric.Score(query, s.vectors[s.ids[r.Embedding.ID]])
+		if vectorstore.Passes(params, sc) {
+			rescored.Push(sc, r.Embedding)
+		}
+	}
+
+	return rescored.Results(params), nil
+}
+
+// Len returns the number of stored embeddings
+func (s *MemoryVectorStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.embeddings)
+}
+
+// Close drops every stored embedding
+func (s *MemoryVectorStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.embeddings = nil
+	s.vectors = nil
+	s.codes = nil
+	s.ids = map[string]int{}
+	s.dim = 0
+
+	return nil
+}
+
+// NewCollections returns a core.CollectionManager keeping each collection in
+// its own store, configured with opts. Collections live as long as the
+// process.
+func NewCollections(embedder core.Embedder, opts ...MemoryVectorStoreConfigFunc) *vectorstore.Collections {
+	return vectorstore.NewCollections(func(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+		return NewMemoryVectorStore(embedder, opts...), nil
+	})
+}
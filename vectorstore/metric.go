@@ -0,0 +1,132 @@
+package vectorstore
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Metric selects how vectors are compared. Every metric yields a score where
+// higher means more similar, so that SearchParams.Threshold always is a
+// minimum score:
+//
+//   - Cosine: cosine similarity, in [-1, 1]
+//   - DotProduct: inner product, unbounded
+//   - L2: 1 / (1 + euclidean distance), in (0, 1]
+type Metric int
+
+const (
+	Cosine Metric = iota
+	DotProduct
+	L2
+)
+
+func (m Metric) String() string {
+	switch m {
+	case Cosine:
+		return "cosine"
+	case DotProduct:
+		return "dot"
+	case L2:
+		return "l2"
+	default:
+		return fmt.Sprintf("Metric(%d)", int(m))
+	}
+}
+
+// ParseMetric returns the metric named "cosine", "dot" or "l2"
+func ParseMetric(name string) (Metric, error) {
+	switch name {
+	case "cosine":
+		return Cosine, nil
+	case "dot":
+		return DotProduct, nil
+	case "l2":
+		return L2, nil
+	default:
+		return 0, fmt.Errorf("unknown metric %q", name)
+	}
+}
+
+// Score compares two vectors of the same dimension with the metric. Cosine
+// scores of vectors that were normalized beforehand are cheaper to compute
+// with DotProduct.
+func (m Metric) Score(a, b core.Vec32) float32 {
+	switch m {
+	case DotProduct:
+		return Dot(a, b)
+	case L2:
+		return 1 / (1 + float32(math.Sqrt(float64(SquaredL2(a, b)))))
+	default:
+		na, nb := Dot(a, a), Dot(b, b)
+		if na == 0 || nb == 0 {
+			return 0
+		}
+		return Dot(a, b) / float32(math.Sqrt(float64(na)*float64(nb)))
+	}
+}
+
+// Dot returns the inner product of a and b. The loop is unrolled over four
+// independent accumulators, which the compiler keeps in registers and the
+// CPU pipelines.
+func Dot(a, b core.Vec32) float32 {
+	n := min(len(a), len(b))
+	a, b = a[:n], b[:n]
+
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < n; i++ {
+		s0 += a[i] * b[i]
+	}
+
+	return s0 + s1 + s2 + s3
+}
+
+// SquaredL2 returns the squared euclidean distance between a and b
+func SquaredL2(a, b core.Vec32) float32 {
+	n := min(len(a), len(b))
+	a, b = a[:n], b[:n]
+
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= n; i += 4 {
+		d0 := a[i] - b[i]
+		d1 := a[i+1] - b[i+1]
+		d2 := a[i+2] - b[i+2]
+		d3 := a[i+3] - b[i+3]
+		s0 += d0 * d0
+		s1 += d1 * d1
+		s2 += d2 * d2
+		s3 += d3 * d3
+	}
+	for ; i < n; i++ {
+		d := a[i] - b[i]
+		s0 += d * d
+	}
+
+	return s0 + s1 + s2 + s3
+}
+
+// Normalize returns a unit length copy of v. The zero vector is returned
+// unchanged.
+func Normalize(v core.Vec32) core.Vec32 {
+	out := make(core.Vec32, len(v))
+	norm := float32(math.Sqrt(float64(Dot(v, v))))
+	if norm == 0 {
+		copy(out, v)
+		return out
+	}
+
+	for i, x := range v {
+		out[i] = x / norm
+	}
+
+	return out
+}
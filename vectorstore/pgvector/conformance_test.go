@@ -0,0 +1,62 @@
+package pgvector
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+	"github.com/joaopandolfi/core/vectorstore/conformance"
+)
+
+// TestConformance runs the suite against the database of PGVECTOR_DSN, in
+// tables dropped afterwards. The module depends on no driver: register one
+// named after PGVECTOR_DRIVER, "pgx" by default, with a blank import in a
+// test file of your own, such as
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib"
+func TestConformance(t *testing.T) {
+	dsn := os.Getenv("PGVECTOR_DSN")
+	if dsn == "" {
+		t.Skip("PGVECTOR_DSN is not set")
+	}
+	driver := os.Getenv("PGVECTOR_DRIVER")
+	if driver == "" {
+		driver = "pgx"
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tables := 0
+
+	for _, m := range []vectorstore.Metric{vectorstore.Cosine, vectorstore.DotProduct, vectorstore.L2} {
+		t.Run(m.String(), func(t *testing.T) {
+			factory := func(ctx context.Context, embedder core.Embedder) (core.MutableVectorStorer, error) {
+				tables++
+				store, err := NewPgVectorStore(db, fmt.Sprintf("conformance_%d_%d", os.Getpid(), tables), embedder,
+					WithMetric(m),
+					WithDimensions(conformance.Dimensions),
+				)
+				if err != nil {
+					return nil, err
+				}
+				t.Cleanup(func() {
+					if err := store.Drop(context.Background()); err != nil {
+						t.Error(err)
+					}
+				})
+
+				return store, nil
+			}
+
+			conformance.Test(t, factory)
+		})
+	}
+}
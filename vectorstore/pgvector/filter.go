@@ -0,0 +1,86 @@
+package pgvector
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/joaopandolfi/core"
+)
+
+// whereBuilder translates a valid core.Filter into an SQL condition over the
+// metadata column, binding values as parameters after args.
+//
+// Field conditions are SQL/JSON path predicates such as
+//
+//	jsonb_path_exists(metadata, '$."lang" ? (@ == $v)', '{"v": "en"}')
+//
+// In the lax mode of paths, lists are unwrapped so that a condition holds
+// when any element does, and values of different types never compare equal,
+// as in core filters. Rows without metadata match no field condition.
+type whereBuilder struct {
+	column string
+	args   []interface{}
+}
+
+func (w *whereBuilder) bind(v interface{}) string {
+	w.args = append(w.args, v)
+	return "$" + strconv.Itoa(len(w.args))
+}
+
+func (w *whereBuilder) build(f *core.Filter) string {
+	switch f.Op {
+	case core.FilterAnd, core.FilterOr:
+		sep := " AND "
+		if f.Op == core.FilterOr {
+			sep = " OR "
+		}
+		clauses := make([]string, len(f.Filters))
+		for i, sub := range f.Filters {
+			clauses[i] = w.build(sub)
+		}
+		return "(" + strings.Join(clauses, sep) + ")"
+	case core.FilterNot:
+		return "(NOT " + w.build(f.Filters[0]) + ")"
+	case core.FilterEq:
+		return w.path(f.Field, "@ == $v0", f.Value)
+	case core.FilterIn:
+		tests := make([]string, len(f.Values))
+		for i := range f.Values {
+			tests[i] = "@ == $v" + strconv.Itoa(i)
+		}
+		return w.path(f.Field, strings.Join(tests, " || "), f.Values...)
+	case core.FilterRange:
+		var (
+			tests  []string
+			values []interface{}
+		)
+		for _, b := range []struct {
+			op    string
+			value interface{}
+		}{{">", f.Gt}, {">=", f.Gte}, {"<", f.Lt}, {"<=", f.Lte}} {
+			if b.value != nil {
+				tests = append(tests, "@ "+b.op+" $v"+strconv.Itoa(len(values)))
+				values = append(values, b.value)
+			}
+		}
+		return w.path(f.Field, strings.Join(tests, " && "), values...)
+	default:
+		// exists
+		return w.path(f.Field, "@ != null")
+	}
+}
+
+// path returns a predicate testing the values of field, with values bound to
+// the variables $v0, $v1...
+func (w *whereBuilder) path(field, test string, values ...interface{}) string {
+	vars := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		vars["v"+strconv.Itoa(i)] = v
+	}
+	data, _ := json.Marshal(vars)
+
+	path := `$."` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(field) + `" ? (` + test + `)`
+
+	return "COALESCE(jsonb_path_exists(" + w.column + ", " + w.bind(path) + "::jsonpath, " + w.bind(string(data)) + "::jsonb), false)"
+}
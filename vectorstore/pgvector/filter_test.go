@@ -0,0 +1,69 @@
+package pgvector
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+func TestWhereBuilder(t *testing.T) {
+	for name, tc := range map[string]struct {
+		filter *core.Filter
+		where  string
+		args   []interface{}
+	}{
+		"eq": {
+			filter: core.Eq("lang", "en"),
+			where:  `COALESCE(jsonb_path_exists("metadata", $2::jsonpath, $3::jsonb), false)`,
+			args:   []interface{}{"[1]", `$."lang" ? (@ == $v0)`, `{"v0":"en"}`},
+		},
+		"in": {
+			filter: core.In("year", 2023, 2024),
+			where:  `COALESCE(jsonb_path_exists("metadata", $2::jsonpath, $3::jsonb), false)`,
+			args:   []interface{}{"[1]", `$."year" ? (@ == $v0 || @ == $v1)`, `{"v0":2023,"v1":2024}`},
+		},
+		"range": {
+			filter: &core.Filter{Op: core.FilterRange, Field: "score", Gt: 0.5, Lte: 1},
+			where:  `COALESCE(jsonb_path_exists("metadata", $2::jsonpath, $3::jsonb), false)`,
+			args:   []interface{}{"[1]", `$."score" ? (@ > $v0 && @ <= $v1)`, `{"v0":0.5,"v1":1}`},
+		},
+		"exists": {
+			filter: core.Exists("title"),
+			where:  `COALESCE(jsonb_path_exists("metadata", $2::jsonpath, $3::jsonb), false)`,
+			args:   []interface{}{"[1]", `$."title" ? (@ != null)`, `{}`},
+		},
+		"quoted field": {
+			filter: core.Eq(`a"b\c`, true),
+			where:  `COALESCE(jsonb_path_exists("metadata", $2::jsonpath, $3::jsonb), false)`,
+			args:   []interface{}{"[1]", `$."a\"b\\c" ? (@ == $v0)`, `{"v0":true}`},
+		},
+		"nested": {
+			filter: core.And(
+				core.Eq("lang", "en"),
+				core.Or(core.Exists("title"), core.Not(core.Eq("draft", true))),
+			),
+			where: `(COALESCE(jsonb_path_exists("metadata", $2::jsonpath, $3::jsonb), false) AND ` +
+				`(COALESCE(jsonb_path_exists("metadata", $4::jsonpath, $5::jsonb), false) OR ` +
+				`(NOT COALESCE(jsonb_path_exists("metadata", $6::jsonpath, $7::jsonb), false))))`,
+			args: []interface{}{
+				"[1]",
+				`$."lang" ? (@ == $v0)`, `{"v0":"en"}`,
+				`$."title" ? (@ != null)`, `{}`,
+				`$."draft" ? (@ == $v0)`, `{"v0":true}`,
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// values are bound after those of the statement, here a vector
+			w := &whereBuilder{column: quote("metadata"), args: []interface{}{"[1]"}}
+
+			if got := w.build(tc.filter); got != tc.where {
+				t.Errorf("got condition\n%s\nwant\n%s", got, tc.where)
+			}
+			if !reflect.DeepEqual(w.args, tc.args) {
+				t.Errorf("got args %q, want %q", w.args, tc.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,624 @@
+// Package pgvector implements core.VectorStorer over a PostgreSQL table
+// using the pgvector extension, through database/sql. The driver is left to
+// the caller, which must register one using $n placeholders such as
+// github.com/jackc/pgx/v5/stdlib or github.com/lib/pq:
+//
+//	db, err := sql.Open("pgx", "postgres://localhost/app")
+//	...
+//	store, err := pgvector.NewPgVectorStore(db, "documents", embedder,
+//		pgvector.WithDimensions(768),
+//	)
+//
+// Each embedding is a row holding its ID, content, metadata as jsonb and
+// vector. Filters are translated into SQL/JSON path predicates over the
+// metadata, which like core filters match list values element-wise.
+package pgvector
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// batchSize caps the IDs bound to a single statement
+const batchSize = 1000
+
+// PgVectorStore implements core.MutableVectorStorer over a pgvector table
+type PgVectorStore struct {
+	db       *sql.DB
+	table    string
+	embedder core.Embedder
+	metric   vectorstore.Metric
+	dims     int
+	create   bool
+	columns  Columns
+
+	mu    sync.Mutex
+	ready bool
+}
+
+// Columns names the columns of the table
+type Columns struct {
+	ID        string
+	Content   string
+	Metadata  string
+	Embedding string
+}
+
+// PgVectorStoreConfig holds configuration for a PgVectorStore
+type PgVectorStoreConfig struct {
+	// Metric used to compare vectors, and by the index created with the
+	// table
+	// default vectorstore.Cosine
+	Metric vectorstore.Metric
+
+	// Dimensions of the vector column of a created table. pgvector only
+	// indexes columns of a fixed dimension: an HNSW index is created along
+	// with the table when set.
+	// default 0, any dimension and no index
+	Dimensions int
+
+	// CreateTable creates the extension, the table and its index if
+	// missing, when the store is first used
+	// default true
+	CreateTable bool
+
+	// Columns names the columns of the table
+	// default "id", "content", "metadata" and "embedding"
+	Columns Columns
+}
+
+// PgVectorStoreConfigFunc is a function type that modifies PgVectorStoreConfig
+type PgVectorStoreConfigFunc func(*PgVectorStoreConfig)
+
+func WithMetric(m vectorstore.Metric) PgVectorStoreConfigFunc {
+	return func(conf *PgVectorStoreConfig) {
+		conf.Metric = m
+	}
+}
+
+func WithDimensions(n int) PgVectorStoreConfigFunc {
+	return func(conf *PgVectorStoreConfig) {
+		conf.Dimensions = n
+	}
+}
+
+func WithCreateTable(create bool) PgVectorStoreConfigFunc {
+	return func(conf *PgVectorStoreConfig) {
+		conf.CreateTable = create
+	}
+}
+
+func WithColumns(columns Columns) PgVectorStoreConfigFunc {
+	return func(conf *PgVectorStoreConfig) {
+		conf.Columns = columns
+	}
+}
+
+// NewPgVectorStore returns a new PgVectorStore over the given table,
+// optionally schema qualified, embedding contents with the given embedder.
+// The database is used as is and left open by Close.
+func NewPgVectorStore(db *sql.DB, table string, embedder core.Embedder, opts ...PgVectorStoreConfigFunc) (*PgVectorStore, error) {
+	conf := &PgVectorStoreConfig{
+		Metric:      vectorstore.Cosine,
+		CreateTable: true,
+		Columns:     Columns{ID: "id", Content: "content", Metadata: "metadata", Embedding: "embedding"},
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if db == nil {
+		return nil, fmt.Errorf("error creating pgvector store: nil database")
+	}
+	if table == "" {
+		return nil, fmt.Errorf("error creating pgvector store: empty table name")
+	}
+	if conf.Dimensions < 0 {
+		return nil, fmt.Errorf("error creating pgvector store: negative dimensions %d", conf.Dimensions)
+	}
+	if conf.Columns.ID == "" || conf.Columns.Content == "" || conf.Columns.Metadata == "" || conf.Columns.Embedding == "" {
+		return nil, fmt.Errorf("error creating pgvector store: every column needs a name")
+	}
+
+	return &PgVectorStore{
+		db:       db,
+		table:    table,
+		embedder: embedder,
+		metric:   conf.Metric,
+		dims:     conf.Dimensions,
+		create:   conf.CreateTable,
+		columns:  conf.Columns,
+	}, nil
+}
+
+// quote quotes an identifier, each part of a qualified one
+func quote(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// ensure creates the table when configured to, once
+func (s *PgVectorStore) ensure(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready || !s.create {
+		return nil
+	}
+
+	vectorType := "vector"
+	if s.dims > 0 {
+		vectorType = fmt.Sprintf("vector(%d)", s.dims)
+	}
+
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS vector",
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s text PRIMARY KEY, %s text NOT NULL DEFAULT '', %s jsonb, %s %s NOT NULL)",
+			quote(s.table), quote(s.columns.ID), quote(s.columns.Content), quote(s.columns.Metadata), quote(s.columns.Embedding), vectorType),
+	}
+	if s.dims > 0 {
+		name := s.table[strings.LastIndex(s.table, ".")+1:] + "_" + s.columns.Embedding + "_idx"
+		statements = append(statements, fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING hnsw (%s %s)",
+			quote(name), quote(s.table), quote(s.columns.Embedding), opClass(s.metric)))
+	}
+
+	for _, stmt := range statements {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("error creating table %s: %w", s.table, err)
+		}
+	}
+	s.ready = true
+
+	return nil
+}
+
+func opClass(m vectorstore.Metric) string {
+	switch m {
+	case vectorstore.DotProduct:
+		return "vector_ip_ops"
+	case vectorstore.L2:
+		return "vector_l2_ops"
+	default:
+		return "vector_cosine_ops"
+	}
+}
+
+// operator returns the distance operator of the metric
+func operator(m vectorstore.Metric) string {
+	switch m {
+	case vectorstore.DotProduct:
+		return "<#>"
+	case vectorstore.L2:
+		return "<->"
+	default:
+		return "<=>"
+	}
+}
+
+// score turns a pgvector distance into the score of the metric
+func (s *PgVectorStore) score(distance float64) float32 {
+	switch s.metric {
+	case vectorstore.DotProduct:
+		// <#> is the negative inner product
+		return float32(-distance)
+	case vectorstore.L2:
+		return float32(1 / (1 + distance))
+	default:
+		return float32(1 - distance)
+	}
+}
+
+// formatVector returns the text representation of a vector
+func formatVector(v core.Vec32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+
+	return b.String()
+}
+
+// parseVector parses the text representation of a vector
+func parseVector(text string) (core.Vec32, error) {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "[") || !strings.HasSuffix(text, "]") {
+		return nil, fmt.Errorf("error parsing vector %q", text)
+	}
+
+	text = strings.TrimSpace(text[1 : len(text)-1])
+	if text == "" {
+		return core.Vec32{}, nil
+	}
+
+	fields := strings.Split(text, ",")
+	v := make(core.Vec32, len(fields))
+	for i, f := range fields {
+		x, err := strconv.ParseFloat(strings.TrimSpace(f), 32)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing vector: %w", err)
+		}
+		v[i] = float32(x)
+	}
+
+	return v, nil
+}
+
+// Add embeds and stores contents
+func (s *PgVectorStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := vectorstore.Embed(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Upsert(ctx, embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// Upsert stores embeddings in a single transaction, embedding the content of
+// those without a vector
+func (s *PgVectorStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	if err := vectorstore.EmbedMissing(ctx, s.embedder, embeddings); err != nil {
+		return err
+	}
+
+	dim := len(embeddings[0].Vector)
+	if s.dims > 0 {
+		dim = s.dims
+	}
+	for _, e := range embeddings {
+		if len(e.Vector) != dim {
+			return fmt.Errorf("%w: embedding %q has %d dimensions, expected %d", vectorstore.ErrDimensionMismatch, e.ID, len(e.Vector), dim)
+		}
+	}
+
+	if err := s.ensure(ctx); err != nil {
+		return err
+	}
+
+	c := s.columns
+	query := fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) VALUES ($1, $2, $3::jsonb, $4::vector) ON CONFLICT (%s) DO UPDATE SET %s = EXCLUDED.%s, %s = EXCLUDED.%s, %s = EXCLUDED.%s",
+		quote(s.table), quote(c.ID), quote(c.Content), quote(c.Metadata), quote(c.Embedding), quote(c.ID),
+		quote(c.Content), quote(c.Content), quote(c.Metadata), quote(c.Metadata), quote(c.Embedding), quote(c.Embedding))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("error preparing upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, e := range embeddings {
+		var metadata interface{}
+		if len(e.Metadata) > 0 {
+			data, err := json.Marshal(e.Metadata)
+			if err != nil {
+				return fmt.Errorf("error encoding metadata of %q: %w", e.ID, err)
+			}
+			metadata = string(data)
+		}
+
+		if _, err := stmt.ExecContext(ctx, e.ID, e.Content, metadata, formatVector(e.Vector)); err != nil {
+			return fmt.Errorf("error storing embedding %q: %w", e.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing embeddings: %w", err)
+	}
+
+	return nil
+}
+
+// selectColumns lists the columns scanned by scan
+func (s *PgVectorStore) selectColumns() string {
+	c := s.columns
+	return fmt.Sprintf("%s, %s, %s, %s::text", quote(c.ID), quote(c.Content), quote(c.Metadata), quote(c.Embedding))
+}
+
+// scan reads a row of selectColumns, followed by dest
+func scan(rows *sql.Rows, dest ...interface{}) (*core.Embedding, error) {
+	var (
+		e        core.Embedding
+		metadata []byte
+		vector   string
+	)
+	if err := rows.Scan(append([]interface{}{&e.ID, &e.Content, &metadata, &vector}, dest...)...); err != nil {
+		return nil, fmt.Errorf("error reading embedding: %w", err)
+	}
+
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &e.Metadata); err != nil {
+			return nil, fmt.Errorf("error decoding metadata of %q: %w", e.ID, err)
+		}
+	}
+
+	v, err := parseVector(vector)
+	if err != nil {
+		return nil, err
+	}
+	e.Vector = v
+
+	return &e, nil
+}
+
+// Search returns the Limit rows closest to the query, best first. Without an
+// index the search is exact; with one it is approximate, and filtered
+// searches may return fewer results than the filter matches.
+func (s *PgVectorStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if err := vectorstore.ValidateFilter(params); err != nil {
+		return nil, err
+	}
+
+	query, err := vectorstore.QueryVector(ctx, s.embedder, params)
+	if err != nil {
+		return nil, err
+	}
+	if s.dims > 0 && len(query) != s.dims {
+		return nil, fmt.Errorf("%w: query has %d dimensions, store has %d", vectorstore.ErrDimensionMismatch, len(query), s.dims)
+	}
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+
+	args := []interface{}{formatVector(query)}
+	where := ""
+	if params.Filter != nil {
+		w := &whereBuilder{column: quote(s.columns.Metadata), args: args}
+		where = " WHERE " + w.build(params.Filter)
+		args = w.args
+	}
+	args = append(args, vectorstore.Limit(params))
+
+	stmt := fmt.Sprintf("SELECT %s, %s %s $1::vector AS distance FROM %s%s ORDER BY distance LIMIT $%d",
+		s.selectColumns(), quote(s.columns.Embedding), operator(s.metric), quote(s.table), where, len(args))
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	results := []*core.SearchResult{}
+	for rows.Next() {
+		var distance float64
+		e, err := scan(rows, &distance)
+		if err != nil {
+			return nil, err
+		}
+
+		score := s.score(distance)
+		if !vectorstore.Passes(params, score) {
+			continue
+		}
+		results = append(results, &core.SearchResult{Score: score, Embedding: e, SearchMeta: params})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error searching %s: %w", s.table, err)
+	}
+
+	return results, nil
+}
+
+// placeholders returns $start, ..., $(start+n-1)
+func placeholders(start, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = "$" + strconv.Itoa(start+i)
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// batches calls fn with the IDs, at most batchSize at a time
+func batches(ids []string, fn func(args []interface{}) error) error {
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		if err := fn(args); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the rows with the given IDs. Unknown IDs are ignored.
+func (s *PgVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := s.ensure(ctx); err != nil {
+		return err
+	}
+
+	return batches(ids, func(args []interface{}) error {
+		stmt := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", quote(s.table), quote(s.columns.ID), placeholders(1, len(args)))
+		if _, err := s.db.ExecContext(ctx, stmt, args...); err != nil {
+			return fmt.Errorf("error deleting from %s: %w", s.table, err)
+		}
+		return nil
+	})
+}
+
+// DeleteWhere removes the rows matching filter
+func (s *PgVectorStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	if err := s.ensure(ctx); err != nil {
+		return 0, err
+	}
+
+	w := &whereBuilder{column: quote(s.columns.Metadata)}
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE %s", quote(s.table), w.build(filter))
+
+	res, err := s.db.ExecContext(ctx, stmt, w.args...)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting from %s: %w", s.table, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error deleting from %s: %w", s.table, err)
+	}
+
+	return int(n), nil
+}
+
+// Get returns the stored embeddings with the given IDs
+func (s *PgVectorStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	if len(ids) == 0 {
+		return []*core.Embedding{}, nil
+	}
+	if err := s.ensure(ctx); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*core.Embedding, len(ids))
+	err := batches(ids, func(args []interface{}) error {
+		stmt := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)", s.selectColumns(), quote(s.table), quote(s.columns.ID), placeholders(1, len(args)))
+		rows, err := s.db.QueryContext(ctx, stmt, args...)
+		if err != nil {
+			return fmt.Errorf("error reading from %s: %w", s.table, err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			e, err := scan(rows)
+			if err != nil {
+				return err
+			}
+			byID[e.ID] = e
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*core.Embedding, 0, len(byID))
+	for _, id := range ids {
+		if e, ok := byID[id]; ok {
+			out = append(out, e)
+			delete(byID, id)
+		}
+	}
+
+	return out, nil
+}
+
+// Count returns the number of rows matching filter
+func (s *PgVectorStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := s.ensure(ctx); err != nil {
+		return 0, err
+	}
+
+	stmt := "SELECT count(*) FROM " + quote(s.table)
+	var args []interface{}
+	if filter != nil {
+		if err := filter.Validate(); err != nil {
+			return 0, err
+		}
+		w := &whereBuilder{column: quote(s.columns.Metadata)}
+		stmt += " WHERE " + w.build(filter)
+		args = w.args
+	}
+
+	var n int
+	if err := s.db.QueryRowContext(ctx, stmt, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting %s: %w", s.table, err)
+	}
+
+	return n, nil
+}
+
+// Close does nothing: the database belongs to the caller
+func (s *PgVectorStore) Close() error {
+	return nil
+}
+
+// Drop deletes the table along with its rows
+func (s *PgVectorStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	s.ready = false
+	s.mu.Unlock()
+
+	if _, err := s.db.ExecContext(ctx, "DROP TABLE IF EXISTS "+quote(s.table)); err != nil {
+		return fmt.Errorf("error dropping %s: %w", s.table, err)
+	}
+
+	return nil
+}
+
+// NewCollections returns a core.CollectionManager keeping each collection in
+// the table of the same name, in the current schema. Existing tables with a
+// vector column of the configured name are listed as collections.
+func NewCollections(db *sql.DB, embedder core.Embedder, opts ...PgVectorStoreConfigFunc) *vectorstore.Collections {
+	conf := &PgVectorStoreConfig{Columns: Columns{Embedding: "embedding"}}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return vectorstore.NewCollections(
+		func(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+			return NewPgVectorStore(db, name, embedder, opts...)
+		},
+		vectorstore.WithList(func(ctx context.Context) ([]string, error) {
+			rows, err := db.QueryContext(ctx, "SELECT table_name FROM information_schema.columns WHERE table_schema = current_schema() AND column_name = $1 AND udt_name = 'vector' ORDER BY table_name", conf.Columns.Embedding)
+			if err != nil {
+				return nil, fmt.Errorf("error listing tables: %w", err)
+			}
+			defer rows.Close()
+
+			names := []string{}
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					return nil, fmt.Errorf("error listing tables: %w", err)
+				}
+				names = append(names, name)
+			}
+			return names, rows.Err()
+		}),
+		vectorstore.WithDrop(func(ctx context.Context, name string) error {
+			store, err := NewPgVectorStore(db, name, embedder, opts...)
+			if err != nil {
+				return err
+			}
+			return store.Drop(ctx)
+		}),
+	)
+}
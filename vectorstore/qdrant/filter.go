@@ -0,0 +1,76 @@
+package qdrant
+
+import (
+	"github.com/joaopandolfi/core"
+)
+
+// filterOf translates a valid core.Filter into a Qdrant filter, whose
+// clauses are conditions or nested filters
+func filterOf(f *core.Filter) map[string]interface{} {
+	switch f.Op {
+	case core.FilterAnd:
+		return map[string]interface{}{"must": conditions(f.Filters)}
+	case core.FilterOr:
+		return map[string]interface{}{"should": conditions(f.Filters)}
+	case core.FilterNot:
+		return map[string]interface{}{"must_not": conditions(f.Filters)}
+	default:
+		return map[string]interface{}{"must": []interface{}{condition(f)}}
+	}
+}
+
+func conditions(filters []*core.Filter) []interface{} {
+	out := make([]interface{}, len(filters))
+	for i, f := range filters {
+		out[i] = condition(f)
+	}
+
+	return out
+}
+
+// condition translates a filter into a single Qdrant condition. Like core
+// filters, Qdrant matches payload lists when any of their elements does.
+func condition(f *core.Filter) interface{} {
+	switch f.Op {
+	case core.FilterEq:
+		return match(f.Field, f.Value)
+	case core.FilterIn:
+		clauses := make([]interface{}, len(f.Values))
+		for i, v := range f.Values {
+			clauses[i] = match(f.Field, v)
+		}
+		return map[string]interface{}{"should": clauses}
+	case core.FilterRange:
+		bounds := map[string]interface{}{}
+		for name, bound := range map[string]interface{}{"gt": f.Gt, "gte": f.Gte, "lt": f.Lt, "lte": f.Lte} {
+			if bound != nil {
+				bounds[name] = bound
+			}
+		}
+		return map[string]interface{}{"key": f.Field, "range": bounds}
+	case core.FilterExists:
+		// is_empty also matches empty lists, which core filters tell apart
+		return map[string]interface{}{
+			"must_not": []interface{}{map[string]interface{}{"is_empty": map[string]interface{}{"key": f.Field}}},
+		}
+	default:
+		return filterOf(f)
+	}
+}
+
+// match is an equality condition. Qdrant only matches keywords, integers and
+// booleans: other numbers are matched by a range of a single value.
+func match(field string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case float32:
+		if v != float32(int64(v)) {
+			return map[string]interface{}{"key": field, "range": map[string]interface{}{"gte": v, "lte": v}}
+		}
+	case float64:
+		if v != float64(int64(v)) {
+			return map[string]interface{}{"key": field, "range": map[string]interface{}{"gte": v, "lte": v}}
+		}
+	}
+
+	return map[string]interface{}{"key": field, "match": map[string]interface{}{"value": value}}
+}
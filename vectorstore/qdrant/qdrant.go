@@ -0,0 +1,540 @@
+// Package qdrant implements core.VectorStorer over a collection of a Qdrant
+// server, through its HTTP API:
+//
+//	store := qdrant.NewQdrantVectorStore("http://localhost:6333", "handbook", embedder,
+//		qdrant.WithAPIKey(os.Getenv("QDRANT_API_KEY")),
+//	)
+//
+// Qdrant only accepts unsigned integers and UUIDs as point IDs: points are
+// stored under a UUID derived from the ID of the embedding, which is kept in
+// the payload along with the content, under the keys "_id" and "_content" by
+// default. The metadata of the embedding makes up the rest of the payload, so
+// filters apply to payload fields of the same name. Collections filled by
+// other tools are read by setting the keys they use, points without an ID
+// key being identified by their point ID.
+//
+// The qdranttest package serves a stand-in of the API for tests.
+package qdrant
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// QdrantVectorStore implements core.MutableVectorStorer over a Qdrant
+// collection. The collection is created on the first write when missing,
+// with the dimension of the first vector written.
+type QdrantVectorStore struct {
+	baseURL    string
+	collection string
+	embedder   core.Embedder
+	metric     vectorstore.Metric
+	apiKey     string
+	client     *http.Client
+	idKey      string
+	contentKey string
+
+	mu sync.Mutex
+	// ready is set once the collection is known to exist
+	ready bool
+}
+
+// QdrantVectorStoreConfig holds configuration for a QdrantVectorStore
+type QdrantVectorStoreConfig struct {
+	// Metric of a collection created by the store. Existing collections
+	// keep their own, which must match for scores to make sense.
+	// default vectorstore.Cosine
+	Metric vectorstore.Metric
+
+	// APIKey is sent in the api-key header
+	// default none
+	APIKey string
+
+	// HTTPClient sends the requests
+	// default a client with a 30 seconds timeout
+	HTTPClient *http.Client
+
+	// IDKey is the payload key holding the ID of the embedding
+	// default "_id"
+	IDKey string
+
+	// ContentKey is the payload key holding the content of the embedding
+	// default "_content"
+	ContentKey string
+}
+
+// QdrantVectorStoreConfigFunc is a function type that modifies QdrantVectorStoreConfig
+type QdrantVectorStoreConfigFunc func(*QdrantVectorStoreConfig)
+
+func WithMetric(m vectorstore.Metric) QdrantVectorStoreConfigFunc {
+	return func(conf *QdrantVectorStoreConfig) {
+		conf.Metric = m
+	}
+}
+
+func WithAPIKey(key string) QdrantVectorStoreConfigFunc {
+	return func(conf *QdrantVectorStoreConfig) {
+		conf.APIKey = key
+	}
+}
+
+func WithHTTPClient(c *http.Client) QdrantVectorStoreConfigFunc {
+	return func(conf *QdrantVectorStoreConfig) {
+		conf.HTTPClient = c
+	}
+}
+
+func WithIDKey(key string) QdrantVectorStoreConfigFunc {
+	return func(conf *QdrantVectorStoreConfig) {
+		conf.IDKey = key
+	}
+}
+
+func WithContentKey(key string) QdrantVectorStoreConfigFunc {
+	return func(conf *QdrantVectorStoreConfig) {
+		conf.ContentKey = key
+	}
+}
+
+// NewQdrantVectorStore returns a new QdrantVectorStore over the named
+// collection of the server at baseURL, embedding contents with the given
+// embedder. No request is sent until the store is used.
+func NewQdrantVectorStore(baseURL, collection string, embedder core.Embedder, opts ...QdrantVectorStoreConfigFunc) *QdrantVectorStore {
+	conf := &QdrantVectorStoreConfig{
+		Metric:     vectorstore.Cosine,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		IDKey:      "_id",
+		ContentKey: "_content",
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &QdrantVectorStore{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		collection: collection,
+		embedder:   embedder,
+		metric:     conf.Metric,
+		apiKey:     conf.APIKey,
+		client:     conf.HTTPClient,
+		idKey:      conf.IDKey,
+		contentKey: conf.ContentKey,
+	}
+}
+
+// errNotFound is returned by do for 404 responses
+var errNotFound = errors.New("not found")
+
+// do sends a request and decodes the result field of the response into out,
+// if not nil
+func (s *QdrantVectorStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("error encoding qdrant request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiKey != "" {
+		req.Header.Set("api-key", s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling qdrant: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading qdrant response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("qdrant %s %s: %w", method, path, errNotFound)
+	}
+	if resp.StatusCode/100 != 2 {
+		var failure struct {
+			Status struct {
+				Error string `json:"error"`
+			} `json:"status"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &failure) == nil && failure.Status.Error != "" {
+			msg = failure.Status.Error
+		}
+		return fmt.Errorf("qdrant %s %s: %s: %s", method, path, resp.Status, msg)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	envelope := struct {
+		Result interface{} `json:"result"`
+	}{Result: out}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("error decoding qdrant response: %w", err)
+	}
+
+	return nil
+}
+
+func (s *QdrantVectorStore) path(suffix string) string {
+	return "/collections/" + url.PathEscape(s.collection) + suffix
+}
+
+// ensureCollection creates the collection for vectors of dim dimensions
+// unless it exists
+func (s *QdrantVectorStore) ensureCollection(ctx context.Context, dim int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready {
+		return nil
+	}
+
+	err := s.do(ctx, http.MethodGet, s.path(""), nil, nil)
+	if errors.Is(err, errNotFound) {
+		err = s.do(ctx, http.MethodPut, s.path(""), map[string]interface{}{
+			"vectors": map[string]interface{}{"size": dim, "distance": distance(s.metric)},
+		}, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("error preparing collection %s: %w", s.collection, err)
+	}
+
+	s.ready = true
+	return nil
+}
+
+func distance(m vectorstore.Metric) string {
+	switch m {
+	case vectorstore.DotProduct:
+		return "Dot"
+	case vectorstore.L2:
+		return "Euclid"
+	default:
+		return "Cosine"
+	}
+}
+
+// PointID returns the UUID a point is stored under for an embedding ID, a
+// version 5 style UUID of its SHA-1
+func PointID(id string) string {
+	sum := sha1.Sum([]byte(id))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+type point struct {
+	ID      json.RawMessage        `json:"id"`
+	Vector  core.Vec32             `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Score   float32                `json:"score,omitempty"`
+}
+
+func (s *QdrantVectorStore) point(e *core.Embedding) *point {
+	payload := make(map[string]interface{}, len(e.Metadata)+2)
+	for k, v := range e.Metadata {
+		payload[k] = v
+	}
+	payload[s.idKey] = e.ID
+	payload[s.contentKey] = e.Content
+
+	id, _ := json.Marshal(PointID(e.ID))
+	return &point{ID: id, Vector: e.Vector, Payload: payload}
+}
+
+func (s *QdrantVectorStore) embedding(p *point) *core.Embedding {
+	e := &core.Embedding{Vector: p.Vector}
+	e.Content, _ = p.Payload[s.contentKey].(string)
+	var ok bool
+	if e.ID, ok = p.Payload[s.idKey].(string); !ok {
+		e.ID = strings.Trim(string(p.ID), `"`)
+	}
+
+	for k, v := range p.Payload {
+		if k == s.idKey || k == s.contentKey {
+			continue
+		}
+		if e.Metadata == nil {
+			e.Metadata = map[string]interface{}{}
+		}
+		e.Metadata[k] = v
+	}
+
+	return e
+}
+
+// Add embeds and stores contents
+func (s *QdrantVectorStore) Add(ctx context.Context, contents []string) ([]*core.Embedding, error) {
+	embeddings, err := vectorstore.Embed(ctx, s.embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Upsert(ctx, embeddings...); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// Upsert stores embeddings, embedding the content of those without a vector
+func (s *QdrantVectorStore) Upsert(ctx context.Context, embeddings ...*core.Embedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	if err := vectorstore.EmbedMissing(ctx, s.embedder, embeddings); err != nil {
+		return err
+	}
+
+	dim := len(embeddings[0].Vector)
+	points := make([]*point, len(embeddings))
+	for i, e := range embeddings {
+		if len(e.Vector) != dim {
+			return fmt.Errorf("%w: embedding %q has %d dimensions, expected %d", vectorstore.ErrDimensionMismatch, e.ID, len(e.Vector), dim)
+		}
+		points[i] = s.point(e)
+	}
+
+	if err := s.ensureCollection(ctx, dim); err != nil {
+		return err
+	}
+
+	return s.do(ctx, http.MethodPut, s.path("/points?wait=true"), map[string]interface{}{"points": points}, nil)
+}
+
+// Search returns the Limit points scoring highest against the query, best
+// first. Scores follow the metric of the collection, euclidean distances
+// being turned into the scores of vectorstore.L2.
+func (s *QdrantVectorStore) Search(ctx context.Context, params *core.SearchParams) ([]*core.SearchResult, error) {
+	if err := vectorstore.ValidateFilter(params); err != nil {
+		return nil, err
+	}
+
+	query, err := vectorstore.QueryVector(ctx, s.embedder, params)
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{
+		"vector":       query,
+		"limit":        vectorstore.Limit(params),
+		"with_payload": true,
+		"with_vector":  true,
+	}
+	if params.Filter != nil {
+		body["filter"] = filterOf(params.Filter)
+	}
+	if params.Threshold != 0 {
+		// Qdrant bounds euclidean distances from above
+		if s.metric == vectorstore.L2 {
+			body["score_threshold"] = 1/params.Threshold - 1
+		} else {
+			body["score_threshold"] = params.Threshold
+		}
+	}
+
+	var points []*point
+	err = s.do(ctx, http.MethodPost, s.path("/points/search"), body, &points)
+	if errors.Is(err, errNotFound) {
+		return []*core.SearchResult{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*core.SearchResult, 0, len(points))
+	for _, p := range points {
+		score := p.Score
+		if s.metric == vectorstore.L2 {
+			score = 1 / (1 + score)
+		}
+		if !vectorstore.Passes(params, score) {
+			continue
+		}
+		results = append(results, &core.SearchResult{Score: score, Embedding: s.embedding(p), SearchMeta: params})
+	}
+
+	return results, nil
+}
+
+// Delete removes the embeddings with the given IDs. Unknown IDs are ignored.
+func (s *QdrantVectorStore) Delete(ctx context.Context, ids ...string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = PointID(id)
+	}
+
+	err := s.do(ctx, http.MethodPost, s.path("/points/delete?wait=true"), map[string]interface{}{"points": points}, nil)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteWhere removes the embeddings matching filter. Qdrant does not tell
+// how many points a deletion removed: they are counted beforehand, which
+// concurrent writes may throw off.
+func (s *QdrantVectorStore) DeleteWhere(ctx context.Context, filter *core.Filter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	n, err := s.Count(ctx, filter)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	err = s.do(ctx, http.MethodPost, s.path("/points/delete?wait=true"), map[string]interface{}{"filter": filterOf(filter)}, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// Get returns the stored embeddings with the given IDs
+func (s *QdrantVectorStore) Get(ctx context.Context, ids ...string) ([]*core.Embedding, error) {
+	if len(ids) == 0 {
+		return []*core.Embedding{}, nil
+	}
+
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = PointID(id)
+	}
+
+	var found []*point
+	err := s.do(ctx, http.MethodPost, s.path("/points"), map[string]interface{}{
+		"ids":          points,
+		"with_payload": true,
+		"with_vector":  true,
+	}, &found)
+	if errors.Is(err, errNotFound) {
+		return []*core.Embedding{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*core.Embedding, len(found))
+	for _, p := range found {
+		e := s.embedding(p)
+		byID[e.ID] = e
+	}
+
+	out := make([]*core.Embedding, 0, len(found))
+	for _, id := range ids {
+		if e, ok := byID[id]; ok {
+			out = append(out, e)
+		}
+	}
+
+	return out, nil
+}
+
+// Count returns the number of stored embeddings matching filter
+func (s *QdrantVectorStore) Count(ctx context.Context, filter *core.Filter) (int, error) {
+	body := map[string]interface{}{"exact": true}
+	if filter != nil {
+		if err := filter.Validate(); err != nil {
+			return 0, err
+		}
+		body["filter"] = filterOf(filter)
+	}
+
+	var result struct {
+		Count int `json:"count"`
+	}
+	err := s.do(ctx, http.MethodPost, s.path("/points/count"), body, &result)
+	if errors.Is(err, errNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Count, nil
+}
+
+// Close releases idle connections. The collection is left as is.
+func (s *QdrantVectorStore) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// Drop deletes the collection along with its points
+func (s *QdrantVectorStore) Drop(ctx context.Context) error {
+	s.mu.Lock()
+	s.ready = false
+	s.mu.Unlock()
+
+	err := s.do(ctx, http.MethodDelete, s.path(""), nil, nil)
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// NewCollections returns a core.CollectionManager keeping each collection in
+// the Qdrant collection of the same name
+func NewCollections(baseURL string, embedder core.Embedder, opts ...QdrantVectorStoreConfigFunc) *vectorstore.Collections {
+	admin := NewQdrantVectorStore(baseURL, "", embedder, opts...)
+
+	return vectorstore.NewCollections(
+		func(ctx context.Context, name string) (core.MutableVectorStorer, error) {
+			return NewQdrantVectorStore(baseURL, name, embedder, opts...), nil
+		},
+		vectorstore.WithList(func(ctx context.Context) ([]string, error) {
+			var result struct {
+				Collections []struct {
+					Name string `json:"name"`
+				} `json:"collections"`
+			}
+			if err := admin.do(ctx, http.MethodGet, "/collections", nil, &result); err != nil {
+				return nil, err
+			}
+
+			names := make([]string, len(result.Collections))
+			for i, c := range result.Collections {
+				names[i] = c.Name
+			}
+			return names, nil
+		}),
+		vectorstore.WithDrop(func(ctx context.Context, name string) error {
+			return NewQdrantVectorStore(baseURL, name, embedder, opts...).Drop(ctx)
+		}),
+	)
+}
@@ -0,0 +1,635 @@
+// Package qdranttest serves an in-memory stand-in of the Qdrant HTTP API, for
+// testing code using the qdrant package without a Qdrant server:
+//
+//	srv := qdranttest.NewServer()
+//	defer srv.Close()
+//	store := qdrant.NewQdrantVectorStore(srv.URL, "docs", embedder)
+//
+// It implements the endpoints the qdrant package calls, with exact search
+// and the filter conditions it emits, and validates requests as Qdrant does
+// where it matters to clients: point IDs must be UUIDs or unsigned
+// integers, and vectors must match the dimension of their collection.
+package qdranttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewServer starts a server with no collections, to be closed by the caller
+func NewServer() *httptest.Server {
+	return httptest.NewServer(NewHandler())
+}
+
+// NewHandler returns the handler of the API, with no collections
+func NewHandler() http.Handler {
+	s := &server{collections: map[string]*collection{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /collections", s.listCollections)
+	mux.HandleFunc("GET /collections/{name}", s.getCollection)
+	mux.HandleFunc("PUT /collections/{name}", s.createCollection)
+	mux.HandleFunc("DELETE /collections/{name}", s.deleteCollection)
+	mux.HandleFunc("PUT /collections/{name}/points", s.upsertPoints)
+	mux.HandleFunc("POST /collections/{name}/points", s.retrievePoints)
+	mux.HandleFunc("POST /collections/{name}/points/search", s.searchPoints)
+	mux.HandleFunc("POST /collections/{name}/points/delete", s.deletePoints)
+	mux.HandleFunc("POST /collections/{name}/points/count", s.countPoints)
+
+	return mux
+}
+
+type server struct {
+	mu          sync.Mutex
+	collections map[string]*collection
+}
+
+type collection struct {
+	size     int
+	distance string
+	points   map[string]*point
+}
+
+type point struct {
+	ID      json.RawMessage        `json:"id"`
+	Vector  []float32              `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Score   *float32               `json:"score,omitempty"`
+}
+
+// filter is a Qdrant filter, or a field condition when Key is set
+type filter struct {
+	Must    []*filter `json:"must"`
+	Should  []*filter `json:"should"`
+	MustNot []*filter `json:"must_not"`
+
+	Key   string `json:"key"`
+	Match *struct {
+		Value interface{}   `json:"value"`
+		Any   []interface{} `json:"any"`
+	} `json:"match"`
+	Range   map[string]interface{} `json:"range"`
+	IsEmpty *struct {
+		Key string `json:"key"`
+	} `json:"is_empty"`
+	IsNull *struct {
+		Key string `json:"key"`
+	} `json:"is_null"`
+}
+
+func respond(w http.ResponseWriter, status int, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if status/100 != 2 {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": map[string]interface{}{"error": result},
+			"time":   0,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok", "time": 0})
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		respond(w, http.StatusBadRequest, fmt.Sprintf("Format error in JSON body: %v", err))
+		return false
+	}
+
+	return true
+}
+
+// lookup returns the collection of the request, responding 404 when missing.
+// It must be called with mu held.
+func (s *server) lookup(w http.ResponseWriter, r *http.Request) *collection {
+	name := r.PathValue("name")
+	c, ok := s.collections[name]
+	if !ok {
+		respond(w, http.StatusNotFound, fmt.Sprintf("Not found: Collection `%s` doesn't exist!", name))
+		return nil
+	}
+
+	return c
+}
+
+func (s *server) listCollections(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.collections))
+	for name := range s.collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]map[string]string, len(names))
+	for i, name := range names {
+		list[i] = map[string]string{"name": name}
+	}
+	respond(w, http.StatusOK, map[string]interface{}{"collections": list})
+}
+
+func (s *server) getCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{
+		"status":        "green",
+		"points_count":  len(c.points),
+		"vectors_count": len(c.points),
+		"config": map[string]interface{}{
+			"params": map[string]interface{}{
+				"vectors": map[string]interface{}{"size": c.size, "distance": c.distance},
+			},
+		},
+	})
+}
+
+func (s *server) createCollection(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Vectors struct {
+			Size     int    `json:"size"`
+			Distance string `json:"distance"`
+		} `json:"vectors"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	switch req.Vectors.Distance {
+	case "Cosine", "Dot", "Euclid":
+	default:
+		respond(w, http.StatusBadRequest, fmt.Sprintf("Wrong input: unknown distance %q", req.Vectors.Distance))
+		return
+	}
+	if req.Vectors.Size <= 0 {
+		respond(w, http.StatusBadRequest, "Wrong input: vector size must be positive")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.PathValue("name")
+	if _, ok := s.collections[name]; ok {
+		respond(w, http.StatusConflict, fmt.Sprintf("Wrong input: Collection `%s` already exists!", name))
+		return
+	}
+
+	s.collections[name] = &collection{size: req.Vectors.Size, distance: req.Vectors.Distance, points: map[string]*point{}}
+	respond(w, http.StatusOK, true)
+}
+
+func (s *server) deleteCollection(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := r.PathValue("name")
+	_, ok := s.collections[name]
+	delete(s.collections, name)
+	respond(w, http.StatusOK, ok)
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{4}-?[0-9a-fA-F]{12}$`)
+
+// pointKey validates a point ID and returns it in a canonical form
+func pointKey(raw json.RawMessage) (string, error) {
+	var id interface{}
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.UseNumber()
+	if err := dec.Decode(&id); err != nil {
+		return "", err
+	}
+
+	switch id := id.(type) {
+	case json.Number:
+		if n, err := id.Int64(); err == nil && n >= 0 {
+			return id.String(), nil
+		}
+	case string:
+		if uuidPattern.MatchString(id) {
+			return strings.ToLower(strings.ReplaceAll(id, "-", "")), nil
+		}
+	}
+
+	return "", fmt.Errorf("Unable to parse point ID %s: expected an unsigned integer or a UUID", raw)
+}
+
+func (s *server) upsertPoints(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Points []*point `json:"points"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	keys := make([]string, len(req.Points))
+	for i, p := range req.Points {
+		key, err := pointKey(p.ID)
+		if err != nil {
+			respond(w, http.StatusBadRequest, "Format error in JSON body: "+err.Error())
+			return
+		}
+		if len(p.Vector) != c.size {
+			respond(w, http.StatusBadRequest, fmt.Sprintf("Wrong input: Vector dimension error: expected dim: %d, got %d", c.size, len(p.Vector)))
+			return
+		}
+		keys[i] = key
+	}
+
+	for i, p := range req.Points {
+		if c.distance == "Cosine" {
+			p.Vector = normalize(p.Vector)
+		}
+		p.Score = nil
+		c.points[keys[i]] = p
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{"operation_id": 0, "status": "completed"})
+}
+
+func (s *server) retrievePoints(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		IDs         []json.RawMessage `json:"ids"`
+		WithPayload bool              `json:"with_payload"`
+		WithVector  bool              `json:"with_vector"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	out := []*point{}
+	for _, id := range req.IDs {
+		key, err := pointKey(id)
+		if err != nil {
+			respond(w, http.StatusBadRequest, "Format error in JSON body: "+err.Error())
+			return
+		}
+		if p, ok := c.points[key]; ok {
+			out = append(out, view(p, nil, req.WithPayload, req.WithVector))
+		}
+	}
+
+	respond(w, http.StatusOK, out)
+}
+
+func (s *server) searchPoints(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Vector         []float32 `json:"vector"`
+		Limit          int       `json:"limit"`
+		Filter         *filter   `json:"filter"`
+		WithPayload    bool      `json:"with_payload"`
+		WithVector     bool      `json:"with_vector"`
+		ScoreThreshold *float32  `json:"score_threshold"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+	if len(req.Vector) != c.size {
+		respond(w, http.StatusBadRequest, fmt.Sprintf("Wrong input: Vector dimension error: expected dim: %d, got %d", c.size, len(req.Vector)))
+		return
+	}
+
+	query := req.Vector
+	if c.distance == "Cosine" {
+		query = normalize(query)
+	}
+
+	// euclidean distances rank in increasing order
+	ascending := c.distance == "Euclid"
+	type scored struct {
+		key   string
+		score float32
+	}
+	var hits []scored
+	for key, p := range c.points {
+		if req.Filter != nil && !req.Filter.match(p.Payload) {
+			continue
+		}
+
+		var score float32
+		if ascending {
+			for i := range query {
+				d := query[i] - p.Vector[i]
+				score += d * d
+			}
+			score = float32(math.Sqrt(float64(score)))
+		} else {
+			for i := range query {
+				score += query[i] * p.Vector[i]
+			}
+		}
+
+		if t := req.ScoreThreshold; t != nil && ((ascending && score > *t) || (!ascending && score < *t)) {
+			continue
+		}
+		hits = append(hits, scored{key, score})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return (hits[i].score < hits[j].score) == ascending
+		}
+		return hits[i].key < hits[j].key
+	})
+	if req.Limit > 0 && len(hits) > req.Limit {
+		hits = hits[:req.Limit]
+	}
+
+	out := make([]*point, len(hits))
+	for i, h := range hits {
+		score := h.score
+		out[i] = view(c.points[h.key], &score, req.WithPayload, req.WithVector)
+	}
+
+	respond(w, http.StatusOK, out)
+}
+
+func (s *server) deletePoints(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Points []json.RawMessage `json:"points"`
+		Filter *filter           `json:"filter"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	for _, id := range req.Points {
+		key, err := pointKey(id)
+		if err != nil {
+			respond(w, http.StatusBadRequest, "Format error in JSON body: "+err.Error())
+			return
+		}
+		delete(c.points, key)
+	}
+	if req.Filter != nil {
+		for key, p := range c.points {
+			if req.Filter.match(p.Payload) {
+				delete(c.points, key)
+			}
+		}
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{"operation_id": 0, "status": "completed"})
+}
+
+func (s *server) countPoints(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Filter *filter `json:"filter"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.lookup(w, r)
+	if c == nil {
+		return
+	}
+
+	n := 0
+	for _, p := range c.points {
+		if req.Filter == nil || req.Filter.match(p.Payload) {
+			n++
+		}
+	}
+
+	respond(w, http.StatusOK, map[string]interface{}{"count": n})
+}
+
+// view returns the point as returned by a query
+func view(p *point, score *float32, withPayload, withVector bool) *point {
+	out := &point{ID: p.ID, Score: score}
+	if withPayload {
+		out.Payload = p.Payload
+	}
+	if withVector {
+		out.Vector = p.Vector
+	}
+
+	return out
+}
+
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = float32(float64(x) / math.Sqrt(norm))
+	}
+
+	return out
+}
+
+// match evaluates the filter against a payload: every must clause, at least
+// one should clause and no must_not clause
+func (f *filter) match(payload map[string]interface{}) bool {
+	if f.Key != "" || f.IsEmpty != nil || f.IsNull != nil {
+		return f.condition(payload)
+	}
+
+	for _, c := range f.Must {
+		if !c.match(payload) {
+			return false
+		}
+	}
+	for _, c := range f.MustNot {
+		if c.match(payload) {
+			return false
+		}
+	}
+	if len(f.Should) == 0 {
+		return true
+	}
+	for _, c := range f.Should {
+		if c.match(payload) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f *filter) condition(payload map[string]interface{}) bool {
+	switch {
+	case f.IsEmpty != nil:
+		v, ok := payload[f.IsEmpty.Key]
+		list, isList := v.([]interface{})
+		return !ok || v == nil || (isList && len(list) == 0)
+	case f.IsNull != nil:
+		v, ok := payload[f.IsNull.Key]
+		return ok && v == nil
+	}
+
+	v, ok := payload[f.Key]
+	if !ok || v == nil {
+		return false
+	}
+
+	values := []interface{}{v}
+	if list, isList := v.([]interface{}); isList {
+		values = list
+	}
+
+	for _, v := range values {
+		switch {
+		case f.Match != nil && f.Match.Any != nil:
+			for _, want := range f.Match.Any {
+				if equal(v, want) {
+					return true
+				}
+			}
+		case f.Match != nil:
+			if equal(v, f.Match.Value) {
+				return true
+			}
+		case f.Range != nil:
+			if inRange(v, f.Range) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// equal matches keywords, integers and booleans exactly, as Qdrant does
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b && a == math.Trunc(a)
+	}
+
+	return false
+}
+
+// inRange compares numbers, or RFC 3339 datetimes
+func inRange(v interface{}, bounds map[string]interface{}) bool {
+	for op, bound := range bounds {
+		if bound == nil {
+			continue
+		}
+
+		c, ok := compare(v, bound)
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case "gt":
+			ok = c > 0
+		case "gte":
+			ok = c >= 0
+		case "lt":
+			ok = c < 0
+		case "lte":
+			ok = c <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func compare(a, b interface{}) (int, bool) {
+	if fa, ok := a.(float64); ok {
+		fb, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	sa, aok := a.(string)
+	sb, bok := b.(string)
+	if !aok || !bok {
+		return 0, false
+	}
+	ta, okA := parseTime(sa)
+	tb, okB := parseTime(sb)
+	if !okA || !okB {
+		return 0, false
+	}
+
+	return ta.Compare(tb), true
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
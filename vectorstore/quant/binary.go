@@ -0,0 +1,165 @@
+package quant
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// BinaryQuantizer keeps the sign of each dimension, a bit per dimension,
+// along with the norm of the vector. The Hamming distance between the bits
+// of two vectors estimates the angle between them (Charikar, 2002), which
+// scores a code with a few XOR and popcount instructions: searches scan
+// binary codes an order of magnitude faster than float vectors.
+//
+// The estimate is coarse, so binary codes are best used to preselect
+// candidates rescored against the float vectors, and with models whose
+// dimensions are centered on zero, which most sentence embedding models
+// are.
+type BinaryQuantizer struct {
+	dim int
+}
+
+// NewBinaryQuantizer returns a new, untrained BinaryQuantizer. Training
+// only records the dimension of the vectors.
+func NewBinaryQuantizer() *BinaryQuantizer {
+	return &BinaryQuantizer{}
+}
+
+func (q *BinaryQuantizer) Train(sample []core.Vec32) error {
+	dim, err := checkSample(sample)
+	if err != nil {
+		return err
+	}
+
+	q.dim = dim
+	return nil
+}
+
+func (q *BinaryQuantizer) Trained() bool {
+	return q.dim > 0
+}
+
+func (q *BinaryQuantizer) Dimensions() int {
+	return q.dim
+}
+
+// words returns the number of 64 bit words holding the signs
+func (q *BinaryQuantizer) words() int {
+	return (q.dim + 63) / 64
+}
+
+// CodeSize returns the size of the signs, padded to 64 bits, and of the
+// float32 norm that follows them
+func (q *BinaryQuantizer) CodeSize() int {
+	return 8*q.words() + 4
+}
+
+func (q *BinaryQuantizer) Encode(dst []byte, v core.Vec32) []byte {
+	v = v[:q.dim]
+	for w := 0; w < q.words(); w++ {
+		var word uint64
+		for i, x := range v[w*64 : min((w+1)*64, q.dim)] {
+			if x > 0 {
+				word |= 1 << i
+			}
+		}
+		dst = binary.LittleEndian.AppendUint64(dst, word)
+	}
+
+	norm := float32(math.Sqrt(float64(vectorstore.Dot(v, v))))
+	return binary.LittleEndian.AppendUint32(dst, math.Float32bits(norm))
+}
+
+// Decode returns a vector of the norm of the encoded one, spread evenly over
+// the dimensions with their signs
+func (q *BinaryQuantizer) Decode(code []byte) core.Vec32 {
+	scale := q.norm(code) / float32(math.Sqrt(float64(q.dim)))
+
+	v := make(core.Vec32, q.dim)
+	for i := range v {
+		if code[i/8]&(1<<(i%8)) != 0 {
+			v[i] = scale
+		} else {
+			v[i] = -scale
+		}
+	}
+
+	return v
+}
+
+func (q *BinaryQuantizer) norm(code []byte) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(code[8*q.words():]))
+}
+
+// Hamming returns the number of dimensions whose signs differ between two
+// codes
+func (q *BinaryQuantizer) Hamming(a, b []byte) int {
+	n := 0
+	for i := 0; i < 8*q.words(); i += 8 {
+		n += bits.OnesCount64(binary.LittleEndian.Uint64(a[i:]) ^ binary.LittleEndian.Uint64(b[i:]))
+	}
+
+	return n
+}
+
+// Scorer estimates the angle between the query and a vector as π times the
+// fraction of differing signs, then the score of the metric from the angle
+// and the norms
+func (q *BinaryQuantizer) Scorer(query core.Vec32, metric vectorstore.Metric) Scorer {
+	bitsLen := 8 * q.words()
+	qcode := q.Encode(nil, query)[:bitsLen]
+	qnorm := float32(math.Sqrt(float64(vectorstore.Dot(query[:q.dim], query[:q.dim]))))
+
+	cos := make([]float32, q.dim+1)
+	for h := range cos {
+		cos[h] = float32(math.Cos(math.Pi * float64(h) / float64(q.dim)))
+	}
+
+	return func(code []byte) float32 {
+		h := 0
+		for i := 0; i < bitsLen; i += 8 {
+			h += bits.OnesCount64(binary.LittleEndian.Uint64(qcode[i:]) ^ binary.LittleEndian.Uint64(code[i:]))
+		}
+
+		switch metric {
+		case vectorstore.DotProduct:
+			return qnorm * q.norm(code) * cos[h]
+		case vectorstore.L2:
+			n := q.norm(code)
+			return l2Score(qnorm*qnorm + n*n - 2*qnorm*n*cos[h])
+		default:
+			return cos[h]
+		}
+	}
+}
+
+func (q *BinaryQuantizer) MarshalBinary() ([]byte, error) {
+	if !q.Trained() {
+		return nil, ErrNotTrained
+	}
+
+	return appendUint32([]byte{kindBinary}, uint32(q.dim)), nil
+}
+
+func (q *BinaryQuantizer) UnmarshalBinary(data []byte) error {
+	r, err := header(data, kindBinary)
+	if err != nil {
+		return err
+	}
+
+	dim := int(r.uint32())
+	if r.err != nil {
+		return r.err
+	}
+	if dim == 0 {
+		return fmt.Errorf("invalid binary quantizer of %d dimensions", dim)
+	}
+
+	q.dim = dim
+	return nil
+}
@@ -0,0 +1,338 @@
+package quant
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// ProductQuantizer splits vectors into subspaces of consecutive dimensions
+// and replaces each sub-vector with the nearest of 256 centroids learnt by
+// k-means, a byte per subspace (Jégou et al., 2011). Queries are scored
+// without decoding: the score of the query against every centroid is
+// computed once per search, then the score of a code is a sum of table
+// lookups.
+type ProductQuantizer struct {
+	subspaces  int
+	iterations int
+	seed       int64
+
+	dim int
+	// bounds holds the first dimension of each subspace, and dim last
+	bounds []int
+	// k is the number of centroids per subspace, 256 unless the training
+	// sample is smaller
+	k int
+	// centroids holds the k centroids of each subspace, one after the other
+	centroids [][]float32
+}
+
+// ProductQuantizerConfig holds configuration for a ProductQuantizer
+type ProductQuantizerConfig struct {
+	// Subspaces is the number of subspaces, hence the size of the codes in
+	// bytes. More subspaces are more precise and larger.
+	// default one per 8 dimensions
+	Subspaces int
+
+	// Iterations of k-means while training
+	// default 20
+	Iterations int
+
+	// Seed of the k-means initialization, for reproducible training
+	// default 1
+	Seed int64
+}
+
+// ProductQuantizerConfigFunc is a function type that modifies ProductQuantizerConfig
+type ProductQuantizerConfigFunc func(*ProductQuantizerConfig)
+
+func WithSubspaces(n int) ProductQuantizerConfigFunc {
+	return func(conf *ProductQuantizerConfig) {
+		conf.Subspaces = n
+	}
+}
+
+func WithIterations(n int) ProductQuantizerConfigFunc {
+	return func(conf *ProductQuantizerConfig) {
+		conf.Iterations = n
+	}
+}
+
+func WithSeed(seed int64) ProductQuantizerConfigFunc {
+	return func(conf *ProductQuantizerConfig) {
+		conf.Seed = seed
+	}
+}
+
+// NewProductQuantizer returns a new, untrained ProductQuantizer
+func NewProductQuantizer(opts ...ProductQuantizerConfigFunc) *ProductQuantizer {
+	conf := &ProductQuantizerConfig{
+		Iterations: 20,
+		Seed:       1,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &ProductQuantizer{
+		subspaces:  conf.Subspaces,
+		iterations: max(conf.Iterations, 1),
+		seed:       conf.Seed,
+	}
+}
+
+// Train runs k-means in every subspace, spread over the CPUs. Its cost grows
+// with the size of the sample: some tens of thousands of vectors, picked
+// with Sample, are plenty.
+func (q *ProductQuantizer) Train(sample []core.Vec32) error {
+	dim, err := checkSample(sample)
+	if err != nil {
+		return err
+	}
+
+	m := q.subspaces
+	if m <= 0 {
+		m = (dim + 7) / 8
+	}
+	if m > dim {
+		return fmt.Errorf("%d subspaces exceed the %d dimensions", m, dim)
+	}
+
+	bounds := make([]int, m+1)
+	for i := range bounds {
+		bounds[i] = i * dim / m
+	}
+	k := min(len(sample), 256)
+
+	centroids := make([][]float32, m)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), m); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for s := range next {
+				r := rand.New(rand.NewSource(q.seed + int64(s)))
+				centroids[s] = kmeans(sample, bounds[s], bounds[s+1], k, q.iterations, r)
+			}
+		}()
+	}
+	for s := 0; s < m; s++ {
+		next <- s
+	}
+	close(next)
+	wg.Wait()
+
+	q.dim, q.bounds, q.k, q.centroids = dim, bounds, k, centroids
+	return nil
+}
+
+// kmeans clusters the dimensions from to to of sample into k centroids,
+// seeded with k-means++, and returns them one after the other
+func kmeans(sample []core.Vec32, from, to, k, iterations int, r *rand.Rand) []float32 {
+	d := to - from
+	sub := func(i int) []float32 {
+		return sample[i][from:to]
+	}
+
+	// k-means++: each further centroid is drawn with a probability
+	// proportional to its squared distance to the nearest one drawn
+	centroids := make([]float32, k*d)
+	copy(centroids, sub(r.Intn(len(sample))))
+	nearest := make([]float32, len(sample))
+	for i := range nearest {
+		nearest[i] = vectorstore.SquaredL2(sub(i), centroids[:d])
+	}
+	for c := 1; c < k; c++ {
+		var total float64
+		for _, n := range nearest {
+			total += float64(n)
+		}
+
+		pick := r.Intn(len(sample))
+		if total > 0 {
+			target := r.Float64() * total
+			for i, n := range nearest {
+				target -= float64(n)
+				if target <= 0 {
+					pick = i
+					break
+				}
+			}
+		}
+
+		centroid := centroids[c*d : (c+1)*d]
+		copy(centroid, sub(pick))
+		for i := range nearest {
+			nearest[i] = min(nearest[i], vectorstore.SquaredL2(sub(i), centroid))
+		}
+	}
+
+	assign := make([]int, len(sample))
+	sums := make([]float64, k*d)
+	counts := make([]int, k)
+	for it := 0; it < iterations; it++ {
+		changed := false
+		for i := range sample {
+			c := nearestCentroid(sub(i), centroids, k)
+			if c != assign[i] || it == 0 {
+				changed = true
+			}
+			assign[i] = c
+		}
+		if !changed {
+			break
+		}
+
+		clear(sums)
+		clear(counts)
+		for i, c := range assign {
+			counts[c]++
+			for j, x := range sub(i) {
+				sums[c*d+j] += float64(x)
+			}
+		}
+
+		for c := 0; c < k; c++ {
+			centroid := centroids[c*d : (c+1)*d]
+			if counts[c] == 0 {
+				// an empty cluster restarts from a random point
+				copy(centroid, sub(r.Intn(len(sample))))
+				continue
+			}
+			for j := range centroid {
+				centroid[j] = float32(sums[c*d+j] / float64(counts[c]))
+			}
+		}
+	}
+
+	return centroids
+}
+
+func nearestCentroid(v []float32, centroids []float32, k int) int {
+	d := len(v)
+	best, bestDist := 0, float32(math.Inf(1))
+	for c := 0; c < k; c++ {
+		if dist := vectorstore.SquaredL2(v, centroids[c*d:(c+1)*d]); dist < bestDist {
+			best, bestDist = c, dist
+		}
+	}
+
+	return best
+}
+
+func (q *ProductQuantizer) Trained() bool {
+	return q.centroids != nil
+}
+
+func (q *ProductQuantizer) Dimensions() int {
+	return q.dim
+}
+
+func (q *ProductQuantizer) CodeSize() int {
+	return len(q.centroids)
+}
+
+func (q *ProductQuantizer) Encode(dst []byte, v core.Vec32) []byte {
+	for s, centroids := range q.centroids {
+		dst = append(dst, byte(nearestCentroid(v[q.bounds[s]:q.bounds[s+1]], centroids, q.k)))
+	}
+
+	return dst
+}
+
+func (q *ProductQuantizer) Decode(code []byte) core.Vec32 {
+	v := make(core.Vec32, q.dim)
+	for s, centroids := range q.centroids {
+		d := q.bounds[s+1] - q.bounds[s]
+		c := int(code[s])
+		copy(v[q.bounds[s]:], centroids[c*d:(c+1)*d])
+	}
+
+	return v
+}
+
+// Scorer computes the table of the partial scores of the query against the
+// centroids of every subspace, which costs as much as scoring 256 float
+// vectors: searches over fewer codes than that are cheaper with another
+// quantizer
+func (q *ProductQuantizer) Scorer(query core.Vec32, metric vectorstore.Metric) Scorer {
+	m, k := len(q.centroids), q.k
+	table := make([]float32, m*k)
+	for s, centroids := range q.centroids {
+		sub := query[q.bounds[s]:q.bounds[s+1]]
+		d := len(sub)
+		for c := 0; c < k; c++ {
+			if metric == vectorstore.L2 {
+				table[s*k+c] = vectorstore.SquaredL2(sub, centroids[c*d:(c+1)*d])
+			} else {
+				table[s*k+c] = vectorstore.Dot(sub, centroids[c*d:(c+1)*d])
+			}
+		}
+	}
+
+	return func(code []byte) float32 {
+		code = code[:m]
+		var sum float32
+		for s, c := range code {
+			sum += table[s*k+int(c)]
+		}
+		if metric == vectorstore.L2 {
+			return l2Score(sum)
+		}
+		return sum
+	}
+}
+
+func (q *ProductQuantizer) MarshalBinary() ([]byte, error) {
+	if !q.Trained() {
+		return nil, ErrNotTrained
+	}
+
+	b := []byte{kindProduct}
+	b = appendUint32(b, uint32(q.dim))
+	b = appendUint32(b, uint32(len(q.centroids)))
+	b = appendUint32(b, uint32(q.k))
+	for _, centroids := range q.centroids {
+		b = appendFloats(b, centroids)
+	}
+
+	return b, nil
+}
+
+func (q *ProductQuantizer) UnmarshalBinary(data []byte) error {
+	r, err := header(data, kindProduct)
+	if err != nil {
+		return err
+	}
+
+	dim, m, k := int(r.uint32()), int(r.uint32()), int(r.uint32())
+	if r.err != nil {
+		return r.err
+	}
+	if dim == 0 || m == 0 || m > dim || k == 0 || k > 256 {
+		return fmt.Errorf("invalid product quantizer of %d dimensions, %d subspaces and %d centroids", dim, m, k)
+	}
+
+	bounds := make([]int, m+1)
+	for i := range bounds {
+		bounds[i] = i * dim / m
+	}
+	centroids := make([][]float32, m)
+	for s := range centroids {
+		centroids[s] = r.floats(k * (bounds[s+1] - bounds[s]))
+	}
+	if r.err != nil {
+		return r.err
+	}
+
+	q.dim, q.bounds, q.k, q.centroids = dim, bounds, k, centroids
+	q.subspaces = m
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package quant compresses vectors into compact codes, for indexes that do
+// not fit in memory at four bytes per dimension. The stores of the memory,
+// hnsw and disk packages accept a Quantizer as a storage option and search
+// its codes instead of the float vectors.
+//
+// Three quantizers trade memory for precision, for 384 dimensions:
+//
+//	quantizer               bytes per vector   compression
+//	ScalarQuantizer         384                4x
+//	ProductQuantizer        48                 32x
+//	BinaryQuantizer         52                 30x
+//
+// Scalar quantization keeps 8 bits per dimension and barely changes the
+// ranking. Product and binary quantization lose more: they are meant to
+// preselect candidates that are then rescored against the float vectors,
+// kept on disk by the disk store. Measured by BenchmarkRecall on 20,000
+// unit vectors of 384 dimensions drawn around a 64 dimensional subspace,
+// the recall@10 of a brute force search of the codes was:
+//
+//	quantizer               no rescoring   rescoring 10x
+//	ScalarQuantizer         0.99           1.00
+//	ProductQuantizer        0.62           1.00
+//	BinaryQuantizer         0.39           0.88
+//
+// Quantizers are trained on a sample of the vectors they will encode, before
+// any store uses them:
+//
+//	q := quant.NewScalarQuantizer()
+//	if err := q.Train(sample); err != nil {
+//		return err
+//	}
+//	store := memory.NewMemoryVectorStore(embedder, memory.WithQuantizer(q))
+//
+// A trained quantizer can be saved with MarshalBinary and restored with
+// UnmarshalBinary, or with Unmarshal when its kind is not known.
+package quant
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// ErrNotTrained is returned when an untrained quantizer is used
+var ErrNotTrained = errors.New("quantizer is not trained")
+
+// Quantizer compresses vectors of a fixed dimension into fixed size codes.
+// Train must not run concurrently with other methods, which are safe for
+// concurrent use once trained.
+type Quantizer interface {
+	// Train fits the quantizer to a sample of the vectors it will encode
+	Train(sample []core.Vec32) error
+
+	// Trained reports whether the quantizer was trained
+	Trained() bool
+
+	// Dimensions returns the dimension of the vectors encoded
+	Dimensions() int
+
+	// CodeSize returns the size in bytes of a code
+	CodeSize() int
+
+	// Encode appends the code of v to dst and returns the extended slice
+	Encode(dst []byte, v core.Vec32) []byte
+
+	// Decode returns the approximation of the vector encoded by code
+	Decode(code []byte) core.Vec32
+
+	// Scorer returns a function estimating the score of query against the
+	// vectors encoded by codes, on the scale of metric. Under the cosine
+	// metric both vectors are assumed to be unit length, as the stores keep
+	// them.
+	Scorer(query core.Vec32, metric vectorstore.Metric) Scorer
+
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+// Scorer estimates the score of a query against the vector of a code
+type Scorer func(code []byte) float32
+
+// l2Score turns a squared euclidean distance into the score of the L2 metric
+func l2Score(d float32) float32 {
+	return 1 / (1 + float32(math.Sqrt(float64(max(d, 0)))))
+}
+
+// checkSample returns the dimension of the vectors of sample, which must all
+// have the same
+func checkSample(sample []core.Vec32) (int, error) {
+	if len(sample) == 0 || len(sample[0]) == 0 {
+		return 0, errors.New("empty training sample")
+	}
+
+	dim := len(sample[0])
+	for _, v := range sample {
+		if len(v) != dim {
+			return 0, fmt.Errorf("%w: got %d, want %d", vectorstore.ErrDimensionMismatch, len(v), dim)
+		}
+	}
+
+	return dim, nil
+}
+
+// Sample returns n of vectors picked at random, or all of them when there are
+// fewer, for training quantizers on large corpora
+func Sample(vectors []core.Vec32, n int, seed int64) []core.Vec32 {
+	if len(vectors) <= n {
+		return vectors
+	}
+
+	out := make([]core.Vec32, n)
+	for i, j := range rand.New(rand.NewSource(seed)).Perm(len(vectors))[:n] {
+		out[i] = vectors[j]
+	}
+
+	return out
+}
+
+// Unmarshal returns a new quantizer restored from the data of MarshalBinary,
+// of the kind that wrote it
+func Unmarshal(data []byte) (Quantizer, error) {
+	var q Quantizer
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("empty quantizer data")
+	case data[0] == kindScalar:
+		q = NewScalarQuantizer()
+	case data[0] == kindBinary:
+		q = NewBinaryQuantizer()
+	case data[0] == kindProduct:
+		q = NewProductQuantizer()
+	default:
+		return nil, fmt.Errorf("unknown quantizer kind %q", data[0])
+	}
+
+	if err := q.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// reader decodes the little-endian values written by MarshalBinary
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) uint32() uint32 {
+	if len(r.data) < 4 {
+		r.err = errors.New("truncated quantizer data")
+		return 0
+	}
+
+	v := binary.LittleEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *reader) floats(n int) []float32 {
+	if len(r.data) < 4*n {
+		r.err = errors.New("truncated quantizer data")
+		return nil
+	}
+
+	out := make([]float32, n)
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(r.data[4*i:]))
+	}
+	r.data = r.data[4*n:]
+	return out
+}
+
+// header checks the leading kind byte of quantizer data
+func header(data []byte, kind byte) (*reader, error) {
+	if len(data) == 0 || data[0] != kind {
+		return nil, fmt.Errorf("not %s quantizer data", kindName(kind))
+	}
+
+	return &reader{data: data[1:]}, nil
+}
+
+func kindName(kind byte) string {
+	switch kind {
+	case kindScalar:
+		return "scalar"
+	case kindBinary:
+		return "binary"
+	default:
+		return "product"
+	}
+}
+
+const (
+	kindScalar  = 's'
+	kindBinary  = 'b'
+	kindProduct = 'p'
+)
+
+func appendUint32(b []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+func appendFloats(b []byte, v []float32) []byte {
+	for _, x := range v {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(x))
+	}
+
+	return b
+}
@@ -0,0 +1,241 @@
+package quant
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// clusteredVectors returns n unit vectors of dim dimensions drawn around a
+// random subspace of sub dimensions, as embeddings of a corpus are
+func clusteredVectors(n, dim, sub int, seed int64) []core.Vec32 {
+	r := rand.New(rand.NewSource(seed))
+
+	basis := make([]core.Vec32, sub)
+	for i := range basis {
+		basis[i] = make(core.Vec32, dim)
+		for j := range basis[i] {
+			basis[i][j] = float32(r.NormFloat64())
+		}
+	}
+
+	out := make([]core.Vec32, n)
+	for i := range out {
+		v := make(core.Vec32, dim)
+		for _, b := range basis {
+			c := float32(r.NormFloat64())
+			for j := range v {
+				v[j] += c * b[j]
+			}
+		}
+		for j := range v {
+			v[j] += float32(r.NormFloat64()) * 2
+		}
+		out[i] = vectorstore.Normalize(v)
+	}
+
+	return out
+}
+
+// topK returns the indexes of the k vectors scoring highest
+func topK(k int, n int, score func(i int) float32) []int {
+	indexes := make([]int, n)
+	scores := make([]float32, n)
+	for i := range indexes {
+		indexes[i] = i
+		scores[i] = score(i)
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return scores[indexes[a]] > scores[indexes[b]]
+	})
+
+	return indexes[:min(k, n)]
+}
+
+// recall returns the recall@k of a brute force search of the codes of q
+// against the exact cosine neighbours of queries among data. With rescore,
+// the k × rescore best codes are rescored against the float vectors.
+func recall(q Quantizer, data, queries []core.Vec32, k, rescore int) float64 {
+	codes := make([][]byte, len(data))
+	for i, v := range data {
+		codes[i] = q.Encode(nil, v)
+	}
+
+	total := 0.0
+	for _, query := range queries {
+		exact := topK(k, len(data), func(i int) float32 {
+			return vectorstore.Cosine.Score(query, data[i])
+		})
+
+		score := q.Scorer(query, vectorstore.Cosine)
+		found := topK(k*max(rescore, 1), len(data), func(i int) float32 {
+			return score(codes[i])
+		})
+		if rescore > 0 {
+			candidates := found
+			found = topK(k, len(candidates), func(i int) float32 {
+				return vectorstore.Cosine.Score(query, data[candidates[i]])
+			})
+			for i, c := range found {
+				found[i] = candidates[c]
+			}
+		}
+
+		want := make(map[int]bool, k)
+		for _, i := range exact {
+			want[i] = true
+		}
+		hits := 0
+		for _, i := range found {
+			if want[i] {
+				hits++
+			}
+		}
+		total += float64(hits) / float64(len(exact))
+	}
+
+	return total / float64(len(queries))
+}
+
+var quantizers = map[string]func() Quantizer{
+	"scalar":  func() Quantizer { return NewScalarQuantizer() },
+	"product": func() Quantizer { return NewProductQuantizer() },
+	"binary":  func() Quantizer { return NewBinaryQuantizer() },
+}
+
+func TestRecall(t *testing.T) {
+	data := clusteredVectors(2000+50, 128, 32, 1)
+	queries, data := data[:50], data[50:]
+
+	for name, want := range map[string][2]float64{
+		"scalar":  {0.95, 0.99},
+		"product": {0.4, 0.95},
+		"binary":  {0.3, 0.8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q := quantizers[name]()
+			if err := q.Train(data); err != nil {
+				t.Fatal(err)
+			}
+
+			if r := recall(q, data, queries, 10, 0); r < want[0] {
+				t.Errorf("recall@10 %.3f, want at least %.2f", r, want[0])
+			}
+			if r := recall(q, data, queries, 10, 10); r < want[1] {
+				t.Errorf("recall@10 rescoring 10x %.3f, want at least %.2f", r, want[1])
+			}
+		})
+	}
+}
+
+func TestMarshalBinary(t *testing.T) {
+	data := clusteredVectors(500, 64, 16, 1)
+
+	for name, newQuantizer := range quantizers {
+		t.Run(name, func(t *testing.T) {
+			q := newQuantizer()
+			if _, err := q.MarshalBinary(); err != ErrNotTrained {
+				t.Errorf("untrained: got %v, want ErrNotTrained", err)
+			}
+			if err := q.Train(data); err != nil {
+				t.Fatal(err)
+			}
+
+			saved, err := q.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			restored, err := Unmarshal(saved)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if restored.Dimensions() != q.Dimensions() || restored.CodeSize() != q.CodeSize() {
+				t.Errorf("restored %d dimensions, %d bytes, want %d, %d", restored.Dimensions(), restored.CodeSize(), q.Dimensions(), q.CodeSize())
+			}
+			for _, v := range data[:20] {
+				if !bytes.Equal(restored.Encode(nil, v), q.Encode(nil, v)) {
+					t.Fatal("restored quantizer encodes differently")
+				}
+			}
+
+			if _, err := Unmarshal(saved[:len(saved)-1]); err == nil {
+				t.Error("truncated data was restored")
+			}
+		})
+	}
+
+	if _, err := Unmarshal([]byte("x")); err == nil {
+		t.Error("data of an unknown kind was restored")
+	}
+}
+
+// BenchmarkRecall measures the figures documented in the package comment:
+// 20,000 unit vectors of 384 dimensions around a 64 dimensional subspace,
+// recall@10 without rescoring and rescoring 10x
+func BenchmarkRecall(b *testing.B) {
+	data := clusteredVectors(20000+100, 384, 64, 1)
+	queries, data := data[:100], data[100:]
+
+	for _, name := range []string{"scalar", "product", "binary"} {
+		q := quantizers[name]()
+		if err := q.Train(Sample(data, 20000, 1)); err != nil {
+			b.Fatal(err)
+		}
+
+		for _, rescore := range []int{0, 10} {
+			b.Run(fmt.Sprintf("%s/rescore=%d", name, rescore), func(b *testing.B) {
+				var r float64
+				for i := 0; i < b.N; i++ {
+					r = recall(q, data, queries, 10, rescore)
+				}
+				b.ReportMetric(r, "recall@10")
+			})
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	data := clusteredVectors(1000, 384, 64, 1)
+
+	for _, name := range []string{"scalar", "product", "binary"} {
+		q := quantizers[name]()
+		if err := q.Train(data); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(name, func(b *testing.B) {
+			code := make([]byte, 0, q.CodeSize())
+			for i := 0; i < b.N; i++ {
+				code = q.Encode(code[:0], data[i%len(data)])
+			}
+		})
+	}
+}
+
+func BenchmarkScore(b *testing.B) {
+	data := clusteredVectors(1000, 384, 64, 1)
+
+	for _, name := range []string{"scalar", "product", "binary"} {
+		q := quantizers[name]()
+		if err := q.Train(data); err != nil {
+			b.Fatal(err)
+		}
+		codes := make([][]byte, len(data))
+		for i, v := range data {
+			codes[i] = q.Encode(nil, v)
+		}
+		score := q.Scorer(data[0], vectorstore.Cosine)
+
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				score(codes[i%len(codes)])
+			}
+		})
+	}
+}
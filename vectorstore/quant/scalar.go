@@ -0,0 +1,162 @@
+package quant
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// ScalarQuantizer maps each dimension linearly onto 256 levels between the
+// minimum and maximum it takes in the training sample, a byte per dimension.
+// Values outside of that range are clamped.
+type ScalarQuantizer struct {
+	min  []float32
+	step []float32
+}
+
+// NewScalarQuantizer returns a new, untrained ScalarQuantizer
+func NewScalarQuantizer() *ScalarQuantizer {
+	return &ScalarQuantizer{}
+}
+
+func (q *ScalarQuantizer) Train(sample []core.Vec32) error {
+	dim, err := checkSample(sample)
+	if err != nil {
+		return err
+	}
+
+	lo := make([]float32, dim)
+	hi := make([]float32, dim)
+	copy(lo, sample[0])
+	copy(hi, sample[0])
+	for _, v := range sample[1:] {
+		for i, x := range v {
+			lo[i] = min(lo[i], x)
+			hi[i] = max(hi[i], x)
+		}
+	}
+
+	q.min = lo
+	q.step = make([]float32, dim)
+	for i := range q.step {
+		q.step[i] = (hi[i] - lo[i]) / 255
+	}
+
+	return nil
+}
+
+func (q *ScalarQuantizer) Trained() bool {
+	return q.min != nil
+}
+
+func (q *ScalarQuantizer) Dimensions() int {
+	return len(q.min)
+}
+
+func (q *ScalarQuantizer) CodeSize() int {
+	return len(q.min)
+}
+
+func (q *ScalarQuantizer) Encode(dst []byte, v core.Vec32) []byte {
+	for i, x := range v[:len(q.min)] {
+		var level float32
+		if q.step[i] > 0 {
+			level = float32(math.Round(float64((x - q.min[i]) / q.step[i])))
+		}
+		dst = append(dst, byte(min(max(level, 0), 255)))
+	}
+
+	return dst
+}
+
+func (q *ScalarQuantizer) Decode(code []byte) core.Vec32 {
+	v := make(core.Vec32, len(q.min))
+	for i, c := range code[:len(v)] {
+		v[i] = q.min[i] + q.step[i]*float32(c)
+	}
+
+	return v
+}
+
+// Scorer folds the offsets and steps of the dimensions into the query, so
+// that scoring a code costs one multiplication per dimension
+func (q *ScalarQuantizer) Scorer(query core.Vec32, metric vectorstore.Metric) Scorer {
+	dim := len(q.min)
+	query = query[:dim]
+
+	if metric == vectorstore.L2 {
+		// each term is (query - min - step × code)²
+		offset := make([]float32, dim)
+		for i := range offset {
+			offset[i] = query[i] - q.min[i]
+		}
+		step := q.step
+
+		return func(code []byte) float32 {
+			code = code[:dim]
+			var d float32
+			for i, c := range code {
+				diff := offset[i] - step[i]*float32(c)
+				d += diff * diff
+			}
+			return l2Score(d)
+		}
+	}
+
+	// query · decoded is query · min + Σ query × step × code
+	var base float32
+	weights := make([]float32, dim)
+	for i := range weights {
+		base += query[i] * q.min[i]
+		weights[i] = query[i] * q.step[i]
+	}
+
+	return func(code []byte) float32 {
+		code = code[:dim]
+		var s0, s1, s2, s3 float32
+		i := 0
+		for ; i+4 <= dim; i += 4 {
+			s0 += weights[i] * float32(code[i])
+			s1 += weights[i+1] * float32(code[i+1])
+			s2 += weights[i+2] * float32(code[i+2])
+			s3 += weights[i+3] * float32(code[i+3])
+		}
+		for ; i < dim; i++ {
+			s0 += weights[i] * float32(code[i])
+		}
+		return base + s0 + s1 + s2 + s3
+	}
+}
+
+func (q *ScalarQuantizer) MarshalBinary() ([]byte, error) {
+	if !q.Trained() {
+		return nil, ErrNotTrained
+	}
+
+	b := []byte{kindScalar}
+	b = appendUint32(b, uint32(len(q.min)))
+	b = appendFloats(b, q.min)
+	return appendFloats(b, q.step), nil
+}
+
+func (q *ScalarQuantizer) UnmarshalBinary(data []byte) error {
+	r, err := header(data, kindScalar)
+	if err != nil {
+		return err
+	}
+
+	dim := int(r.uint32())
+	lo := r.floats(dim)
+	step := r.floats(dim)
+	if r.err != nil {
+		return r.err
+	}
+	if dim == 0 {
+		return fmt.Errorf("invalid scalar quantizer of %d dimensions", dim)
+	}
+
+	q.min, q.step = lo, step
+	return nil
+}
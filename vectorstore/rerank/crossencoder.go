@@ -0,0 +1,253 @@
+package rerank
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/joaopandolfi/core"
+)
+
+// Format is the request and response format of a reranking endpoint
+type Format int
+
+const (
+	// FormatCohere is the format of the Cohere, Jina and Voyage rerank APIs
+	// and of most services mimicking them:
+	//
+	//	{"model": "...", "query": "...", "documents": ["..."], "top_n": 5}
+	//	{"results": [{"index": 0, "relevance_score": 0.92}]}
+	FormatCohere Format = iota
+
+	// FormatTEI is the format of the /rerank route of Hugging Face's text
+	// embeddings inference server:
+	//
+	//	{"query": "...", "texts": ["..."], "truncate": true}
+	//	[{"index": 0, "score": 0.92}]
+	FormatTEI
+)
+
+// CrossEncoder is a core.Reranker scoring each result against the query with
+// a cross-encoder model served through an HTTP endpoint
+type CrossEncoder struct {
+	url      string
+	apiKey   string
+	model    string
+	format   Format
+	maxChars int
+	client   *http.Client
+}
+
+// CrossEncoderConfig holds configuration for a CrossEncoder
+type CrossEncoderConfig struct {
+	// APIKey, sent as a bearer token when set
+	// default none
+	APIKey string
+
+	// Model name sent along with FormatCohere requests
+	// default none
+	Model string
+
+	// Format of the endpoint
+	// default FormatCohere
+	Format Format
+
+	// MaxChars truncates the content sent for each result. Zero sends it
+	// whole.
+	// default 0
+	MaxChars int
+
+	// The http.Client used to call the endpoint
+	// default http.DefaultClient
+	Client *http.Client
+}
+
+// CrossEncoderConfigFunc is a function type that modifies CrossEncoderConfig
+type CrossEncoderConfigFunc func(*CrossEncoderConfig)
+
+func WithAPIKey(key string) CrossEncoderConfigFunc {
+	return func(conf *CrossEncoderConfig) {
+		conf.APIKey = key
+	}
+}
+
+func WithModel(model string) CrossEncoderConfigFunc {
+	return func(conf *CrossEncoderConfig) {
+		conf.Model = model
+	}
+}
+
+func WithFormat(f Format) CrossEncoderConfigFunc {
+	return func(conf *CrossEncoderConfig) {
+		conf.Format = f
+	}
+}
+
+func WithMaxChars(n int) CrossEncoderConfigFunc {
+	return func(conf *CrossEncoderConfig) {
+		conf.MaxChars = n
+	}
+}
+
+func WithHTTPClient(c *http.Client) CrossEncoderConfigFunc {
+	return func(conf *CrossEncoderConfig) {
+		conf.Client = c
+	}
+}
+
+// NewCrossEncoder returns a new CrossEncoder calling the endpoint at url
+func NewCrossEncoder(url string, opts ...CrossEncoderConfigFunc) *CrossEncoder {
+	conf := &CrossEncoderConfig{
+		Format: FormatCohere,
+		Client: http.DefaultClient,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &CrossEncoder{
+		url:      url,
+		apiKey:   conf.APIKey,
+		model:    conf.Model,
+		format:   conf.Format,
+		maxChars: conf.MaxChars,
+		client:   conf.Client,
+	}
+}
+
+type cohereRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n,omitempty"`
+}
+
+type teiRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+type rankedItem struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float32 `json:"relevance_score"`
+	Score          *float32 `json:"score"`
+}
+
+// Rerank scores results with the endpoint. Results the endpoint leaves out
+// are dropped.
+func (c *CrossEncoder) Rerank(ctx context.Context, query string, results []*core.SearchResult, limit int) ([]*core.SearchResult, error) {
+	if len(results) == 0 {
+		return []*core.SearchResult{}, nil
+	}
+
+	docs := make([]string, len(results))
+	for i, res := range results {
+		docs[i] = truncate(res.Embedding.Content, c.maxChars)
+	}
+
+	var req any
+	switch c.format {
+	case FormatTEI:
+		req = &teiRequest{Query: query, Texts: docs, Truncate: true}
+	default:
+		req = &cohereRequest{Model: c.model, Query: query, Documents: docs, TopN: max(limit, 0)}
+	}
+
+	items, err := c.call(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*core.SearchResult, 0, len(items))
+	seen := make(map[int]bool, len(items))
+	for _, item := range items {
+		if item.Index < 0 || item.Index >= len(results) || seen[item.Index] {
+			return nil, fmt.Errorf("reranker returned an invalid index %d", item.Index)
+		}
+		seen[item.Index] = true
+
+		score := item.Score
+		if item.RelevanceScore != nil {
+			score = item.RelevanceScore
+		}
+		if score == nil {
+			return nil, fmt.Errorf("reranker returned no score for index %d", item.Index)
+		}
+
+		out = append(out, rescored(results[item.Index], *score))
+	}
+
+	return sortAndLimit(out, limit), nil
+}
+
+func (c *CrossEncoder) call(ctx context.Context, body any) ([]rankedItem, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("error creating rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error calling reranker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rerank response: %w", err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("reranker returned %s: %s", resp.Status, truncate(string(bytes.TrimSpace(data)), 512))
+	}
+
+	// TEI answers with a bare list, the others wrap it
+	var items []rankedItem
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &items)
+	} else {
+		var wrapped struct {
+			Results []rankedItem `json:"results"`
+		}
+		err = json.Unmarshal(data, &wrapped)
+		items = wrapped.Results
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding rerank response: %w", err)
+	}
+
+	return items, nil
+}
+
+// truncate cuts s to at most n bytes, on a rune boundary. Zero or less
+// leaves s whole.
+func truncate(s string, n int) string {
+	if n <= 0 || len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !isRuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,110 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joaopandolfi/core"
+)
+
+func results(contents ...string) []*core.SearchResult {
+	out := make([]*core.SearchResult, len(contents))
+	for i, c := range contents {
+		out[i] = &core.SearchResult{Embedding: &core.Embedding{ID: c, Content: c}, Score: 0.5}
+	}
+	return out
+}
+
+func ids(results []*core.SearchResult) string {
+	parts := make([]string, len(results))
+	for i, r := range results {
+		parts[i] = r.Embedding.ID
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestCrossEncoderCohere(t *testing.T) {
+	var got cohereRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer key" {
+			t.Errorf("authorization %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"results": [{"index": 2, "relevance_score": 0.9}, {"index": 0, "relevance_score": 0.4}]}`))
+	}))
+	defer srv.Close()
+
+	c := NewCrossEncoder(srv.URL, WithAPIKey("key"), WithModel("rerank-v3"), WithMaxChars(4))
+	out, err := c.Rerank(context.Background(), "query", results("alpha", "beta", "gamma"), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "rerank-v3" || got.Query != "query" || got.TopN != 2 || strings.Join(got.Documents, ",") != "alph,beta,gamm" {
+		t.Errorf("request %+v", got)
+	}
+	if ids(out) != "gamma,alpha" || out[0].Score != 0.9 || out[1].Score != 0.4 {
+		t.Errorf("got %s with scores %v, %v", ids(out), out[0].Score, out[1].Score)
+	}
+}
+
+func TestCrossEncoderTEI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req teiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Texts) != 3 || !req.Truncate {
+			t.Errorf("request %+v, %v", req, err)
+		}
+		w.Write([]byte(`[{"index": 0, "score": 0.1}, {"index": 1, "score": 0.7}, {"index": 2, "score": 0.3}]`))
+	}))
+	defer srv.Close()
+
+	out, err := NewCrossEncoder(srv.URL, WithFormat(FormatTEI)).Rerank(context.Background(), "query", results("a", "b", "c"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(out) != "b,c,a" {
+		t.Errorf("got %s", ids(out))
+	}
+}
+
+func TestCrossEncoderErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		status int
+		body   string
+		want   string
+	}{
+		"status":        {http.StatusTooManyRequests, `{"message": "slow down"}`, "429"},
+		"invalid index": {http.StatusOK, `{"results": [{"index": 3, "relevance_score": 0.9}]}`, "invalid index 3"},
+		"repeated":      {http.StatusOK, `[{"index": 0, "score": 0.9}, {"index": 0, "score": 0.8}]`, "invalid index 0"},
+		"no score":      {http.StatusOK, `{"results": [{"index": 0}]}`, "no score"},
+		"malformed":     {http.StatusOK, `{"results": `, "error decoding"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			_, err := NewCrossEncoder(srv.URL).Rerank(context.Background(), "query", results("a", "b"), 0)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("héllo", 2); got != "h" {
+		t.Errorf("got %q, want a cut before the multibyte rune", got)
+	}
+	if got := truncate("héllo", 0); got != "héllo" {
+		t.Errorf("got %q", got)
+	}
+}
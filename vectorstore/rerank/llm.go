@@ -0,0 +1,222 @@
+package rerank
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+
+	"github.com/joaopandolfi/core"
+)
+
+const defaultLLMSystemPrompt = "You rank passages by how well they answer a search query. " +
+	"You only ever answer with a JSON array of passage numbers, most relevant first."
+
+// LLMReranker is a listwise core.Reranker: it shows an LLM the query along
+// with a window of numbered passages and asks for their order. Result lists
+// longer than the window are ranked with windows sliding from the bottom of
+// the list to its top, so that relevant results bubble up (Sun et al., 2023).
+//
+// Results get scores from 1 down to 0 following their final rank.
+type LLMReranker struct {
+	provider     core.Provider
+	window       int
+	step         int
+	maxChars     int
+	systemPrompt string
+	logger       *logr.Logger
+}
+
+// LLMRerankerConfig holds configuration for an LLMReranker
+type LLMRerankerConfig struct {
+	// WindowSize is the number of passages ranked per LLM call
+	// default 20
+	WindowSize int
+
+	// StepSize is how far the window slides between calls. It must be
+	// smaller than WindowSize for relevant results to move across windows.
+	// default 10
+	StepSize int
+
+	// MaxPassageChars truncates each passage shown to the LLM
+	// default 1000
+	MaxPassageChars int
+
+	// SystemPrompt instructing the LLM
+	// default a prompt asking for a JSON array of passage numbers
+	SystemPrompt string
+
+	// Logger
+	// default logr.Discard()
+	Logger *logr.Logger
+}
+
+// LLMRerankerConfigFunc is a function type that modifies LLMRerankerConfig
+type LLMRerankerConfigFunc func(*LLMRerankerConfig)
+
+func WithWindowSize(n int) LLMRerankerConfigFunc {
+	return func(conf *LLMRerankerConfig) {
+		conf.WindowSize = n
+	}
+}
+
+func WithStepSize(n int) LLMRerankerConfigFunc {
+	return func(conf *LLMRerankerConfig) {
+		conf.StepSize = n
+	}
+}
+
+func WithMaxPassageChars(n int) LLMRerankerConfigFunc {
+	return func(conf *LLMRerankerConfig) {
+		conf.MaxPassageChars = n
+	}
+}
+
+func WithSystemPrompt(prompt string) LLMRerankerConfigFunc {
+	return func(conf *LLMRerankerConfig) {
+		conf.SystemPrompt = prompt
+	}
+}
+
+func WithLogger(l *logr.Logger) LLMRerankerConfigFunc {
+	return func(conf *LLMRerankerConfig) {
+		conf.Logger = l
+	}
+}
+
+// NewLLMReranker returns a new LLMReranker prompting the given provider
+func NewLLMReranker(provider core.Provider, opts ...LLMRerankerConfigFunc) *LLMReranker {
+	discard := logr.Discard()
+	conf := &LLMRerankerConfig{
+		WindowSize:      20,
+		StepSize:        10,
+		MaxPassageChars: 1000,
+		SystemPrompt:    defaultLLMSystemPrompt,
+		Logger:          &discard,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	window := max(conf.WindowSize, 2)
+	return &LLMReranker{
+		provider:     provider,
+		window:       window,
+		step:         min(max(conf.StepSize, 1), window),
+		maxChars:     conf.MaxPassageChars,
+		systemPrompt: conf.SystemPrompt,
+		logger:       conf.Logger,
+	}
+}
+
+// Rerank orders results with the LLM
+func (r *LLMReranker) Rerank(ctx context.Context, query string, results []*core.SearchResult, limit int) ([]*core.SearchResult, error) {
+	order := make([]int, len(results))
+	for i := range order {
+		order[i] = i
+	}
+
+	for end := len(order); end > 0; end -= r.step {
+		start := max(end-r.window, 0)
+		if err := r.rankWindow(ctx, query, results, order[start:end]); err != nil {
+			return nil, err
+		}
+		if start == 0 {
+			break
+		}
+	}
+
+	out := make([]*core.SearchResult, len(order))
+	for rank, i := range order {
+		out[rank] = rescored(results[i], 1-float32(rank)/float32(len(order)))
+	}
+
+	return sortAndLimit(out, limit), nil
+}
+
+// rankWindow reorders window, a slice of indexes into results, in place
+func (r *LLMReranker) rankWindow(ctx context.Context, query string, results []*core.SearchResult, window []int) error {
+	if len(window) < 2 {
+		return nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Query: %s\n\nPassages:\n", query)
+	for n, i := range window {
+		content := strings.Join(strings.Fields(truncate(results[i].Embedding.Content, r.maxChars)), " ")
+		fmt.Fprintf(&b, "[%d] %s\n", n+1, content)
+	}
+	fmt.Fprintf(&b, "\nRank the %d passages above by relevance to the query. "+
+		"Answer with their numbers only, most relevant first, as a JSON array such as [2, 1, 3].", len(window))
+
+	msg, err := r.provider.Generate(ctx, &core.GenerateOptions{
+		Messages: []*core.Message{
+			{Role: core.SystemMessageRole, Content: r.systemPrompt},
+			{Role: core.UserMessageRole, Content: b.String()},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error generating ranking: %w", err)
+	}
+
+	ranking := parseRanking(msg.Content, len(window))
+	if len(ranking) == 0 {
+		r.logger.Info("Could not parse a ranking, keeping the window order", "response", truncate(msg.Content, 200))
+		return nil
+	}
+
+	// passages the LLM forgot keep their relative order after those it ranked
+	ranked := make([]int, 0, len(window))
+	used := make([]bool, len(window))
+	for _, n := range ranking {
+		ranked = append(ranked, window[n])
+		used[n] = true
+	}
+	for n, i := range window {
+		if !used[n] {
+			ranked = append(ranked, i)
+		}
+	}
+	copy(window, ranked)
+
+	return nil
+}
+
+var numberPattern = regexp.MustCompile(`\d+`)
+
+// parseRanking extracts the 0-based passage indexes of an answer, preferably
+// from a JSON array, otherwise from the numbers it holds. Duplicates and
+// numbers out of range are ignored.
+func parseRanking(answer string, n int) []int {
+	var numbers []int
+	if start, end := strings.Index(answer, "["), strings.LastIndex(answer, "]"); start >= 0 && end > start {
+		if err := json.Unmarshal([]byte(answer[start:end+1]), &numbers); err != nil {
+			numbers = nil
+		}
+	}
+
+	if numbers == nil {
+		for _, m := range numberPattern.FindAllString(answer, -1) {
+			if v, err := strconv.Atoi(m); err == nil {
+				numbers = append(numbers, v)
+			}
+		}
+	}
+
+	seen := make([]bool, n)
+	ranking := make([]int, 0, n)
+	for _, v := range numbers {
+		if v < 1 || v > n || seen[v-1] {
+			continue
+		}
+		seen[v-1] = true
+		ranking = append(ranking, v-1)
+	}
+
+	return ranking
+}
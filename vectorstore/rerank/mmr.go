@@ -0,0 +1,125 @@
+package rerank
+
+import (
+	"context"
+
+	"github.com/joaopandolfi/core"
+	"github.com/joaopandolfi/core/vectorstore"
+)
+
+// MMR is a core.Reranker trading relevance for diversity with maximal
+// marginal relevance (Carbonell & Goldstein, 1998): results are picked one at
+// a time, each maximizing
+//
+//	lambda × relevance − (1 − lambda) × max similarity to the picked ones
+//
+// Relevance is the search score, min-max normalized over the results, and
+// similarity is the cosine of the stored vectors, so results must carry
+// their vectors. Results get their MMR value as score.
+type MMR struct {
+	lambda float32
+}
+
+// MMRConfig holds configuration for an MMR
+type MMRConfig struct {
+	// Lambda weighs relevance against diversity: 1 keeps the search order,
+	// 0 only seeks diversity
+	// default 0.5
+	Lambda float32
+}
+
+// MMRConfigFunc is a function type that modifies MMRConfig
+type MMRConfigFunc func(*MMRConfig)
+
+func WithLambda(lambda float32) MMRConfigFunc {
+	return func(conf *MMRConfig) {
+		conf.Lambda = lambda
+	}
+}
+
+// NewMMR returns a new MMR reranker
+func NewMMR(opts ...MMRConfigFunc) *MMR {
+	conf := &MMRConfig{
+		Lambda: 0.5,
+	}
+
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	return &MMR{lambda: min(max(conf.Lambda, 0), 1)}
+}
+
+// Rerank picks up to limit diverse results. The query is not used: the
+// search scores already measure relevance to it.
+func (m *MMR) Rerank(ctx context.Context, query string, results []*core.SearchResult, limit int) ([]*core.SearchResult, error) {
+	n := len(results)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	if n == 0 {
+		return []*core.SearchResult{}, nil
+	}
+
+	lo, hi := results[0].Score, results[0].Score
+	vectors := make([]core.Vec32, n)
+	for i, res := range results {
+		lo = min(lo, res.Score)
+		hi = max(hi, res.Score)
+		if len(res.Embedding.Vector) > 0 {
+			vectors[i] = vectorstore.Normalize(res.Embedding.Vector)
+		}
+	}
+
+	relevance := make([]float32, n)
+	for i, res := range results {
+		relevance[i] = 1
+		if hi > lo {
+			relevance[i] = (res.Score - lo) / (hi - lo)
+		}
+	}
+
+	// maxSim holds the highest similarity of each result to the picked ones
+	maxSim := make([]float32, n)
+	picked := make([]bool, n)
+	out := make([]*core.SearchResult, 0, limit)
+
+	for len(out) < limit {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		best, bestValue := -1, float32(0)
+		for i := range results {
+			if picked[i] {
+				continue
+			}
+
+			value := m.lambda*relevance[i] - (1-m.lambda)*maxSim[i]
+			if best < 0 || value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+
+		picked[best] = true
+		out = append(out, rescored(results[best], bestValue))
+
+		for i := range results {
+			if !picked[i] {
+				maxSim[i] = max(maxSim[i], similarity(vectors[i], vectors[best]))
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// similarity is the cosine of two normalized vectors, zero when either is
+// missing or their dimensions differ
+func similarity(a, b core.Vec32) float32 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+
+	return vectorstore.Dot(a, b)
+}
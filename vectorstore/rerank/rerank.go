@@ -0,0 +1,29 @@
+// Package rerank provides core.Reranker implementations: a cross-encoder
+// served over HTTP, a listwise reranker prompting an LLM, and maximal
+// marginal relevance for diversity.
+package rerank
+
+import (
+	"sort"
+
+	"github.com/joaopandolfi/core"
+)
+
+// rescored returns a copy of res carrying score, leaving the result of the
+// search untouched
+func rescored(res *core.SearchResult, score float32) *core.SearchResult {
+	return &core.SearchResult{Score: score, Embedding: res.Embedding, SearchMeta: res.SearchMeta}
+}
+
+// sortAndLimit orders results best first and keeps at most limit of them
+func sortAndLimit(results []*core.SearchResult, limit int) []*core.SearchResult {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
@@ -0,0 +1,81 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/joaopandolfi/core"
+)
+
+// TopK collects the k best scoring embeddings out of a stream of candidates.
+// It keeps a min-heap of size k, so the worst retained score is checked in
+// constant time and a search over n vectors costs O(n log k).
+type TopK struct {
+	k    int
+	heap resultHeap
+}
+
+// NewTopK returns a collector retaining k results
+func NewTopK(k int) *TopK {
+	return &TopK{k: k, heap: make(resultHeap, 0, k)}
+}
+
+// Accepts reports whether a candidate with the given score would be retained,
+// letting callers skip building results that would be dropped
+func (t *TopK) Accepts(score float32) bool {
+	return t.k > 0 && (len(t.heap) < t.k || score > t.heap[0].Score)
+}
+
+// Push offers a candidate
+func (t *TopK) Push(score float32, e *core.Embedding) {
+	if !t.Accepts(score) {
+		return
+	}
+
+	if len(t.heap) < t.k {
+		heap.Push(&t.heap, &core.SearchResult{Score: score, Embedding: e})
+		return
+	}
+
+	t.heap[0] = &core.SearchResult{Score: score, Embedding: e}
+	heap.Fix(&t.heap, 0)
+}
+
+// Len returns the number of retained results
+func (t *TopK) Len() int {
+	return len(t.heap)
+}
+
+// Results returns the retained results, best first, tagged with params
+func (t *TopK) Results(params *core.SearchParams) []*core.SearchResult {
+	out := make([]*core.SearchResult, len(t.heap))
+	copy(out, t.heap)
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Score > out[j].Score
+	})
+
+	for _, r := range out {
+		r.SearchMeta = params
+	}
+
+	return out
+}
+
+type resultHeap []*core.SearchResult
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *resultHeap) Push(x any) {
+	*h = append(*h, x.(*core.SearchResult))
+}
+
+func (h *resultHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
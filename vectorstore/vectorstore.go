@@ -0,0 +1,179 @@
+// Package vectorstore holds the pieces shared by the core.VectorStorer
+// implementations in its sub packages: similarity metrics, top-k collection
+// and query handling.
+package vectorstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/joaopandolfi/core"
+)
+
+// DefaultLimit is the number of results returned when SearchParams.Limit is
+// not set
+const DefaultLimit = 10
+
+var (
+	// ErrDimensionMismatch is returned for vectors whose dimension differs
+	// from the vectors already in a store
+	ErrDimensionMismatch = errors.New("vector dimension mismatch")
+
+	// ErrEmptyQuery is returned for searches with neither a query nor a
+	// query vector
+	ErrEmptyQuery = errors.New("search needs a query or a query vector")
+
+	// ErrUnsupportedFilter is returned by stores backed by databases that
+	// cannot express a filter
+	ErrUnsupportedFilter = errors.New("filter not supported by the store")
+)
+
+// NewID returns a random embedding identifier
+func NewID() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// Embed generates the embeddings of contents, filling in missing IDs and
+// contents. Contents are embedded in a single call when embedder is a
+// core.BatchEmbedder.
+func Embed(ctx context.Context, embedder core.Embedder, contents []string) ([]*core.Embedding, error) {
+	if embedder == nil {
+		return nil, errors.New("no embedder configured")
+	}
+
+	embeddings, err := generate(ctx, embedder, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, e := range embeddings {
+		if e.ID == "" {
+			e.ID = NewID()
+		}
+		if e.Content == "" {
+			e.Content = contents[i]
+		}
+	}
+
+	return embeddings, nil
+}
+
+// EmbedMissing fills in the vectors of the embeddings that have none by
+// embedding their content, and the IDs of those without one
+func EmbedMissing(ctx context.Context, embedder core.Embedder, embeddings []*core.Embedding) error {
+	var (
+		missing  []*core.Embedding
+		contents []string
+	)
+	for _, e := range embeddings {
+		if e.ID == "" {
+			e.ID = NewID()
+		}
+		if len(e.Vector) > 0 {
+			continue
+		}
+
+		if e.Content == "" {
+			return fmt.Errorf("embedding %q has neither a vector nor content", e.ID)
+		}
+		missing = append(missing, e)
+		contents = append(contents, e.Content)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+	if embedder == nil {
+		return errors.New("no embedder configured")
+	}
+
+	generated, err := generate(ctx, embedder, contents)
+	if err != nil {
+		return err
+	}
+	for i, e := range missing {
+		e.Vector = generated[i].Vector
+	}
+
+	return nil
+}
+
+// generate embeds contents, in a single call when embedder supports it
+func generate(ctx context.Context, embedder core.Embedder, contents []string) ([]*core.Embedding, error) {
+	if batch, ok := embedder.(core.BatchEmbedder); ok && len(contents) > 1 {
+		embeddings, err := batch.GenerateEmbeddings(ctx, contents)
+		if err != nil {
+			return nil, fmt.Errorf("error generating embeddings: %w", err)
+		}
+		if len(embeddings) != len(contents) {
+			return nil, fmt.Errorf("embedder returned %d embeddings for %d contents", len(embeddings), len(contents))
+		}
+		return embeddings, nil
+	}
+
+	embeddings := make([]*core.Embedding, 0, len(contents))
+	for _, content := range contents {
+		e, err := embedder.GenerateEmbedding(ctx, content)
+		if err != nil {
+			return nil, fmt.Errorf("error generating embedding: %w", err)
+		}
+		embeddings = append(embeddings, e)
+	}
+
+	return embeddings, nil
+}
+
+// QueryVector returns params.QueryVec, embedding params.Query when it is not
+// set
+func QueryVector(ctx context.Context, embedder core.Embedder, params *core.SearchParams) (core.Vec32, error) {
+	if len(params.QueryVec) > 0 {
+		return params.QueryVec, nil
+	}
+
+	if params.Query == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	if embedder == nil {
+		return nil, errors.New("no embedder configured to embed the query")
+	}
+
+	e, err := embedder.GenerateEmbedding(ctx, params.Query)
+	if err != nil {
+		return nil, fmt.Errorf("error embedding query: %w", err)
+	}
+
+	return e.Vector, nil
+}
+
+// Limit returns the number of results a search should return
+func Limit(params *core.SearchParams) int {
+	if params.Limit <= 0 {
+		return DefaultLimit
+	}
+
+	return params.Limit
+}
+
+// Passes reports whether a score satisfies the threshold of a search. A zero
+// threshold accepts every score.
+func Passes(params *core.SearchParams, score float32) bool {
+	return params.Threshold == 0 || score >= params.Threshold
+}
+
+// ValidateFilter checks the filter of a search, if any
+func ValidateFilter(params *core.SearchParams) error {
+	if params.Filter == nil {
+		return nil
+	}
+
+	return params.Filter.Validate()
+}
@@ -11,6 +11,10 @@ type Embedding struct {
 	ID      string
 	Vector  Vec32
 	Content string
+
+	// Metadata holds arbitrary attributes searches can be filtered on, such
+	// as a tenant, a source document or a date
+	Metadata map[string]interface{}
 }
 
 // SearchResult represents a single result from a vector search
@@ -26,6 +30,9 @@ type SearchParams struct {
 	QueryVec  Vec32
 	Limit     int
 	Threshold float32
+
+	// Filter restricts the search to embeddings whose metadata matches it
+	Filter *Filter
 }
 
 type VectorStorer interface {
@@ -38,3 +45,46 @@ type VectorStorer interface {
 	// Close releases resources associated with the vector storer
 	Close() error
 }
+
+// MutableVectorStorer is implemented by vector stores whose content can be
+// kept in sync with its sources. Use a type assertion on a VectorStorer to
+// detect it.
+type MutableVectorStorer interface {
+	VectorStorer
+
+	// Upsert stores embeddings under their own IDs, replacing any stored
+	// embedding with the same ID. Embeddings without a vector are embedded
+	// from their content, and those without an ID get a random one.
+	Upsert(ctx context.Context, embeddings ...*Embedding) error
+
+	// Delete removes the embeddings with the given IDs, ignoring unknown ones
+	Delete(ctx context.Context, ids ...string) error
+
+	// DeleteWhere removes the embeddings matching filter and returns how many
+	// were removed
+	DeleteWhere(ctx context.Context, filter *Filter) (int, error)
+
+	// Get returns the stored embeddings with the given IDs, in the order of
+	// ids, leaving out unknown ones
+	Get(ctx context.Context, ids ...string) ([]*Embedding, error)
+
+	// Count returns the number of embeddings matching filter, all of them
+	// when filter is nil
+	Count(ctx context.Context, filter *Filter) (int, error)
+}
+
+// CollectionManager keeps separate, named collections of embeddings, for
+// instance one per tenant or per corpus
+type CollectionManager interface {
+	// Collection returns the named collection, creating it if needed
+	Collection(ctx context.Context, name string) (MutableVectorStorer, error)
+
+	// Collections returns the names of the existing collections, sorted
+	Collections(ctx context.Context) ([]string, error)
+
+	// DropCollection deletes a collection along with its embeddings
+	DropCollection(ctx context.Context, name string) error
+
+	// Close releases every collection
+	Close() error
+}